@@ -0,0 +1,47 @@
+package wenbuntts
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// validRequestID limits client-supplied X-Request-ID values to something
+// safe to log and echo back.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// requestID returns the ID accessLog assigned to the request behind ctx, or
+// a fresh one outside a request.
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return newRequestID()
+}
+
+// accessLog gives every request an X-Request-ID, reusing a valid one sent by
+// the client, echoes it in the response and logs one line per request. The
+// ID is attached to the request's logger, so handler log lines carry it too.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = withLogAttrs(ctx, "request_id", id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		logger(ctx).Info("Request handled", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(), "bytes", rec.bytes)
+	})
+}
@@ -0,0 +1,41 @@
+package wenbuntts
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminToken guards maintenance endpoints. When ADMIN_TOKEN is unset they
+// are disabled entirely.
+var adminToken string
+
+// requireAdmin only lets requests carrying "Authorization: Bearer <ADMIN_TOKEN>" through.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !onAdminListener(r.Context()) {
+			http.NotFound(w, r)
+			return
+		}
+		if adminToken == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		if !hasAdminToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hasAdminToken reports whether r carries ADMIN_TOKEN and may act as an
+// admin, see requireAdmin.
+func hasAdminToken(r *http.Request) bool {
+	if adminToken == "" || !onAdminListener(r.Context()) {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
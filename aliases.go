@@ -0,0 +1,36 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// textAliases maps reserved, non-Han ?text= keywords to the phrase they stand
+// for, e.g. TEXT_ALIASES=demo:你好世界,greeting:早上好.
+var textAliases = map[string]string{}
+
+// parseTextAliases parses a comma-separated list of keyword:phrase pairs.
+// Keywords may not contain Han characters, so they can never shadow real input.
+func parseTextAliases(s string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		keyword, phrase, ok := strings.Cut(pair, ":")
+		keyword, phrase = strings.TrimSpace(keyword), strings.TrimSpace(phrase)
+		if !ok || keyword == "" || phrase == "" {
+			return nil, fmt.Errorf("invalid alias %q: want keyword:phrase", pair)
+		}
+		if strings.IndexFunc(keyword, func(r rune) bool { return unicode.Is(unicode.Han, r) }) >= 0 {
+			return nil, fmt.Errorf("invalid alias %q: keyword must not contain Chinese characters", keyword)
+		}
+		if _, dup := aliases[keyword]; dup {
+			return nil, fmt.Errorf("duplicate alias %q", keyword)
+		}
+		aliases[keyword] = phrase
+	}
+	return aliases, nil
+}
@@ -0,0 +1,60 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestTextAliases(t *testing.T) {
+	if _, err := parseTextAliases("你好:你好世界"); err == nil {
+		t.Error("accepted a Chinese keyword, which would shadow real input")
+	}
+	aliases, err := parseTextAliases("demo:你好世界, long:一二三四五六七八")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := textAliases
+	textAliases = aliases
+	t.Cleanup(func() { textAliases = saved })
+
+	echo := func(text string) requestEcho {
+		t.Helper()
+		resp, body := get(t, "/tts", url.Values{"text": {text}, "echo": {"true"}})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %s %s", text, resp.Status, body)
+		}
+		var e requestEcho
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	demo := echo("demo")
+	if demo.Text != "你好世界" || demo.Alias != "demo" {
+		t.Errorf("demo resolved to %q from %q", demo.Text, demo.Alias)
+	}
+	if phrase := echo("你好世界"); phrase.CacheFile == demo.CacheFile {
+		t.Errorf("demo is cached as its phrase, %s", demo.CacheFile)
+	}
+
+	if meta := getMetadata(t, url.Values{"text": {"demo"}}); meta.CacheHit {
+		t.Error("first demo request was a cache hit")
+	}
+	if meta := getMetadata(t, url.Values{"text": {"demo"}}); !meta.CacheHit {
+		t.Error("second demo request was a cache miss")
+	}
+	backgroundWork.Wait()
+	entries, err := queryIndex(context.Background(), indexFilter{text: "你好世界"})
+	if err != nil || len(entries) != 1 || entries[0].Key != demo.CacheFile {
+		t.Errorf("index %v %+v, want the alias's %s", err, entries, demo.CacheFile)
+	}
+
+	// An alias's phrase may be longer than text is allowed to be.
+	if resp, body := get(t, "/tts", url.Values{"text": {"一二三四五六七八"}}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("the long phrase itself: %s %s, want 400", resp.Status, body)
+	}
+	getMetadata(t, url.Values{"text": {"long"}})
+}
@@ -0,0 +1,74 @@
+package wenbuntts
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+)
+
+// ankiNotesName is the notes file of an Anki export. Its header lines let
+// Anki's importer pick the separator and field names without prompting.
+const ankiNotesName = "notes.csv"
+
+// handleCacheAnki returns a ZIP ready for Anki: the clips in media/, to be
+// copied into the collection's media folder, and notes.csv with one note per
+// word whose Audio field is its [sound:...] tag. Media files are named after
+// their cache key, so clips from different exports never collide.
+func handleCacheAnki(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body tarRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	words, err := body.resolve(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="anki.zip"`)
+	zw := zip.NewWriter(w)
+
+	var notes bytes.Buffer
+	notes.WriteString("#separator:Comma\n#html:false\n#columns:Text,Audio\n")
+	cw := csv.NewWriter(&notes)
+	missing := []tarMissing{}
+	for _, req := range words {
+		if err := ensureCached(r.Context(), req); err != nil {
+			missing = append(missing, tarMissing{req.text, err.Error()})
+			continue
+		}
+		name := "wenbun-" + path.Base(req.key)
+		if err := writeZipFile(r.Context(), zw, "media/"+name, req.key); err != nil {
+			// The archive is corrupt past this point; abort the stream.
+			slog.Error("Failed to write zip entry", "key", logPath(req.key), "error", logRedacted(err.Error(), req.text))
+			return
+		}
+		cw.Write([]string{req.text, "[sound:" + name + "]"})
+	}
+	cw.Flush()
+
+	if f, err := zw.CreateHeader(&zip.FileHeader{Name: ankiNotesName, Method: zip.Deflate, Modified: time.Now()}); err == nil {
+		f.Write(notes.Bytes())
+	}
+	manifest, _ := json.MarshalIndent(struct {
+		Missing []tarMissing `json:"missing"`
+	}{missing}, "", "  ")
+	if f, err := zw.CreateHeader(&zip.FileHeader{Name: manifestName, Method: zip.Deflate, Modified: time.Now()}); err == nil {
+		f.Write(manifest)
+	}
+	zw.Close()
+}
@@ -0,0 +1,184 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ankiConnectURL is a running AnkiConnect add-on, from ANKICONNECT_URL;
+// empty disables /anki/push. ankiConnectKey is its optional API key.
+var (
+	ankiConnectURL string
+	ankiConnectKey string
+)
+
+// ankiConnect calls an AnkiConnect action and decodes its result into out.
+func ankiConnect(ctx context.Context, action string, params, out any) error {
+	body, _ := json.Marshal(struct {
+		Action  string `json:"action"`
+		Version int    `json:"version"`
+		Params  any    `json:"params,omitempty"`
+		Key     string `json:"key,omitempty"`
+	}{action, 6, params, ankiConnectKey})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ankiConnectURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  *string         `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("AnkiConnect %s: %w", action, err)
+	}
+	if result.Error != nil {
+		return fmt.Errorf("AnkiConnect %s: %s", action, *result.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
+
+type ankiPushRequest struct {
+	Deck       string `json:"deck"`
+	Field      string `json:"field"`
+	AudioField string `json:"audioField"`
+	Model      string `json:"model"`
+	Provider   string `json:"provider"`
+	Format     string `json:"format"`
+}
+
+type ankiNote struct {
+	NoteID int64 `json:"noteId"`
+	Fields map[string]struct {
+		Value string `json:"value"`
+	} `json:"fields"`
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// handleAnkiPush fills audioField (default "Audio") of every note in deck
+// with a [sound:...] tag for the text of its field, storing the clips in
+// Anki's media folder through AnkiConnect.
+func handleAnkiPush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body ankiPushRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Deck == "" || body.Field == "" {
+		http.Error(w, "Missing deck or field", http.StatusBadRequest)
+		return
+	}
+	if body.AudioField == "" {
+		body.AudioField = "Audio"
+	}
+
+	ctx := r.Context()
+	var ids []int64
+	query := `deck:"` + strings.ReplaceAll(body.Deck, `"`, `\"`) + `"`
+	if err := ankiConnect(ctx, "findNotes", map[string]string{"query": query}, &ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var notes []ankiNote
+	if err := ankiConnect(ctx, "notesInfo", map[string]any{"notes": ids}, &notes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// Notes are resolved like a /cache/tar word list, so each distinct
+	// text is validated and generated once.
+	texts := map[int64]string{}
+	seen := map[string]bool{}
+	words := tarRequest{Model: body.Model, Provider: body.Provider, Format: body.Format}
+	for _, note := range notes {
+		field, ok := note.Fields[body.Field]
+		if !ok {
+			continue
+		}
+		if text := strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(field.Value, ""))); text != "" {
+			if !seen[text] {
+				seen[text] = true
+				words.Words = append(words.Words, text)
+			}
+			texts[note.NoteID] = text
+		}
+	}
+	if len(words.Words) == 0 {
+		http.Error(w, "No notes in deck "+body.Deck+" have a "+body.Field+" field", http.StatusBadRequest)
+		return
+	}
+	resolved, err := words.resolve(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report := struct {
+		Updated int          `json:"updated"`
+		Skipped int          `json:"skipped"`
+		Missing []tarMissing `json:"missing"`
+	}{Missing: []tarMissing{}}
+	sounds := map[string]string{}
+	for _, req := range resolved {
+		if err := ensureCached(ctx, req); err != nil {
+			report.Missing = append(report.Missing, tarMissing{req.text, err.Error()})
+			continue
+		}
+		name := "wenbun-" + path.Base(req.key)
+		data, _, err := cacheStore.Get(ctx, req.key)
+		if err == nil {
+			err = ankiConnect(ctx, "storeMediaFile", map[string]string{"filename": name, "data": base64.StdEncoding.EncodeToString(data)}, nil)
+		}
+		if err != nil {
+			report.Missing = append(report.Missing, tarMissing{req.text, err.Error()})
+			continue
+		}
+		sounds[req.text] = "[sound:" + name + "]"
+	}
+
+	for _, note := range notes {
+		tag, ok := sounds[texts[note.NoteID]]
+		if !ok {
+			continue
+		}
+		if note.Fields[body.AudioField].Value == tag {
+			report.Skipped++
+			continue
+		}
+		update := map[string]any{"note": map[string]any{"id": note.NoteID, "fields": map[string]string{body.AudioField: tag}}}
+		if err := ankiConnect(ctx, "updateNoteFields", update, nil); err != nil {
+			report.Missing = append(report.Missing, tarMissing{texts[note.NoteID], err.Error()})
+			continue
+		}
+		report.Updated++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(report)
+}
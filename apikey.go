@@ -0,0 +1,51 @@
+package wenbuntts
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// apiKeys are the keys clients must present to reach endpoints that can
+// call the provider: API_KEYS and the keys in TENANT_KEYS. When neither is
+// set those endpoints are open.
+var apiKeys []string
+
+// requireAPIKey only lets requests carrying one of apiKeys, as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>", through, and
+// attaches the tenant they act for to the request context.
+func requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(apiKeys) > 0 && !validAPIKey(requestAPIKey(r)) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		tenant, ok := requestTenant(w, r)
+		if !ok {
+			return
+		}
+		next(w, r.WithContext(withTenant(r.Context(), tenant)))
+	}
+}
+
+// requestAPIKey returns the API key r carries, if any.
+func requestAPIKey(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return key
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// validAPIKey compares key against every configured key, so the time taken
+// doesn't reveal which one it came close to.
+func validAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	valid := 0
+	for _, k := range apiKeys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+	}
+	return valid == 1
+}
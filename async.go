@@ -0,0 +1,98 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// asyncJob is a background synthesis started by /tts?async=true.
+type asyncJob struct {
+	id   string
+	req  ttsRequest
+	done chan struct{}
+	err  error
+}
+
+var (
+	asyncJobsMu sync.Mutex
+	asyncJobs   = map[string]*asyncJob{}
+)
+
+// asyncJobID derives a stable job id from the cache key, so concurrent
+// async requests for the same entry share one job. Since the id can be
+// worked out from the text, /tts/status only serves a job to its tenant.
+func asyncJobID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// startAsyncJob returns the in-flight job for req's cache entry, starting a new
+// background synthesis if there is none. The synthesis keeps ctx's values but
+// outlives the request. Finished jobs are forgotten after asyncJobRetention.
+func startAsyncJob(ctx context.Context, req ttsRequest) *asyncJob {
+	id := asyncJobID(req.key)
+
+	asyncJobsMu.Lock()
+	defer asyncJobsMu.Unlock()
+
+	if job, ok := asyncJobs[id]; ok {
+		return job
+	}
+
+	job := &asyncJob{id: id, req: req, done: make(chan struct{})}
+	asyncJobs[id] = job
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		job.err = generateFile(ctx, req)
+		if job.err != nil {
+			logger(ctx).Error("Async job failed", "job", id, "error", logRedacted(job.err.Error(), req.text, req.alias))
+		}
+		close(job.done)
+
+		time.AfterFunc(asyncJobRetention, func() {
+			asyncJobsMu.Lock()
+			delete(asyncJobs, id)
+			asyncJobsMu.Unlock()
+		})
+	}()
+	return job
+}
+
+func handleTTSStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	asyncJobsMu.Lock()
+	job, ok := asyncJobs[id]
+	asyncJobsMu.Unlock()
+
+	if !ok || job.req.tenant != tenantFrom(r.Context()) {
+		http.Error(w, "Unknown or expired job", http.StatusNotFound)
+		return
+	}
+
+	select {
+	case <-job.done:
+	default:
+		w.Header().Set("Location", "/tts/status?id="+job.id)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Still generating\n"))
+		return
+	}
+
+	if serveFallback(w, r, job.err) {
+		return
+	}
+	if job.err != nil {
+		httpGenerateError(r.Context(), w, job.err.Error(), job.err)
+		return
+	}
+
+	// Serve the finished entry directly: rebuilding the /tts URL would
+	// have to round-trip every option that went into its cache key.
+	serveAudio(w, r, job.req.key)
+}
@@ -0,0 +1,92 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTSAsyncStatusIsTenantScoped(t *testing.T) {
+	resp, body := get(t, "/tts", url.Values{"text": {"异步"}, "async": {"true"}, "tenant": {"alpha"}})
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("%s %s, want 202", resp.Status, body)
+	}
+	id := strings.TrimPrefix(resp.Header.Get("Location"), "/tts/status?id=")
+	if id == "" {
+		t.Fatalf("Location %q", resp.Header.Get("Location"))
+	}
+
+	// The id follows from the text, so another tenant must not get the
+	// audio with it.
+	for _, query := range []url.Values{{"id": {id}}, {"id": {id}, "tenant": {"beta"}}} {
+		if resp, body := get(t, "/tts/status", query); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("/tts/status?%s: %s %.60q, want 404", query.Encode(), resp.Status, body)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, body := get(t, "/tts/status", url.Values{"id": {id}, "tenant": {"alpha"}})
+		if resp.StatusCode == http.StatusOK {
+			if ct := resp.Header.Get("Content-Type"); ct != "audio/mpeg" {
+				t.Errorf("Content-Type %q, want audio/mpeg", ct)
+			}
+			break
+		}
+		if resp.StatusCode != http.StatusAccepted || time.Now().After(deadline) {
+			t.Fatalf("%s %.60q, want the finished audio", resp.Status, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTTSProgressive(t *testing.T) {
+	saved := progressiveVoice
+	progressiveVoice = "mock-fast"
+	t.Cleanup(func() { progressiveVoice = saved })
+
+	query := url.Values{"text": {"渐进"}, "progressive": {"true"}}
+	resp, body := get(t, "/tts", query)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-TTS-Progressive") != "placeholder" {
+		t.Fatalf("first request: %s, X-TTS-Progressive %q, want the placeholder", resp.Status, resp.Header.Get("X-TTS-Progressive"))
+	}
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("placeholder Cache-Control %q, want no-store", resp.Header.Get("Cache-Control"))
+	}
+
+	// Wait for the requested voice, rendering in the background.
+	_, echo := get(t, "/tts", url.Values{"text": {"渐进"}, "echo": {"true"}})
+	var resolved requestEcho
+	if err := json.Unmarshal(echo, &resolved); err != nil {
+		t.Fatal(err)
+	}
+	asyncJobsMu.Lock()
+	job := asyncJobs[asyncJobID(resolved.CacheFile)]
+	asyncJobsMu.Unlock()
+	if job == nil {
+		t.Fatal("no background render of the requested voice")
+	}
+	<-job.done
+	backgroundWork.Wait()
+
+	entries, err := queryIndex(context.Background(), indexFilter{text: "渐进"})
+	voices := map[string]bool{}
+	for _, e := range entries {
+		voices[e.Voice] = true
+	}
+	if err != nil || len(entries) != 2 || !voices["mock-fast"] || !voices[mockVoice] {
+		t.Errorf("index %v %+v, want the placeholder and the requested voice", err, entries)
+	}
+
+	resp, body = get(t, "/tts", query)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-TTS-Progressive") != "" {
+		t.Errorf("second request: %s, X-TTS-Progressive %q, want the requested voice", resp.Status, resp.Header.Get("X-TTS-Progressive"))
+	}
+	if meta := getMetadata(t, url.Values{"text": {"渐进"}}); !meta.CacheHit || meta.Voice != mockVoice || meta.Bytes != int64(len(body)) {
+		t.Errorf("second request served %d bytes, want the %s clip: %+v", len(body), mockVoice, meta)
+	}
+}
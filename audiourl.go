@@ -0,0 +1,148 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ttsCacheControl is sent with audio served from /tts, from
+// TTS_CACHE_CONTROL or else CACHE_CONTROL. What a /tts URL returns can
+// change with the defaults (voice, rate, format), so a CDN may want a
+// shorter policy there than for /audio URLs.
+var ttsCacheControl string
+
+// audioURL is the content-addressed URL of the clip stored under key. The
+// key holds a hash of everything that shapes the clip, so what it serves
+// never changes and it is sent with the long-lived cacheControl policy. Its
+// path elements are escaped, as a filenameTemplate can put text in them.
+func audioURL(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return "/audio/" + strings.Join(parts, "/")
+}
+
+// contentAudioURL is the URL of a clip by contentHash of its bytes, as in
+// X-Content-URL or the immutableUrl of a JSON response. Unlike audioURL it
+// stays the same when a change of voice or settings yields the same audio,
+// and a regenerated clip with different bytes gets a new one, so it is
+// always sent with immutableCacheControl.
+func contentAudioURL(hash string, f audioFormat) string {
+	return "/audio/" + hash + f.ext
+}
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// contentHashFile matches the file of a contentAudioURL. Storage keys are
+// shorter hashes or sit in a deck directory, so the two never collide.
+var contentHashFile = regexp.MustCompile(`^[0-9a-f]{64}\.[a-z0-9]+$`)
+
+// contentHash returns the hex SHA-256 of a clip's bytes.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// handleAudio serves GET /audio/{file...}, a cached clip by its storage key
+// as in Content-Location or the contentUrl of a JSON response, or by its
+// contentAudioURL. It never synthesizes: unknown keys are 404s.
+func handleAudio(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("file")
+	if contentHashFile.MatchString(key) {
+		handleContentAudio(w, r, key)
+		return
+	}
+	if !validCacheKey(key) || !mayReadKey(r.Context(), key) {
+		http.NotFound(w, r)
+		return
+	}
+	serveAudioKey(w, r, key)
+}
+
+// mayReadKey reports whether the client behind ctx may read the clip under
+// key. A tenant's clips are only served to that tenant, and shared clips
+// only to callers without one.
+func mayReadKey(ctx context.Context, key string) bool {
+	tenant, _ := keyTenant(key)
+	return tenant == tenantFrom(ctx)
+}
+
+// serveAudioKey serves the cached clip under key, a valid cache key the
+// caller may read.
+func serveAudioKey(w http.ResponseWriter, r *http.Request, key string) {
+	if _, err := cacheStore.Stat(r.Context(), key); errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	writeAudio(w, r, key)
+}
+
+// handleContentAudio serves the file of a contentAudioURL: any cached clip
+// of the tenant's with those bytes, looked up in the index.
+func handleContentAudio(w http.ResponseWriter, r *http.Request, file string) {
+	f, ok := formatForFile(file)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	hash, tenant := file[:len(file)-len(f.ext)], tenantFrom(r.Context())
+	key, err := contentKey(r.Context(), hash, f.ext, tenant)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer beginServing(key)()
+	data, info, err := cacheStore.Get(r.Context(), key)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && contentHash(data) != hash) {
+		// Deleted or regenerated since it was indexed.
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to read cache entry", http.StatusInternalServerError)
+		logger(r.Context()).Error("Failed to read cache entry", "key", logPath(key), "error", err)
+		return
+	}
+	w.Header().Set("Cache-Control", immutableCacheControl)
+	sendAudio(w, r, key, data, info.ModTime)
+}
+
+// contentKey returns the key of one of tenant's clips with content hash
+// hash whose encoding is saved with extension ext. The extension can't
+// stand for the encoding itself, since the telephony formats share .wav
+// with LINEAR16.
+func contentKey(ctx context.Context, hash, ext, tenant string) (string, error) {
+	rows, err := cacheIndex.QueryContext(ctx, `SELECT key, encoding FROM entries WHERE content_hash = ? AND tenant = ?`, hash, tenant)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, encoding string
+		if err := rows.Scan(&key, &encoding); err != nil {
+			return "", err
+		}
+		if audioFormats[formatKey(encoding)].ext == ext {
+			return key, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return "", sql.ErrNoRows
+}
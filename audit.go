@@ -0,0 +1,62 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditFile receives one JSON line per upstream synthesis when AUDIT_LOG is set.
+var (
+	auditMu   sync.Mutex
+	auditFile *os.File
+)
+
+// auditRecord is what was sent upstream for one synthesis. The API key is
+// passed in the URL, never in the body, so the recorded body never holds it.
+type auditRecord struct {
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"requestId"`
+	Request   json.RawMessage `json:"request"`
+}
+
+func openAuditLog(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	auditFile = f
+	return nil
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// auditSynthesis appends the upstream request body to the audit log, under
+// the ID of the request it was made for.
+func auditSynthesis(ctx context.Context, payload string) {
+	if auditFile == nil {
+		return
+	}
+
+	var body json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
+		slog.Error("Failed to audit synthesis", "error", err)
+		return
+	}
+	line, _ := json.Marshal(auditRecord{Time: time.Now().UTC(), RequestID: requestID(ctx), Request: body})
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if _, err := auditFile.Write(append(line, '\n')); err != nil {
+		slog.Error("Failed to write audit log", "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package wenbuntts
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// With ?autoSplit=true, /tts text longer than its voice's max length is cut
+// into chunks that fit (see splitText), each synthesized and cached like
+// any /tts text, and the clip is the chunks' MP3s joined without a gap. The
+// joined clip is cached under its own key, so later requests are plain
+// hits, and its ?response=json metadata lists the chunks.
+
+// chunkMetadata describes one chunk of a split clip.
+type chunkMetadata struct {
+	Text       string `json:"text"`
+	URL        string `json:"url"`
+	ContentURL string `json:"contentUrl"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+}
+
+// splitText cuts text into chunks of at most maxLen runes. A chunk ends
+// after the last punctuation or at the last space that fits, else between
+// two characters not both Latin letters or digits, and only mid-word if the
+// word is too long itself.
+func splitText(text string, maxLen int) []string {
+	runes := []rune(text)
+	var chunks []string
+	for len(runes) > 0 {
+		cut := len(runes)
+		if cut > maxLen {
+			cut = splitPoint(runes[:maxLen+1])
+		}
+		if chunk := strings.TrimSpace(string(runes[:cut])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = runes[cut:]
+	}
+	return chunks
+}
+
+// splitPoint returns where to end a chunk of window, which is one rune
+// longer than a chunk may be.
+func splitPoint(window []rune) int {
+	last := len(window) - 1
+	for i := last; i > 0; i-- {
+		if r := window[i-1]; unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSpace(window[i]) {
+			return i
+		}
+	}
+	for i := last; i > 0; i-- {
+		if !isWordRune(window[i-1]) || !isWordRune(window[i]) {
+			return i
+		}
+	}
+	return last
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsDigit(r) || unicode.Is(unicode.Latin, r)
+}
+
+// splitRequest returns the chunks of req, whose text is too long for its
+// voice, as requests of their own. hints are the ?pinyin= readings, which
+// are resolved again for each chunk.
+func splitRequest(req ttsRequest, hints map[string]string, applyHeteronyms bool) ([]ttsRequest, error) {
+	texts := splitText(req.text, maxTextLengthFor(req.model, req.language))
+	if len(texts) > maxConcatTexts {
+		return nil, fmt.Errorf("Invalid autoSplit: text makes %d chunks, at most %d are joined", len(texts), maxConcatTexts)
+	}
+	chunks := make([]ttsRequest, len(texts))
+	for i, text := range texts {
+		if err := validateText(text, req.language, req.model); err != nil {
+			return nil, err
+		}
+		chunk := req
+		chunk.text, chunk.ssml, chunk.heteronyms = text, "", nil
+		if req.ssml != "" {
+			readings, notes, err := resolveHeteronyms(text, hints, applyHeteronyms)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid pinyin: %w", err)
+			}
+			if len(readings) > 0 {
+				chunk.ssml = pinyinSSML(text, readings)
+			}
+			chunk.heteronyms = notes
+		}
+		chunk.key = chunk.storageKey()
+		chunks[i] = chunk
+	}
+	return chunks, nil
+}
+
+// chunksMetadata describes the chunks of req, a split clip, which query
+// serves.
+func chunksMetadata(ctx context.Context, req ttsRequest, query url.Values) ([]chunkMetadata, error) {
+	out := make([]chunkMetadata, len(req.chunks))
+	for i, chunk := range req.chunks {
+		q := maps.Clone(query)
+		q.Set("text", chunk.text)
+		q.Del("autoSplit")
+		meta, err := clipMetadata(ctx, chunk, q, true)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = chunkMetadata{Text: chunk.text, URL: meta.URL, ContentURL: meta.ContentURL, DurationMs: meta.DurationMs}
+	}
+	return out, nil
+}
@@ -0,0 +1,73 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	for _, tt := range []struct {
+		text   string
+		maxLen int
+		want   []string
+	}{
+		{"我们明天一起去图书馆看书", 5, []string{"我们明天一", "起去图书馆", "看书"}},
+		{"你好，我们走吧", 5, []string{"你好，", "我们走吧"}},
+		{"我有iPhone手机", 5, []string{"我有", "iPhon", "e手机"}},
+		{"我有abc手机", 5, []string{"我有abc", "手机"}},
+		{"我的abc手机", 4, []string{"我的", "abc手", "机"}},
+		{"好 好 好", 3, []string{"好 好", "好"}},
+		{"你好", 5, []string{"你好"}},
+	} {
+		if got := splitText(tt.text, tt.maxLen); !slices.Equal(got, tt.want) {
+			t.Errorf("splitText(%q, %d) = %q, want %q", tt.text, tt.maxLen, got, tt.want)
+		}
+	}
+}
+
+func TestTTSAutoSplit(t *testing.T) {
+	text := "我们明天一起去图书馆看书" // 12 characters, over the mock voice's 5
+	resp, body := get(t, "/tts", url.Values{"text": {text}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("without autoSplit: %s %s, want 400", resp.Status, body)
+	}
+
+	query := url.Values{"text": {text}, "autoSplit": {"true"}}
+	meta := getMetadata(t, query)
+	if meta.CacheHit {
+		t.Error("first request was a cache hit")
+	}
+	if len(meta.Chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3: %+v", len(meta.Chunks), meta.Chunks)
+	}
+	var total int64
+	for _, chunk := range meta.Chunks {
+		q, err := url.ParseQuery(chunk.URL[len("/tts?"):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := getMetadata(t, q); !c.CacheHit {
+			t.Errorf("chunk %q was not cached", chunk.Text)
+		}
+		total += chunk.DurationMs
+	}
+	// The mock speaks each character for 250ms, rounded up to whole frames.
+	if meta.DurationMs < 12*250 || meta.DurationMs > total+50 {
+		t.Errorf("joined clip is %dms, chunks %dms", meta.DurationMs, total)
+	}
+	if again := getMetadata(t, query); !again.CacheHit {
+		t.Error("second request was a cache miss")
+	}
+
+	resp, audio := get(t, "/tts", query)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "audio/mpeg" || int64(len(audio)) != meta.Bytes {
+		t.Errorf("joined clip: %s %s, %d bytes, want %d", resp.Status, resp.Header.Get("Content-Type"), len(audio), meta.Bytes)
+	}
+
+	resp, body = get(t, "/tts", url.Values{"text": {text}, "autoSplit": {"true"}, "format": {"wav"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("wav: %s %s, want 400", resp.Status, body)
+	}
+}
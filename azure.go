@@ -0,0 +1,169 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// azureProvider synthesizes with Azure Cognitive Services Speech.
+type azureProvider struct {
+	key          secretSetting
+	region       string
+	defaultVoice string
+	voices       []string
+}
+
+func newAzureProvider() (provider, error) {
+	key, region := setting("AZURE_SPEECH_KEY"), setting("AZURE_SPEECH_REGION")
+	if key == "" || region == "" {
+		return nil, fmt.Errorf("%w: missing AZURE_SPEECH_KEY or AZURE_SPEECH_REGION", errNotConfigured)
+	}
+
+	p := &azureProvider{
+		key:          "AZURE_SPEECH_KEY",
+		region:       region,
+		defaultVoice: setting("AZURE_DEFAULT_VOICE"),
+		voices:       splitList(setting("AZURE_VOICES")),
+	}
+	if p.defaultVoice == "" {
+		p.defaultVoice = "zh-CN-XiaoxiaoNeural"
+	}
+	if len(p.voices) == 0 {
+		p.voices = []string{"zh-CN-XiaoxiaoNeural", "zh-CN-YunxiNeural", "zh-CN-YunjianNeural"}
+	}
+	if !slices.Contains(p.voices, p.defaultVoice) {
+		p.voices = append(p.voices, p.defaultVoice)
+	}
+	return p, nil
+}
+
+func (p *azureProvider) Name() string { return "azure" }
+
+func (p *azureProvider) DefaultVoice() string { return p.defaultVoice }
+
+func (p *azureProvider) AllowedVoices() []string { return p.voices }
+
+func (p *azureProvider) SpeaksSSML() bool { return true }
+
+// azureOutputFormats maps our audio encodings onto Azure's output formats.
+var azureOutputFormats = map[string]string{
+	"MP3":      "audio-24khz-48kbitrate-mono-mp3",
+	"OGG_OPUS": "ogg-24khz-16bit-mono-opus",
+	"LINEAR16": "riff-24khz-16bit-mono-pcm",
+	"MULAW":    "riff-8khz-8bit-mono-mulaw",
+	"ALAW":     "riff-8khz-8bit-mono-alaw",
+}
+
+// azureMP3Bitrates are the MP3 output formats by bitrate.
+var azureMP3Bitrates = map[int]string{
+	32:  "audio-16khz-32kbitrate-mono-mp3",
+	48:  "audio-24khz-48kbitrate-mono-mp3",
+	64:  "audio-16khz-64kbitrate-mono-mp3",
+	96:  "audio-24khz-96kbitrate-mono-mp3",
+	128: "audio-16khz-128kbitrate-mono-mp3",
+	160: "audio-24khz-160kbitrate-mono-mp3",
+	192: "audio-48khz-192kbitrate-mono-mp3",
+}
+
+func (p *azureProvider) SetsBitrate(kbps int) bool {
+	_, ok := azureMP3Bitrates[kbps]
+	return ok
+}
+
+func (p *azureProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	format, ok := azureOutputFormats[req.AudioEncoding]
+	if !ok {
+		return nil, fmt.Errorf("azure does not support %s output", req.AudioEncoding)
+	}
+	if req.BitrateKbps != 0 {
+		format = azureMP3Bitrates[req.BitrateKbps]
+	}
+	if req.VolumeGainDb != 0 {
+		return nil, fmt.Errorf("azure does not support volume adjustment")
+	}
+
+	var text strings.Builder
+	if req.SSML != "" {
+		text.WriteString(req.SSML)
+	} else {
+		xml.EscapeText(&text, []byte(req.Text))
+	}
+	// Azure's prosody rate is relative to the voice's normal speed.
+	ssml := fmt.Sprintf(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="%s"><voice name="%s"><prosody rate="%+.0f%%" pitch="%+.1fst">%s</prosody></voice></speak>`,
+		req.Language, req.Voice, (req.SpeakingRate-1)*100, req.Pitch, text.String())
+	auditBody, _ := json.Marshal(map[string]string{"provider": "azure", "ssml": ssml, "outputFormat": format})
+	auditSynthesis(ctx, string(auditBody))
+
+	apiURL := fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/v1", p.region)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(ssml))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Ocp-Apim-Subscription-Key", p.key.value())
+	httpReq.Header.Set("Content-Type", "application/ssml+xml")
+	httpReq.Header.Set("X-Microsoft-OutputFormat", format)
+	httpReq.Header.Set("User-Agent", "wenbun-tts-generator")
+
+	resp, err := upstreamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, nil)
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("No audio content in response")
+	}
+	return audio, nil
+}
+
+func (p *azureProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	apiURL := fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/voices/list", p.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", p.key.value())
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("voices request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("voices request failed: %s", resp.Status)
+	}
+
+	var result []struct {
+		ShortName       string `json:"ShortName"`
+		Locale          string `json:"Locale"`
+		Gender          string `json:"Gender"`
+		SampleRateHertz string `json:"SampleRateHertz"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse voices: %w", err)
+	}
+
+	var voices []voiceInfo
+	for _, v := range result {
+		if language != "" && !strings.EqualFold(v.Locale, language) {
+			continue
+		}
+		var rate int
+		fmt.Sscan(v.SampleRateHertz, &rate)
+		voices = append(voices, voiceInfo{Name: v.ShortName, LanguageCodes: []string{v.Locale}, Gender: v.Gender, NaturalSampleRate: rate})
+	}
+	return voices, nil
+}
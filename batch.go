@@ -0,0 +1,132 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+type batchItem struct {
+	Text     string `json:"text"`
+	Model    string `json:"model"`
+	Provider string `json:"provider"`
+	Format   string `json:"format"`
+}
+
+// batchResult reports one batch item. URL fetches the clip through /tts, so
+// it is always a cache hit once the batch has returned, or through /audio
+// if /tts would refuse the text for MIN_HAN_FOR_TTS.
+type batchResult struct {
+	Text   string `json:"text"`
+	Model  string `json:"model"`
+	File   string `json:"file,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Cached bool   `json:"cached"`
+	Error  string `json:"error,omitempty"`
+}
+
+// maxBatchItems bounds the work a single /tts/batch request can trigger.
+const maxBatchItems = 1000
+
+// handleTTSBatch generates (or reuses) audio for each {text, model} item and
+// returns a JSON manifest in the same order. Items that fail don't fail the
+// batch; their result carries the error instead.
+func handleTTSBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var items []batchItem
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&items); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 || len(items) > maxBatchItems {
+		http.Error(w, "Invalid batch: must list between 1 and 1000 items", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		results[i] = batchGenerate(r.Context(), item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(results)
+}
+
+// batchRequest validates item and returns its request, with its voice
+// and any problem set in result.
+func batchRequest(ctx context.Context, item batchItem) (req ttsRequest, result batchResult) {
+	result = batchResult{Text: item.Text, Model: item.Model}
+
+	prov, ok := providerFor(item.Provider)
+	if !ok {
+		result.Error = "invalid provider"
+		return req, result
+	}
+	if result.Model == "" {
+		result.Model = prov.DefaultVoice()
+	}
+	if !slices.Contains(prov.AllowedVoices(), result.Model) {
+		result.Error = "invalid model"
+		return req, result
+	}
+	format, ok := parseFormat(item.Format)
+	if !ok {
+		result.Error = "invalid format"
+		return req, result
+	}
+	text := normalizeText(item.Text)
+	if verbalizeNumbers && strings.HasPrefix(languageFor(result.Model), "cmn") {
+		text = verbalizeText(text, yearReading)
+	}
+	if validateText(text, languageFor(result.Model), result.Model) != nil {
+		result.Error = "invalid text"
+		return req, result
+	}
+
+	req = ttsRequest{text: text, provider: prov, model: result.Model, format: format, language: languageFor(result.Model), tenant: tenantFrom(ctx)}
+	req.key = req.storageKey()
+	return req, result
+}
+
+func batchGenerate(ctx context.Context, item batchItem) batchResult {
+	req, result := batchRequest(ctx, item)
+	if result.Error != "" {
+		return result
+	}
+	if _, err := lookupCached(ctx, req); err == nil {
+		result.Cached = true
+		history.record(time.Now(), true)
+		cacheHitCounter.Add(ctx, 1)
+		indexHit(ctx, req.key)
+	} else if err := generateFile(ctx, req); err != nil {
+		enqueueRetry(ctx, req, item, err)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.File = req.key
+	query := url.Values{"text": {req.text}, "model": {result.Model}}
+	if item.Provider != "" {
+		query.Set("provider", item.Provider)
+	}
+	if req.format != defaultFormat {
+		query.Set("format", req.format)
+	}
+	result.URL = "/tts?" + query.Encode()
+	if checkHanForTTS(req.text) != nil {
+		result.URL = audioURL(req.key)
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MP3 clips are made at ?bitrate= kbps, or MP3_BITRATE without one, e.g. 48
+// for small files on phones and 128 for the web player. Providers that offer
+// the bitrate render it themselves; other clips are re-encoded with ffmpeg,
+// and kept at the provider's bitrate without it. Zero leaves the provider's
+// bitrate.
+var defaultBitrate int
+
+// parseBitrate validates a ?bitrate= or MP3_BITRATE value.
+func parseBitrate(v string) (int, error) {
+	kbps, err := strconv.Atoi(v)
+	if err != nil || kbps < 8 || kbps > 320 {
+		return 0, errors.New("must be between 8 and 320 kbps")
+	}
+	return kbps, nil
+}
+
+// applyBitrate re-encodes MP3 audio at kbps, unless kbps is zero.
+func applyBitrate(ctx context.Context, audio []byte, kbps int) []byte {
+	if kbps == 0 {
+		return audio
+	}
+	if ffmpegPath == "" {
+		logger(ctx).Warn("ffmpeg not found; keeping the provider's bitrate", "bitrate", kbps)
+		return audio
+	}
+	encoded, err := runFFmpeg(ctx, audio, mp3Encoder(kbps)...)
+	if err != nil {
+		logger(ctx).Warn("Skipping bitrate change", "bitrate", kbps, "error", err)
+		return audio
+	}
+	return encoded
+}
+
+// mp3Encoder returns the ffmpeg output options that encode MP3 at kbps, or
+// at ffmpeg's default bitrate for zero.
+func mp3Encoder(kbps int) []string {
+	if kbps == 0 {
+		return ffmpegEncoders["MP3"]
+	}
+	return []string{"-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", kbps), "-f", "mp3"}
+}
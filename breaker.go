@@ -0,0 +1,130 @@
+package wenbuntts
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops calling a provider that failed breakerFailures times
+// in a row. While open, syntheses fail at once with errCircuitOpen, which
+// lets synthesize fall back to the next provider. After breakerCooldown a
+// single trial call is let through: success closes the breaker, failure
+// opens it for another cooldown.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	state    breakerState
+	until    time.Time // end of the cooldown while open
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	return [...]string{"closed", "half-open", "open"}[s]
+}
+
+// From CIRCUIT_BREAKER_FAILURES and CIRCUIT_BREAKER_COOLDOWN. With
+// breakerFailures 0 there are no breakers.
+var (
+	breakerFailures int
+	breakerCooldown time.Duration
+)
+
+var errCircuitOpen = errors.New("Provider is failing, not retried until its circuit breaker cools down")
+
+// breakers holds a breaker for each of providers, by name.
+var breakers = map[string]*circuitBreaker{}
+
+func setupBreakers() {
+	if breakerFailures == 0 {
+		return
+	}
+	for name := range providers {
+		breakers[name] = &circuitBreaker{}
+	}
+}
+
+// breakerFor returns p's breaker, which is nil (and always allows calls)
+// when breakers are off.
+func breakerFor(p provider) *circuitBreaker {
+	return breakers[p.Name()]
+}
+
+// allow reports whether a call may go ahead, moving an open breaker whose
+// cooldown has passed to half-open for the one trial it lets through.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Before(b.until) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record counts the outcome of a call allow let through.
+func (b *circuitBreaker) record(now time.Time, ok bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerFailures {
+		b.state, b.until = breakerOpen, now.Add(breakerCooldown)
+	}
+}
+
+// abandon gives up a call allow let through without an outcome, e.g. when
+// the client went away, so a half-open breaker lets the next call try.
+func (b *circuitBreaker) abandon(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state, b.until = breakerOpen, now
+	}
+}
+
+// canFallBack reports whether a fallback provider's breaker lets calls
+// through.
+func canFallBack() bool {
+	for _, p := range fallbackProviders {
+		if state, _ := breakerFor(p).status(); state != breakerOpen {
+			return true
+		}
+	}
+	return false
+}
+
+// status returns the state and, while open, the end of the cooldown.
+func (b *circuitBreaker) status() (breakerState, time.Time) {
+	if b == nil {
+		return breakerClosed, time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.until
+}
@@ -0,0 +1,154 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// Characters sent upstream are counted per UTC day and month in the cache
+// index, so the counts survive restarts. With CHAR_BUDGET_DAILY or
+// CHAR_BUDGET_MONTHLY set, a synthesis that would exceed either fails with
+// errBudgetExhausted; cached audio is still served. Concurrent syntheses
+// are checked against the same count, so they may overshoot it slightly.
+// Such a refusal is a JSON apiError with CHAR_BUDGET_STATUS, 402 Payment
+// Required by default, so metering clients can tell it from the 429 of a
+// transient rate limit; 429 suits clients that don't handle 402.
+
+var errBudgetExhausted = errors.New("Character budget exhausted: only cached audio is served until it resets, see /stats/usage")
+
+const usageSchema = `
+CREATE TABLE IF NOT EXISTS usage (
+	period TEXT PRIMARY KEY,
+	chars  INTEGER NOT NULL
+);
+`
+
+// usagePeriods returns the day and month now falls in. A tenant's own
+// counts are kept under "<tenant>/<period>".
+func usagePeriods(now time.Time, tenant string) (day, month string) {
+	now = now.UTC()
+	day, month = now.Format(time.DateOnly), now.Format("2006-01")
+	if tenant != "" {
+		day, month = tenant+"/"+day, tenant+"/"+month
+	}
+	return day, month
+}
+
+// usageChars returns the characters counted in period.
+func usageChars(ctx context.Context, period string) (int64, error) {
+	var n int64
+	err := cacheIndex.QueryRowContext(ctx, `SELECT COALESCE(SUM(chars), 0) FROM usage WHERE period = ?`, period).Scan(&n)
+	return n, err
+}
+
+// checkBudget fails with errBudgetExhausted if synthesizing req's text would
+// exceed a budget, the server's or its tenant's.
+func checkBudget(ctx context.Context, req ttsRequest) error {
+	if !withinBudget(ctx, req.tenant, utf8.RuneCountInString(req.text)) {
+		return errBudgetExhausted
+	}
+	return nil
+}
+
+// writeBudgetError refuses a request whose synthesis would exceed a budget
+// with msg, in the apiError envelope even outside /v1.
+func writeBudgetError(ctx context.Context, w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	status := current().charBudgetStatus
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error apiError `json:"error"`
+	}{newAPIError(status, msg, requestID(ctx), nil)})
+}
+
+type usageBudget struct {
+	period string
+	limit  int
+}
+
+// budgets returns the periods that count against the budgets of tenant,
+// and the server's, now.
+func budgets(now time.Time, tenant string) []usageBudget {
+	s := current()
+	day, month := usagePeriods(now, "")
+	b := []usageBudget{{day, s.charBudgetDaily}, {month, s.charBudgetMonthly}}
+	if tenant != "" {
+		day, month = usagePeriods(now, tenant)
+		b = append(b, usageBudget{day, s.tenantBudgetDaily}, usageBudget{month, s.tenantBudgetMonthly})
+	}
+	return b
+}
+
+// withinBudget reports whether n more characters for tenant fit today's and
+// this month's budgets. Usage that can't be read doesn't stop synthesis.
+func withinBudget(ctx context.Context, tenant string, n int) bool {
+	for _, b := range budgets(time.Now(), tenant) {
+		if b.limit == 0 {
+			continue
+		}
+		used, err := usageChars(ctx, b.period)
+		if err != nil {
+			logger(ctx).Error("Failed to read character usage", "error", err)
+			continue
+		}
+		if used+int64(n) > int64(b.limit) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordUsage counts req's text as synthesized today, for the server and
+// req's tenant.
+func recordUsage(ctx context.Context, req ttsRequest) {
+	n := utf8.RuneCountInString(req.text)
+	for _, b := range budgets(time.Now(), req.tenant) {
+		_, err := cacheIndex.ExecContext(ctx, `INSERT INTO usage (period, chars) VALUES (?, ?) ON CONFLICT (period) DO UPDATE SET chars = chars + excluded.chars`, b.period, n)
+		if err != nil {
+			logger(ctx).Error("Failed to record character usage", "error", err)
+		}
+	}
+}
+
+type usagePeriod struct {
+	Period string `json:"period"`
+	Chars  int64  `json:"chars"`
+	Budget int    `json:"budget,omitempty"` // 0 is unlimited
+}
+
+// handleStatsUsage reports the characters synthesized today and this month
+// against their budgets, the server's or those of the caller's tenant, see
+// statsTenant.
+func handleStatsUsage(w http.ResponseWriter, r *http.Request) {
+	tenant, _ := statsTenant(r.Context())
+	day, month := usagePeriods(time.Now(), tenant)
+	var stats struct {
+		Tenant string      `json:"tenant,omitempty"`
+		Day    usagePeriod `json:"day"`
+		Month  usagePeriod `json:"month"`
+	}
+	stats.Tenant = tenant
+	s := current()
+	stats.Day = usagePeriod{Period: day, Budget: s.charBudgetDaily}
+	stats.Month = usagePeriod{Period: month, Budget: s.charBudgetMonthly}
+	if tenant != "" {
+		stats.Day.Budget, stats.Month.Budget = s.tenantBudgetDaily, s.tenantBudgetMonthly
+	}
+	var err error
+	stats.Day.Chars, err = usageChars(r.Context(), day)
+	if err == nil {
+		stats.Month.Chars, err = usageChars(r.Context(), month)
+	}
+	if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,37 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestBudgetExhaustedIsNotRateLimited(t *testing.T) {
+	// An uncached clip over the budget is refused with a JSON error.
+	setSettings(t, func(s *reloadableSettings) { s.charBudgetDaily = 1 })
+	resp, body := get(t, "/tts", url.Values{"text": {"预算"}})
+	var e struct {
+		Error apiError `json:"error"`
+	}
+	if resp.StatusCode != http.StatusPaymentRequired {
+		t.Fatalf("over budget: %s %s, want 402", resp.Status, body)
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Error.Status != http.StatusPaymentRequired || e.Error.Code != "payment_required" {
+		t.Errorf("over budget: body %s, want a payment_required error", body)
+	}
+	setSettings(t, func(s *reloadableSettings) { s.charBudgetStatus = http.StatusTooManyRequests })
+	if resp, body := get(t, "/tts", url.Values{"text": {"预算"}}); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("over budget with CHAR_BUDGET_STATUS=429: %s %s", resp.Status, body)
+	}
+
+	// Running out of rate limit tokens is still 429, budget or not.
+	setSettings(t, func(s *reloadableSettings) {
+		s.charBudgetDaily, s.charBudgetStatus = 0, http.StatusPaymentRequired
+		s.rateLimitPerMinute, s.rateLimitBurst = 1, 1
+	})
+	get(t, "/tts", url.Values{"text": {"限速"}})
+	if resp, body := get(t, "/tts", url.Values{"text": {"限速"}}); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("rate limited: %s %s, want 429", resp.Status, body)
+	}
+}
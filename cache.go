@@ -0,0 +1,80 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const maxCacheListLimit = 10000
+
+// handleCacheList lists cache entries from the index, least recently used
+// first, filtered by ?tenant=, ?deck=, ?voice= and ?prefix= (of the text), up
+// to ?limit= of them (default 1000).
+func handleCacheList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 1000
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCacheListLimit {
+			http.Error(w, "Invalid limit: must be between 1 and 10000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	deck, voice, prefix := query.Get("deck"), query.Get("voice"), query.Get("prefix")
+
+	// One extra row tells whether the listing was cut short.
+	entries, err := queryIndex(r.Context(), indexFilter{tenant: query.Get("tenant"), deck: deck, voice: voice, prefix: prefix, limit: limit + 1})
+	if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	truncated := len(entries) > limit
+	if truncated {
+		entries = entries[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Entries   []indexEntry `json:"entries"`
+		Truncated bool         `json:"truncated"`
+	}{entries, truncated})
+}
+
+// handleCacheEntry deletes the single cache entry named by ?file=, as listed
+// by GET /cache.
+func handleCacheEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := r.URL.Query().Get("file")
+	if !validCacheKey(key) {
+		http.Error(w, "Invalid file: must be a cache entry as listed by /cache", http.StatusBadRequest)
+		return
+	}
+	deck := keyDeck(key)
+
+	if _, err := cacheStore.Stat(r.Context(), key); err != nil {
+		http.Error(w, "No such cache entry", http.StatusNotFound)
+		return
+	}
+	if err := cacheStore.Delete(r.Context(), key); err != nil {
+		http.Error(w, "Failed to delete entry: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deleteSidecars(r.Context(), key)
+	if err := indexDelete(r.Context(), key); err != nil {
+		slog.Error("Failed to drop entry from the cache index", "key", logPath(key), "error", err)
+	}
+	slog.Info("Deleted cache entry", "key", logPath(key))
+
+	if err := pruneDeckManifest(r.Context(), deck); err != nil {
+		slog.Error("Failed to prune manifest", "deck", deck, "error", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
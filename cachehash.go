@@ -0,0 +1,56 @@
+package wenbuntts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// A cacheHasher names cache entries: it hashes the fields that shape a clip
+// (see storageHash) into 32 hex digits.
+type cacheHasher interface {
+	hash(data []byte) string
+}
+
+// cacheHashers are the CACHE_HASH algorithms. sha256, the default, resists
+// crafted collisions; fnv and xxhash can be cheaper where SHA-256 has no
+// hardware support (see BenchmarkCacheHashers).
+// Switching renames every key, so like a cache version bump no clip cached
+// before is hit again, and the old files are left for CACHE_TTL or eviction.
+var cacheHashers = map[string]cacheHasher{
+	"sha256": sha256Hasher{},
+	"fnv":    fnvHasher{},
+	"xxhash": xxHasher{},
+}
+
+var keyHasher cacheHasher = sha256Hasher{}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+type fnvHasher struct{}
+
+func (fnvHasher) hash(data []byte) string {
+	h := fnv.New128a()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// xxHasher joins two 64-bit xxHashes with different seeds, to be as wide as
+// the others.
+type xxHasher struct{}
+
+func (xxHasher) hash(data []byte) string {
+	sum := xxhash.NewWithSeed(0)
+	sum.Write(data)
+	out := sum.Sum(nil)
+	sum.ResetWithSeed(1)
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(out))
+}
@@ -0,0 +1,51 @@
+package wenbuntts
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCacheHashers(t *testing.T) {
+	seen := map[string]string{}
+	for name, h := range cacheHashers {
+		a, b := h.hash([]byte("google\x00cmn-CN-Wavenet-B\x00你好")), h.hash([]byte("google\x00cmn-CN-Wavenet-B\x00你好"))
+		if a != b {
+			t.Errorf("%s is not stable: %s, %s", name, a, b)
+		}
+		if len(a) != 32 {
+			t.Errorf("%s gives %d hex digits, want 32", name, len(a))
+		}
+		if a == h.hash([]byte("google\x00cmn-CN-Wavenet-B\x00您好")) {
+			t.Errorf("%s gives different texts the same key", name)
+		}
+		if other, ok := seen[a]; ok {
+			t.Errorf("%s and %s give the same key", name, other)
+		}
+		seen[a] = name
+	}
+}
+
+func TestCacheHashChangeMissesOldEntries(t *testing.T) {
+	query := url.Values{"text": {"图书馆"}}
+	getMetadata(t, query)
+	keyHasher = xxHasher{}
+	defer func() { keyHasher = sha256Hasher{} }()
+	if meta := getMetadata(t, query); meta.CacheHit {
+		t.Error("the entry cached under sha256 was hit with xxhash")
+	}
+	if meta := getMetadata(t, query); !meta.CacheHit {
+		t.Error("second request with xxhash was a cache miss")
+	}
+}
+
+func BenchmarkCacheHashers(b *testing.B) {
+	data := []byte("google\x00cmn-CN-Wavenet-B\x00我们明天一起去图书馆看书吧\x00\x00MP3\x00speakingRate=0.9\x00false")
+	for name, h := range cacheHashers {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				h.hash(data)
+			}
+		})
+	}
+}
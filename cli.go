@@ -0,0 +1,176 @@
+package wenbuntts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// runGenerate pre-renders the texts in -input, one per line, into the cache
+// without starting the server. Each result is printed as a JSON line like
+// those of /tts/batch; the exit status is 1 if any text failed.
+func runGenerate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	input := fs.String("input", "-", "`file` with one text per line, or - for stdin")
+	model := fs.String("model", "", "voice to render with (default: the provider's default voice)")
+	format := fs.String("format", "", "audio format (default: AUDIO_FORMAT, or mp3)")
+	cleanup := setup(fs, args)
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := context.Background()
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	total, failed := 0, 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		total++
+		result := batchGenerate(ctx, batchItem{Text: text, Model: *model, Format: *format})
+		if result.Error != "" {
+			failed++
+		}
+		enc.Encode(result)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read %s: %v", *input, err)
+	}
+	slog.Info("Generation finished", "texts", total, "failed", failed)
+
+	cleanup()
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runPurge deletes cache entries matching every given criterion, like
+// POST /cache/purge.
+func runPurge(args []string) {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	olderThan := fs.String("older-than", "", "only entries created longer ago than this `duration`, e.g. 30d")
+	voice := fs.String("voice", "", "only entries rendered with this voice")
+	prefix := fs.String("prefix", "", "only entries whose text starts with this")
+	dryRun := fs.Bool("dry-run", false, "only count the matching entries")
+	defer setup(fs, args)()
+
+	if *olderThan == "" && *voice == "" && *prefix == "" {
+		log.Fatal("Refusing to purge everything: give at least one of -older-than, -voice, -prefix")
+	}
+	filter := indexFilter{voice: *voice, prefix: *prefix}
+	if *olderThan != "" {
+		d, err := parseDuration(*olderThan)
+		if err != nil {
+			log.Fatal("Invalid -older-than: must be a positive duration")
+		}
+		filter.createdBefore = time.Now().Add(-d)
+	}
+
+	matched, removed, err := purgeCache(context.Background(), filter, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to read cache index: %v", err)
+	}
+	fmt.Printf("Matched %d, removed %d\n", matched, removed)
+}
+
+// runSweep checks every cached clip and deletes corrupt ones and orphaned
+// metadata, like POST /cache/sweep.
+func runSweep(args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	regenerate := fs.Bool("regenerate", false, "synthesize deleted clips again where the index tells how")
+	dryRun := fs.Bool("dry-run", false, "only report what is corrupt or orphaned")
+	defer setup(fs, args)()
+
+	report, err := sweepCache(context.Background(), *regenerate, *dryRun)
+	if err != nil {
+		log.Fatalf("Cache sweep failed: %v", err)
+	}
+	for _, c := range report.Corrupt {
+		fmt.Printf("%s: %s\n", c.Key, c.Problem)
+	}
+	fmt.Printf("Checked %d, corrupt %d, regenerated %d, orphans %d\n", report.Checked, len(report.Corrupt), report.Regenerated, report.Orphans)
+}
+
+// runExport writes the whole cache to -output as a tar.gz, like
+// GET /cache/export.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("output", "-", "`file` to write the archive to, or - for stdout")
+	defer setup(fs, args)()
+
+	ctx := context.Background()
+	entries, keys, err := exportContents(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list the cache: %v", err)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeExport(ctx, w, entries, keys); err != nil {
+		log.Fatalf("Cache export failed: %v", err)
+	}
+}
+
+// runImport imports an archive written by export, like POST /cache/import.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	input := fs.String("input", "-", "`file` with the archive, or - for stdin")
+	overwrite := fs.Bool("overwrite", false, "replace clips that are already cached")
+	defer setup(fs, args)()
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	report, err := importCache(context.Background(), r, *overwrite)
+	if err != nil {
+		log.Fatalf("Failed to import cache: %v", err)
+	}
+	fmt.Printf("Imported %d, skipped %d, corrupt %d\n", report.Imported, report.Skipped, report.Corrupt)
+}
+
+// runMigrate moves every cache entry still stored under its legacy
+// "{voice}_{text}" name to its content-hash key, see migrateLegacyCache.
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only list the entries that would be migrated")
+	defer setup(fs, args)()
+
+	report, err := migrateLegacyCache(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatalf("Cache migration failed: %v", err)
+	}
+	for _, key := range report.Unmapped {
+		fmt.Printf("unmapped: %s\n", key)
+	}
+	fmt.Printf("Migrated %d, unmapped %d\n", len(report.Migrated), len(report.Unmapped))
+}
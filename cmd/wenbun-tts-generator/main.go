@@ -0,0 +1,13 @@
+// Command wenbun-tts-generator serves and pre-generates WenBun audio, see
+// wenbuntts.Main.
+package main
+
+import (
+	"os"
+
+	wenbuntts "github.com/ray-pH/wenbun-tts-generator"
+)
+
+func main() {
+	wenbuntts.Main(os.Args[1:])
+}
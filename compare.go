@@ -0,0 +1,90 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxCompareModels bounds the syntheses a single /tts/compare can trigger.
+const maxCompareModels = 10
+
+type compareResult struct {
+	Model string `json:"model"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleTTSCompare synthesizes one text with each of ?models= for
+// auditioning voices. It returns a ZIP with a member per voice, or with
+// ?response=json the /tts URL of each voice's now cached clip.
+func handleTTSCompare(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	text := normalizeText(query.Get("text"))
+	if text == "" {
+		http.Error(w, "Missing ?text= parameter", http.StatusBadRequest)
+		return
+	}
+	models := splitList(query.Get("models"))
+	if len(models) == 0 || len(models) > maxCompareModels {
+		http.Error(w, "Invalid models: must list between 1 and 10 voices", http.StatusBadRequest)
+		return
+	}
+	prov, ok := providerFor(query.Get("provider"))
+	if !ok {
+		http.Error(w, "Invalid provider: "+query.Get("provider"), http.StatusBadRequest)
+		return
+	}
+	format, ok := parseFormat(query.Get("format"))
+	if !ok {
+		http.Error(w, "Invalid format: "+query.Get("format"), http.StatusBadRequest)
+		return
+	}
+
+	var reqs []ttsRequest
+	seen := map[string]bool{}
+	for _, model := range models {
+		if seen[model] {
+			continue
+		}
+		seen[model] = true
+		if !slices.Contains(prov.AllowedVoices(), model) {
+			http.Error(w, "Invalid model "+model+": must be one of "+strings.Join(prov.AllowedVoices(), ", "), http.StatusBadRequest)
+			return
+		}
+		req := ttsRequest{text: text, provider: prov, model: model, format: format, language: languageFor(model), tenant: tenantFrom(r.Context())}
+		if validateText(text, req.language, req.model) == nil {
+			req.key = req.storageKey()
+		}
+		reqs = append(reqs, req)
+	}
+
+	if !wantsJSON(r) {
+		serveClipZip(w, r, "compare.zip", reqs, func(req ttsRequest) string { return req.model })
+		return
+	}
+
+	results := []compareResult{}
+	for _, req := range reqs {
+		result := compareResult{Model: req.model}
+		if err := ensureCached(r.Context(), req); err != nil {
+			result.Error = err.Error()
+		} else {
+			v := url.Values{"text": {text}, "model": {req.model}}
+			if p := query.Get("provider"); p != "" {
+				v.Set("provider", p)
+			}
+			if f := query.Get("format"); f != "" {
+				v.Set("format", f)
+			}
+			result.URL = "/tts?" + v.Encode()
+		}
+		results = append(results, result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(results)
+}
@@ -0,0 +1,148 @@
+package wenbuntts
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// JSON and other text responses are compressed for clients that accept it,
+// with gzip at COMPRESSION_LEVEL (1-9, 5 by default; 0 turns compression
+// off), or with Brotli at the same level if COMPRESSION_BROTLI=true and the
+// client accepts br. Audio is never compressed: it is compressed already,
+// and Range requests must address its own bytes. Neither is an event
+// stream, which proxies would hold back.
+var (
+	compressionLevel  = 5
+	compressionBrotli bool
+)
+
+// compressResponses compresses the compressible responses of next.
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if compressionLevel == 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header, or ""
+// for neither.
+func negotiateEncoding(accept string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+	accepts := func(name string) bool {
+		if w, ok := q[name]; ok {
+			return w > 0
+		}
+		w, ok := q["*"]
+		return ok && w > 0
+	}
+	switch {
+	case compressionBrotli && accepts("br"):
+		return "br"
+	case accepts("gzip"):
+		return "gzip"
+	}
+	return ""
+}
+
+// compressible reports whether a response of contentType is worth
+// compressing.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/xml", "application/javascript", "image/svg+xml":
+		return true
+	case "text/event-stream":
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// compressWriter compresses the body once the headers show it is
+// compressible, and passes everything else through.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	wroteHeader bool
+	w           io.WriteCloser // nil when not compressing
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		if w.encoding == "br" {
+			w.w = brotli.NewWriterLevel(w.ResponseWriter, compressionLevel)
+		} else {
+			w.w, _ = gzip.NewWriterLevel(w.ResponseWriter, compressionLevel)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.w != nil {
+		return w.w.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been compressed so far, for streamed responses.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close ends the compressed stream, if any.
+func (w *compressWriter) Close() error {
+	if w.w == nil {
+		return nil
+	}
+	return w.w.Close()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,112 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// getEncoded requests path with query accepting accept, without the
+// client's own transparent gzip.
+func getEncoded(t *testing.T, path string, query url.Values, accept string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", server.URL+path+"?"+query.Encode(), nil)
+	req.Header.Set("Accept-Encoding", accept)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestCompressResponses(t *testing.T) {
+	t.Cleanup(func() { compressionLevel, compressionBrotli = 5, false })
+	query := url.Values{"text": {"压缩"}, "response": {"json"}}
+
+	for _, tt := range []struct {
+		level  int
+		brotli bool
+		accept string
+		want   string // Content-Encoding
+	}{
+		{9, false, "gzip", "gzip"},
+		{1, false, "gzip, br", "gzip"},
+		{5, true, "gzip, br", "br"},
+		{5, true, "br;q=0, gzip", "gzip"},
+		{5, true, "identity", ""},
+		{0, true, "gzip, br", ""},
+	} {
+		compressionLevel, compressionBrotli = tt.level, tt.brotli
+		resp, body := getEncoded(t, "/tts", query, tt.accept)
+		if got := resp.Header.Get("Content-Encoding"); got != tt.want {
+			t.Errorf("level %d brotli %v accepting %q: Content-Encoding %q, want %q", tt.level, tt.brotli, tt.accept, got, tt.want)
+			continue
+		}
+		var r io.Reader = bytes.NewReader(body)
+		switch tt.want {
+		case "gzip":
+			// The gzip header records the best and fastest levels.
+			if xfl := map[int]byte{1: 4, 9: 2}[tt.level]; xfl != 0 && body[8] != xfl {
+				t.Errorf("level %d: gzip XFL %d, want %d", tt.level, body[8], xfl)
+			}
+			r, _ = gzip.NewReader(r)
+		case "br":
+			r = brotli.NewReader(r)
+		}
+		var meta audioMetadata
+		if err := json.NewDecoder(r).Decode(&meta); err != nil || meta.Voice != mockVoice {
+			t.Errorf("level %d accepting %q: %v, %+v", tt.level, tt.accept, err, meta)
+		}
+	}
+
+	// Audio never is.
+	compressionLevel, compressionBrotli = 9, true
+	resp, body := getEncoded(t, "/tts", url.Values{"text": {"压缩"}}, "gzip, br")
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" || !bytes.HasPrefix(body, mockMP3Frame[:4]) {
+		t.Errorf("audio: Content-Encoding %q, %d bytes", ce, len(body))
+	}
+}
+
+func BenchmarkCompressResponses(b *testing.B) {
+	var entries []map[string]any
+	for i := range 200 {
+		entries = append(entries, map[string]any{"key": fmt.Sprintf("deck/cmn-CN-Wavenet-A_词%d.mp3", i), "voice": "cmn-CN-Wavenet-A", "size": 4000 + i, "hits": i})
+	}
+	payload, _ := json.Marshal(entries)
+	handler := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(payload)
+	}))
+	defer func() { compressionLevel, compressionBrotli = 5, false }()
+	compressionBrotli = true
+	for _, encoding := range []string{"gzip", "br"} {
+		for _, level := range []int{1, 5, 9} {
+			b.Run(fmt.Sprintf("%s-%d", encoding, level), func(b *testing.B) {
+				compressionLevel = level
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Set("Accept-Encoding", encoding)
+				var size int
+				for b.Loop() {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, req)
+					size = rec.Body.Len()
+				}
+				b.ReportMetric(float64(size), "bytes/op-out")
+				b.ReportMetric(float64(size)/float64(len(payload)), "ratio")
+			})
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxConcatTexts bounds the clips a single /tts/concat can stitch.
+	maxConcatTexts = 50
+	maxConcatGap   = 5 * time.Second
+	// maxCrossfade bounds ?crossfadeMs=, as the overlap must stay shorter
+	// than the clips, which are often single words.
+	maxCrossfade = 200 * time.Millisecond
+)
+
+// handleTTSConcat stitches the MP3 clips for a comma-separated ?texts= into
+// one MP3, with ?gapMs= of silence (500 by default) between them, or
+// overlapping by ?crossfadeMs= instead. Clips are served from the cache, or
+// generated like any other, so a drill built from cached words costs no API
+// calls.
+func handleTTSConcat(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	texts := splitList(query.Get("texts"))
+	if len(texts) == 0 || len(texts) > maxConcatTexts {
+		http.Error(w, "Invalid texts: must list between 1 and 50 comma-separated texts", http.StatusBadRequest)
+		return
+	}
+	gap := 500 * time.Millisecond
+	if v := query.Get("gapMs"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxConcatGap {
+			http.Error(w, "Invalid gapMs: must be between 0 and 5000", http.StatusBadRequest)
+			return
+		}
+		gap = time.Duration(ms) * time.Millisecond
+	}
+	var fade time.Duration
+	if v := query.Get("crossfadeMs"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			ms = -1
+		}
+		if fade, err = parseCrossfade(ms, query.Has("gapMs")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if f, ok := parseFormat(query.Get("format")); !ok || f != "mp3" {
+		http.Error(w, "Invalid format: concatenation only supports mp3", http.StatusBadRequest)
+		return
+	}
+
+	prov, ok := providerFor(query.Get("provider"))
+	if !ok {
+		http.Error(w, "Invalid provider: "+query.Get("provider"), http.StatusBadRequest)
+		return
+	}
+	modelName := query.Get("model")
+	if modelName == "" {
+		modelName = prov.DefaultVoice()
+	}
+	if !slices.Contains(prov.AllowedVoices(), modelName) {
+		http.Error(w, "Invalid model: must be one of "+strings.Join(prov.AllowedVoices(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	reqs := make([]ttsRequest, len(texts))
+	for i, text := range texts {
+		text = normalizeText(text)
+		req := ttsRequest{text: text, provider: prov, model: modelName, format: "mp3", language: languageFor(modelName), tenant: tenantFrom(r.Context())}
+		if err := validateText(text, req.language, req.model); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.key = req.storageKey()
+		reqs[i] = req
+	}
+	out, _, err := joinMP3(r.Context(), reqs, gap, fade)
+	if err != nil {
+		httpGenerateError(r.Context(), w, err.Error(), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("ETag", audioETag(out))
+	http.ServeContent(w, r, "concat.mp3", time.Time{}, bytes.NewReader(out))
+}
+
+// clipSpan is where one clip plays in a stitched MP3.
+type clipSpan struct {
+	start, duration time.Duration
+}
+
+// parseCrossfade validates a ?crossfadeMs= of ms, which can't be combined
+// with a gap.
+func parseCrossfade(ms int, withGap bool) (time.Duration, error) {
+	fade := time.Duration(ms) * time.Millisecond
+	switch {
+	case withGap:
+		return 0, errors.New("Invalid crossfadeMs: cannot be combined with gapMs")
+	case ms < 1 || fade > maxCrossfade:
+		return 0, fmt.Errorf("Invalid crossfadeMs: must be between 1 and %d", maxCrossfade.Milliseconds())
+	case ffmpegPath == "":
+		return 0, errors.New("Invalid crossfadeMs: crossfades need ffmpeg, see FFMPEG_PATH")
+	}
+	return fade, nil
+}
+
+// joinMP3 joins the MP3 clips of reqs with crossfadeMP3 if fade is set, and
+// with stitchMP3 otherwise.
+func joinMP3(ctx context.Context, reqs []ttsRequest, gap, fade time.Duration) ([]byte, []clipSpan, error) {
+	if fade > 0 && len(reqs) > 1 {
+		return crossfadeMP3(ctx, reqs, fade)
+	}
+	return stitchMP3(ctx, reqs, gap)
+}
+
+// stitchMP3 joins the MP3 clips of reqs, generating those that aren't
+// cached, with gap of silence between them, and reports where each plays.
+func stitchMP3(ctx context.Context, reqs []ttsRequest, gap time.Duration) ([]byte, []clipSpan, error) {
+	var out bytes.Buffer
+	spans := make([]clipSpan, len(reqs))
+	for i, req := range reqs {
+		if err := ensureCached(ctx, req); err != nil {
+			return nil, nil, fmt.Errorf("Failed to generate %s: %w", req.text, err)
+		}
+		data, _, err := cacheStore.Get(ctx, req.key)
+		if err == nil {
+			err = appendMP3(&out, data, gap, i > 0)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read clip for %s: %w", req.text, err)
+		}
+		clip, _ := audioDuration(data, ".mp3")
+		total, _ := audioDuration(out.Bytes(), ".mp3")
+		spans[i] = clipSpan{start: total - clip, duration: clip}
+	}
+	return out.Bytes(), spans, nil
+}
+
+// crossfadeMP3 joins the MP3 clips of reqs like stitchMP3, but overlapping
+// each clip with the next by fade, with ffmpeg's acrossfade and linear
+// curves. Unlike stitching frames, this decodes the clips and encodes the
+// result again.
+func crossfadeMP3(ctx context.Context, reqs []ttsRequest, fade time.Duration) ([]byte, []clipSpan, error) {
+	dir, err := os.MkdirTemp("", "wenbun-crossfade")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	spans := make([]clipSpan, len(reqs))
+	var end time.Duration
+	for i, req := range reqs {
+		if err := ensureCached(ctx, req); err != nil {
+			return nil, nil, fmt.Errorf("Failed to generate %s: %w", req.text, err)
+		}
+		data, _, err := cacheStore.Get(ctx, req.key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read clip for %s: %w", req.text, err)
+		}
+		clip, ok := audioDuration(data, ".mp3")
+		if !ok || clip <= fade {
+			return nil, nil, fmt.Errorf("Failed to crossfade %s: clip is not longer than %v", req.text, fade)
+		}
+		path := filepath.Join(dir, strconv.Itoa(i)+".mp3")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-i", path)
+		if i > 0 {
+			end -= fade
+		}
+		spans[i] = clipSpan{start: end, duration: clip}
+		end += clip
+	}
+
+	filters := make([]string, len(reqs)-1)
+	prev := "[0:a]"
+	for i := 1; i < len(reqs); i++ {
+		filters[i-1] = fmt.Sprintf("%s[%d:a]acrossfade=d=%.3f:c1=tri:c2=tri[x%d]", prev, i, fade.Seconds(), i)
+		prev = fmt.Sprintf("[x%d]", i)
+	}
+	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-map", prev)
+	args = append(append(args, mp3Encoder(0)...), "pipe:1")
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("Failed to crossfade clips: ffmpeg: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+	return out.Bytes(), spans, nil
+}
+
+// appendMP3 appends the audio frames of clip to out, preceded by gap of
+// silent frames if withGap is set. Tags and the Xing frame are dropped,
+// since they would describe only the first clip.
+func appendMP3(out *bytes.Buffer, clip []byte, gap time.Duration, withGap bool) error {
+	frames, err := mp3Frames(clip)
+	if err != nil {
+		return err
+	}
+	if withGap && gap > 0 {
+		silence, err := silentMP3Frame(clip[frames[0].offset:])
+		if err != nil {
+			return err
+		}
+		for d := time.Duration(0); d < gap; d += frames[0].duration {
+			out.Write(silence)
+		}
+	}
+	for _, f := range frames {
+		out.Write(clip[f.offset : f.offset+f.length])
+	}
+	return nil
+}
+
+// silentMP3Frame returns a frame with the header of the frame at the start
+// of data and no audio data, which decodes as silence. The padding bit is
+// cleared so the frame length only depends on the bitrate.
+func silentMP3Frame(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errNotMP3
+	}
+	header := []byte{data[0], data[1] | 0x01, data[2] &^ 0x02, data[3]} // no CRC, no padding
+	f, ok := parseMP3Frame(header)
+	if !ok || f.length < 4 {
+		return nil, errors.New("cannot build a silent frame for this stream")
+	}
+	frame := make([]byte, f.length)
+	copy(frame, header)
+	return frame, nil
+}
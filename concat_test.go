@@ -0,0 +1,59 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConcatCrossfadeValidation(t *testing.T) {
+	want := "Invalid crossfadeMs: crossfades need ffmpeg"
+	if ffmpegPath != "" {
+		want = ""
+	}
+	for _, tt := range []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{"texts": {"你好,谢谢"}, "crossfadeMs": {"50"}, "gapMs": {"0"}}, "cannot be combined with gapMs"},
+		{url.Values{"texts": {"你好,谢谢"}, "crossfadeMs": {"0"}}, "must be between 1 and 200"},
+		{url.Values{"texts": {"你好,谢谢"}, "crossfadeMs": {"1000"}}, "must be between 1 and 200"},
+		{url.Values{"texts": {"你好,谢谢"}, "crossfadeMs": {"soft"}}, "must be between 1 and 200"},
+		{url.Values{"texts": {"你好,谢谢"}, "crossfadeMs": {"50"}}, want},
+	} {
+		if tt.want == "" {
+			continue
+		}
+		resp, body := get(t, "/tts/concat", tt.query)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), tt.want) {
+			t.Errorf("/tts/concat?%s: %s %q, want 400 %q", tt.query.Encode(), resp.Status, body, tt.want)
+		}
+	}
+}
+
+func TestConcatCrossfadeIsShorter(t *testing.T) {
+	if ffmpegPath == "" {
+		t.Skip("crossfades need ffmpeg")
+	}
+	const fade = 100 * time.Millisecond
+	duration := func(query url.Values) time.Duration {
+		t.Helper()
+		resp, body := get(t, "/tts/concat", query)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("/tts/concat?%s: %s %s", query.Encode(), resp.Status, body)
+		}
+		d, ok := audioDuration(body, ".mp3")
+		if !ok {
+			t.Fatalf("/tts/concat?%s: not an MP3", query.Encode())
+		}
+		return d
+	}
+	hard := duration(url.Values{"texts": {"你好,谢谢,再见"}, "gapMs": {"0"}})
+	faded := duration(url.Values{"texts": {"你好,谢谢,再见"}, "crossfadeMs": {"100"}})
+	// Two overlaps, give or take the MP3 frames and encoder delay.
+	if diff := hard - faded; diff < 2*fade-60*time.Millisecond || diff > 2*fade+60*time.Millisecond {
+		t.Errorf("crossfaded join is %v, hard join %v: %v shorter, want about %v", faded, hard, diff, 2*fade)
+	}
+}
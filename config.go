@@ -0,0 +1,106 @@
+package wenbuntts
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// config holds every setting by its environment variable name (see
+// .env.example). Values come from, in increasing precedence, a YAML or TOML
+// config file, the environment (including .env) and command-line flags.
+type config struct {
+	path  string // of the config file, if any
+	file  map[string]string
+	flags map[string]string
+}
+
+var settings config
+
+// setting returns the named setting, or "" when it is unset.
+func setting(name string) string {
+	v, _ := lookupSetting(name)
+	return v
+}
+
+// lookupSetting returns the named setting and whether it is set at all.
+// Secret references are replaced with the secret, see secretSchemes.
+func lookupSetting(name string) (string, bool) {
+	v, ok := rawSetting(name)
+	if ok && isSecretRef(v) {
+		v = resolvedSecret(v)
+	}
+	return v, ok
+}
+
+func rawSetting(name string) (string, bool) {
+	if v, ok := settings.flags[name]; ok {
+		return v, true
+	}
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true
+	}
+	v, ok := settings.file[name]
+	return v, ok
+}
+
+// settingFlags maps convenience flags to the settings they override; any
+// other setting can be given with -set NAME=VALUE.
+var settingFlags = map[string]string{
+	"port":       "PORT",
+	"provider":   "TTS_PROVIDER",
+	"output-dir": "OUTPUT_DIR",
+	"log-level":  "LOG_LEVEL",
+}
+
+// loadConfig parses args with fs, extended with the setting flags, and
+// reads the config file named by -config or CONFIG_FILE.
+func loadConfig(fs *flag.FlagSet, args []string) error {
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config `file`")
+	overrides := map[string]*string{}
+	for name, key := range settingFlags {
+		overrides[key] = fs.String(name, "", "override "+key)
+	}
+	settings.flags = map[string]string{}
+	fs.Func("set", "override a setting, as `NAME=VALUE` (repeatable)", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("must be NAME=VALUE")
+		}
+		settings.flags[strings.ToUpper(name)] = value
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := settingFlags[f.Name]; ok {
+			settings.flags[key] = *overrides[key]
+		}
+	})
+
+	settings.path = *configFile
+	file, err := readConfigFile(settings.path)
+	if err != nil {
+		return err
+	}
+	settings.file = file
+	return exportOTelSettings()
+}
+
+// exportOTelSettings copies OTEL_* settings into the environment, where the
+// OpenTelemetry exporters read them.
+func exportOTelSettings() error {
+	for _, m := range []map[string]string{settings.file, settings.flags} {
+		for name := range m {
+			if !strings.HasPrefix(name, "OTEL_") {
+				continue
+			}
+			if err := os.Setenv(name, setting(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
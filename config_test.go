@@ -0,0 +1,96 @@
+package wenbuntts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigFileExample(t *testing.T) {
+	file, err := readConfigFile("config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"TTS_PROVIDER":           "google",
+		"TTS_FALLBACK_PROVIDERS": "piper",
+		"CACHE_BACKEND":          "disk",
+		"SPEED_PRESETS":          "slow:0.7,fast:1.2",
+		"UPSTREAM_HTTP2":         "true",
+		"SPEAKING_RATE":          "0.9",
+		"REDIS_LOCK_TTL":         "30s",
+	} {
+		if got := file[name]; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestFileConfigCoversSettings checks every documented setting has a place
+// in fileConfig.
+func TestFileConfigCoversSettings(t *testing.T) {
+	names := map[string]string{}
+	var cfg fileConfig
+	fillConfig(reflect.ValueOf(&cfg).Elem())
+	flattenConfig(names, "", reflect.ValueOf(cfg))
+	for _, m := range settingName.FindAllStringSubmatch(envExample, -1) {
+		name := m[1]
+		if name == "CONFIG_FILE" || strings.HasPrefix(name, "OTEL_") {
+			continue
+		}
+		if _, ok := names[name]; !ok {
+			t.Errorf("%s has no config file key", name)
+		}
+	}
+}
+
+// fillConfig sets every setting in v, a fileConfig or one of its sections.
+func fillConfig(v reflect.Value) {
+	for i := range v.NumField() {
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Struct:
+			fillConfig(f)
+		case reflect.Pointer:
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	for _, tt := range []struct {
+		name, data string
+		want       map[string]string
+		err        string
+	}{
+		{"a.yaml", "google:\n  api_key: AI\nport: 9000\notel:\n  service_name: tts\n",
+			map[string]string{"GOOGLE_API_KEY": "AI", "PORT": "9000", "OTEL_SERVICE_NAME": "tts"}, ""},
+		{"a.yml", "", map[string]string{}, ""},
+		{"a.yaml", "google:\n  api_kee: AI\n", nil, "line 2: unknown setting api_kee"},
+		{"a.yaml", "google_api_key: AI\n", nil, "unknown setting google_api_key"},
+		{"a.yaml", "port:\n  http: 80\n", nil, "must be a value"},
+		{"a.toml", "port = 9000\napi_keys = [\"a\", \"b\"]\n[cache]\nbackend = \"s3\"\n",
+			map[string]string{"PORT": "9000", "API_KEYS": "a,b", "CACHE_BACKEND": "s3"}, ""},
+		{"a.toml", "[cache]\nbackend = \"s3\"\nbakend = \"s3\"\n", nil, "unknown settings cache.bakend"},
+		{"a.toml", "[port]\nhttp = 80\n", nil, "must be a value"},
+		{"a.json", "{}", nil, "Unsupported config file type"},
+	} {
+		path := filepath.Join(t.TempDir(), tt.name)
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readConfigFile(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s %q: error %v, want %q", tt.name, tt.data, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.name, tt.data, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q = %v, want %v", tt.name, tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of a YAML or TOML config file. Each key is a
+// setting from .env.example, grouped into sections by its leading words:
+// cache.backend sets CACHE_BACKEND. Any OTEL_* setting goes under otel, e.g.
+// otel.exporter_otlp_endpoint.
+type fileConfig struct {
+	TTS struct {
+		Provider          *settingValue `yaml:"provider" toml:"provider"`
+		FallbackProviders *settingValue `yaml:"fallback_providers" toml:"fallback_providers"`
+		RetryAttempts     *settingValue `yaml:"retry_attempts" toml:"retry_attempts"`
+		RetryBaseDelay    *settingValue `yaml:"retry_base_delay" toml:"retry_base_delay"`
+		CacheControl      *settingValue `yaml:"cache_control" toml:"cache_control"`
+	} `yaml:"tts" toml:"tts"`
+	Upstream struct {
+		QueueTimeout        *settingValue `yaml:"queue_timeout" toml:"queue_timeout"`
+		Timeout             *settingValue `yaml:"timeout" toml:"timeout"`
+		DialTimeout         *settingValue `yaml:"dial_timeout" toml:"dial_timeout"`
+		TLSTimeout          *settingValue `yaml:"tls_timeout" toml:"tls_timeout"`
+		ResponseTimeout     *settingValue `yaml:"response_timeout" toml:"response_timeout"`
+		IdleConnTimeout     *settingValue `yaml:"idle_conn_timeout" toml:"idle_conn_timeout"`
+		MaxIdleConnsPerHost *settingValue `yaml:"max_idle_conns_per_host" toml:"max_idle_conns_per_host"`
+		MaxConnsPerHost     *settingValue `yaml:"max_conns_per_host" toml:"max_conns_per_host"`
+		HTTP2               *settingValue `yaml:"http2" toml:"http2"`
+		Proxy               *settingValue `yaml:"proxy" toml:"proxy"`
+	} `yaml:"upstream" toml:"upstream"`
+	MaxUpstreamConcurrency *settingValue `yaml:"max_upstream_concurrency" toml:"max_upstream_concurrency"`
+	Google                 struct {
+		Auth                   *settingValue `yaml:"auth" toml:"auth"`
+		APIKey                 *settingValue `yaml:"api_key" toml:"api_key"`
+		APIKeys                *settingValue `yaml:"api_keys" toml:"api_keys"`
+		KeyRotation            *settingValue `yaml:"key_rotation" toml:"key_rotation"`
+		KeyCooldown            *settingValue `yaml:"key_cooldown" toml:"key_cooldown"`
+		ApplicationCredentials *settingValue `yaml:"application_credentials" toml:"application_credentials"`
+		EffectsProfile         *settingValue `yaml:"effects_profile" toml:"effects_profile"`
+	} `yaml:"google" toml:"google"`
+	Azure struct {
+		SpeechKey    *settingValue `yaml:"speech_key" toml:"speech_key"`
+		SpeechRegion *settingValue `yaml:"speech_region" toml:"speech_region"`
+		DefaultVoice *settingValue `yaml:"default_voice" toml:"default_voice"`
+		Voices       *settingValue `yaml:"voices" toml:"voices"`
+	} `yaml:"azure" toml:"azure"`
+	AWS struct {
+		AccessKeyID     *settingValue `yaml:"access_key_id" toml:"access_key_id"`
+		SecretAccessKey *settingValue `yaml:"secret_access_key" toml:"secret_access_key"`
+		SessionToken    *settingValue `yaml:"session_token" toml:"session_token"`
+		Region          *settingValue `yaml:"region" toml:"region"`
+		DefaultRegion   *settingValue `yaml:"default_region" toml:"default_region"`
+	} `yaml:"aws" toml:"aws"`
+	Polly struct {
+		DefaultVoice *settingValue `yaml:"default_voice" toml:"default_voice"`
+		Voices       *settingValue `yaml:"voices" toml:"voices"`
+	} `yaml:"polly" toml:"polly"`
+	ElevenLabs struct {
+		APIKey       *settingValue `yaml:"api_key" toml:"api_key"`
+		ModelID      *settingValue `yaml:"model_id" toml:"model_id"`
+		DefaultVoice *settingValue `yaml:"default_voice" toml:"default_voice"`
+		Voices       *settingValue `yaml:"voices" toml:"voices"`
+	} `yaml:"elevenlabs" toml:"elevenlabs"`
+	OpenAI struct {
+		APIKey       *settingValue `yaml:"api_key" toml:"api_key"`
+		TTSModel     *settingValue `yaml:"tts_model" toml:"tts_model"`
+		DefaultVoice *settingValue `yaml:"default_voice" toml:"default_voice"`
+		Voices       *settingValue `yaml:"voices" toml:"voices"`
+	} `yaml:"openai" toml:"openai"`
+	Piper struct {
+		Binary       *settingValue `yaml:"binary" toml:"binary"`
+		VoicesDir    *settingValue `yaml:"voices_dir" toml:"voices_dir"`
+		DefaultVoice *settingValue `yaml:"default_voice" toml:"default_voice"`
+	} `yaml:"piper" toml:"piper"`
+	Secrets struct {
+		RefreshInterval *settingValue `yaml:"refresh_interval" toml:"refresh_interval"`
+	} `yaml:"secrets" toml:"secrets"`
+	Vault struct {
+		Addr  *settingValue `yaml:"addr" toml:"addr"`
+		Token *settingValue `yaml:"token" toml:"token"`
+	} `yaml:"vault" toml:"vault"`
+	Default struct {
+		Language *settingValue `yaml:"language" toml:"language"`
+		Voice    *settingValue `yaml:"voice" toml:"voice"`
+	} `yaml:"default" toml:"default"`
+	SpeakingRate        *settingValue `yaml:"speaking_rate" toml:"speaking_rate"`
+	SpeedPresets        *settingValue `yaml:"speed_presets" toml:"speed_presets"`
+	AudioFormat         *settingValue `yaml:"audio_format" toml:"audio_format"`
+	SampleRateHertz     *settingValue `yaml:"sample_rate_hertz" toml:"sample_rate_hertz"`
+	MP3Bitrate          *settingValue `yaml:"mp3_bitrate" toml:"mp3_bitrate"`
+	LoudnessTargetLUFS  *settingValue `yaml:"loudness_target_lufs" toml:"loudness_target_lufs"`
+	FFmpegPath          *settingValue `yaml:"ffmpeg_path" toml:"ffmpeg_path"`
+	TranscodeCached     *settingValue `yaml:"transcode_cached" toml:"transcode_cached"`
+	TranscodeFailPolicy *settingValue `yaml:"transcode_fail_policy" toml:"transcode_fail_policy"`
+	Silence             struct {
+		Trim        *settingValue `yaml:"trim" toml:"trim"`
+		ThresholdDB *settingValue `yaml:"threshold_db" toml:"threshold_db"`
+		PadStartMs  *settingValue `yaml:"pad_start_ms" toml:"pad_start_ms"`
+		PadEndMs    *settingValue `yaml:"pad_end_ms" toml:"pad_end_ms"`
+	} `yaml:"silence" toml:"silence"`
+	Leadin struct {
+		TrimMs     *settingValue `yaml:"trim_ms" toml:"trim_ms"`
+		TrimVoices *settingValue `yaml:"trim_voices" toml:"trim_voices"`
+	} `yaml:"leadin" toml:"leadin"`
+	ProgressiveVoice     *settingValue `yaml:"progressive_voice" toml:"progressive_voice"`
+	VoicePool            *settingValue `yaml:"voice_pool" toml:"voice_pool"`
+	DialogueVoices       *settingValue `yaml:"dialogue_voices" toml:"dialogue_voices"`
+	ValidateDefaultVoice *settingValue `yaml:"validate_default_voice" toml:"validate_default_voice"`
+	InferLangFromVoice   *settingValue `yaml:"infer_lang_from_voice" toml:"infer_lang_from_voice"`
+	Text                 struct {
+		Aliases          *settingValue `yaml:"aliases" toml:"aliases"`
+		Scripts          *settingValue `yaml:"scripts" toml:"scripts"`
+		AllowLatin       *settingValue `yaml:"allow_latin" toml:"allow_latin"`
+		AllowDigits      *settingValue `yaml:"allow_digits" toml:"allow_digits"`
+		AllowPunctuation *settingValue `yaml:"allow_punctuation" toml:"allow_punctuation"`
+		MinScriptChars   *settingValue `yaml:"min_script_chars" toml:"min_script_chars"`
+	} `yaml:"text" toml:"text"`
+	Heteronym struct {
+		Mode      *settingValue `yaml:"mode" toml:"mode"`
+		Overrides *settingValue `yaml:"overrides" toml:"overrides"`
+	} `yaml:"heteronym" toml:"heteronym"`
+	VerbalizeNumbers *settingValue `yaml:"verbalize_numbers" toml:"verbalize_numbers"`
+	YearReading      *settingValue `yaml:"year_reading" toml:"year_reading"`
+	MaxTextLength    *settingValue `yaml:"max_text_length" toml:"max_text_length"`
+	MinHanForTTS     *settingValue `yaml:"min_han_for_tts" toml:"min_han_for_tts"`
+	VoiceMaxLengths  *settingValue `yaml:"voice_max_lengths" toml:"voice_max_lengths"`
+	Sentence         struct {
+		MaxLength  *settingValue `yaml:"max_length" toml:"max_length"`
+		DailyChars *settingValue `yaml:"daily_chars" toml:"daily_chars"`
+	} `yaml:"sentence" toml:"sentence"`
+	Cache struct {
+		Backend         *settingValue `yaml:"backend" toml:"backend"`
+		IndexPath       *settingValue `yaml:"index_path" toml:"index_path"`
+		TTL             *settingValue `yaml:"ttl" toml:"ttl"`
+		Hash            *settingValue `yaml:"hash" toml:"hash"`
+		Control         *settingValue `yaml:"control" toml:"control"`
+		EvictInterval   *settingValue `yaml:"evict_interval" toml:"evict_interval"`
+		EvictPolicy     *settingValue `yaml:"evict_policy" toml:"evict_policy"`
+		SweepInterval   *settingValue `yaml:"sweep_interval" toml:"sweep_interval"`
+		SweepRegenerate *settingValue `yaml:"sweep_regenerate" toml:"sweep_regenerate"`
+		NamespaceByKey  *settingValue `yaml:"namespace_by_key" toml:"namespace_by_key"`
+		NamespaceSalt   *settingValue `yaml:"namespace_salt" toml:"namespace_salt"`
+	} `yaml:"cache" toml:"cache"`
+	OutputDir        *settingValue `yaml:"output_dir" toml:"output_dir"`
+	FilenameTemplate *settingValue `yaml:"filename_template" toml:"filename_template"`
+	MaxCacheBytes    *settingValue `yaml:"max_cache_bytes" toml:"max_cache_bytes"`
+	MemoryCacheBytes *settingValue `yaml:"memory_cache_bytes" toml:"memory_cache_bytes"`
+	VerifyOnServe    *settingValue `yaml:"verify_on_serve" toml:"verify_on_serve"`
+	FailureCacheTTL  *settingValue `yaml:"failure_cache_ttl" toml:"failure_cache_ttl"`
+	VoicesCacheTTL   *settingValue `yaml:"voices_cache_ttl" toml:"voices_cache_ttl"`
+	S3               struct {
+		Endpoint *settingValue `yaml:"endpoint" toml:"endpoint"`
+		Bucket   *settingValue `yaml:"bucket" toml:"bucket"`
+		Prefix   *settingValue `yaml:"prefix" toml:"prefix"`
+		Region   *settingValue `yaml:"region" toml:"region"`
+	} `yaml:"s3" toml:"s3"`
+	GCS struct {
+		Bucket        *settingValue `yaml:"bucket" toml:"bucket"`
+		Prefix        *settingValue `yaml:"prefix" toml:"prefix"`
+		HMACAccessKey *settingValue `yaml:"hmac_access_key" toml:"hmac_access_key"`
+		HMACSecret    *settingValue `yaml:"hmac_secret" toml:"hmac_secret"`
+	} `yaml:"gcs" toml:"gcs"`
+	Redis struct {
+		URL     *settingValue `yaml:"url" toml:"url"`
+		Prefix  *settingValue `yaml:"prefix" toml:"prefix"`
+		LockTTL *settingValue `yaml:"lock_ttl" toml:"lock_ttl"`
+	} `yaml:"redis" toml:"redis"`
+	Port        *settingValue `yaml:"port" toml:"port"`
+	Listen      *settingValue `yaml:"listen" toml:"listen"`
+	AdminListen *settingValue `yaml:"admin_listen" toml:"admin_listen"`
+	SocketMode  *settingValue `yaml:"socket_mode" toml:"socket_mode"`
+	GRPCPort    *settingValue `yaml:"grpc_port" toml:"grpc_port"`
+	TLS         struct {
+		CertFile *settingValue `yaml:"cert_file" toml:"cert_file"`
+		KeyFile  *settingValue `yaml:"key_file" toml:"key_file"`
+	} `yaml:"tls" toml:"tls"`
+	Autocert struct {
+		Domains  *settingValue `yaml:"domains" toml:"domains"`
+		Email    *settingValue `yaml:"email" toml:"email"`
+		CacheDir *settingValue `yaml:"cache_dir" toml:"cache_dir"`
+		HTTPAddr *settingValue `yaml:"http_addr" toml:"http_addr"`
+	} `yaml:"autocert" toml:"autocert"`
+	ShutdownTimeout *settingValue `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ServeOnly       *settingValue `yaml:"serve_only" toml:"serve_only"`
+	StrictStartup   *settingValue `yaml:"strict_startup" toml:"strict_startup"`
+	Log             struct {
+		Level      *settingValue `yaml:"level" toml:"level"`
+		Format     *settingValue `yaml:"format" toml:"format"`
+		RedactText *settingValue `yaml:"redact_text" toml:"redact_text"`
+	} `yaml:"log" toml:"log"`
+	AuditLog *settingValue `yaml:"audit_log" toml:"audit_log"`
+	Metrics  struct {
+		Enabled *settingValue `yaml:"enabled" toml:"enabled"`
+	} `yaml:"metrics" toml:"metrics"`
+	HistoryRetention  *settingValue `yaml:"history_retention" toml:"history_retention"`
+	AsyncJobRetention *settingValue `yaml:"async_job_retention" toml:"async_job_retention"`
+	Compression       struct {
+		Level  *settingValue `yaml:"level" toml:"level"`
+		Brotli *settingValue `yaml:"brotli" toml:"brotli"`
+	} `yaml:"compression" toml:"compression"`
+	State struct {
+		File         *settingValue `yaml:"file" toml:"file"`
+		SaveInterval *settingValue `yaml:"save_interval" toml:"save_interval"`
+	} `yaml:"state" toml:"state"`
+	AdminToken       *settingValue `yaml:"admin_token" toml:"admin_token"`
+	APIKeys          *settingValue `yaml:"api_keys" toml:"api_keys"`
+	TenantKeys       *settingValue `yaml:"tenant_keys" toml:"tenant_keys"`
+	URLSigningSecret *settingValue `yaml:"url_signing_secret" toml:"url_signing_secret"`
+	SignedURLTTL     *settingValue `yaml:"signed_url_ttl" toml:"signed_url_ttl"`
+	CORS             struct {
+		AllowedOrigins *settingValue `yaml:"allowed_origins" toml:"allowed_origins"`
+		AllowedMethods *settingValue `yaml:"allowed_methods" toml:"allowed_methods"`
+	} `yaml:"cors" toml:"cors"`
+	Webhook struct {
+		Secret *settingValue `yaml:"secret" toml:"secret"`
+		Hosts  *settingValue `yaml:"hosts" toml:"hosts"`
+	} `yaml:"webhook" toml:"webhook"`
+	TrustedProxies   *settingValue `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	IPAllow          *settingValue `yaml:"ip_allow" toml:"ip_allow"`
+	IPDeny           *settingValue `yaml:"ip_deny" toml:"ip_deny"`
+	MissIPAllow      *settingValue `yaml:"miss_ip_allow" toml:"miss_ip_allow"`
+	MaxInflightPerIP *settingValue `yaml:"max_inflight_per_ip" toml:"max_inflight_per_ip"`
+	RateLimit        struct {
+		PerMinute *settingValue `yaml:"per_minute" toml:"per_minute"`
+		Burst     *settingValue `yaml:"burst" toml:"burst"`
+	} `yaml:"rate_limit" toml:"rate_limit"`
+	CharBudget struct {
+		Daily   *settingValue `yaml:"daily" toml:"daily"`
+		Monthly *settingValue `yaml:"monthly" toml:"monthly"`
+		Status  *settingValue `yaml:"status" toml:"status"`
+	} `yaml:"char_budget" toml:"char_budget"`
+	TenantCharBudget struct {
+		Daily   *settingValue `yaml:"daily" toml:"daily"`
+		Monthly *settingValue `yaml:"monthly" toml:"monthly"`
+	} `yaml:"tenant_char_budget" toml:"tenant_char_budget"`
+	RetryQueue struct {
+		Attempts *settingValue `yaml:"attempts" toml:"attempts"`
+		Delay    *settingValue `yaml:"delay" toml:"delay"`
+	} `yaml:"retry_queue" toml:"retry_queue"`
+	CircuitBreaker struct {
+		Failures *settingValue `yaml:"failures" toml:"failures"`
+		Cooldown *settingValue `yaml:"cooldown" toml:"cooldown"`
+	} `yaml:"circuit_breaker" toml:"circuit_breaker"`
+	Ready struct {
+		ErrorWindow    *settingValue `yaml:"error_window" toml:"error_window"`
+		ErrorThreshold *settingValue `yaml:"error_threshold" toml:"error_threshold"`
+		MinSamples     *settingValue `yaml:"min_samples" toml:"min_samples"`
+		ProviderPing   *settingValue `yaml:"provider_ping" toml:"provider_ping"`
+	} `yaml:"ready" toml:"ready"`
+	MaintenanceSchedule *settingValue `yaml:"maintenance_schedule" toml:"maintenance_schedule"`
+	Warmup              struct {
+		File        *settingValue `yaml:"file" toml:"file"`
+		Concurrency *settingValue `yaml:"concurrency" toml:"concurrency"`
+	} `yaml:"warmup" toml:"warmup"`
+	PopularWarmCount *settingValue `yaml:"popular_warm_count" toml:"popular_warm_count"`
+	AnkiConnect      struct {
+		URL *settingValue `yaml:"url" toml:"url"`
+		Key *settingValue `yaml:"key" toml:"key"`
+	} `yaml:"ankiconnect" toml:"ankiconnect"`
+	OTel map[string]*settingValue `yaml:"otel" toml:"otel"`
+}
+
+// unknownYAMLField matches yaml's error for a key fileConfig lacks, which
+// names the (long, anonymous) section type.
+var unknownYAMLField = regexp.MustCompile(`field (\S+) not found in type .*`)
+
+// readConfigFile reads the settings in the YAML or TOML file at path, none
+// if path is "". Keys fileConfig doesn't know are an error.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return map[string]string{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg fileConfig
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+		var typeErr *yaml.TypeError
+		if errors.Is(err, io.EOF) {
+			err = nil
+		} else if errors.As(err, &typeErr) {
+			for i, e := range typeErr.Errors {
+				typeErr.Errors[i] = unknownYAMLField.ReplaceAllString(e, "unknown setting $1")
+			}
+		}
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), &cfg)
+		if undecoded := md.Undecoded(); err == nil && len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			err = fmt.Errorf("unknown settings %s", strings.Join(keys, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported config file type %q: must be .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config file %s: %w", path, err)
+	}
+	file := map[string]string{}
+	flattenConfig(file, "", reflect.ValueOf(cfg))
+	return file, nil
+}
+
+// flattenConfig stores the values set in v, a fileConfig or one of its
+// sections, under their setting names, so
+//
+//	google:
+//	  api_key: AI...
+//
+// sets GOOGLE_API_KEY.
+func flattenConfig(out map[string]string, prefix string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			name := strings.ToUpper(v.Type().Field(i).Tag.Get("yaml"))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			flattenConfig(out, name, v.Field(i))
+		}
+	case reflect.Map:
+		for iter := v.MapRange(); iter.Next(); {
+			flattenConfig(out, prefix+"_"+strings.ToUpper(iter.Key().String()), iter.Value())
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			out[prefix] = string(*v.Interface().(*settingValue))
+		}
+	}
+}
+
+// settingValue is a setting's value in a config file. Scalars of any type
+// are taken as written, and lists become comma-separated values; the
+// setting's reader validates the result as it does the environment's.
+type settingValue string
+
+func (s *settingValue) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		*s = settingValue(n.Value)
+	case yaml.SequenceNode:
+		items := make([]string, len(n.Content))
+		for i, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: list items must be values", item.Line)
+			}
+			items[i] = item.Value
+		}
+		*s = settingValue(strings.Join(items, ","))
+	default:
+		return fmt.Errorf("line %d: must be a value or a list of values", n.Line)
+	}
+	return nil
+}
+
+func (s *settingValue) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		return fmt.Errorf("must be a value or a list of values")
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.(map[string]any); ok {
+				return fmt.Errorf("list items must be values")
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		*s = settingValue(strings.Join(items, ","))
+	default:
+		*s = settingValue(fmt.Sprint(v))
+	}
+	return nil
+}
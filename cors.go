@@ -0,0 +1,46 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORS_ALLOWED_ORIGINS are the origins browsers may call the service from;
+// "*" allows any. Empty disables CORS headers. CORS_ALLOWED_METHODS are the
+// methods allowed in preflights, defaultCORSMethods by default.
+var defaultCORSMethods = []string{"GET", "HEAD", "POST", "OPTIONS"}
+
+const (
+	corsAllowHeaders  = "Authorization, X-API-Key, Content-Type, Range, X-Request-ID"
+	corsExposeHeaders = "X-Request-ID, X-Audio-Duration, X-TTS-Cached, X-TTS-Content-Length, X-TTS-Voice, X-TTS-Progressive, X-TTS-Fallback, Content-Length, Content-Range, Accept-Ranges, ETag, Content-Location, X-Content-URL, Retry-After, Location"
+)
+
+// allowCORS adds CORS headers for allowed origins and answers preflight
+// requests itself, before any authentication sees them.
+func allowCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		live := current()
+		if origin == "" || len(live.corsOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !slices.Contains(live.corsOrigins, "*") && !slices.Contains(live.corsOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(live.corsMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
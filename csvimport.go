@@ -0,0 +1,114 @@
+package wenbuntts
+
+import (
+	"cmp"
+	"encoding/csv"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Columns a vocabulary spreadsheet names the word and the voice by; the
+// first header found wins. Other columns, such as pinyin or a translation,
+// are carried through to the annotated copy untouched.
+var (
+	csvTextColumns  = []string{"hanzi", "simplified", "word", "text"}
+	csvVoiceColumns = []string{"voice", "model"}
+)
+
+// The annotated copy adds these columns after the spreadsheet's own.
+var csvResultColumns = []string{"file", "url", "cached", "error"}
+
+// handleImportCSV generates audio for every row of an uploaded CSV or TSV
+// vocabulary list, as /tts/batch would, and returns the same table with the
+// file, /tts URL, cache state and any error of each row appended. The
+// header row must have a hanzi, simplified, word or text column; a voice
+// (or model), provider and format column override ?model=, ?provider= and
+// ?format= for their row. TSV is read when the Content-Type is
+// text/tab-separated-values, and answered in kind.
+func handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType := "text/csv"
+	cr := csv.NewReader(io.LimitReader(r.Body, 4<<20))
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "text/tab-separated-values" {
+		contentType = mt
+		cr.Comma = '\t'
+		cr.LazyQuotes = true
+	}
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		http.Error(w, "Invalid CSV body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) < 2 {
+		http.Error(w, "Invalid CSV body: must have a header row and at least one word", http.StatusBadRequest)
+		return
+	}
+	if len(rows)-1 > maxBatchItems {
+		http.Error(w, "Invalid CSV body: must have at most 1000 rows", http.StatusBadRequest)
+		return
+	}
+
+	header := make([]string, len(rows[0]))
+	for i, name := range rows[0] {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	}
+	textCol := csvColumn(header, csvTextColumns...)
+	if textCol < 0 {
+		http.Error(w, "Invalid CSV body: must have a hanzi, simplified, word or text column", http.StatusBadRequest)
+		return
+	}
+	voiceCol, providerCol, formatCol := csvColumn(header, csvVoiceColumns...), csvColumn(header, "provider"), csvColumn(header, "format")
+
+	query := r.URL.Query()
+	for i, row := range rows[1:] {
+		item := batchItem{
+			Text:     csvField(row, textCol),
+			Model:    cmp.Or(csvField(row, voiceCol), query.Get("model")),
+			Provider: cmp.Or(csvField(row, providerCol), query.Get("provider")),
+			Format:   cmp.Or(csvField(row, formatCol), query.Get("format")),
+		}
+		var result batchResult
+		if item.Text == "" {
+			result.Error = "missing text"
+		} else {
+			result = batchGenerate(r.Context(), item)
+		}
+		for len(row) < len(header) {
+			row = append(row, "")
+		}
+		rows[i+1] = append(row, result.File, result.URL, strconv.FormatBool(result.Cached), result.Error)
+	}
+	rows[0] = append(rows[0], csvResultColumns...)
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Comma = cr.Comma
+	cw.WriteAll(rows)
+}
+
+// csvColumn returns the index of the first of names in header, or -1.
+func csvColumn(header []string, names ...string) int {
+	for _, name := range names {
+		if i := slices.Index(header, name); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func csvField(row []string, col int) string {
+	if col < 0 || col >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[col])
+}
@@ -0,0 +1,160 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const manifestName = "manifest.json"
+
+var deckNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// manifestMu serializes manifest read-modify-write cycles across all decks.
+var manifestMu sync.Mutex
+
+type deckManifest struct {
+	Deck    string          `json:"deck"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	Text      string    `json:"text"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	File      string    `json:"file"`
+	Generated time.Time `json:"generated"`
+}
+
+// isValidDeck reports whether deck is safe to use as a single path element.
+func isValidDeck(deck string) bool {
+	return deckNamePattern.MatchString(deck)
+}
+
+// keyDeck returns the deck a storage key belongs to, or "" for the top level.
+func keyDeck(key string) string {
+	if dir := path.Dir(key); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// updateDeckManifest records req's audio in its deck's manifest.json,
+// replacing any previous entry for the same file. Audio outside any deck
+// has no manifest, as rewriting one for every miss would serialize them.
+func updateDeckManifest(ctx context.Context, req ttsRequest) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	key := path.Join(req.dir(), manifestName)
+	manifest := deckManifest{Deck: req.deck}
+	if data, _, err := cacheStore.Get(ctx, key); err == nil {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	entry := manifestEntry{
+		Text:      req.text,
+		Provider:  req.provider.Name(),
+		Model:     req.model,
+		File:      path.Base(req.key),
+		Generated: time.Now().UTC(),
+	}
+	replaced := false
+	for i := range manifest.Entries {
+		if manifest.Entries[i].File == entry.File {
+			manifest.Entries[i] = entry
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	return writeDeckManifest(ctx, key, manifest)
+}
+
+// pruneDeckManifest drops manifest entries whose audio no longer exists.
+func pruneDeckManifest(ctx context.Context, deck string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	key := path.Join(deck, manifestName)
+	data, _, err := cacheStore.Get(ctx, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var manifest deckManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+
+	entries := manifest.Entries[:0]
+	for _, e := range manifest.Entries {
+		if _, err := cacheStore.Stat(ctx, path.Join(deck, e.File)); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	manifest.Entries = entries
+	return writeDeckManifest(ctx, key, manifest)
+}
+
+// readManifestEntries returns deck's manifest entries by file, or none if the
+// manifest is missing or unreadable.
+func readManifestEntries(ctx context.Context, deck string) map[string]manifestEntry {
+	entries := map[string]manifestEntry{}
+	data, _, err := cacheStore.Get(ctx, path.Join(deck, manifestName))
+	if err != nil {
+		return entries
+	}
+	var manifest deckManifest
+	if json.Unmarshal(data, &manifest) == nil {
+		for _, e := range manifest.Entries {
+			entries[e.File] = e
+		}
+	}
+	return entries
+}
+
+// renameManifestFile points deck's manifest entry for file from at file to.
+func renameManifestFile(ctx context.Context, deck, from, to string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	key := path.Join(deck, manifestName)
+	data, _, err := cacheStore.Get(ctx, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var manifest deckManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+	for i := range manifest.Entries {
+		if manifest.Entries[i].File == from {
+			manifest.Entries[i].File = to
+		}
+	}
+	return writeDeckManifest(ctx, key, manifest)
+}
+
+func writeDeckManifest(ctx context.Context, key string, manifest deckManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return cacheStore.Put(ctx, key, data)
+}
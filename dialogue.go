@@ -0,0 +1,217 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialogueVoices are the voices of named speakers, from DIALOGUE_VOICES
+// (speaker:voice,...). Speakers a dialogue doesn't give a voice either get
+// theirs from here or the next voice of VOICE_POOL, or of the provider, that
+// no other speaker of the dialogue has.
+var dialogueVoices map[string]string
+
+// maxDialogueTurns bounds the clips a single /tts/dialogue can stitch.
+const maxDialogueTurns = 50
+
+type dialogueTurn struct {
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+// dialogueRequest is the body of POST /tts/dialogue.
+type dialogueRequest struct {
+	Turns       []dialogueTurn    `json:"turns"`
+	Voices      map[string]string `json:"voices"` // by speaker
+	Provider    string            `json:"provider"`
+	GapMs       *int              `json:"gapMs"`
+	CrossfadeMs *int              `json:"crossfadeMs"`
+}
+
+// turnTiming is where one turn plays in the dialogue.
+type turnTiming struct {
+	Speaker    string `json:"speaker"`
+	Voice      string `json:"voice"`
+	Text       string `json:"text"`
+	StartMs    int64  `json:"startMs"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// dialogueMetadata is the ?response=json form of a /tts/dialogue response.
+type dialogueMetadata struct {
+	DurationMs  int64        `json:"durationMs"`
+	Turns       []turnTiming `json:"turns"`
+	AudioBase64 string       `json:"audioBase64"`
+}
+
+// parseDialogueVoices parses DIALOGUE_VOICES.
+func parseDialogueVoices(s string) (map[string]string, error) {
+	voices := map[string]string{}
+	for _, entry := range splitList(s) {
+		speaker, voice, ok := strings.Cut(entry, ":")
+		speaker, voice = strings.TrimSpace(speaker), strings.TrimSpace(voice)
+		if !ok || speaker == "" || voice == "" {
+			return nil, fmt.Errorf("%q is not speaker:voice", entry)
+		}
+		voices[speaker] = voice
+	}
+	return voices, nil
+}
+
+// handleTTSDialogue synthesizes each {speaker, text} turn of a JSON body in
+// its speaker's voice and stitches the clips into one MP3, with gapMs of
+// silence (500 by default) between turns, or overlapping by crossfadeMs
+// instead. Turns are sentences when sentence
+// mode is enabled, and cached like any other clip. The response is the MP3,
+// with each turn's start in ms in X-Turn-Offsets, or with ?response=json
+// the timing of every turn and the base64 audio.
+func handleTTSDialogue(w http.ResponseWriter, r *http.Request) {
+	var body dialogueRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body.Turns) == 0 || len(body.Turns) > maxDialogueTurns {
+		http.Error(w, fmt.Sprintf("Invalid turns: must list between 1 and %d turns", maxDialogueTurns), http.StatusBadRequest)
+		return
+	}
+	gap := 500 * time.Millisecond
+	if body.GapMs != nil {
+		if *body.GapMs < 0 || time.Duration(*body.GapMs)*time.Millisecond > maxConcatGap {
+			http.Error(w, "Invalid gapMs: must be between 0 and 5000", http.StatusBadRequest)
+			return
+		}
+		gap = time.Duration(*body.GapMs) * time.Millisecond
+	}
+	var fade time.Duration
+	if body.CrossfadeMs != nil {
+		var err error
+		if fade, err = parseCrossfade(*body.CrossfadeMs, body.GapMs != nil); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	prov, ok := providerFor(body.Provider)
+	if !ok {
+		http.Error(w, "Invalid provider: "+body.Provider, http.StatusBadRequest)
+		return
+	}
+	voices, err := speakerVoices(prov, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	reqs := make([]ttsRequest, len(body.Turns))
+	for i, turn := range body.Turns {
+		voice := voices[turn.Speaker]
+		req := ttsRequest{text: normalizeText(turn.Text), provider: prov, model: voice, format: "mp3", language: languageFor(voice), tenant: tenantFrom(ctx)}
+		if sentenceMaxLength > 0 {
+			req.sentence = true
+			err = validateSentence(req.text, req.language)
+		} else {
+			err = validateText(req.text, req.language, req.model)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.key = req.storageKey()
+		reqs[i] = req
+	}
+	for _, req := range reqs {
+		if _, err := lookupCached(ctx, req); err != nil {
+			if err := allowMiss(ctx); err != nil {
+				httpGenerateError(ctx, w, err.Error(), err)
+				return
+			}
+			if req.sentence && !takeSentenceBudget(len([]rune(req.text)), time.Now()) {
+				http.Error(w, "Daily sentence budget exhausted", http.StatusTooManyRequests)
+				return
+			}
+		}
+	}
+
+	out, spans, err := joinMP3(ctx, reqs, gap, fade)
+	if err != nil {
+		httpGenerateError(ctx, w, err.Error(), err)
+		return
+	}
+	timings := make([]turnTiming, len(reqs))
+	offsets := make([]string, len(reqs))
+	for i, span := range spans {
+		timings[i] = turnTiming{
+			Speaker:    body.Turns[i].Speaker,
+			Voice:      reqs[i].model,
+			Text:       reqs[i].text,
+			StartMs:    span.start.Milliseconds(),
+			DurationMs: span.duration.Milliseconds(),
+		}
+		offsets[i] = strconv.FormatInt(span.start.Milliseconds(), 10)
+	}
+
+	if wantsJSON(r) {
+		total, _ := audioDuration(out, ".mp3")
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.Encode(dialogueMetadata{DurationMs: total.Milliseconds(), Turns: timings, AudioBase64: base64.StdEncoding.EncodeToString(out)})
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("X-Turn-Offsets", strings.Join(offsets, ","))
+	w.Header().Set("ETag", audioETag(out))
+	http.ServeContent(w, r, "dialogue.mp3", time.Time{}, bytes.NewReader(out))
+}
+
+// speakerVoices picks the voice of each speaker of body.
+func speakerVoices(prov provider, body dialogueRequest) (map[string]string, error) {
+	allowed := prov.AllowedVoices()
+	voices := map[string]string{}
+	var unvoiced []string
+	for _, turn := range body.Turns {
+		if turn.Speaker == "" {
+			return nil, fmt.Errorf("Invalid turns: every turn needs a speaker")
+		}
+		if _, ok := voices[turn.Speaker]; ok || slices.Contains(unvoiced, turn.Speaker) {
+			continue
+		}
+		voice := body.Voices[turn.Speaker]
+		if voice == "" {
+			voice = dialogueVoices[turn.Speaker]
+		}
+		if voice == "" {
+			unvoiced = append(unvoiced, turn.Speaker)
+			continue
+		}
+		if !slices.Contains(allowed, voice) {
+			return nil, fmt.Errorf("Invalid voices: %s of %s must be one of %s", voice, turn.Speaker, strings.Join(allowed, ", "))
+		}
+		voices[turn.Speaker] = voice
+	}
+
+	candidates := voicePool
+	if len(candidates) == 0 || prov != defaultProvider {
+		candidates = allowed
+	}
+	taken := slices.Collect(maps.Values(voices))
+	for _, speaker := range unvoiced {
+		i := slices.IndexFunc(candidates, func(v string) bool { return !slices.Contains(taken, v) })
+		if i < 0 {
+			return nil, fmt.Errorf("Invalid voices: provider %s has no voice left for %s", prov.Name(), speaker)
+		}
+		voices[speaker] = candidates[i]
+		taken = append(taken, candidates[i])
+	}
+	return voices, nil
+}
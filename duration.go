@@ -0,0 +1,63 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// audioDuration returns how long a clip in the format of ext plays, or
+// false when its headers can't be read.
+func audioDuration(data []byte, ext string) (time.Duration, bool) {
+	switch ext {
+	case ".mp3":
+		frames, err := mp3Frames(data)
+		if err != nil {
+			return 0, false
+		}
+		var d time.Duration
+		for _, f := range frames {
+			d += f.duration
+		}
+		return d, true
+	case ".wav":
+		return wavDuration(data)
+	case ".ogg":
+		return oggDuration(data)
+	}
+	return 0, false
+}
+
+// wavDuration reads the byte rate from the fmt chunk and divides the size
+// of the data chunk by it.
+func wavDuration(data []byte) (time.Duration, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, false
+	}
+	var byteRate uint32
+	for pos := 12; pos+8 <= len(data); {
+		id, size := string(data[pos:pos+4]), int(binary.LittleEndian.Uint32(data[pos+4:pos+8]))
+		body := data[pos+8:]
+		switch {
+		case id == "fmt " && len(body) >= 12:
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+		case id == "data" && byteRate > 0:
+			// Streamed WAVs may leave the size unset; use what is there.
+			size = min(size, len(body))
+			return time.Duration(size) * time.Second / time.Duration(byteRate), true
+		}
+		pos += 8 + size + size%2
+	}
+	return 0, false
+}
+
+// oggDuration reads the granule position of the last Ogg page, which for
+// Opus counts 48 kHz samples.
+func oggDuration(data []byte) (time.Duration, bool) {
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || last+14 > len(data) {
+		return 0, false
+	}
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	return time.Duration(granule) * time.Second / 48000, true
+}
@@ -0,0 +1,47 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// requestEcho describes how the server resolved a /tts request, so clients
+// can verify normalization and predict cache keys.
+type requestEcho struct {
+	Text          string            `json:"text"`
+	Alias         string            `json:"alias,omitempty"`
+	SSML          string            `json:"ssml,omitempty"`
+	Provider      string            `json:"provider"`
+	Voice         string            `json:"voice"`
+	Options       map[string]string `json:"options,omitempty"`
+	Language      string            `json:"language"`
+	SpeakingRate  float64           `json:"speakingRate"`
+	Pitch         float64           `json:"pitch"`
+	VolumeGainDb  float64           `json:"volumeGainDb"`
+	AudioEncoding string            `json:"audioEncoding"`
+	SampleRate    int               `json:"sampleRateHertz,omitempty"`
+	Deck          string            `json:"deck,omitempty"`
+	Sentence      bool              `json:"sentence,omitempty"`
+	CacheFile     string            `json:"cacheFile"`
+}
+
+func writeEcho(w http.ResponseWriter, req ttsRequest) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requestEcho{
+		Text:          req.text,
+		Alias:         req.alias,
+		SSML:          req.ssml,
+		Provider:      req.provider.Name(),
+		Voice:         req.model,
+		Options:       req.options,
+		Language:      req.language,
+		SpeakingRate:  req.prosody.speakingRate(),
+		Pitch:         req.prosody.pitch,
+		VolumeGainDb:  req.prosody.volumeGainDb,
+		AudioEncoding: req.audioFormat().encoding,
+		SampleRate:    req.sampleRateHertz(),
+		Deck:          req.deck,
+		Sentence:      req.sentence,
+		CacheFile:     req.key,
+	})
+}
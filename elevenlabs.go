@@ -0,0 +1,187 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+const elevenLabsAPIBase = "https://api.elevenlabs.io/v1"
+
+// elevenLabsProvider synthesizes with ElevenLabs, whose voices (including
+// custom and cloned ones) are addressed by voice_id.
+type elevenLabsProvider struct {
+	apiKey       secretSetting
+	modelID      string
+	defaultVoice string
+	voices       []string
+}
+
+func newElevenLabsProvider() (provider, error) {
+	key := setting("ELEVENLABS_API_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing ELEVENLABS_API_KEY", errNotConfigured)
+	}
+
+	p := &elevenLabsProvider{
+		apiKey:       "ELEVENLABS_API_KEY",
+		modelID:      setting("ELEVENLABS_MODEL_ID"),
+		defaultVoice: setting("ELEVENLABS_DEFAULT_VOICE"),
+		voices:       splitList(setting("ELEVENLABS_VOICES")),
+	}
+	if p.modelID == "" {
+		p.modelID = "eleven_multilingual_v2"
+	}
+	if p.defaultVoice == "" {
+		p.defaultVoice = "21m00Tcm4TlvDq8ikWAM"
+	}
+	if !slices.Contains(p.voices, p.defaultVoice) {
+		p.voices = append(p.voices, p.defaultVoice)
+	}
+	return p, nil
+}
+
+func (p *elevenLabsProvider) Name() string { return "elevenlabs" }
+
+func (p *elevenLabsProvider) DefaultVoice() string { return p.defaultVoice }
+
+func (p *elevenLabsProvider) AllowedVoices() []string { return p.voices }
+
+// elevenLabsOutputFormats maps our audio encodings onto ElevenLabs output formats.
+var elevenLabsOutputFormats = map[string]string{
+	"MP3": "mp3_44100_128",
+}
+
+// elevenLabsMP3Bitrates are the MP3 output formats by bitrate.
+var elevenLabsMP3Bitrates = map[int]string{
+	32:  "mp3_22050_32",
+	64:  "mp3_44100_64",
+	96:  "mp3_44100_96",
+	128: "mp3_44100_128",
+	192: "mp3_44100_192",
+}
+
+func (p *elevenLabsProvider) SetsBitrate(kbps int) bool {
+	_, ok := elevenLabsMP3Bitrates[kbps]
+	return ok
+}
+
+// ParseOptions reads ?modelId=, ?stability= and ?similarity=. Unset values
+// fall back to the configured model and the voice's own settings.
+func (p *elevenLabsProvider) ParseOptions(q url.Values) (map[string]string, error) {
+	options := map[string]string{}
+	if v := q.Get("modelId"); v != "" && v != p.modelID {
+		options["modelId"] = v
+	}
+	for _, name := range []string{"stability", "similarity"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("Invalid %s: must be between 0 and 1", name)
+		}
+		options[name] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return options, nil
+}
+
+func (p *elevenLabsProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	format, ok := elevenLabsOutputFormats[req.AudioEncoding]
+	if !ok {
+		return nil, fmt.Errorf("elevenlabs does not support %s output", req.AudioEncoding)
+	}
+	if req.BitrateKbps != 0 {
+		format = elevenLabsMP3Bitrates[req.BitrateKbps]
+	}
+	if req.Pitch != 0 || req.VolumeGainDb != 0 {
+		return nil, fmt.Errorf("elevenlabs does not support pitch or volume adjustment")
+	}
+
+	modelID := p.modelID
+	if v := req.Options["modelId"]; v != "" {
+		modelID = v
+	}
+	settings := map[string]float64{"speed": req.SpeakingRate}
+	if v, ok := req.Options["stability"]; ok {
+		settings["stability"], _ = strconv.ParseFloat(v, 64)
+	}
+	if v, ok := req.Options["similarity"]; ok {
+		settings["similarity_boost"], _ = strconv.ParseFloat(v, 64)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"text":           req.Text,
+		"model_id":       modelID,
+		"voice_settings": settings,
+	})
+	auditSynthesis(ctx, string(body))
+
+	apiURL := fmt.Sprintf("%s/text-to-speech/%s?output_format=%s", elevenLabsAPIBase, url.PathEscape(req.Voice), format)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("xi-api-key", p.apiKey.value())
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "audio/mpeg")
+
+	resp, err := upstreamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, audio)
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("No audio content in response")
+	}
+	return audio, nil
+}
+
+// Voices lists the account's voices. ElevenLabs voices are multilingual, so
+// language is ignored.
+func (p *elevenLabsProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, elevenLabsAPIBase+"/voices", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("xi-api-key", p.apiKey.value())
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("voices request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("voices request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Voices []struct {
+			VoiceID string            `json:"voice_id"`
+			Labels  map[string]string `json:"labels"`
+		} `json:"voices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse voices: %w", err)
+	}
+	voices := make([]voiceInfo, len(result.Voices))
+	for i, v := range result.Voices {
+		voices[i] = voiceInfo{Name: v.VoiceID, Gender: v.Labels["gender"]}
+	}
+	return voices, nil
+}
@@ -0,0 +1,100 @@
+package wenbuntts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxEstimateItems bounds a /tts/estimate request. Estimates are cheap, so
+// it is well above maxBatchItems.
+const maxEstimateItems = 20000
+
+type estimateResult struct {
+	Text   string `json:"text"`
+	Model  string `json:"model"`
+	Cached bool   `json:"cached"`
+	Chars  int    `json:"chars,omitempty"` // billable, 0 when cached
+	Error  string `json:"error,omitempty"`
+}
+
+// handleTTSEstimate reports what a /tts/batch of the same items would cost
+// without synthesizing anything: which are cached, which are not and how
+// many characters those would bill, counting repeated items once. The body
+// is a batch's JSON, or text/plain with one word per line for the default
+// voice.
+func handleTTSEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var items []batchItem
+	body := io.LimitReader(r.Body, 4<<20)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/plain" {
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			if text := strings.TrimSpace(scanner.Text()); text != "" {
+				items = append(items, batchItem{Text: text})
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(body).Decode(&items); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 || len(items) > maxEstimateItems {
+		http.Error(w, "Invalid estimate: must list between 1 and 20000 items", http.StatusBadRequest)
+		return
+	}
+
+	var estimate struct {
+		Cached        int              `json:"cached"`
+		Uncached      int              `json:"uncached"`
+		Invalid       int              `json:"invalid"`
+		BillableChars int              `json:"billableChars"`
+		WithinBudget  bool             `json:"withinBudget"` // see CHAR_BUDGET_DAILY and CHAR_BUDGET_MONTHLY, and TENANT_CHAR_BUDGET_*
+		Items         []estimateResult `json:"items"`
+	}
+	estimate.Items = make([]estimateResult, len(items))
+	counted := map[string]bool{}
+	for i, item := range items {
+		req, result := batchRequest(r.Context(), item)
+		e := estimateResult{Text: result.Text, Model: result.Model, Error: result.Error}
+		switch {
+		case e.Error != "":
+			estimate.Invalid++
+		case isCached(r.Context(), req):
+			e.Cached = true
+			estimate.Cached++
+		default:
+			e.Chars = utf8.RuneCountInString(req.text)
+			estimate.Uncached++
+			if !counted[req.key] {
+				counted[req.key] = true
+				estimate.BillableChars += e.Chars
+			}
+		}
+		estimate.Items[i] = e
+	}
+	estimate.WithinBudget = withinBudget(r.Context(), tenantFrom(r.Context()), estimate.BillableChars)
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(estimate)
+}
+
+func isCached(ctx context.Context, req ttsRequest) bool {
+	_, err := lookupCached(ctx, req)
+	return err == nil
+}
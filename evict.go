@@ -0,0 +1,117 @@
+package wenbuntts
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// With maxCacheBytes set, a background evictor deletes the least recently
+// used cache entries whenever the cache outgrows it, down to 90% of the cap
+// so that it doesn't run again on the very next miss. Sizes and access times
+// come from the cache index, since atime is often disabled on the mount.
+// CACHE_EVICT_POLICY=created evicts the oldest entries instead, however
+// often they are still served.
+var (
+	maxCacheBytes int64
+	evictOldest   bool
+
+	// cacheServing counts in-flight responses per key; those entries are
+	// never evicted.
+	cacheServingMu sync.Mutex
+	cacheServing   = map[string]int{}
+
+	evictTrigger = make(chan struct{}, 1)
+)
+
+// beginServing marks key as in use. The returned function must be called
+// once the response is done.
+func beginServing(key string) (done func()) {
+	cacheServingMu.Lock()
+	cacheServing[key]++
+	cacheServingMu.Unlock()
+
+	return func() {
+		cacheServingMu.Lock()
+		if cacheServing[key]--; cacheServing[key] == 0 {
+			delete(cacheServing, key)
+		}
+		cacheServingMu.Unlock()
+	}
+}
+
+// requestEviction asks the evictor to check the cache size soon.
+func requestEviction() {
+	if maxCacheBytes == 0 {
+		return
+	}
+	select {
+	case evictTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// runEvictor checks the cache after every new file and every interval.
+func runEvictor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-evictTrigger:
+		}
+		if err := evictCache(); err != nil {
+			slog.Error("Cache eviction failed", "error", err)
+		}
+	}
+}
+
+func evictCache() error {
+	ctx := context.Background()
+	var total int64
+	err := cacheIndex.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM entries`).Scan(&total)
+	if err != nil || total <= maxCacheBytes {
+		return err
+	}
+	candidates, err := queryIndex(ctx, indexFilter{oldestFirst: evictOldest})
+	if err != nil {
+		return err
+	}
+
+	target := maxCacheBytes / 10 * 9
+	removed := 0
+	decks := map[string]bool{}
+	for _, c := range candidates {
+		if total <= target {
+			break
+		}
+		cacheServingMu.Lock()
+		serving := cacheServing[c.Key] > 0
+		cacheServingMu.Unlock()
+		if serving {
+			continue
+		}
+		// A request may start after the check above; it then finds the
+		// entry gone and answers 404 rather than sending partial audio.
+		if err := cacheStore.Delete(ctx, c.Key); err != nil {
+			slog.Error("Failed to evict", "key", logPath(c.Key), "error", err)
+			continue
+		}
+		deleteSidecars(ctx, c.Key)
+		if err := indexDelete(ctx, c.Key); err != nil {
+			slog.Error("Failed to drop entry from the cache index", "key", logPath(c.Key), "error", err)
+		}
+		total -= c.Size
+		removed++
+		decks[keyDeck(c.Key)] = true
+	}
+
+	for deck := range decks {
+		if err := pruneDeckManifest(ctx, deck); err != nil {
+			slog.Error("Failed to prune manifest", "deck", deck, "error", err)
+		}
+	}
+	slog.Info("Evicted cache entries", "removed", removed, "cache_bytes", total)
+	return nil
+}
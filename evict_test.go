@@ -0,0 +1,61 @@
+package wenbuntts
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useEmptyCache points the cache at a new directory and index until the test
+// ends.
+func useEmptyCache(t *testing.T) {
+	t.Helper()
+	store, index, dir := cacheStore, cacheIndex, outputDir
+	outputDir = t.TempDir()
+	cacheStore = diskStorage{outputDir}
+	if err := openCacheIndex(filepath.Join(outputDir, "index.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cacheIndex.Close()
+		cacheStore, cacheIndex, outputDir = store, index, dir
+	})
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	t.Cleanup(func() { maxCacheBytes, evictOldest = 0, false })
+	for _, tt := range []struct {
+		oldest        bool
+		kept, evicted string
+	}{
+		// 旧 was generated first but is still served, 新 was not served
+		// since it was generated.
+		{false, "旧", "新"},
+		{true, "新", "旧"},
+	} {
+		useEmptyCache(t)
+		old := getMetadata(t, url.Values{"text": {"旧"}})
+		time.Sleep(time.Millisecond)
+		getMetadata(t, url.Values{"text": {"新"}})
+		time.Sleep(time.Millisecond)
+		getMetadata(t, url.Values{"text": {"旧"}})
+
+		// Room for one of the two.
+		maxCacheBytes, evictOldest = 2*old.Bytes-1, tt.oldest
+		if err := evictCache(); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := queryIndex(context.Background(), indexFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Text != tt.kept {
+			t.Errorf("oldest first %v: kept %+v, want only %s", tt.oldest, entries, tt.kept)
+		}
+		if meta := getMetadata(t, url.Values{"text": {tt.evicted}}); meta.CacheHit {
+			t.Errorf("oldest first %v: %s was not evicted", tt.oldest, tt.evicted)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// cacheTTL, when set, makes entries older than it count as missing, so they
+// are synthesized again on their next request and pick up voice updates.
+var cacheTTL time.Duration
+
+var errCacheExpired = errors.New("cache entry expired")
+
+// statCached stats a cache entry in cacheStore, failing with errCacheExpired
+// if it is older than cacheTTL and, with verifyOnServe, with
+// errChecksumMismatch if it is corrupt.
+func statCached(ctx context.Context, key string) (objectInfo, error) {
+	info, err := cacheStore.Stat(ctx, key)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	if cacheTTL > 0 && time.Since(info.ModTime) > cacheTTL {
+		return objectInfo{}, errCacheExpired
+	}
+	if verifyOnServe {
+		data, _, err := cacheStore.Get(ctx, key)
+		if err == nil {
+			err = verifyClip(ctx, key, data)
+		}
+		if errors.Is(err, errChecksumMismatch) {
+			logger(ctx).Warn("Cache entry failed verification", "key", logPath(key))
+		}
+		if err != nil {
+			return objectInfo{}, err
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,253 @@
+package wenbuntts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// A cache export is a tar.gz of every clip, timing sidecar and deck
+// manifest under its storage key, led by exportIndexName with the cache
+// index rows as JSON lines. Importing it on another instance keeps the keys,
+// so the same requests hit the imported clips there.
+const exportIndexName = "index.jsonl"
+
+// maxImportMember bounds a single member of an imported archive.
+const maxImportMember = 64 << 20
+
+// exportContents returns the index rows and the keys of the objects an
+// export of the whole cache holds.
+func exportContents(ctx context.Context) ([]indexEntry, []string, error) {
+	entries, err := queryIndex(ctx, indexFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []string
+	err = cacheStore.List(ctx, func(obj objectInfo) error {
+		if exportKind(obj.Key) != "" {
+			keys = append(keys, obj.Key)
+		}
+		return nil
+	})
+	return entries, keys, err
+}
+
+// writeExport writes entries and the objects under keys to w as a tar.gz.
+func writeExport(ctx context.Context, w io.Writer, entries []indexEntry, keys []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	var index bytes.Buffer
+	enc := json.NewEncoder(&index)
+	enc.SetEscapeHTML(false)
+	for _, e := range entries {
+		enc.Encode(e)
+	}
+	err := tw.WriteHeader(&tar.Header{Name: exportIndexName, Mode: 0644, Size: int64(index.Len()), ModTime: time.Now()})
+	if err == nil {
+		_, err = tw.Write(index.Bytes())
+	}
+	for _, key := range keys {
+		if err != nil {
+			break
+		}
+		err = writeTarFile(ctx, tw, key, key)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Evicted or purged since it was listed.
+			err = nil
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	if err == nil {
+		slog.Info("Exported cache", "files", len(keys), "indexed", len(entries))
+	}
+	return err
+}
+
+// exportKind tells what the object under key is to an export: "clip",
+// "sidecar" or "manifest", or "" for anything else, such as the index
+// database when it lives in OUTPUT_DIR.
+func exportKind(key string) string {
+	switch {
+	case path.Base(key) == manifestName:
+		if validCacheKey(path.Join(path.Dir(key), "clip.mp3")) {
+			return "manifest"
+		}
+	case strings.HasSuffix(key, ".timing.json"):
+		if validCacheKey(strings.TrimSuffix(key, ".timing.json") + ".mp3") {
+			return "sidecar"
+		}
+	case validCacheKey(key):
+		return "clip"
+	}
+	return ""
+}
+
+// importReport counts what an import did with the archive's clips.
+type importReport struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"` // already cached
+	Corrupt  int `json:"corrupt"` // not matching their indexed checksum
+}
+
+// importCache stores the clips, sidecars and manifests of an export read
+// from r. Clips already cached are kept unless overwrite is set; manifests
+// are merged into the ones there.
+func importCache(ctx context.Context, r io.Reader, overwrite bool) (importReport, error) {
+	var report importReport
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return report, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	tr := tar.NewReader(gr)
+	entries := map[string]indexEntry{}
+	var imported []string
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return report, err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size > maxImportMember {
+			continue
+		}
+		key := hdr.Name
+		kind := exportKind(key)
+		if key != exportIndexName && kind == "" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return report, err
+		}
+
+		switch kind {
+		case "":
+			dec := json.NewDecoder(bytes.NewReader(data))
+			for {
+				var e indexEntry
+				if err := dec.Decode(&e); err != nil {
+					break
+				}
+				if validCacheKey(e.Key) {
+					entries[e.Key] = e
+				}
+			}
+		case "manifest":
+			var m deckManifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return report, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			if err := mergeDeckManifest(ctx, key, m); err != nil {
+				return report, err
+			}
+		case "sidecar", "clip":
+			if _, err := cacheStore.Stat(ctx, key); err == nil && !overwrite {
+				if kind == "clip" {
+					report.Skipped++
+				}
+				continue
+			}
+			if e, ok := entries[key]; ok && kind == "clip" && e.ContentHash != "" && e.ContentHash != contentHash(data) {
+				slog.Warn("Skipped corrupt clip in import", "key", logPath(key))
+				report.Corrupt++
+				continue
+			}
+			if err := cacheStore.Put(ctx, key, data); err != nil {
+				return report, err
+			}
+			if kind == "clip" {
+				imported = append(imported, key)
+				report.Imported++
+			}
+		}
+	}
+
+	for _, key := range imported {
+		if e, ok := entries[key]; ok {
+			if err := indexImport(ctx, e); err != nil {
+				return report, err
+			}
+		}
+	}
+	// Clips the archive didn't index are indexed from their manifests.
+	if err := syncCacheIndex(ctx); err != nil {
+		return report, err
+	}
+	slog.Info("Imported cache", "imported", report.Imported, "skipped", report.Skipped, "corrupt", report.Corrupt)
+	return report, nil
+}
+
+// mergeDeckManifest adds the entries of incoming to the manifest stored
+// under key, replacing those for the same file.
+func mergeDeckManifest(ctx context.Context, key string, incoming deckManifest) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	manifest := deckManifest{Deck: incoming.Deck}
+	if data, _, err := cacheStore.Get(ctx, key); err == nil {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	files := map[string]int{}
+	for i, e := range manifest.Entries {
+		files[e.File] = i
+	}
+	for _, e := range incoming.Entries {
+		if i, ok := files[e.File]; ok {
+			manifest.Entries[i] = e
+		} else {
+			files[e.File] = len(manifest.Entries)
+			manifest.Entries = append(manifest.Entries, e)
+		}
+	}
+	return writeDeckManifest(ctx, key, manifest)
+}
+
+// handleCacheExport streams the whole cache as a tar.gz.
+func handleCacheExport(w http.ResponseWriter, r *http.Request) {
+	entries, keys, err := exportContents(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list the cache: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="cache.tar.gz"`)
+	if err := writeExport(r.Context(), w, entries, keys); err != nil {
+		// The archive is cut short; its missing gzip trailer tells the client.
+		slog.Error("Cache export failed", "error", err)
+	}
+}
+
+// handleCacheImport imports an export posted as the request body, keeping
+// clips already cached unless ?overwrite=true.
+func handleCacheImport(w http.ResponseWriter, r *http.Request) {
+	report, err := importCache(r.Context(), r.Body, r.URL.Query().Get("overwrite") == "true")
+	if err != nil {
+		http.Error(w, "Failed to import cache: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,69 @@
+package wenbuntts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// failureTTL is how long a provider's rejection of a request is remembered,
+// from FAILURE_CACHE_TTL. Until it passes, the same request fails with the
+// same error without calling the provider again, so a client looping on e.g.
+// a voice that doesn't exist can't burn quota.
+var failureTTL time.Duration
+
+var failures = struct {
+	sync.Mutex
+	byKey map[string]*cachedFailure
+}{byKey: map[string]*cachedFailure{}}
+
+// cachedFailure is a remembered rejection, returned in its place.
+type cachedFailure struct {
+	err   error
+	until time.Time
+}
+
+func (f *cachedFailure) Error() string {
+	return fmt.Sprintf("%v (remembered, not retried before %s)", f.err, f.until.UTC().Format(time.RFC3339))
+}
+
+func (f *cachedFailure) Unwrap() error { return f.err }
+
+// isRejection reports whether err is the provider refusing the request
+// itself, which repeating it can't fix. Rate limiting and server errors are
+// left to retries and the upstream health check.
+func isRejection(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.code >= 400 && se.code < 500 && se.code != http.StatusRequestTimeout && se.code != http.StatusTooManyRequests
+}
+
+// rememberFailure records err for key if it is a rejection.
+func rememberFailure(key string, err error) {
+	if !isRejection(err) {
+		return
+	}
+	now := time.Now()
+	failures.Lock()
+	defer failures.Unlock()
+	for k, f := range failures.byKey {
+		if now.After(f.until) {
+			delete(failures.byKey, k)
+		}
+	}
+	failures.byKey[key] = &cachedFailure{err: err, until: now.Add(failureTTL)}
+}
+
+// rememberedFailure returns the unexpired failure recorded for key, or nil.
+func rememberedFailure(key string) error {
+	failures.Lock()
+	defer failures.Unlock()
+	if f, ok := failures.byKey[key]; ok && time.Now().Before(f.until) {
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package wenbuntts
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// filenameTemplate, from FILENAME_TEMPLATE, names cached clips for tools
+// with their own naming rules, e.g. "{{.Text}}-{{.Voice}}-{{.Hash}}". It
+// must use .Hash, which keeps names unique. The extension is added unless
+// the template ends with it. Without a template clips are named by hash.
+var filenameTemplate *template.Template
+
+// filenameFields are what a filenameTemplate can use.
+type filenameFields struct {
+	Text     string // sanitized and truncated, see sanitizeFilename
+	Voice    string
+	Provider string
+	Deck     string
+	Format   string // key of audioFormats, e.g. mp3
+	Hash     string
+}
+
+// parseFilenameTemplate parses and tries out a FILENAME_TEMPLATE value.
+func parseFilenameTemplate(s string) (*template.Template, error) {
+	if !strings.Contains(s, ".Hash") {
+		return nil, errors.New("must use {{.Hash}}")
+	}
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	var name strings.Builder
+	if err := tmpl.Execute(&name, filenameFields{Text: "你好", Voice: builtinVoice, Provider: "google", Format: "mp3", Hash: strings.Repeat("0", 32)}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// cacheFilename names the clip for req whose hash is hash, from
+// filenameTemplate if set.
+func (req ttsRequest) cacheFilename(hash string) string {
+	ext := req.audioFormat().ext
+	if filenameTemplate == nil {
+		return hash + ext
+	}
+	var name strings.Builder
+	err := filenameTemplate.Execute(&name, filenameFields{
+		Text:     sanitizeFilename(req.textKey()),
+		Voice:    req.model,
+		Provider: req.provider.Name(),
+		Deck:     req.deck,
+		Format:   cmp.Or(req.format, defaultFormat),
+		Hash:     hash,
+	})
+	// Rendered names are single path elements like any other.
+	file := strings.NewReplacer("/", "_", `\`, "_").Replace(strings.TrimSpace(name.String()))
+	if err != nil || !strings.Contains(file, hash) {
+		slog.Error("Failed to render FILENAME_TEMPLATE, naming clip by hash", "error", err)
+		return hash + ext
+	}
+	if path.Ext(file) != ext {
+		file += ext
+	}
+	return file
+}
+
+// downloadDisposition returns the Content-Disposition of a /tts response for
+// req: an attachment with ?download=true, which browsers save rather than
+// play, under ?filename= or else the text and voice, e.g.
+// 你好_achernar.mp3. It is "" without either parameter.
+func downloadDisposition(query url.Values, req ttsRequest) (string, error) {
+	download, name := query.Get("download"), query.Get("filename")
+	if download == "" && name == "" {
+		return "", nil
+	}
+	disposition := "inline"
+	switch download {
+	case "", "0", "false":
+	case "1", "true":
+		disposition = "attachment"
+	default:
+		return "", errors.New("Invalid download: must be true or false")
+	}
+	if name == "" {
+		name = sanitizeFilename(req.textKey()) + "_" + voiceLabel(req.model)
+	} else if sanitizeFilename(name) != name || strings.Trim(name, ".") == "" || strings.ContainsFunc(name, unicode.IsControl) {
+		return "", fmt.Errorf("Invalid filename: must be at most %d characters without slashes, backslashes or surrounding spaces", maxFilenameRunes)
+	}
+	ext := req.audioFormat().ext
+	if !strings.EqualFold(path.Ext(name), ext) {
+		name += ext
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": name}), nil
+}
+
+// voiceLabel shortens a voice name for a filename: cmn-CN-Chirp3-HD-Achernar
+// is achernar and cmn-CN-Wavenet-B wavenet-b.
+func voiceLabel(voice string) string {
+	if m := voiceLanguagePattern.FindString(voice); m != "" {
+		voice = voice[len(m):]
+	}
+	parts := strings.Split(strings.ToLower(voice), "-")
+	if last := parts[len(parts)-1]; len(last) > 1 || len(parts) == 1 {
+		return last
+	}
+	return strings.Join(parts[len(parts)-2:], "-")
+}
@@ -0,0 +1,95 @@
+package wenbuntts
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// audioFormat is an output encoding clients can pick with ?format=.
+type audioFormat struct {
+	// encoding is the Google-style audioEncoding handed to providers, which
+	// map it onto their own output format names.
+	encoding    string
+	ext         string
+	contentType string
+	// telephony formats are G.711 at 8 kHz in a WAV container, for IVR
+	// systems. They share .wav with LINEAR16, which the extension alone
+	// stands for.
+	telephony bool
+}
+
+// defaultFormat is the key of audioFormats used without ?format=, from
+// AUDIO_FORMAT.
+var defaultFormat = "mp3"
+
+var audioFormats = map[string]audioFormat{
+	"mp3":   {encoding: "MP3", ext: ".mp3", contentType: "audio/mpeg"},
+	"opus":  {encoding: "OGG_OPUS", ext: ".ogg", contentType: "audio/ogg"},
+	"wav":   {encoding: "LINEAR16", ext: ".wav", contentType: "audio/wav"},
+	"mulaw": {encoding: "MULAW", ext: ".wav", contentType: "audio/wav", telephony: true},
+	"alaw":  {encoding: "ALAW", ext: ".wav", contentType: "audio/wav", telephony: true},
+}
+
+// telephonySampleRate is the sample rate of G.711 audio.
+const telephonySampleRate = 8000
+
+// defaultSampleRate applies to providers that can set one when a request
+// names none, from SAMPLE_RATE_HERTZ. Zero leaves the voice's natural rate.
+var defaultSampleRate int
+
+// parseSampleRate validates a ?sampleRateHertz= or SAMPLE_RATE_HERTZ value.
+func parseSampleRate(v string) (int, error) {
+	rate, err := strconv.Atoi(v)
+	if err != nil || rate < 8000 || rate > 48000 {
+		return 0, errors.New("must be between 8000 and 48000")
+	}
+	return rate, nil
+}
+
+// formatAliases accepts Google's encoding names and the container name for
+// LINEAR16 as ?format= values.
+var formatAliases = map[string]string{
+	"ogg_opus": "opus",
+	"ogg":      "opus",
+	"linear16": "wav",
+	"ulaw":     "mulaw",
+	"pcmu":     "mulaw",
+	"pcma":     "alaw",
+}
+
+// parseFormat resolves a ?format= value, case-insensitively, to a key of
+// audioFormats. An empty value means defaultFormat.
+func parseFormat(v string) (string, bool) {
+	if v == "" {
+		return defaultFormat, true
+	}
+	v = strings.ToLower(v)
+	if alias, ok := formatAliases[v]; ok {
+		v = alias
+	}
+	_, ok := audioFormats[v]
+	return v, ok
+}
+
+// formatKey returns the key of audioFormats with encoding, or "" if none.
+func formatKey(encoding string) string {
+	for name, f := range audioFormats {
+		if f.encoding == encoding {
+			return name
+		}
+	}
+	return ""
+}
+
+// formatForFile returns the format of a cache file from its extension.
+func formatForFile(name string) (audioFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, f := range audioFormats {
+		if f.ext == ext && !f.telephony {
+			return f, true
+		}
+	}
+	return audioFormat{}, false
+}
@@ -0,0 +1,105 @@
+package wenbuntts
+
+import (
+	"context"
+	"sync"
+)
+
+// generation is one in-flight synthesis of a cache entry, shared by every
+// request for that entry that arrives before it finishes.
+type generation struct {
+	done chan struct{}
+	err  error
+	// ready is closed once audio holds the synthesized clip, which may be
+	// before it is cached. It stays open if synthesis fails.
+	ready   chan struct{}
+	audio   []byte
+	waiters int // guarded by generatingMu
+	cancel  context.CancelFunc
+}
+
+var (
+	generatingMu sync.Mutex
+	generating   = map[string]*generation{}
+)
+
+// generateFile synthesizes req and saves it to req.key. Concurrent calls for
+// the same key share a single upstream synthesis, which is only canceled once
+// every caller's ctx is done; one client hanging up doesn't fail the others.
+func generateFile(ctx context.Context, req ttsRequest) error {
+	if err := allowMiss(ctx); err != nil {
+		return err
+	}
+	g := joinGeneration(ctx, req)
+	select {
+	case <-g.done:
+		return g.err
+	case <-ctx.Done():
+		leaveGeneration(req.key, g)
+		return ctx.Err()
+	}
+}
+
+// generateAudio is generateFile, but returns the clip as soon as it is
+// synthesized, while it is still being written to the cache. A failure to
+// cache it is only logged then.
+func generateAudio(ctx context.Context, req ttsRequest) ([]byte, error) {
+	if err := allowMiss(ctx); err != nil {
+		return nil, err
+	}
+	g := joinGeneration(ctx, req)
+	select {
+	case <-g.ready:
+		return g.audio, nil
+	case <-g.done:
+		return g.audio, g.err
+	case <-ctx.Done():
+		leaveGeneration(req.key, g)
+		return nil, ctx.Err()
+	}
+}
+
+// joinGeneration returns the in-flight generation of req.key, starting one
+// if there is none, and counts the caller as one of its waiters.
+func joinGeneration(ctx context.Context, req ttsRequest) *generation {
+	generatingMu.Lock()
+	defer generatingMu.Unlock()
+	g, joined := generating[req.key]
+	if !joined {
+		shared, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		g = &generation{done: make(chan struct{}), ready: make(chan struct{}), cancel: cancel}
+		generating[req.key] = g
+		backgroundWork.Go(func() {
+			g.err = generateAcrossReplicas(shared, req, func(audio []byte) {
+				g.audio = audio
+				close(g.ready)
+			})
+			generatingMu.Lock()
+			if generating[req.key] == g {
+				delete(generating, req.key)
+			}
+			generatingMu.Unlock()
+			cancel()
+			close(g.done)
+		})
+	}
+	g.waiters++
+	if joined {
+		logger(ctx).Info("Waiting for in-flight generation", "key", logPath(req.key))
+	}
+	return g
+}
+
+// leaveGeneration drops a waiter whose ctx is done, canceling g if it was
+// the last one.
+func leaveGeneration(key string, g *generation) {
+	generatingMu.Lock()
+	defer generatingMu.Unlock()
+	if g.waiters--; g.waiters == 0 {
+		// Later requests start afresh instead of joining a canceled run.
+		if generating[key] == g {
+			delete(generating, key)
+		}
+		g.cancel()
+	}
+}
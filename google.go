@@ -0,0 +1,407 @@
+package wenbuntts
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const googleAPIBase = "https://texttospeech.googleapis.com/v1"
+
+// Timepoints are only offered by the beta API.
+const googleBetaAPIBase = "https://texttospeech.googleapis.com/v1beta1"
+
+// googleProvider synthesizes with Google Cloud Text-to-Speech.
+type googleProvider struct {
+	keys *googleKeys
+	// creds replace keys with GOOGLE_AUTH=adc.
+	creds *googleCredentials
+	// effectsProfile is the default effectsProfileId, from
+	// GOOGLE_EFFECTS_PROFILE; empty applies none.
+	effectsProfile string
+}
+
+// googleEffectsProfiles are the device classes Google can tune audio for.
+var googleEffectsProfiles = []string{
+	"wearable-class-device",
+	"handset-class-device",
+	"headphone-class-device",
+	"small-bluetooth-speaker-class-device",
+	"medium-bluetooth-speaker-class-device",
+	"large-home-entertainment-class-device",
+	"large-automotive-class-device",
+	"telephony-class-application",
+}
+
+func newGoogleProvider() (provider, error) {
+	p := &googleProvider{}
+	switch setting("GOOGLE_AUTH") {
+	case "", "apikey":
+		rotation := setting("GOOGLE_KEY_ROTATION")
+		if rotation != "" && rotation != "round-robin" && rotation != "failover" {
+			return nil, fmt.Errorf("invalid GOOGLE_KEY_ROTATION: must be round-robin or failover")
+		}
+		p.keys = newGoogleKeys(rotation, envDuration("GOOGLE_KEY_COOLDOWN", time.Minute))
+		if len(p.keys.list()) == 0 {
+			return nil, fmt.Errorf("%w: missing GOOGLE_API_KEY in .env", errNotConfigured)
+		}
+		googleKeyPool = p.keys
+	case "adc":
+		creds, err := newGoogleCredentials()
+		if err != nil {
+			return nil, err
+		}
+		p.creds = creds
+	default:
+		return nil, fmt.Errorf("invalid GOOGLE_AUTH: must be apikey or adc")
+	}
+	profile := setting("GOOGLE_EFFECTS_PROFILE")
+	if profile != "" && !slices.Contains(googleEffectsProfiles, profile) {
+		return nil, fmt.Errorf("invalid GOOGLE_EFFECTS_PROFILE: must be one of %s", strings.Join(googleEffectsProfiles, ", "))
+	}
+	p.effectsProfile = profile
+	return p, nil
+}
+
+func (p *googleProvider) Name() string { return "google" }
+
+// authorize adds an access token, or else key, to req.
+func (p *googleProvider) authorize(req *http.Request, key string) error {
+	if p.creds != nil {
+		return p.creds.authorize(req)
+	}
+	q := req.URL.Query()
+	q.Set("key", key)
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+func (p *googleProvider) DefaultVoice() string {
+	s := current()
+	return cmp.Or(s.ruleFor(s.language).defaultVoice, s.voice)
+}
+
+func (p *googleProvider) DefaultVoiceFor(language string) (string, bool) {
+	rule, ok := current().rules[language]
+	return rule.defaultVoice, ok && rule.defaultVoice != ""
+}
+
+func (p *googleProvider) AllowedVoices() []string { return allowedModelNames() }
+
+func (p *googleProvider) SpeaksSSML() bool { return true }
+
+func (p *googleProvider) SetsSampleRate() bool { return true }
+
+// googlePhoneticEncodings maps ?phoneticEncoding= onto Google's names.
+var googlePhoneticEncodings = map[string]string{
+	"pinyin":            "PHONETIC_ENCODING_PINYIN",
+	"ipa":               "PHONETIC_ENCODING_IPA",
+	"x-sampa":           "PHONETIC_ENCODING_X_SAMPA",
+	"japanese-yomigana": "PHONETIC_ENCODING_JAPANESE_YOMIGANA",
+}
+
+// defaultEffectsProfile is the effectsProfileId used without
+// ?effectsProfileId=: telephony-class-application for G.711 output, else
+// GOOGLE_EFFECTS_PROFILE.
+func (p *googleProvider) defaultEffectsProfile(encoding string) string {
+	if encoding == "MULAW" || encoding == "ALAW" {
+		return "telephony-class-application"
+	}
+	return p.effectsProfile
+}
+
+// ParseOptions reads ?effectsProfileId=, overriding defaultEffectsProfile,
+// and ?customPronunciations=phrase:reading,... in the ?phoneticEncoding=
+// (default pinyin) they are written in.
+func (p *googleProvider) ParseOptions(q url.Values) (map[string]string, error) {
+	options := map[string]string{}
+	format, _ := parseFormat(q.Get("format"))
+	if v := q.Get("effectsProfileId"); v != "" && v != p.defaultEffectsProfile(audioFormats[format].encoding) {
+		if !slices.Contains(googleEffectsProfiles, v) {
+			return nil, fmt.Errorf("Invalid effectsProfileId: must be one of %s", strings.Join(googleEffectsProfiles, ", "))
+		}
+		options["effectsProfileId"] = v
+	}
+	if v := q.Get("customPronunciations"); v != "" {
+		if _, err := parseGooglePronunciations(v, "PHONETIC_ENCODING_PINYIN"); err != nil {
+			return nil, err
+		}
+		options["customPronunciations"] = v
+		encoding := cmp.Or(q.Get("phoneticEncoding"), "pinyin")
+		if _, ok := googlePhoneticEncodings[encoding]; !ok {
+			return nil, fmt.Errorf("Invalid phoneticEncoding: must be pinyin, ipa, x-sampa or japanese-yomigana")
+		}
+		if encoding != "pinyin" {
+			options["phoneticEncoding"] = encoding
+		}
+	}
+	return options, nil
+}
+
+func parseGooglePronunciations(v, encoding string) ([]googlePronunciation, error) {
+	var out []googlePronunciation
+	for _, item := range strings.Split(v, ",") {
+		phrase, reading, ok := strings.Cut(item, ":")
+		if phrase, reading = strings.TrimSpace(phrase), strings.TrimSpace(reading); !ok || phrase == "" || reading == "" {
+			return nil, fmt.Errorf("Invalid customPronunciations: must be phrase:reading pairs separated by commas")
+		}
+		out = append(out, googlePronunciation{Phrase: phrase, PhoneticEncoding: encoding, Pronunciation: reading})
+	}
+	return out, nil
+}
+
+// googleSynthesizeRequest is the body of text:synthesize.
+type googleSynthesizeRequest struct {
+	Input              googleInput       `json:"input"`
+	Voice              googleVoice       `json:"voice"`
+	AudioConfig        googleAudioConfig `json:"audioConfig"`
+	EnableTimePointing []string          `json:"enableTimePointing,omitempty"`
+}
+
+type googleInput struct {
+	Text string `json:"text,omitempty"`
+	SSML string `json:"ssml,omitempty"`
+	// CustomPronunciations only apply to text input.
+	CustomPronunciations *googleCustomPronunciations `json:"customPronunciations,omitempty"`
+}
+
+type googleCustomPronunciations struct {
+	Pronunciations []googlePronunciation `json:"pronunciations"`
+}
+
+type googlePronunciation struct {
+	Phrase           string `json:"phrase"`
+	PhoneticEncoding string `json:"phoneticEncoding"`
+	Pronunciation    string `json:"pronunciation"`
+}
+
+type googleVoice struct {
+	LanguageCode string `json:"languageCode"`
+	Name         string `json:"name"`
+}
+
+type googleAudioConfig struct {
+	AudioEncoding    string   `json:"audioEncoding"`
+	SpeakingRate     float64  `json:"speakingRate"`
+	Pitch            float64  `json:"pitch"`
+	VolumeGainDb     float64  `json:"volumeGainDb"`
+	SampleRateHertz  int      `json:"sampleRateHertz,omitempty"`
+	EffectsProfileID []string `json:"effectsProfileId,omitempty"`
+}
+
+// payload returns the text:synthesize body for req, speaking input instead
+// of req's own text or SSML.
+func (p *googleProvider) payload(req synthesisRequest, input googleInput) googleSynthesizeRequest {
+	body := googleSynthesizeRequest{
+		Input: input,
+		Voice: googleVoice{LanguageCode: req.Language, Name: req.Voice},
+		AudioConfig: googleAudioConfig{
+			AudioEncoding:   req.AudioEncoding,
+			SpeakingRate:    req.SpeakingRate,
+			Pitch:           req.Pitch,
+			VolumeGainDb:    req.VolumeGainDb,
+			SampleRateHertz: req.SampleRateHertz,
+		},
+	}
+	if profile := cmp.Or(req.Options["effectsProfileId"], p.defaultEffectsProfile(req.AudioEncoding)); profile != "" {
+		body.AudioConfig.EffectsProfileID = []string{profile}
+	}
+	if v := req.Options["customPronunciations"]; v != "" && input.SSML == "" {
+		encoding := googlePhoneticEncodings[cmp.Or(req.Options["phoneticEncoding"], "pinyin")]
+		// Options were validated by ParseOptions.
+		pronunciations, _ := parseGooglePronunciations(v, encoding)
+		body.Input.CustomPronunciations = &googleCustomPronunciations{pronunciations}
+	}
+	return body
+}
+
+func (p *googleProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	input := googleInput{Text: req.Text}
+	if req.SSML != "" {
+		input = googleInput{SSML: "<speak>" + req.SSML + "</speak>"}
+	}
+
+	var result struct {
+		AudioContent string `json:"audioContent"`
+	}
+	if err := p.synthesize(ctx, googleAPIBase, p.payload(req, input), &result); err != nil {
+		return nil, err
+	}
+	return decodeGoogleAudio(result.AudioContent)
+}
+
+// SynthesizeTimed speaks req.Text with a <mark> before each character and
+// returns when each one starts.
+func (p *googleProvider) SynthesizeTimed(ctx context.Context, req synthesisRequest) ([]byte, []time.Duration, error) {
+	chars := []rune(req.Text)
+	var ssml strings.Builder
+	ssml.WriteString("<speak>")
+	for i, c := range chars {
+		fmt.Fprintf(&ssml, `<mark name="%d"/>`, i)
+		xml.EscapeText(&ssml, []byte(string(c)))
+	}
+	ssml.WriteString("</speak>")
+	payload := p.payload(req, googleInput{SSML: ssml.String()})
+	payload.EnableTimePointing = []string{"SSML_MARK"}
+
+	var result struct {
+		AudioContent string `json:"audioContent"`
+		Timepoints   []struct {
+			MarkName    string  `json:"markName"`
+			TimeSeconds float64 `json:"timeSeconds"`
+		} `json:"timepoints"`
+	}
+	if err := p.synthesize(ctx, googleBetaAPIBase, payload, &result); err != nil {
+		return nil, nil, err
+	}
+	audio, err := decodeGoogleAudio(result.AudioContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Marks the voice skipped (e.g. silent punctuation) start with the
+	// character after them, or at the end with the one before.
+	offsets := make([]time.Duration, len(chars))
+	found := make([]bool, len(chars))
+	for _, tp := range result.Timepoints {
+		if i, err := strconv.Atoi(tp.MarkName); err == nil && i >= 0 && i < len(chars) {
+			offsets[i], found[i] = time.Duration(tp.TimeSeconds*float64(time.Second)), true
+		}
+	}
+	for i := len(chars) - 2; i >= 0; i-- {
+		if !found[i] && found[i+1] {
+			offsets[i], found[i] = offsets[i+1], true
+		}
+	}
+	for i := 1; i < len(chars); i++ {
+		if !found[i] {
+			offsets[i] = offsets[i-1]
+		}
+	}
+	return audio, offsets, nil
+}
+
+// synthesize posts body to base's text:synthesize and decodes the response
+// into result. A key out of quota hands over to the next one, see
+// googleKeys.
+func (p *googleProvider) synthesize(ctx context.Context, base string, body googleSynthesizeRequest, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	payload := string(data)
+	chars := utf8.RuneCountInString(body.Input.Text + body.Input.SSML)
+	auditSynthesis(ctx, payload)
+	if p.creds != nil {
+		_, err := p.post(ctx, base, payload, "", result)
+		return err
+	}
+	err = fmt.Errorf("%w: missing GOOGLE_API_KEY", errNotConfigured)
+	for _, key := range p.keys.order() {
+		var status int
+		status, err = p.post(ctx, base, payload, key, result)
+		p.keys.record(key, chars, status)
+		if status != http.StatusTooManyRequests {
+			break
+		}
+	}
+	return err
+}
+
+// post makes one text:synthesize request and returns its status, or 0 when
+// there was no response.
+func (p *googleProvider) post(ctx context.Context, base, payload, key string, result any) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/text:synthesize", strings.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	if err := p.authorize(httpReq, key); err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := upstreamClient.Do(httpReq)
+	if err != nil {
+		// url.Error would print the URL, which carries the API key.
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return 0, fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	// log.Printf("Response body: %s", string(body)) // debug print
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, newStatusError(resp, body)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return resp.StatusCode, fmt.Errorf("Failed to parse response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+func decodeGoogleAudio(content string) ([]byte, error) {
+	if content == "" {
+		return nil, fmt.Errorf("No audio content in response")
+	}
+	audio, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode audio: %w", err)
+	}
+	return audio, nil
+}
+
+func (p *googleProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	q := url.Values{}
+	if language != "" {
+		q.Set("languageCode", language)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleAPIBase+"/voices?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	if p.creds == nil {
+		if keys := p.keys.order(); len(keys) > 0 {
+			key = keys[0]
+		}
+	}
+	if err := p.authorize(req, key); err != nil {
+		return nil, err
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("voices request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("voices request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Voices []struct {
+			Name                   string   `json:"name"`
+			LanguageCodes          []string `json:"languageCodes"`
+			SsmlGender             string   `json:"ssmlGender"`
+			NaturalSampleRateHertz int      `json:"naturalSampleRateHertz"`
+		} `json:"voices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse voices: %w", err)
+	}
+	voices := make([]voiceInfo, len(result.Voices))
+	for i, v := range result.Voices {
+		voices[i] = voiceInfo{Name: v.Name, LanguageCodes: v.LanguageCodes, Gender: v.SsmlGender, NaturalSampleRate: v.NaturalSampleRateHertz}
+	}
+	return voices, nil
+}
@@ -0,0 +1,101 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoogleTelephonyPayload(t *testing.T) {
+	p := &googleProvider{effectsProfile: "headphone-class-device"}
+	for _, tt := range []struct {
+		query    url.Values
+		encoding string
+		rate     int
+		profile  string
+	}{
+		{url.Values{"format": {"mulaw"}}, "MULAW", 8000, "telephony-class-application"},
+		{url.Values{"format": {"alaw"}}, "ALAW", 8000, "telephony-class-application"},
+		{url.Values{"format": {"mulaw"}, "effectsProfileId": {"handset-class-device"}}, "MULAW", 8000, "handset-class-device"},
+		{url.Values{"format": {"mulaw"}, "effectsProfileId": {"headphone-class-device"}}, "MULAW", 8000, "headphone-class-device"},
+		{url.Values{"format": {"wav"}}, "LINEAR16", 0, "headphone-class-device"},
+	} {
+		options, err := p.ParseOptions(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		format, _ := parseFormat(tt.query.Get("format"))
+		req := ttsRequest{text: "你好", provider: p, model: builtinVoice, format: format, options: options}
+		body := p.payload(synthesisRequest{AudioEncoding: req.audioFormat().encoding, SampleRateHertz: req.sampleRateHertz(), Options: options}, googleInput{Text: req.text})
+		config := body.AudioConfig
+		if config.AudioEncoding != tt.encoding {
+			t.Errorf("%s: audioEncoding %s, want %s", tt.query.Encode(), config.AudioEncoding, tt.encoding)
+		}
+		if config.SampleRateHertz != tt.rate {
+			t.Errorf("%s: sampleRateHertz %d, want %d", tt.query.Encode(), config.SampleRateHertz, tt.rate)
+		}
+		if len(config.EffectsProfileID) != 1 || config.EffectsProfileID[0] != tt.profile {
+			t.Errorf("%s: effectsProfileId %v, want %s", tt.query.Encode(), config.EffectsProfileID, tt.profile)
+		}
+	}
+}
+
+// TestGoogleAudit synthesizes against a stand-in for the Google API with
+// AUDIT_LOG set, and checks the record it leaves.
+func TestGoogleAudit(t *testing.T) {
+	const key = "audit-test-key"
+	t.Setenv("GOOGLE_API_KEY", key)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != key {
+			http.Error(w, "no key", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"audioContent": "AAAA"}`))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := openAuditLog(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		auditFile.Close()
+		auditFile = nil
+	})
+
+	p := &googleProvider{keys: newGoogleKeys("", 0)}
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "audit-request")
+	body := p.payload(synthesisRequest{Language: "cmn-CN", Voice: builtinVoice, AudioEncoding: "MP3", SpeakingRate: 0.8}, googleInput{Text: "你好"})
+	var result struct{}
+	if err := p.synthesize(ctx, upstream.URL, body, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(key)) {
+		t.Errorf("audit log holds the API key: %s", data)
+	}
+	var record auditRecord
+	if err := json.Unmarshal(data, &record); err != nil || bytes.Count(data, []byte("\n")) != 1 {
+		t.Fatalf("audit log %q, want one JSON line: %v", data, err)
+	}
+	if record.Time.IsZero() || record.RequestID != "audit-request" {
+		t.Errorf("audit record at %v for %q", record.Time, record.RequestID)
+	}
+	var sent googleSynthesizeRequest
+	if err := json.Unmarshal(record.Request, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Input.Text != "你好" || sent.Voice != body.Voice || sent.AudioConfig.AudioEncoding != "MP3" || sent.AudioConfig.SpeakingRate != 0.8 {
+		t.Errorf("audited request %+v, want %+v", sent, body)
+	}
+}
@@ -0,0 +1,217 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURL  = "https://oauth2.googleapis.com/token"
+	googleAuthScope = "https://www.googleapis.com/auth/cloud-platform"
+	// googleMetadataToken is where GCE, Cloud Run and GKE hand out tokens
+	// for the workload's service account.
+	googleMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// googleCredentials are Application Default Credentials: a service account
+// key or gcloud user credentials read from a JSON file, or else the metadata
+// server. Access tokens are fetched on first use and refreshed shortly
+// before they expire.
+type googleCredentials struct {
+	file googleCredentialsFile // zero for the metadata server
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// googleCredentialsFile is the JSON of a service account key
+// ("service_account") or of `gcloud auth application-default login`
+// ("authorized_user").
+type googleCredentialsFile struct {
+	Type           string `json:"type"`
+	ClientEmail    string `json:"client_email"`
+	PrivateKeyID   string `json:"private_key_id"`
+	PrivateKey     string `json:"private_key"`
+	TokenURI       string `json:"token_uri"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id"`
+
+	key *rsa.PrivateKey
+}
+
+// newGoogleCredentials finds credentials the way Google's client libraries
+// do: GOOGLE_APPLICATION_CREDENTIALS, then gcloud's well-known file, then
+// the metadata server.
+func newGoogleCredentials() (*googleCredentials, error) {
+	file := setting("GOOGLE_APPLICATION_CREDENTIALS")
+	if file == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			wellKnown := filepath.Join(dir, "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(wellKnown); err == nil {
+				file = wellKnown
+			}
+		}
+	}
+	if file == "" {
+		return &googleCredentials{}, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Google credentials: %w", err)
+	}
+	var f googleCredentialsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse Google credentials %s: %w", file, err)
+	}
+	switch f.Type {
+	case "service_account":
+		block, _ := pem.Decode([]byte(f.PrivateKey))
+		if block == nil || f.ClientEmail == "" {
+			return nil, fmt.Errorf("invalid service account key %s: missing client_email or private_key", file)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account key %s: %w", file, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("invalid service account key %s: not an RSA key", file)
+		}
+		f.key = rsaKey
+	case "authorized_user":
+		if f.RefreshToken == "" || f.ClientID == "" {
+			return nil, fmt.Errorf("invalid Google user credentials %s: missing refresh_token or client_id", file)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s", f.Type, file)
+	}
+	if f.TokenURI == "" {
+		f.TokenURI = googleTokenURL
+	}
+	return &googleCredentials{file: f}, nil
+}
+
+// authorize adds a bearer token, and the quota project user credentials
+// bill to, to req.
+func (c *googleCredentials) authorize(req *http.Request) error {
+	token, err := c.accessToken(req.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get Google access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if c.file.QuotaProjectID != "" {
+		req.Header.Set("X-Goog-User-Project", c.file.QuotaProjectID)
+	}
+	return nil
+}
+
+func (c *googleCredentials) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Refresh early, so a token can't expire between here and Google.
+	if c.token != "" && time.Until(c.expires) > time.Minute {
+		return c.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	switch c.file.Type {
+	case "service_account":
+		var assertion string
+		assertion, err = c.file.assertion(time.Now())
+		if err == nil {
+			req, err = tokenRequest(ctx, c.file.TokenURI, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+		}
+	case "authorized_user":
+		req, err = tokenRequest(ctx, c.file.TokenURI, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {c.file.RefreshToken},
+			"client_id":     {c.file.ClientID},
+			"client_secret": {c.file.ClientSecret},
+		})
+	default:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, googleMetadataToken, nil)
+		if err == nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("no access_token in token response")
+	}
+	c.token, c.expires = result.AccessToken, time.Now().Add(time.Duration(result.ExpiresIn)*time.Second)
+	return c.token, nil
+}
+
+func tokenRequest(ctx context.Context, tokenURL string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// assertion returns the signed JWT a service account trades for an access
+// token.
+func (f googleCredentialsFile) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": f.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   f.ClientEmail,
+		"scope": googleAuthScope,
+		"aud":   f.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
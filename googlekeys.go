@@ -0,0 +1,133 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// googleKeys spreads synthesis over GOOGLE_API_KEY and GOOGLE_API_KEYS,
+// e.g. keys of several projects, each with its own quota. With
+// GOOGLE_KEY_ROTATION=round-robin (the default) every synthesis starts at
+// the next key; with failover the first key is used until it runs out of
+// quota. Either way a key answering 429 is rested for GOOGLE_KEY_COOLDOWN
+// and the synthesis moves on to the next one.
+type googleKeys struct {
+	failover bool
+	cooldown time.Duration
+	next     atomic.Uint64
+
+	mu    sync.Mutex
+	usage map[string]*googleKeyUsage // by key
+}
+
+// googleKeyUsage accounts for one key, as reported by /stats/keys.
+type googleKeyUsage struct {
+	Key         string    `json:"key"` // the last 4 characters, see keyLabel
+	Requests    int64     `json:"requests"`
+	Characters  int64     `json:"characters"`
+	QuotaErrors int64     `json:"quotaErrors"`
+	Errors      int64     `json:"errors"`
+	RestedUntil time.Time `json:"restedUntil,omitzero"`
+}
+
+// googleKeyPool is the google provider's googleKeys, for /stats/keys; nil
+// without that provider or with GOOGLE_AUTH=adc.
+var googleKeyPool *googleKeys
+
+func newGoogleKeys(rotation string, cooldown time.Duration) *googleKeys {
+	return &googleKeys{failover: rotation == "failover", cooldown: cooldown, usage: map[string]*googleKeyUsage{}}
+}
+
+// list returns the configured keys. They are read on every use, so rotated
+// secrets take effect, see secretSetting.
+func (k *googleKeys) list() []string {
+	var keys []string
+	if key := setting("GOOGLE_API_KEY"); key != "" {
+		keys = append(keys, key)
+	}
+	for _, key := range splitList(setting("GOOGLE_API_KEYS")) {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// order returns the keys in the order a synthesis should try them: from the
+// rotation's starting point on, with rested keys last.
+func (k *googleKeys) order() []string {
+	keys := k.list()
+	if len(keys) == 0 {
+		return nil
+	}
+	start := 0
+	if !k.failover {
+		start = int((k.next.Add(1) - 1) % uint64(len(keys)))
+	}
+	keys = append(keys[start:], keys[:start]...)
+
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var ready, rested []string
+	for _, key := range keys {
+		if u := k.usage[key]; u != nil && now.Before(u.RestedUntil) {
+			rested = append(rested, key)
+		} else {
+			ready = append(ready, key)
+		}
+	}
+	return append(ready, rested...)
+}
+
+// record accounts for a request made with key that sent chars characters
+// and got status (0 for no response).
+func (k *googleKeys) record(key string, chars, status int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	u := k.usage[key]
+	if u == nil {
+		u = &googleKeyUsage{Key: keyLabel(key)}
+		k.usage[key] = u
+	}
+	u.Requests++
+	switch {
+	case status == http.StatusOK:
+		u.Characters += int64(chars)
+	case status == http.StatusTooManyRequests:
+		u.QuotaErrors++
+		u.RestedUntil = time.Now().Add(k.cooldown)
+	default:
+		u.Errors++
+	}
+}
+
+// keyLabel identifies key in reports without revealing it.
+func keyLabel(key string) string {
+	if len(key) <= 8 {
+		return "…"
+	}
+	return "…" + key[len(key)-4:]
+}
+
+// handleStatsKeys reports the usage of each Google API key since startup.
+func handleStatsKeys(w http.ResponseWriter, r *http.Request) {
+	usage := []googleKeyUsage{}
+	if googleKeyPool != nil {
+		googleKeyPool.mu.Lock()
+		for _, key := range googleKeyPool.list() {
+			u := googleKeyUsage{Key: keyLabel(key)}
+			if recorded := googleKeyPool.usage[key]; recorded != nil {
+				u = *recorded
+			}
+			usage = append(usage, u)
+		}
+		googleKeyPool.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
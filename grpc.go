@@ -0,0 +1,336 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/ray-pH/wenbun-tts-generator/wenbunttspb"
+)
+
+//go:generate protoc --go_out=wenbunttspb --go_opt=paths=source_relative --go-grpc_out=wenbunttspb --go-grpc_opt=paths=source_relative wenbuntts.proto
+
+// startGRPC serves the gRPC API of wenbuntts.proto on GRPC_PORT, with srv's
+// TLS settings, until srv shuts down. Without GRPC_PORT it does nothing.
+func startGRPC(srv *http.Server) {
+	port := setting("GRPC_PORT")
+	if port == "" {
+		return
+	}
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		fatal(err)
+	}
+	var opts []grpc.ServerOption
+	if srv.TLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(srv.TLSConfig.Clone())))
+	}
+	gs := newGRPCServer(opts...)
+	srv.RegisterOnShutdown(gs.GracefulStop)
+
+	slog.Info("gRPC server running", "port", port)
+	go func() {
+		if err := gs.Serve(lis); err != nil {
+			slog.Error("gRPC server stopped", "error", err)
+		}
+	}()
+}
+
+// newGRPCServer returns a server for the TTS service behind the same
+// checks and limits as the HTTP routes.
+func newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(grpcUnaryAuth, grpcUnaryLimit),
+		grpc.ChainStreamInterceptor(grpcStreamAuth, grpcStreamLimit),
+	)
+	gs := grpc.NewServer(opts...)
+	pb.RegisterTTSServer(gs, grpcServer{})
+	return gs
+}
+
+// grpcServer implements the TTS service.
+type grpcServer struct {
+	pb.UnimplementedTTSServer
+}
+
+func grpcUnaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := grpcAuthorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, tenantStream{ss, ctx})
+}
+
+// tenantStream carries the context grpcAuthorize returned to stream handlers.
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tenantStream) Context() context.Context { return s.ctx }
+
+// grpcClientIP returns the IP address of the client behind ctx, see
+// resolveClientIP, and whether it has a peer at all.
+func grpcClientIP(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var realIP string
+	if v := md.Get("x-real-ip"); len(v) > 0 {
+		realIP = v[0]
+	}
+	return resolveClientIP(p.Addr.String(), md.Get("x-forwarded-for"), realIP), true
+}
+
+// grpcAuthorize applies filterClientIPs' rules to the peer, requireAPIKey's
+// to the request metadata and requireAdmin's to ListCache, and returns ctx
+// with the tenant and any miss marker attached.
+func grpcAuthorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(name string) string {
+		if v := md.Get(name); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	bearer, hasBearer := strings.CutPrefix(first("authorization"), "Bearer ")
+
+	if ip, ok := grpcClientIP(ctx); ok {
+		var admitted bool
+		if ctx, admitted = admitClientIP(ctx, ip); !admitted {
+			return ctx, status.Error(codes.PermissionDenied, "Forbidden")
+		}
+	}
+
+	if method == pb.TTS_ListCache_FullMethodName {
+		if adminToken == "" {
+			return ctx, status.Error(codes.PermissionDenied, "Admin endpoints are disabled")
+		}
+		if !hasBearer || subtle.ConstantTimeCompare([]byte(bearer), []byte(adminToken)) != 1 {
+			return ctx, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		return ctx, nil
+	}
+	if !hasBearer {
+		bearer = first("x-api-key")
+	}
+	if len(apiKeys) > 0 && !validAPIKey(bearer) {
+		return ctx, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	tenant, err := resolveTenant(bearer, first("x-tenant"))
+	if errors.Is(err, errWrongTenant) {
+		return ctx, status.Error(codes.PermissionDenied, err.Error())
+	} else if err != nil {
+		return ctx, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return withTenant(ctx, tenant), nil
+}
+
+func grpcUnaryLimit(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	release, err := grpcLimit(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return handler(ctx, req)
+}
+
+func grpcStreamLimit(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := grpcLimit(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, ss)
+}
+
+// grpcLimit applies the limits of the matching HTTP route to a call of
+// method: limitRate's to all but the admin ListCache, and MAX_INFLIGHT_PER_IP
+// to the calls that synthesize. release ends the call's in-flight count.
+func grpcLimit(ctx context.Context, method string) (release func(), err error) {
+	release = func() {}
+	if method == pb.TTS_ListCache_FullMethodName {
+		return release, nil
+	}
+	ip, _ := grpcClientIP(ctx)
+	s := current()
+	if s.rateLimitPerMinute > 0 {
+		if ok, wait := takeClientToken(ctx, s, ip, time.Now()); !ok {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+			return nil, status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+		}
+	}
+	if method == pb.TTS_ListVoices_FullMethodName {
+		return release, nil
+	}
+	release, ok := enterInflight(s, ip)
+	if !ok {
+		return nil, status.Error(codes.ResourceExhausted, "Too many concurrent requests")
+	}
+	return release, nil
+}
+
+// grpcStatus turns a synthesis error into a status with the code matching
+// generateErrorStatus.
+func grpcStatus(err error) error {
+	code := codes.Internal
+	switch generateErrorStatus(err) {
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusTooManyRequests, http.StatusPaymentRequired:
+		code = codes.ResourceExhausted
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	}
+	if errors.Is(err, context.Canceled) {
+		code = codes.Canceled
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+// synthesizeItem gets the clip for req through the cache, like
+// batchGenerate; audio is only read with withAudio.
+func synthesizeItem(ctx context.Context, req *pb.SynthesizeRequest, withAudio bool) (*pb.SynthesizeResponse, error) {
+	r, result := batchRequest(ctx, batchItem{Text: req.GetText(), Model: req.GetModel(), Provider: req.GetProvider(), Format: req.GetFormat()})
+	if result.Error != "" {
+		return nil, status.Error(codes.InvalidArgument, result.Error)
+	}
+	hit := isCached(ctx, r)
+	if err := ensureCached(ctx, r); err != nil {
+		return nil, grpcStatus(err)
+	}
+	resp := &pb.SynthesizeResponse{
+		ContentType: r.audioFormat().contentType,
+		CacheHit:    hit,
+		Provider:    r.provider.Name(),
+		Model:       r.model,
+		Key:         r.key,
+	}
+	if withAudio {
+		audio, _, err := cacheStore.Get(ctx, r.key)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to read cache entry: "+err.Error())
+		}
+		resp.Audio = audio
+	}
+	return resp, nil
+}
+
+func (grpcServer) Synthesize(ctx context.Context, req *pb.SynthesizeRequest) (*pb.SynthesizeResponse, error) {
+	return synthesizeItem(ctx, req, true)
+}
+
+func (grpcServer) BatchSynthesize(req *pb.BatchSynthesizeRequest, stream grpc.ServerStreamingServer[pb.BatchSynthesizeResponse]) error {
+	items := req.GetItems()
+	if len(items) == 0 || len(items) > maxBatchItems {
+		return status.Error(codes.InvalidArgument, "Invalid batch: must list between 1 and 1000 items")
+	}
+	for i, item := range items {
+		result, err := synthesizeItem(stream.Context(), item, req.GetIncludeAudio())
+		resp := &pb.BatchSynthesizeResponse{Index: int32(i), Result: result}
+		if err != nil {
+			if stream.Context().Err() != nil {
+				return grpcStatus(err)
+			}
+			resp.Error = status.Convert(err).Message()
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (grpcServer) ListVoices(ctx context.Context, req *pb.ListVoicesRequest) (*pb.ListVoicesResponse, error) {
+	prov, ok := providerFor(req.GetProvider())
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "Invalid provider")
+	}
+	voices, err := listVoices(ctx, prov, req.GetLanguage())
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "Failed to list voices: "+err.Error())
+	}
+	resp := &pb.ListVoicesResponse{}
+	for _, v := range voices {
+		resp.Voices = append(resp.Voices, &pb.Voice{
+			Name:                   v.Name,
+			LanguageCodes:          v.LanguageCodes,
+			Gender:                 v.Gender,
+			NaturalSampleRateHertz: int32(v.NaturalSampleRate),
+			Allowed:                slices.Contains(prov.AllowedVoices(), v.Name),
+		})
+	}
+	return resp, nil
+}
+
+func (grpcServer) ListCache(ctx context.Context, req *pb.ListCacheRequest) (*pb.ListCacheResponse, error) {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = 1000
+	}
+	if limit < 1 || limit > maxCacheListLimit {
+		return nil, status.Error(codes.InvalidArgument, "Invalid limit: must be between 1 and 10000")
+	}
+	entries, err := queryIndex(ctx, indexFilter{deck: req.GetDeck(), voice: req.GetVoice(), prefix: req.GetPrefix(), limit: limit + 1})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to read cache index: "+err.Error())
+	}
+	resp := &pb.ListCacheResponse{}
+	if len(entries) > limit {
+		entries, resp.Truncated = entries[:limit], true
+	}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, &pb.CacheEntry{
+			Key:        e.Key,
+			Deck:       e.Deck,
+			Text:       e.Text,
+			Voice:      e.Voice,
+			Provider:   e.Provider,
+			Encoding:   e.Encoding,
+			Size:       e.Size,
+			Created:    protoTime(e.Created),
+			Hits:       e.Hits,
+			LastAccess: protoTime(e.LastAccess),
+			DurationMs: e.DurationMs,
+		})
+	}
+	return resp, nil
+}
+
+// protoTime converts t to a Timestamp, leaving a zero time unset.
+func protoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
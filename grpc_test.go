@@ -0,0 +1,101 @@
+package wenbuntts
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/ray-pH/wenbun-tts-generator/wenbunttspb"
+)
+
+// grpcClient returns a client of a gRPC server on an in-memory listener,
+// whose calls all come from the client IP "bufconn".
+func grpcClient(t *testing.T) pb.TTSClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := newGRPCServer()
+	go gs.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		gs.Stop()
+	})
+	return pb.NewTTSClient(conn)
+}
+
+func TestGRPCSynthesize(t *testing.T) {
+	client := grpcClient(t)
+	ctx := context.Background()
+
+	resp, err := client.Synthesize(ctx, &pb.SynthesizeRequest{Text: "远程"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetAudio()) == 0 || resp.GetProvider() != "mock" || resp.GetContentType() != "audio/mpeg" {
+		t.Errorf("got %d bytes of %s from %s", len(resp.GetAudio()), resp.GetContentType(), resp.GetProvider())
+	}
+
+	stream, err := client.BatchSynthesize(ctx, &pb.BatchSynthesizeRequest{Items: []*pb.SynthesizeRequest{{Text: "远程"}, {Text: "太长了太长了"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []*pb.BatchSynthesizeResponse
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, r)
+	}
+	if len(results) != 2 || !results[0].GetResult().GetCacheHit() || len(results[0].GetResult().GetAudio()) != 0 || results[1].GetError() == "" {
+		t.Errorf("batch results: %v", results)
+	}
+
+	if _, err := client.ListCache(ctx, &pb.ListCacheRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListCache without ADMIN_TOKEN: %v", err)
+	}
+}
+
+func TestGRPCLimits(t *testing.T) {
+	client := grpcClient(t)
+	ctx := context.Background()
+
+	// A client at MAX_INFLIGHT_PER_IP can't synthesize, but can still
+	// list voices.
+	setSettings(t, func(s *reloadableSettings) { s.maxInflightPerIP = 1 })
+	release, _ := enterInflight(current(), "bufconn")
+	if _, err := client.Synthesize(ctx, &pb.SynthesizeRequest{Text: "并发"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Synthesize at the in-flight cap: %v", err)
+	}
+	if _, err := client.ListVoices(ctx, &pb.ListVoicesRequest{}); err != nil {
+		t.Errorf("ListVoices at the in-flight cap: %v", err)
+	}
+	release()
+
+	setSettings(t, func(s *reloadableSettings) { s.rateLimitPerMinute, s.rateLimitBurst = 1, 1 })
+	t.Cleanup(func() {
+		rateMu.Lock()
+		delete(rateBuckets, "bufconn")
+		rateMu.Unlock()
+	})
+	if _, err := client.Synthesize(ctx, &pb.SynthesizeRequest{Text: "并发"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Synthesize(ctx, &pb.SynthesizeRequest{Text: "并发"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Synthesize over the rate limit: %v", err)
+	}
+}
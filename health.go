@@ -0,0 +1,150 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type healthSlot struct {
+	second   int64
+	ok, fail int
+}
+
+// upstreamHealth keeps per-second upstream success/failure counts over a
+// rolling window, used by /readyz to drain an instance whose upstream is sick.
+type upstreamHealth struct {
+	mu         sync.Mutex
+	slots      []healthSlot
+	threshold  float64
+	minSamples int
+}
+
+func newUpstreamHealth(window time.Duration, threshold float64, minSamples int) *upstreamHealth {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &upstreamHealth{slots: make([]healthSlot, n), threshold: threshold, minSamples: minSamples}
+}
+
+func (h *upstreamHealth) record(t time.Time, ok bool) {
+	second := t.Unix()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	slot := &h.slots[second%int64(len(h.slots))]
+	if slot.second != second {
+		*slot = healthSlot{second: second}
+	}
+	if ok {
+		slot.ok++
+	} else {
+		slot.fail++
+	}
+}
+
+// errorRate returns the failure ratio and sample count within the window ending at now.
+func (h *upstreamHealth) errorRate(now time.Time) (rate float64, samples int) {
+	oldest := now.Unix() - int64(len(h.slots))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fail := 0
+	for _, slot := range h.slots {
+		if slot.second <= oldest || slot.second > now.Unix() {
+			continue
+		}
+		samples += slot.ok + slot.fail
+		fail += slot.fail
+	}
+	if samples == 0 {
+		return 0, 0
+	}
+	return float64(fail) / float64(samples), samples
+}
+
+// healthy reports false once enough samples show an error rate above the threshold.
+// With no recent upstream calls (e.g. serving only from cache) it is healthy.
+func (h *upstreamHealth) healthy(now time.Time) bool {
+	rate, samples := h.errorRate(now)
+	return samples < h.minSamples || rate <= h.threshold
+}
+
+// readyProviderPing makes /readyz also list the default provider's voices,
+// which fails when its credentials are rejected.
+var readyProviderPing bool
+
+// Cache and provider checks are repeated at most every readyCheckInterval,
+// so frequent probes don't turn into a stream of writes and API calls.
+const readyCheckInterval = 10 * time.Second
+
+var (
+	readyCheckMu  sync.Mutex
+	readyCheckAt  time.Time
+	readyCheckErr error
+)
+
+const readyProbeKey = ".readyz"
+
+// checkReady verifies the cache accepts writes and, with readyProviderPing,
+// that the default provider answers.
+func checkReady(ctx context.Context) error {
+	readyCheckMu.Lock()
+	defer readyCheckMu.Unlock()
+	if time.Since(readyCheckAt) < readyCheckInterval {
+		return readyCheckErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	readyCheckErr = nil
+	if err := cacheStore.Put(ctx, readyProbeKey, []byte("ok\n")); err != nil {
+		slog.Warn("Readiness: cache write failed", "error", err)
+		readyCheckErr = errors.New("Cache is not writable")
+	} else if err := cacheStore.Delete(ctx, readyProbeKey); err != nil {
+		slog.Warn("Readiness: cache delete failed", "error", err)
+		readyCheckErr = errors.New("Cache is not writable")
+	} else if readyProviderPing {
+		language := languageFor(defaultProvider.DefaultVoice())
+		if _, err := defaultProvider.Voices(ctx, language); err != nil {
+			// The error may carry the API key in a URL, so it is only logged.
+			slog.Warn("Readiness: provider ping failed", "provider", defaultProvider.Name(), "error", err)
+			readyCheckErr = fmt.Errorf("Provider %s is not answering", defaultProvider.Name())
+		}
+	}
+	readyCheckAt = time.Now()
+	return readyCheckErr
+}
+
+// handleHealthz reports that the process is up, for liveness probes.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the instance should receive traffic: the
+// cache is writable, the provider answers (with readyProviderPing), its
+// circuit breaker is closed or a fallback's is, and the upstream error rate
+// is below the threshold.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := checkReady(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if state, until := breakerFor(defaultProvider).status(); state == breakerOpen && !canFallBack() {
+		http.Error(w, fmt.Sprintf("Circuit breaker for %s is open until %s", defaultProvider.Name(), until.UTC().Format(time.RFC3339)), http.StatusServiceUnavailable)
+		return
+	}
+	rate, samples := upstreamStatus.errorRate(time.Now())
+	if !upstreamStatus.healthy(time.Now()) {
+		http.Error(w, fmt.Sprintf("Upstream error rate %.0f%% over %d requests", rate*100, samples), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
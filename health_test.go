@@ -0,0 +1,56 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamHealthWindow(t *testing.T) {
+	h := newUpstreamHealth(10*time.Second, 0.5, 4)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for range 3 {
+		h.record(start, false)
+	}
+	if !h.healthy(start) {
+		t.Error("unhealthy on 3 samples, fewer than the minimum")
+	}
+	h.record(start.Add(time.Second), false)
+	if h.healthy(start.Add(5 * time.Second)) {
+		t.Error("healthy with 4 of 4 calls failing")
+	}
+	if !h.healthy(start.Add(11 * time.Second)) {
+		t.Error("still unhealthy once the failures left the window")
+	}
+}
+
+// TestReadyzUpstreamErrorRate fails a burst of syntheses, then succeeds as
+// many, and checks that /readyz drains and recovers with them.
+func TestReadyzUpstreamErrorRate(t *testing.T) {
+	saved := upstreamStatus
+	upstreamStatus = newUpstreamHealth(time.Minute, 0.5, 4)
+	t.Cleanup(func() { upstreamStatus = saved })
+
+	ready := func(want int) {
+		t.Helper()
+		if resp, body := get(t, "/readyz", nil); resp.StatusCode != want {
+			t.Fatalf("/readyz: %s %s, want %d", resp.Status, body, want)
+		}
+	}
+	ready(http.StatusOK)
+
+	// The mock provider can't render Ogg Opus.
+	for _, text := range strings.Split("坏一 坏二 坏三 坏四", " ") {
+		if resp, _ := get(t, "/tts", url.Values{"text": {text}, "format": {"ogg"}}); resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("%s: %s, want a failed synthesis", text, resp.Status)
+		}
+	}
+	ready(http.StatusServiceUnavailable)
+
+	for _, text := range strings.Split("好一 好二 好三 好四", " ") {
+		getMetadata(t, url.Values{"text": {text}})
+	}
+	ready(http.StatusOK)
+}
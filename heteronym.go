@@ -0,0 +1,148 @@
+package wenbuntts
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"unicode/utf8"
+)
+
+// heteronymChars lists common 多音字 with their readings in the numbered
+// notation of numberedPinyin, the default reading first.
+var heteronymChars = map[rune][]string{
+	'行': {"xing2", "hang2"},
+	'长': {"chang2", "zhang3"},
+	'了': {"le5", "liao3"},
+	'的': {"de5", "di2", "di4"},
+	'得': {"de5", "de2", "dei3"},
+	'地': {"di4", "de5"},
+	'还': {"hai2", "huan2"},
+	'重': {"zhong4", "chong2"},
+	'只': {"zhi3", "zhi1"},
+	'为': {"wei4", "wei2"},
+	'都': {"dou1", "du1"},
+	'和': {"he2", "he4", "huo2", "huo4", "hu2"},
+	'乐': {"le4", "yue4"},
+	'好': {"hao3", "hao4"},
+	'看': {"kan4", "kan1"},
+	'要': {"yao4", "yao1"},
+	'数': {"shu4", "shu3"},
+	'便': {"bian4", "pian2"},
+	'教': {"jiao4", "jiao1"},
+	'觉': {"jue2", "jiao4"},
+	'调': {"diao4", "tiao2"},
+	'传': {"chuan2", "zhuan4"},
+	'种': {"zhong3", "zhong4"},
+	'发': {"fa1", "fa4"},
+	'差': {"cha4", "cha1", "chai1", "ci1"},
+	'少': {"shao3", "shao4"},
+	'空': {"kong1", "kong4"},
+	'处': {"chu4", "chu3"},
+	'分': {"fen1", "fen4"},
+	'难': {"nan2", "nan4"},
+	'相': {"xiang1", "xiang4"},
+	'省': {"sheng3", "xing3"},
+	'着': {"zhe5", "zhao2", "zhuo2"},
+	'大': {"da4", "dai4"},
+	'会': {"hui4", "kuai4"},
+	'量': {"liang4", "liang2"},
+	'背': {"bei4", "bei1"},
+	'担': {"dan1", "dan4"},
+	'血': {"xue4", "xie3"},
+	'朝': {"chao2", "zhao1"},
+}
+
+// heteronymWords are words whose context settles the reading of a 多音字.
+var heteronymWords = map[string]string{
+	"银行": "yin2 hang2",
+	"行业": "hang2 ye4",
+	"长大": "zhang3 da4",
+	"校长": "xiao4 zhang3",
+	"音乐": "yin1 yue4",
+	"快乐": "kuai4 le4",
+	"还是": "hai2 shi4",
+	"还书": "huan2 shu1",
+	"重要": "zhong4 yao4",
+	"重新": "chong2 xin1",
+	"觉得": "jue2 de5",
+	"睡觉": "shui4 jiao4",
+	"会计": "kuai4 ji4",
+	"数学": "shu4 xue2",
+	"教书": "jiao1 shu1",
+	"便宜": "pian2 yi5",
+	"方便": "fang1 bian4",
+	"朝鲜": "chao2 xian3",
+	"早朝": "zao3 chao2",
+	"大夫": "dai4 fu5",
+}
+
+var (
+	// heteronymMode is "apply" to read ambiguous characters with their
+	// default reading, or "warn" to only report them.
+	heteronymMode string
+	// heteronymOverrides replaces or extends the built-in readings, from
+	// HETERONYM_OVERRIDES in the ?pinyin= format.
+	heteronymOverrides map[string]string
+)
+
+// heteronymNote reports a 多音字 the request didn't give a reading for.
+// Reading is the default it was read with under HETERONYM_MODE=apply.
+type heteronymNote struct {
+	Char     string   `json:"char"`
+	Readings []string `json:"readings"`
+	Reading  string   `json:"reading,omitempty"`
+}
+
+// resolveHeteronyms returns the readings for text's 多音字: hints from the
+// request always apply; dictionary words and default readings only when
+// apply is set. Characters neither hints nor dictionary words cover are
+// returned as notes. It fails when hints name nothing in text.
+func resolveHeteronyms(text string, hints map[string]string, apply bool) (map[string]string, []heteronymNote, error) {
+	known := maps.Clone(heteronymWords)
+	for c, readings := range heteronymChars {
+		known[string(c)] = readings[0]
+	}
+	maps.Copy(known, heteronymOverrides)
+
+	applied := map[string]string{}
+	var notes []heteronymNote
+	// The dictionary only looks at the text between request hints.
+	var gap strings.Builder
+	flush := func() {
+		for _, s := range splitHints(gap.String(), known) {
+			if s.reading == "" {
+				continue
+			}
+			if apply {
+				applied[s.text] = s.reading
+			}
+			if utf8.RuneCountInString(s.text) > 1 {
+				continue
+			}
+			c, _ := utf8.DecodeRuneInString(s.text)
+			note := heteronymNote{Char: s.text, Readings: heteronymChars[c]}
+			if note.Readings == nil {
+				note.Readings = []string{s.reading}
+			}
+			if apply {
+				note.Reading = s.reading
+			}
+			notes = append(notes, note)
+		}
+		gap.Reset()
+	}
+	hinted := false
+	for _, s := range splitHints(text, hints) {
+		if s.reading == "" {
+			gap.WriteString(s.text)
+			continue
+		}
+		flush()
+		applied[s.text], hinted = s.reading, true
+	}
+	flush()
+	if len(hints) > 0 && !hinted {
+		return nil, nil, errors.New("none of the hinted texts occur in the text")
+	}
+	return applied, notes, nil
+}
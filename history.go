@@ -0,0 +1,131 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// historyResolution is the granularity at which generation events are recorded.
+// Queries can only be bucketed in multiples of it.
+const historyResolution = time.Minute
+
+type historySlot struct {
+	minute int64
+	hits   int
+	misses int
+}
+
+// generationHistory is a ring buffer of per-minute hit/miss counts. Its size is
+// fixed by the retention window, so memory stays bounded regardless of traffic.
+type generationHistory struct {
+	mu        sync.Mutex
+	retention time.Duration
+	slots     []historySlot
+}
+
+type historyBucket struct {
+	Start  time.Time `json:"start"`
+	Hits   int       `json:"hits"`
+	Misses int       `json:"misses"`
+}
+
+func newGenerationHistory(retention time.Duration) *generationHistory {
+	n := int(retention / historyResolution)
+	if n < 1 {
+		n = 1
+	}
+	return &generationHistory{retention: time.Duration(n) * historyResolution, slots: make([]historySlot, n)}
+}
+
+// record counts one served request at time t as a cache hit or miss.
+func (h *generationHistory) record(t time.Time, hit bool) {
+	minute := t.Unix() / 60
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	slot := &h.slots[minute%int64(len(h.slots))]
+	if slot.minute != minute {
+		*slot = historySlot{minute: minute}
+	}
+	if hit {
+		slot.hits++
+	} else {
+		slot.misses++
+	}
+}
+
+// buckets aggregates the events in (now-since, now] into buckets of the given
+// size, oldest first. since is clamped to the retention window.
+func (h *generationHistory) buckets(now time.Time, since, bucket time.Duration) []historyBucket {
+	if since > h.retention {
+		since = h.retention
+	}
+	first := now.Add(-since).Truncate(bucket)
+	n := int(now.Sub(first)/bucket) + 1
+	out := make([]historyBucket, n)
+	for i := range out {
+		out[i].Start = first.Add(time.Duration(i) * bucket).UTC()
+	}
+
+	from := now.Add(-since).Unix() / 60
+	to := now.Unix() / 60
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, slot := range h.slots {
+		if slot.minute <= from || slot.minute > to {
+			continue
+		}
+		i := int(time.Unix(slot.minute*60, 0).Sub(first) / bucket)
+		if i < 0 || i >= n {
+			continue
+		}
+		out[i].Hits += slot.hits
+		out[i].Misses += slot.misses
+	}
+	return out
+}
+
+// handleStatsHistory reports the server's hits and misses over time. They
+// aren't kept per tenant, so a tenant's caller can't see them.
+func handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	if tenant, _ := statsTenant(r.Context()); tenant != "" {
+		http.Error(w, "Stats history covers every tenant: use the admin token", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+
+	bucket := time.Hour
+	if v := query.Get("bucket"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < historyResolution || d%historyResolution != 0 {
+			http.Error(w, "Invalid bucket: must be a positive multiple of 1m", http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+
+	since := 24 * time.Hour
+	if v := query.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid since: must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	if since > history.retention {
+		since = history.retention
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Bucket  string          `json:"bucket"`
+		Since   string          `json:"since"`
+		Buckets []historyBucket `json:"buckets"`
+	}{bucket.String(), since.String(), history.buckets(time.Now(), since, bucket)})
+}
@@ -0,0 +1,76 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenerationHistoryBuckets(t *testing.T) {
+	h := newGenerationHistory(10 * time.Minute)
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2026, 1, 1, hour, minute, second, 0, time.UTC)
+	}
+	// 11:45 and 11:55 share a slot of the ten, so the hit at 11:45 must be
+	// gone once 11:55 is recorded. 11:48 is older than the retention window
+	// but still in its slot.
+	h.record(at(11, 45, 10), true)
+	h.record(at(11, 48, 0), true)
+	h.record(at(11, 55, 20), false)
+	h.record(at(11, 55, 40), true)
+	h.record(at(12, 0, 10), false)
+	now := at(12, 0, 30)
+
+	for _, tt := range []struct {
+		name          string
+		since, bucket time.Duration
+		want          []historyBucket
+	}{
+		{"retention", 10 * time.Minute, 10 * time.Minute, []historyBucket{
+			{Start: at(11, 50, 0), Hits: 1, Misses: 1},
+			{Start: at(12, 0, 0), Misses: 1},
+		}},
+		{"since clamped to retention", 24 * time.Hour, 10 * time.Minute, []historyBucket{
+			{Start: at(11, 50, 0), Hits: 1, Misses: 1},
+			{Start: at(12, 0, 0), Misses: 1},
+		}},
+		{"minutes", 6 * time.Minute, time.Minute, []historyBucket{
+			{Start: at(11, 54, 0)},
+			{Start: at(11, 55, 0), Hits: 1, Misses: 1},
+			{Start: at(11, 56, 0)},
+			{Start: at(11, 57, 0)},
+			{Start: at(11, 58, 0)},
+			{Start: at(11, 59, 0)},
+			{Start: at(12, 0, 0), Misses: 1},
+		}},
+		{"hours", 3 * time.Minute, time.Hour, []historyBucket{
+			{Start: at(11, 0, 0)},
+			{Start: at(12, 0, 0), Misses: 1},
+		}},
+	} {
+		if got := h.buckets(now, tt.since, tt.bucket); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: buckets(%v, %v) = %+v, want %+v", tt.name, tt.since, tt.bucket, got, tt.want)
+		}
+	}
+}
+
+func TestStatsHistoryInvalid(t *testing.T) {
+	for _, query := range []url.Values{
+		{"bucket": {"30s"}},
+		{"bucket": {"90s"}},
+		{"bucket": {"-1h"}},
+		{"bucket": {"hourly"}},
+		{"since": {"0s"}},
+		{"since": {"-1h"}},
+		{"since": {"yesterday"}},
+	} {
+		if resp, body := get(t, "/stats/history", query); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("/stats/history?%s: %s %s, want 400", query.Encode(), resp.Status, body)
+		}
+	}
+	if resp, body := get(t, "/stats/history", url.Values{"bucket": {"2m"}, "since": {"1h"}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("/stats/history?bucket=2m&since=1h: %s %s", resp.Status, body)
+	}
+}
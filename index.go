@@ -0,0 +1,416 @@
+package wenbuntts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// cacheIndex records metadata for every cached clip in SQLite: the original
+// text, which provider and voice produced it, its size and how often it was
+// served. Filenames are lossy (texts are sanitized and truncated), so
+// listing, purging and eviction go through the index.
+var cacheIndex *sql.DB
+
+const cacheIndexSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	key         TEXT PRIMARY KEY,
+	tenant      TEXT NOT NULL DEFAULT '',
+	deck        TEXT NOT NULL,
+	text        TEXT NOT NULL,
+	voice       TEXT NOT NULL,
+	provider    TEXT NOT NULL,
+	encoding    TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	created     INTEGER NOT NULL,
+	hits        INTEGER NOT NULL DEFAULT 0,
+	last_access INTEGER NOT NULL,
+	duration_ms INTEGER NOT NULL DEFAULT 0,
+	content_hash TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS entries_last_access ON entries (last_access);
+`
+
+// indexEntry is one row of the cache index. Times are stored as Unix
+// nanoseconds.
+type indexEntry struct {
+	Key        string    `json:"file"` // storage key, see DELETE /cache/entry
+	Tenant     string    `json:"tenant,omitempty"`
+	Deck       string    `json:"deck,omitempty"`
+	Text       string    `json:"text"`
+	Voice      string    `json:"voice"`
+	Provider   string    `json:"provider,omitempty"`
+	Encoding   string    `json:"encoding"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	Hits       int64     `json:"hits"`
+	LastAccess time.Time `json:"lastAccess"`
+	DurationMs int64     `json:"durationMs,omitempty"` // 0 until known, see clipDuration
+	// ContentHash is "" until known, see clipContentHash.
+	ContentHash string `json:"contentHash,omitempty"`
+}
+
+func openCacheIndex(file string) error {
+	// A single connection serializes writers, which SQLite requires anyway.
+	db, err := sql.Open("sqlite", "file:"+file+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(cacheIndexSchema + usageSchema + retryQueueSchema + wordRequestsSchema); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addIndexColumn(db, "duration_ms", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addIndexColumn(db, "tenant", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return err
+	}
+	if err := addIndexColumn(db, "content_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS entries_content_hash ON entries (content_hash)`); err != nil {
+		db.Close()
+		return err
+	}
+	cacheIndex = db
+	return nil
+}
+
+// addIndexColumn adds a column to an entries table created before it existed.
+func addIndexColumn(db *sql.DB, name, decl string) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('entries') WHERE name = ?`, name).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	_, err := db.Exec(`ALTER TABLE entries ADD COLUMN ` + name + ` ` + decl)
+	return err
+}
+
+// syncCacheIndex reconciles the index with cacheStore: rows for entries that
+// are gone are dropped, and entries the index doesn't know yet (e.g. cached
+// before it existed) are added with what their deck manifest or legacy
+// filename tells.
+func syncCacheIndex(ctx context.Context) error {
+	known := map[string]bool{}
+	rows, err := cacheIndex.QueryContext(ctx, `SELECT key FROM entries`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		known[key] = false
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var missing []objectInfo
+	err = cacheStore.List(ctx, func(obj objectInfo) error {
+		if _, ok := formatForFile(obj.Key); !ok {
+			return nil
+		}
+		if _, ok := known[obj.Key]; ok {
+			known[obj.Key] = true
+		} else {
+			missing = append(missing, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	manifests := map[string]map[string]manifestEntry{}
+	for _, obj := range missing {
+		dir := keyDeck(obj.Key)
+		if _, ok := manifests[dir]; !ok {
+			manifests[dir] = readManifestEntries(ctx, dir)
+		}
+		var e manifestEntry
+		if m, ok := manifests[dir][path.Base(obj.Key)]; ok {
+			e = m
+		} else if modelName, text, ok := parseCacheFilename(path.Base(obj.Key)); ok {
+			e = manifestEntry{Text: text, Model: modelName}
+		}
+		f, _ := formatForFile(obj.Key)
+		tenant, deck := keyTenant(obj.Key)
+		// A process sharing the cache, like serve while generate starts,
+		// may have indexed the entry since, and knows it better.
+		_, err := cacheIndex.ExecContext(ctx,
+			`INSERT INTO entries (key, tenant, deck, text, voice, provider, encoding, size, created, last_access) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (key) DO NOTHING`,
+			obj.Key, tenant, deck, e.Text, e.Model, e.Provider, f.encoding, obj.Size, obj.ModTime.UnixNano(), obj.ModTime.UnixNano())
+		if err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for key, present := range known {
+		if !present {
+			if err := indexDelete(ctx, key); err != nil {
+				return err
+			}
+			removed++
+		}
+	}
+	slog.Info("Cache index synced", "added", len(missing), "removed", removed)
+	return nil
+}
+
+// indexPut records a freshly generated entry holding audio. A regenerated
+// entry keeps its hit count.
+func indexPut(ctx context.Context, req ttsRequest, audio []byte, duration time.Duration) error {
+	now := time.Now()
+	e := indexEntry{
+		Key: req.key, Tenant: req.tenant, Deck: req.deck, Text: req.text, Voice: req.model,
+		Provider: req.provider.Name(), Encoding: req.audioFormat().encoding, Size: int64(len(audio)),
+		Created: now, LastAccess: now, DurationMs: duration.Milliseconds(), ContentHash: contentHash(audio),
+	}
+	_, err := cacheIndex.ExecContext(ctx, `
+		INSERT INTO entries (key, tenant, deck, text, voice, provider, encoding, size, created, last_access, duration_ms, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			text = excluded.text, voice = excluded.voice, provider = excluded.provider,
+			encoding = excluded.encoding, size = excluded.size, created = excluded.created,
+			last_access = excluded.last_access, duration_ms = excluded.duration_ms,
+			content_hash = excluded.content_hash`,
+		e.Key, e.Tenant, e.Deck, e.Text, e.Voice, e.Provider, e.Encoding, e.Size, e.Created.UnixNano(), e.LastAccess.UnixNano(), e.DurationMs, e.ContentHash)
+	if err == nil {
+		shareIndexChange(ctx, indexChange{Put: &e})
+	}
+	return err
+}
+
+// clipDuration returns the playing time of the clip data stored under key.
+// It is read from the index, or parsed and then recorded there for entries
+// indexed before durations were.
+func clipDuration(ctx context.Context, key string, data []byte) (time.Duration, bool) {
+	var ms int64
+	if err := cacheIndex.QueryRowContext(ctx, `SELECT duration_ms FROM entries WHERE key = ?`, key).Scan(&ms); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	d, ok := audioDuration(data, path.Ext(key))
+	if ok && d > 0 {
+		if _, err := cacheIndex.ExecContext(ctx, `UPDATE entries SET duration_ms = ? WHERE key = ?`, d.Milliseconds(), key); err != nil {
+			logger(ctx).Error("Failed to record clip duration", "key", logPath(key), "error", err)
+		}
+	}
+	return d, ok
+}
+
+// clipContentHash returns contentHash(data) for the clip data stored under
+// key, recording it in the index for entries indexed before content hashes
+// were, so that its contentAudioURL resolves. A recorded hash is never
+// replaced: it is the checksum verifyClip checks against.
+func clipContentHash(ctx context.Context, key string, data []byte) string {
+	hash := contentHash(data)
+	var known string
+	if err := cacheIndex.QueryRowContext(ctx, `SELECT content_hash FROM entries WHERE key = ?`, key).Scan(&known); err == nil && known == "" {
+		recordContentHash(ctx, key, hash)
+	}
+	return hash
+}
+
+// recordContentHash sets the content hash of the index row for key.
+func recordContentHash(ctx context.Context, key, hash string) {
+	if _, err := cacheIndex.ExecContext(ctx, `UPDATE entries SET content_hash = ? WHERE key = ?`, hash, key); err != nil {
+		logger(ctx).Error("Failed to record content hash", "key", logPath(key), "error", err)
+	}
+}
+
+// indexHit counts a cache hit on key.
+func indexHit(ctx context.Context, key string) {
+	_, err := cacheIndex.ExecContext(ctx, `UPDATE entries SET hits = hits + 1, last_access = ? WHERE key = ?`, time.Now().UnixNano(), key)
+	if err != nil {
+		logger(ctx).Error("Failed to record cache hit", "error", err)
+	}
+}
+
+// indexRename moves the row for from to to, replacing any stale row there.
+func indexRename(ctx context.Context, from, to string) error {
+	if err := indexDelete(ctx, to); err != nil {
+		return err
+	}
+	_, err := cacheIndex.ExecContext(ctx, `UPDATE entries SET key = ? WHERE key = ?`, to, from)
+	return err
+}
+
+// indexImport records e, an entry imported from another instance's export,
+// as it was there.
+func indexImport(ctx context.Context, e indexEntry) error {
+	_, err := cacheIndex.ExecContext(ctx, `
+		INSERT INTO entries (key, tenant, deck, text, voice, provider, encoding, size, created, hits, last_access, duration_ms, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			tenant = excluded.tenant, deck = excluded.deck, text = excluded.text, voice = excluded.voice,
+			provider = excluded.provider, encoding = excluded.encoding, size = excluded.size,
+			created = excluded.created, hits = excluded.hits, last_access = excluded.last_access,
+			duration_ms = excluded.duration_ms, content_hash = excluded.content_hash`,
+		e.Key, e.Tenant, e.Deck, e.Text, e.Voice, e.Provider, e.Encoding, e.Size, e.Created.UnixNano(), e.Hits, e.LastAccess.UnixNano(), e.DurationMs, e.ContentHash)
+	return err
+}
+
+func indexDelete(ctx context.Context, key string) error {
+	_, err := cacheIndex.ExecContext(ctx, `DELETE FROM entries WHERE key = ?`, key)
+	if err == nil {
+		shareIndexChange(ctx, indexChange{Delete: key})
+	}
+	return err
+}
+
+// indexFilter selects index rows. Zero fields match everything.
+type indexFilter struct {
+	key           string
+	tenant        string // with byTenant, "" being the shared cache
+	byTenant      bool
+	deck          string
+	voice         string
+	prefix        string // of the original text
+	text          string // the original text, exactly
+	createdBefore time.Time
+	limit         int
+	oldestFirst   bool // order by creation rather than last access
+}
+
+// queryIndex returns the rows matching f, least recently accessed first, or
+// oldest first.
+func queryIndex(ctx context.Context, f indexFilter) ([]indexEntry, error) {
+	var where []string
+	var args []any
+	if f.key != "" {
+		where, args = append(where, "key = ?"), append(args, f.key)
+	}
+	if f.tenant != "" || f.byTenant {
+		where, args = append(where, "tenant = ?"), append(args, f.tenant)
+	}
+	if f.deck != "" {
+		where, args = append(where, "deck = ?"), append(args, f.deck)
+	}
+	if f.voice != "" {
+		where, args = append(where, "voice = ?"), append(args, f.voice)
+	}
+	if f.prefix != "" {
+		where, args = append(where, "substr(text, 1, length(?)) = ?"), append(args, f.prefix, f.prefix)
+	}
+	if f.text != "" {
+		where, args = append(where, "text = ?"), append(args, f.text)
+	}
+	if !f.createdBefore.IsZero() {
+		where, args = append(where, "created < ?"), append(args, f.createdBefore.UnixNano())
+	}
+	query := `SELECT key, tenant, deck, text, voice, provider, encoding, size, created, hits, last_access, duration_ms, content_hash FROM entries`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if f.oldestFirst {
+		query += " ORDER BY created"
+	} else {
+		query += " ORDER BY last_access"
+	}
+	if f.limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.limit)
+	}
+
+	rows, err := cacheIndex.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []indexEntry{}
+	for rows.Next() {
+		var e indexEntry
+		var created, lastAccess int64
+		if err := rows.Scan(&e.Key, &e.Tenant, &e.Deck, &e.Text, &e.Voice, &e.Provider, &e.Encoding, &e.Size, &created, &e.Hits, &lastAccess, &e.DurationMs, &e.ContentHash); err != nil {
+			return nil, err
+		}
+		e.Created, e.LastAccess = time.Unix(0, created).UTC(), time.Unix(0, lastAccess).UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+type cacheStatsGroup struct {
+	Name    string `json:"name"`
+	Entries int64  `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Hits    int64  `json:"hits"`
+}
+
+// indexGroups totals the index by column, over every tenant's entries with
+// all, or else only tenant's.
+func indexGroups(ctx context.Context, column, tenant string, all bool) ([]cacheStatsGroup, error) {
+	where, args := tenantWhere(tenant, all)
+	rows, err := cacheIndex.QueryContext(ctx, `SELECT `+column+`, COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(hits), 0) FROM entries`+where+` GROUP BY `+column+` ORDER BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := []cacheStatsGroup{}
+	for rows.Next() {
+		var g cacheStatsGroup
+		if err := rows.Scan(&g.Name, &g.Entries, &g.Bytes, &g.Hits); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// tenantWhere returns the WHERE clause limiting entries to tenant, "" being
+// the shared cache, unless all.
+func tenantWhere(tenant string, all bool) (string, []any) {
+	if all {
+		return "", nil
+	}
+	return " WHERE tenant = ?", []any{tenant}
+}
+
+// handleStatsCache reports cache totals from the index, overall and per
+// voice and provider, for the tenants statsTenant allows.
+func handleStatsCache(w http.ResponseWriter, r *http.Request) {
+	tenant, all := statsTenant(r.Context())
+	where, args := tenantWhere(tenant, all)
+	var stats struct {
+		Entries    int64             `json:"entries"`
+		Bytes      int64             `json:"bytes"`
+		Hits       int64             `json:"hits"`
+		ByVoice    []cacheStatsGroup `json:"byVoice"`
+		ByProvider []cacheStatsGroup `json:"byProvider"`
+	}
+	err := cacheIndex.QueryRowContext(r.Context(), `SELECT COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(hits), 0) FROM entries`+where, args...).
+		Scan(&stats.Entries, &stats.Bytes, &stats.Hits)
+	if err == nil {
+		stats.ByVoice, err = indexGroups(r.Context(), "voice", tenant, all)
+	}
+	if err == nil {
+		stats.ByProvider, err = indexGroups(r.Context(), "provider", tenant, all)
+	}
+	if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
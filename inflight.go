@@ -0,0 +1,134 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// inflight counts the requests in progress per client IP, which
+// MAX_INFLIGHT_PER_IP caps; 0 disables the cap.
+var (
+	inflightMu sync.Mutex
+	inflight   = map[string]int{}
+)
+
+// trustedProxies are the networks whose X-Forwarded-For headers clientIP
+// believes, from TRUSTED_PROXIES.
+var trustedProxies []netip.Prefix
+
+// parseIPPrefixes parses the comma-separated list of IPs and CIDRs of the
+// setting name.
+func parseIPPrefixes(name, s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range splitList(s) {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s entry %q", name, v)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// containsIP reports whether ip is in one of prefixes.
+func containsIP(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTrustedProxy(ip string) bool {
+	return containsIP(trustedProxies, ip)
+}
+
+// clientIP returns the IP address of the client that sent r, see
+// resolveClientIP.
+func clientIP(r *http.Request) string {
+	return resolveClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"), r.Header.Get("X-Real-IP"))
+}
+
+// resolveClientIP returns the IP address of the client behind a connection
+// from remoteAddr. Behind a trusted proxy it is the rightmost
+// X-Forwarded-For address that isn't itself a trusted proxy, since anything
+// left of that could be forged, or the proxy's X-Real-IP when it sends no
+// X-Forwarded-For.
+func resolveClientIP(remoteAddr string, forwardedFor []string, realIP string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	forwarded := strings.Join(forwardedFor, ",")
+	if forwarded == "" {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(realIP)); err == nil {
+			return addr.Unmap().String()
+		}
+		return ip
+	}
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// limitInflightPerIP rejects a request with 429 when its client already has
+// MAX_INFLIGHT_PER_IP requests in progress. It wraps every route that can
+// synthesize, so the cap holds however the requests are spread over them.
+func limitInflightPerIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, ok := enterInflight(current(), clientIP(r))
+		if !ok {
+			http.Error(w, "Too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
+
+// enterInflight counts a request from ip as in progress until release is
+// called, unless ip already has s.maxInflightPerIP of them.
+func enterInflight(s *reloadableSettings, ip string) (release func(), ok bool) {
+	if s.maxInflightPerIP <= 0 {
+		return func() {}, true
+	}
+	inflightMu.Lock()
+	defer inflightMu.Unlock()
+	if inflight[ip] >= s.maxInflightPerIP {
+		return nil, false
+	}
+	inflight[ip]++
+	return func() {
+		inflightMu.Lock()
+		if inflight[ip]--; inflight[ip] == 0 {
+			delete(inflight, ip)
+		}
+		inflightMu.Unlock()
+	}, true
+}
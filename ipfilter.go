@@ -0,0 +1,69 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+)
+
+// Client IPs, as clientIP finds them behind TRUSTED_PROXIES, are filtered
+// before a request reaches any HTTP handler or gRPC method: IP_DENY is refused outright, and
+// with IP_ALLOW set so is every IP outside it. MISS_IP_ALLOW narrows who may
+// cause a synthesis: other clients are still served cached audio, but a miss
+// fails with errMissForbidden (403) before any budget or provider is
+// touched, e.g. to let only a backend fill the cache behind a public CDN.
+var ipAllow, ipDeny, missIPAllow []netip.Prefix
+
+var errMissForbidden = errors.New("Not cached, and this client may not generate audio")
+
+type missForbiddenKey struct{}
+
+// filterClientIPs refuses requests from denied IPs with 403, and marks the
+// context of requests whose IP may not cause a miss.
+func filterClientIPs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(ipAllow) == 0 && len(ipDeny) == 0 && len(missIPAllow) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, ok := admitClientIP(r.Context(), clientIP(r))
+		if !ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// admitClientIP reports whether the client at ip may be served at all, and
+// returns ctx marked if it may not cause a miss.
+func admitClientIP(ctx context.Context, ip string) (context.Context, bool) {
+	if containsIP(ipDeny, ip) || (len(ipAllow) > 0 && !containsIP(ipAllow, ip)) {
+		logger(ctx).Warn("Refused client IP", "client_ip", ip)
+		return ctx, false
+	}
+	if len(missIPAllow) > 0 && !containsIP(missIPAllow, ip) {
+		ctx = context.WithValue(ctx, missForbiddenKey{}, true)
+	}
+	return ctx, true
+}
+
+// allowMiss returns errMissForbidden if the client behind ctx may not cause
+// a synthesis. generateFile checks it too; handlers call it first where a
+// miss spends a budget before generating.
+func allowMiss(ctx context.Context) error {
+	if forbidden, _ := ctx.Value(missForbiddenKey{}).(bool); forbidden {
+		return errMissForbidden
+	}
+	return nil
+}
+
+// withMissPolicy carries the MISS_IP_ALLOW verdict on the request behind
+// from over to ctx, for work that outlives the request.
+func withMissPolicy(ctx, from context.Context) context.Context {
+	if allowMiss(from) != nil {
+		return context.WithValue(ctx, missForbiddenKey{}, true)
+	}
+	return ctx
+}
@@ -0,0 +1,229 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxJobItems bounds a single /jobs request, which unlike /tts/batch doesn't
+// hold the connection open while it runs.
+const maxJobItems = 20000
+
+// batchJob is a background batch started by POST /jobs. results[i] stays
+// nil until items[i] has been processed. events records progress for
+// /jobs/{id}/events, and updated is closed and replaced whenever it grows.
+type batchJob struct {
+	id       string
+	items    []batchItem
+	callback string // see deliverWebhook
+
+	mu       sync.Mutex
+	results  []*batchResult
+	finished time.Time
+	events   []jobEvent
+	updated  chan struct{}
+}
+
+// jobEvent is one server-sent event: "started", "completed" or "failed" for
+// an item, then "done" for the job.
+type jobEvent struct {
+	name string
+	data any
+}
+
+// addEvent records an event and wakes the streams waiting for one. The
+// caller holds job.mu.
+func (job *batchJob) addEvent(name string, data any) {
+	job.events = append(job.events, jobEvent{name, data})
+	close(job.updated)
+	job.updated = make(chan struct{})
+}
+
+var (
+	batchJobsMu sync.Mutex
+	batchJobs   = map[string]*batchJob{}
+)
+
+// run processes the items in order. Items left when ctx is canceled fail
+// with its error. The job is forgotten asyncJobRetention after it finishes.
+func (job *batchJob) run(ctx context.Context) {
+	type itemEvent struct {
+		Index  int          `json:"index"`
+		Text   string       `json:"text"`
+		Result *batchResult `json:"result,omitempty"`
+	}
+	failed := 0
+	for i, item := range job.items {
+		var result batchResult
+		if err := ctx.Err(); err != nil {
+			result = batchResult{Text: item.Text, Model: item.Model, Error: err.Error()}
+		} else {
+			job.mu.Lock()
+			job.addEvent("started", itemEvent{Index: i, Text: item.Text})
+			job.mu.Unlock()
+			result = batchGenerate(ctx, item)
+		}
+		name := "completed"
+		if result.Error != "" {
+			name = "failed"
+			failed++
+		}
+		job.mu.Lock()
+		job.results[i] = &result
+		job.addEvent(name, itemEvent{Index: i, Text: item.Text, Result: &result})
+		job.mu.Unlock()
+	}
+
+	job.mu.Lock()
+	job.finished = time.Now()
+	job.addEvent("done", struct {
+		Total  int `json:"total"`
+		Failed int `json:"failed"`
+	}{len(job.items), failed})
+	outcome := jobOutcome{ID: job.id, Status: "done", Total: len(job.items), Failed: failed, Results: slices.Clone(job.results)}
+	job.mu.Unlock()
+	slog.Info("Batch job finished", "job", job.id, "items", len(job.items))
+	if job.callback != "" {
+		if ctx.Err() != nil {
+			outcome.Status = "failed"
+		}
+		deliverWebhook(ctx, job.callback, outcome)
+	}
+
+	time.AfterFunc(asyncJobRetention, func() {
+		batchJobsMu.Lock()
+		delete(batchJobs, job.id)
+		batchJobsMu.Unlock()
+	})
+}
+
+// handleJobsCreate starts a batch job for the same JSON body as /tts/batch
+// and responds 202 with the job's URL. ?callback= names a URL to POST the
+// outcome to, see deliverWebhook.
+func handleJobsCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	callback := r.URL.Query().Get("callback")
+	if callback != "" {
+		if err := validCallback(callback); err != nil {
+			http.Error(w, "Invalid callback: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var items []batchItem
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<20)).Decode(&items); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 || len(items) > maxJobItems {
+		http.Error(w, "Invalid job: must list between 1 and "+strconv.Itoa(maxJobItems)+" items", http.StatusBadRequest)
+		return
+	}
+
+	job := &batchJob{id: newRequestID(), items: items, callback: callback, results: make([]*batchResult, len(items)), updated: make(chan struct{})}
+	batchJobsMu.Lock()
+	batchJobs[job.id] = job
+	batchJobsMu.Unlock()
+	go job.run(withMissPolicy(withTenant(shutdownCtx, tenantFrom(r.Context())), r.Context()))
+
+	w.Header().Set("Location", "/jobs/"+job.id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct {
+		ID string `json:"id"`
+	}{job.id})
+}
+
+// handleJobStatus reports a batch job's progress. Results are in item order,
+// with null for items not processed yet.
+func handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	batchJobsMu.Lock()
+	job, ok := batchJobs[r.PathValue("id")]
+	batchJobsMu.Unlock()
+	if !ok {
+		http.Error(w, "Unknown or expired job", http.StatusNotFound)
+		return
+	}
+
+	job.mu.Lock()
+	status := struct {
+		ID        string         `json:"id"`
+		Status    string         `json:"status"`
+		Total     int            `json:"total"`
+		Completed int            `json:"completed"`
+		Failed    int            `json:"failed"`
+		Results   []*batchResult `json:"results"`
+	}{ID: job.id, Status: "running", Total: len(job.items), Results: slices.Clone(job.results)}
+	if !job.finished.IsZero() {
+		status.Status = "done"
+	}
+	job.mu.Unlock()
+	for _, result := range status.Results {
+		if result == nil {
+			continue
+		}
+		status.Completed++
+		if result.Error != "" {
+			status.Failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(status)
+}
+
+// handleJobEvents streams a batch job's progress as server-sent events until
+// it is done. Each event's id is its position, so a reconnecting client
+// resumes after Last-Event-ID.
+func handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	batchJobsMu.Lock()
+	job, ok := batchJobs[r.PathValue("id")]
+	batchJobsMu.Unlock()
+	if !ok {
+		http.Error(w, "Unknown or expired job", http.StatusNotFound)
+		return
+	}
+
+	next := 0
+	if id, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && id >= 0 {
+		next = id + 1
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+
+	for {
+		job.mu.Lock()
+		events := job.events[min(next, len(job.events)):]
+		updated, finished := job.updated, !job.finished.IsZero()
+		job.mu.Unlock()
+
+		for _, e := range events {
+			data, _ := json.Marshal(e.data)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, e.name, data)
+			next++
+		}
+		if err := rc.Flush(); err != nil || finished {
+			return
+		}
+		select {
+		case <-updated:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// languageRule is what a language accepts as input, and the Google voices
+// offered for it.
+type languageRule struct {
+	// name describes script in error messages.
+	name   string
+	script *regexp.Regexp
+	// maxLength overrides MAX_TEXT_LENGTH for the language, e.g. because
+	// its words are spelled with many more characters.
+	maxLength int
+	// voices are the built-in Google voices for the language; defaultVoice
+	// is used when a request names none.
+	voices       []string
+	defaultVoice string
+}
+
+var builtinLanguageRules = map[string]languageRule{
+	"cmn-CN": {
+		name: "Chinese characters",
+		// \p{Han} is a Unicode property that matches Han characters.
+		script:       regexp.MustCompile(`^\p{Han}+$`),
+		voices:       allowedModels[:],
+		defaultVoice: builtinVoice,
+	},
+	// Cantonese is written with the same characters as Mandarin; only the
+	// voices differ.
+	"yue-HK": {
+		name:         "Chinese characters",
+		script:       regexp.MustCompile(`^\p{Han}+$`),
+		voices:       []string{"yue-HK-Standard-A", "yue-HK-Standard-B", "yue-HK-Standard-C", "yue-HK-Standard-D"},
+		defaultVoice: "yue-HK-Standard-A",
+	},
+	// Kana spell out readings, so Japanese and Korean words run longer than
+	// Chinese ones.
+	"ja-JP": {
+		name: "Japanese kana or kanji",
+		// ー (the long vowel mark) belongs to the Common script.
+		script:       regexp.MustCompile(`^[\p{Han}\p{Hiragana}\p{Katakana}ー]+$`),
+		maxLength:    10,
+		voices:       []string{"ja-JP-Chirp3-HD-Achernar", "ja-JP-Chirp3-HD-Charon", "ja-JP-Wavenet-B"},
+		defaultVoice: "ja-JP-Chirp3-HD-Achernar",
+	},
+	"ko-KR": {
+		name:         "Korean hangul or hanja",
+		script:       regexp.MustCompile(`^[\p{Hangul}\p{Han}]+( [\p{Hangul}\p{Han}]+)*$`),
+		maxLength:    10,
+		voices:       []string{"ko-KR-Chirp3-HD-Achernar", "ko-KR-Chirp3-HD-Charon", "ko-KR-Wavenet-A"},
+		defaultVoice: "ko-KR-Chirp3-HD-Achernar",
+	},
+	"en-US": {
+		name:         "English words",
+		script:       regexp.MustCompile(`^\p{Latin}+(['\- ]\p{Latin}+)*$`),
+		maxLength:    32,
+		voices:       []string{"en-US-Chirp3-HD-Achernar", "en-US-Wavenet-D", "en-US-Wavenet-F"},
+		defaultVoice: "en-US-Wavenet-D",
+	},
+}
+
+// setDefaultVoice makes v the voice in rules of requests that name none. It
+// becomes the default of the language in its name, which is returned as the
+// default language if switchLanguage is set and must be language otherwise.
+// A voice that isn't built in is added to its language's voices.
+func setDefaultVoice(rules map[string]languageRule, v, language string, switchLanguage bool) (string, error) {
+	m := voiceLanguagePattern.FindStringSubmatch(v)
+	if m == nil {
+		return "", fmt.Errorf("%q is not a Google voice name", v)
+	}
+	rule, ok := rules[m[1]]
+	if !ok {
+		return "", fmt.Errorf("language %s of %s is not supported", m[1], v)
+	}
+	if switchLanguage {
+		language = m[1]
+	} else if m[1] != language {
+		return "", fmt.Errorf("voice %s does not speak DEFAULT_LANGUAGE %s", v, language)
+	}
+	if !slices.Contains(rule.voices, v) {
+		rule.voices = append(slices.Clone(rule.voices), v)
+	}
+	rule.defaultVoice = v
+	rules[m[1]] = rule
+	return language, nil
+}
+
+// ruleFor returns the rule for language. Languages without one, such as the
+// zh-CN of Azure voice names, are validated as the default language.
+func ruleFor(language string) languageRule {
+	return current().ruleFor(language)
+}
+
+// ruleFor returns the rule for language under s, see the function ruleFor.
+func (s *reloadableSettings) ruleFor(language string) languageRule {
+	if rule, ok := s.rules[language]; ok {
+		return rule
+	}
+	return s.rules[s.language]
+}
+
+// resolveLanguage picks the language for a request with the given voice and
+// ?language= value (possibly empty). A language in the voice name wins, see
+// languageFor, so requesting a different known language is an error.
+func resolveLanguage(modelName, requested string) (string, error) {
+	if requested == "" {
+		return languageFor(modelName), nil
+	}
+	if inferLangFromVoice {
+		if m := voiceLanguagePattern.FindStringSubmatch(modelName); m != nil && m[1] != requested {
+			if _, known := current().rules[m[1]]; known {
+				return "", fmt.Errorf("Invalid language: voice %s speaks %s, not %s", modelName, m[1], requested)
+			}
+		}
+	}
+	return requested, nil
+}
+
+// Besides its language's script, text may contain Latin letters, digits or
+// punctuation where TEXT_ALLOW_LATIN, TEXT_ALLOW_DIGITS or
+// TEXT_ALLOW_PUNCTUATION permit them, e.g. for 卡拉OK or 3D. With
+// punctuation allowed, text also needs TEXT_MIN_SCRIPT_CHARS (1 by default,
+// 0 turns it off) characters of its script, so ？？？ isn't synthesized.
+
+// validateText checks text against the rule for language and the length
+// limit for modelName. Its error names the violated rule as "(rule name)":
+// max_length, latin, digits, punctuation, script or min_script.
+func validateText(text, language, modelName string) error {
+	s := current()
+	rule := s.ruleFor(language)
+	if maxLen := maxTextLengthFor(modelName, language); utf8.RuneCountInString(text) > maxLen {
+		return fmt.Errorf("Invalid text: must be at most %d characters for %s (rule max_length)", maxLen, modelName)
+	}
+	native := strings.Map(func(r rune) rune {
+		if textRuleOf(r) != "script" && s.allowedExtra(r) {
+			return -1
+		}
+		return r
+	}, text)
+	if text != "" && (native == "" || rule.script.MatchString(native)) {
+		return s.checkScriptChars(text, rule)
+	}
+	name := "script"
+	for _, r := range native {
+		if !rule.script.MatchString(string(r)) {
+			name = textRuleOf(r)
+			break
+		}
+	}
+	return fmt.Errorf("Invalid text: must be all %s (rule %s)", s.textRuleName(rule), name)
+}
+
+// MIN_HAN_FOR_TTS (1 by default) is the fewest Chinese characters that
+// /tts synthesizes in one clip, for deployments meant for whole words or
+// sentences. Other endpoints, /tts/batch among them, still take single
+// characters, and text without Chinese characters is not affected.
+
+// checkHanForTTS fails if text, sent to /tts, has Chinese characters but
+// fewer than MIN_HAN_FOR_TTS.
+func checkHanForTTS(text string) error {
+	minHan := current().minHanForTTS
+	n := 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			n++
+		}
+	}
+	if n > 0 && n < minHan {
+		return fmt.Errorf("Invalid text: /tts needs at least %d Chinese characters; request single characters through /tts/batch (rule min_han)", minHan)
+	}
+	return nil
+}
+
+// checkScriptChars fails if text, punctuation allowed, has fewer than
+// s.minScriptChars characters of rule's script.
+func (s *reloadableSettings) checkScriptChars(text string, rule languageRule) error {
+	if !s.allowPunctuation || s.minScriptChars == 0 {
+		return nil
+	}
+	n := 0
+	for _, r := range text {
+		if rule.script.MatchString(string(r)) {
+			n++
+		}
+	}
+	if n < s.minScriptChars {
+		return fmt.Errorf("Invalid text: must have at least %d %s (rule min_script)", s.minScriptChars, rule.name)
+	}
+	return nil
+}
+
+// textRuleOf names the rule a character outside its language's script
+// breaks.
+func textRuleOf(r rune) string {
+	switch {
+	case unicode.IsDigit(r):
+		return "digits"
+	case unicode.IsPunct(r) || unicode.IsSymbol(r):
+		return "punctuation"
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	}
+	return "script"
+}
+
+func (s *reloadableSettings) allowedExtra(r rune) bool {
+	switch textRuleOf(r) {
+	case "digits":
+		return s.allowDigits
+	case "punctuation":
+		return s.allowPunctuation
+	case "latin":
+		return s.allowLatin
+	}
+	return false
+}
+
+// textRuleName describes what rule accepts, with the allowed extras.
+func (s *reloadableSettings) textRuleName(rule languageRule) string {
+	name := rule.name
+	for _, extra := range []struct {
+		allowed bool
+		name    string
+	}{{s.allowLatin, "Latin letters"}, {s.allowDigits, "digits"}, {s.allowPunctuation, "punctuation"}} {
+		if extra.allowed {
+			name += ", " + extra.name
+		}
+	}
+	return name
+}
+
+// parseTextScripts parses TEXT_SCRIPTS, a comma-separated list of
+// language:Script+Script entries naming Unicode scripts (e.g.
+// "cmn-CN:Han+Bopomofo"), and makes each the script rule of its language in
+// rules.
+func parseTextScripts(rules map[string]languageRule, s string) error {
+	for _, entry := range splitList(s) {
+		language, list, _ := strings.Cut(entry, ":")
+		rule, ok := rules[language]
+		scripts := strings.Split(list, "+")
+		if !ok || list == "" {
+			return fmt.Errorf("invalid entry %q: want language:Script+Script for a supported language", entry)
+		}
+		var class strings.Builder
+		for _, script := range scripts {
+			if _, ok := unicode.Scripts[script]; !ok {
+				return fmt.Errorf("invalid entry %q: %s is not a Unicode script", entry, script)
+			}
+			class.WriteString(`\p{` + script + `}`)
+		}
+		rule.script = regexp.MustCompile(`^[` + class.String() + `]+$`)
+		rule.name = strings.Join(scripts, " or ") + " characters"
+		rules[language] = rule
+	}
+	return nil
+}
+
+// languageVoices returns the built-in Google voices of every language,
+// starting with the default language's.
+func languageVoices() []string {
+	s := current()
+	names := slices.Clone(s.ruleFor(s.language).voices)
+	for _, lang := range slices.Sorted(maps.Keys(s.rules)) {
+		for _, v := range s.rules[lang].voices {
+			if !slices.Contains(names, v) {
+				names = append(names, v)
+			}
+		}
+	}
+	return names
+}
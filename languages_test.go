@@ -0,0 +1,130 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateTextMinScriptChars(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		min  int
+		want string // rule broken, "" if valid
+	}{
+		{"？？？", 1, "min_script"},
+		{"。", 1, "min_script"},
+		{"你好？", 1, ""},
+		{"好", 1, ""},
+		{"好！", 2, "min_script"},
+		{"你好！", 2, ""},
+		{"？？？", 0, ""},
+	} {
+		setSettings(t, func(s *reloadableSettings) { s.allowPunctuation, s.minScriptChars = true, tt.min })
+		err := validateText(tt.text, "cmn-CN", mockVoice)
+		if tt.want == "" && err != nil {
+			t.Errorf("%q with TEXT_MIN_SCRIPT_CHARS=%d: %v", tt.text, tt.min, err)
+		} else if tt.want != "" && (err == nil || !strings.Contains(err.Error(), "(rule "+tt.want+")")) {
+			t.Errorf("%q with TEXT_MIN_SCRIPT_CHARS=%d: %v, want rule %s", tt.text, tt.min, err, tt.want)
+		}
+	}
+
+	// Without punctuation allowed, it is rejected as punctuation.
+	setSettings(t, func(s *reloadableSettings) { s.allowPunctuation, s.minScriptChars = false, 1 })
+	if err := validateText("？？？", "cmn-CN", mockVoice); err == nil || !strings.Contains(err.Error(), "(rule punctuation)") {
+		t.Errorf("？？？ without TEXT_ALLOW_PUNCTUATION: %v, want rule punctuation", err)
+	}
+}
+
+func TestTTSMinHan(t *testing.T) {
+	setSettings(t, func(s *reloadableSettings) { s.minHanForTTS = 2 })
+
+	resp, body := get(t, "/tts", url.Values{"text": {"好"}})
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "/tts/batch") {
+		t.Errorf("/tts?text=好 with MIN_HAN_FOR_TTS=2: %s %q, want 400 suggesting /tts/batch", resp.Status, body)
+	}
+	if resp, body := get(t, "/tts", url.Values{"text": {"好人"}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("/tts?text=好人 with MIN_HAN_FOR_TTS=2: %s %q", resp.Status, body)
+	}
+
+	// /tts/batch still takes single characters, and links them through /audio.
+	resp, err := http.Post(server.URL+"/tts/batch", "application/json", strings.NewReader(`[{"text": "好"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var results []batchResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Error != "" || !strings.HasPrefix(results[0].URL, "/audio/") {
+		t.Fatalf("/tts/batch of 好: %+v", results)
+	}
+	if resp, _ := get(t, results[0].URL, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("%s: %s", results[0].URL, resp.Status)
+	}
+}
+
+func TestVoiceMaxLengths(t *testing.T) {
+	usePool(t, "mock-long")
+	saved := voiceMaxLengths
+	voiceMaxLengths = map[string]int{mockVoice: 3, "mock-long": 8}
+	t.Cleanup(func() { voiceMaxLengths = saved })
+
+	for _, tt := range []struct {
+		text   string
+		pool   bool
+		status int
+		limit  string
+	}{
+		{"长三字", false, http.StatusOK, ""},
+		{"长长四字", false, http.StatusBadRequest, "at most 3 characters for mock "},
+		{"长长四字", true, http.StatusOK, ""},
+		{"长长长长长长八字", true, http.StatusOK, ""},
+		{"长长长长长长长九字", true, http.StatusBadRequest, "at most 8 characters for mock-long "},
+	} {
+		query := url.Values{"text": {tt.text}}
+		if tt.pool {
+			query.Set("pool", "true")
+		}
+		resp, body := get(t, "/tts", query)
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.limit) {
+			t.Errorf("/tts?%s: %s %q, want %d %q", query.Encode(), resp.Status, body, tt.status, tt.limit)
+		}
+	}
+}
+
+func TestInferLanguageFromVoice(t *testing.T) {
+	const voice = "yue-HK-Standard-A"
+	usePool(t, voice)
+	saved := inferLangFromVoice
+	t.Cleanup(func() { inferLangFromVoice = saved })
+
+	echo := func() requestEcho {
+		t.Helper()
+		resp, body := get(t, "/tts", url.Values{"text": {"你好"}, "pool": {"true"}, "echo": {"true"}})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s", resp.Status, body)
+		}
+		var e requestEcho
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	inferLangFromVoice = true
+	inferred := echo()
+	if inferred.Voice != voice || inferred.Language != "yue-HK" {
+		t.Errorf("%s speaks %q, want yue-HK", inferred.Voice, inferred.Language)
+	}
+	inferLangFromVoice = false
+	configured := echo()
+	if configured.Language != current().language {
+		t.Errorf("with INFER_LANG_FROM_VOICE=false, %s speaks %q, want the configured %q", voice, configured.Language, current().language)
+	}
+	if inferred.CacheFile == configured.CacheFile {
+		t.Errorf("both languages are cached as %s", inferred.CacheFile)
+	}
+}
@@ -0,0 +1,27 @@
+package wenbuntts
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Some voices emit a faint breath or click at the very start of every clip.
+// For the voices in leadInTrimVoices, the first leadInTrim of audio is cut
+// before the clip is cached.
+var (
+	leadInTrim       time.Duration
+	leadInTrimVoices []string
+)
+
+func applyLeadInTrim(modelName string, audio []byte) []byte {
+	if leadInTrim <= 0 || !slices.Contains(leadInTrimVoices, modelName) {
+		return audio
+	}
+	trimmed, err := trimMP3LeadIn(audio, leadInTrim)
+	if err != nil {
+		slog.Warn("Skipping lead-in trim", "voice", modelName, "error", err)
+		return audio
+	}
+	return trimmed
+}
@@ -0,0 +1,38 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestLeadInTrim renders one text in a listed and an unlisted voice, which
+// the mock gives the same 24ms frames. The listed one is the only voice of
+// the pool.
+func TestLeadInTrim(t *testing.T) {
+	usePool(t, "mock-trimmed")
+	saved, savedVoices := leadInTrim, leadInTrimVoices
+	leadInTrim, leadInTrimVoices = 100*time.Millisecond, []string{"mock-trimmed"}
+	t.Cleanup(func() { leadInTrim, leadInTrimVoices = saved, savedVoices })
+
+	frames := map[string]int{}
+	for voice, query := range map[string]url.Values{
+		mockVoice:      {"text": {"裁剪"}},
+		"mock-trimmed": {"text": {"裁剪"}, "pool": {"true"}},
+	} {
+		resp, body := get(t, "/tts", query)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %s %s", voice, resp.Status, body)
+		}
+		f, err := mp3Frames(body)
+		if err != nil {
+			t.Fatalf("%s: %v", voice, err)
+		}
+		frames[voice] = len(f)
+	}
+	// 100ms takes five frames to cover.
+	if frames[mockVoice]-frames["mock-trimmed"] != 5 {
+		t.Errorf("frames %v, want 5 fewer in the listed voice", frames)
+	}
+}
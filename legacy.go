@@ -0,0 +1,88 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// legacyStorageKey returns the "{voice}_{text}.{ext}" name req was cached
+// under before filenames became content hashes. Tuning is folded into the
+// voice part as a short hash, and long texts are truncated with a hash of the
+// full text appended.
+func (req ttsRequest) legacyStorageKey() string {
+	voice := strings.ReplaceAll(cacheVoiceKey(req.provider, req.model), "_", "-")
+	if tuning := req.tuning(); len(tuning) > 0 {
+		voice += "." + optionsHash(tuning)
+	}
+	if req.sentence {
+		voice += ".sentence"
+	}
+	text := sanitizeFilename(req.textKey())
+	if utf8.RuneCountInString(strings.TrimSpace(req.textKey())) > maxFilenameRunes {
+		text += "." + shortHash(req.textKey())
+	}
+	if req.ssml != "" {
+		text += ".ssml-" + shortHash(req.ssml)
+	}
+	return path.Join(req.dir(), sanitizeFilename(voice)+"_"+text+req.audioFormat().ext)
+}
+
+// parseCacheFilename splits a legacy "{model}_{text}.{ext}" name, see
+// legacyStorageKey.
+func parseCacheFilename(name string) (modelName, key string, ok bool) {
+	f, isAudio := formatForFile(name)
+	if !isAudio {
+		return "", "", false
+	}
+	modelName, key, ok = strings.Cut(name[:len(name)-len(f.ext)], "_")
+	return modelName, key, ok && modelName != "" && key != ""
+}
+
+// lookupCached stats req's cache entry like statCached. An entry still
+// stored under its legacy name, or under its hash name before a
+// filenameTemplate was set, is first moved to req.key, so existing caches
+// stay valid.
+func lookupCached(ctx context.Context, req ttsRequest) (objectInfo, error) {
+	info, err := statCached(ctx, req.key)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+	legacy := req.legacyStorageKey()
+	if filenameTemplate != nil {
+		if _, lerr := statCached(ctx, req.hashStorageKey()); lerr == nil {
+			legacy = req.hashStorageKey()
+		}
+	}
+	if _, lerr := statCached(ctx, legacy); lerr != nil {
+		return info, err
+	}
+	if merr := moveCacheEntry(ctx, legacy, req.key); merr != nil {
+		logger(ctx).Error("Failed to move legacy cache entry", "from", logPath(legacy), "key", req.key, "error", merr)
+		return info, err
+	}
+	logger(ctx).Info("Moved legacy cache entry", "from", logPath(legacy), "key", req.key)
+	return statCached(ctx, req.key)
+}
+
+// moveCacheEntry renames a cache entry within its deck, along with its index
+// row and manifest entry.
+func moveCacheEntry(ctx context.Context, from, to string) error {
+	data, _, err := cacheStore.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	if err := cacheStore.Put(ctx, to, data); err != nil {
+		return err
+	}
+	if err := indexRename(ctx, from, to); err != nil {
+		logger(ctx).Error("Failed to rename entry in the cache index", "from", logPath(from), "error", err)
+	}
+	if err := renameManifestFile(ctx, keyDeck(to), path.Base(from), path.Base(to)); err != nil {
+		logger(ctx).Error("Failed to update manifest", "deck", keyDeck(to), "error", err)
+	}
+	return cacheStore.Delete(ctx, from)
+}
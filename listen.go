@@ -0,0 +1,115 @@
+package wenbuntts
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The server listens on every address in LISTEN, ":"+PORT by default. An
+// address is host:port, :port or unix:/path/to.sock for a Unix socket, e.g.
+// for a reverse proxy on the same host; the socket gets SOCKET_MODE (0660
+// by default). With ADMIN_LISTEN set, the admin endpoints are only served on
+// its addresses, e.g. a localhost port, and answer 404 elsewhere.
+var adminListenOnly bool
+
+// adminConnKey marks the context of connections accepted on an
+// ADMIN_LISTEN address.
+type adminConnKey struct{}
+
+// adminListener marks the connections it accepts as admin connections.
+type adminListener struct{ net.Listener }
+
+type adminConn struct{ net.Conn }
+
+func (l adminListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return adminConn{c}, nil
+}
+
+// markAdminConn is the server's ConnContext.
+func markAdminConn(ctx context.Context, c net.Conn) context.Context {
+	if _, ok := c.(adminConn); ok {
+		return context.WithValue(ctx, adminConnKey{}, true)
+	}
+	return ctx
+}
+
+// onAdminListener reports whether the request may reach admin endpoints.
+func onAdminListener(ctx context.Context) bool {
+	return !adminListenOnly || ctx.Value(adminConnKey{}) != nil
+}
+
+// openListeners listens on the LISTEN and ADMIN_LISTEN addresses.
+func openListeners() ([]net.Listener, error) {
+	addrs := splitList(setting("LISTEN"))
+	if len(addrs) == 0 {
+		addrs = []string{":" + cmp.Or(setting("PORT"), "8080")}
+	}
+	adminAddrs := splitList(setting("ADMIN_LISTEN"))
+	adminListenOnly = len(adminAddrs) > 0
+	mode := os.FileMode(0660)
+	if v := setting("SOCKET_MODE"); v != "" {
+		m, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || m > 0777 {
+			return nil, fmt.Errorf("Invalid SOCKET_MODE: must be octal permissions such as 0660")
+		}
+		mode = os.FileMode(m)
+	}
+
+	var listeners []net.Listener
+	listen := func(addr string, admin bool) error {
+		var l net.Listener
+		var err error
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			// A socket left behind by a crash would fail the listen.
+			if fi, statErr := os.Stat(path); statErr == nil && fi.Mode()&os.ModeSocket != 0 {
+				os.Remove(path)
+			}
+			if l, err = net.Listen("unix", path); err == nil {
+				err = os.Chmod(path, mode)
+			}
+		} else {
+			l, err = net.Listen("tcp", addr)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to listen on %s: %w", addr, err)
+		}
+		if admin {
+			l = adminListener{l}
+		}
+		listeners = append(listeners, l)
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := listen(addr, false); err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+	}
+	for _, addr := range adminAddrs {
+		if err := listen(addr, true); err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+	}
+	return listeners, nil
+}
+
+func isAdminListener(l net.Listener) bool {
+	_, ok := l.(adminListener)
+	return ok
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
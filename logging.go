@@ -0,0 +1,131 @@
+package wenbuntts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// setupLogging installs the default slog logger: LOG_FORMAT is text (the
+// default) or json, LOG_LEVEL is debug, info (the default), warn or error.
+// The standard log package is routed through it as well.
+func setupLogging() error {
+	var level slog.Level
+	if v := setting("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("Invalid LOG_LEVEL: must be debug, info, warn or error")
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(setting("LOG_FORMAT")) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("Invalid LOG_FORMAT: must be text or json")
+	}
+	slog.SetDefault(slog.New(&recentErrorsHandler{Handler: handler}))
+	return nil
+}
+
+// recentErrors keeps the last maxRecentErrors error log lines for /admin.
+var recentErrors = struct {
+	sync.Mutex
+	lines []recentError
+}{}
+
+const maxRecentErrors = 50
+
+type recentError struct {
+	Time    time.Time      `json:"time"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// recentErrorsHandler copies error records into recentErrors on their way
+// to Handler.
+type recentErrorsHandler struct {
+	slog.Handler
+	attrs []slog.Attr // from WithAttrs, with group prefixes applied
+	group string
+}
+
+func (h *recentErrorsHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		e := recentError{Time: r.Time, Message: r.Message, Attrs: map[string]any{}}
+		for _, a := range h.attrs {
+			addLogAttr(e.Attrs, "", a)
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			addLogAttr(e.Attrs, h.group, a)
+			return true
+		})
+		recentErrors.Lock()
+		if len(recentErrors.lines) == maxRecentErrors {
+			recentErrors.lines = recentErrors.lines[1:]
+		}
+		recentErrors.lines = append(recentErrors.lines, e)
+		recentErrors.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *recentErrorsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := slices.Clone(h.attrs)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + a.Key
+		}
+		prefixed = append(prefixed, a)
+	}
+	return &recentErrorsHandler{Handler: h.Handler.WithAttrs(attrs), attrs: prefixed, group: h.group}
+}
+
+func (h *recentErrorsHandler) WithGroup(name string) slog.Handler {
+	return &recentErrorsHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs, group: h.group + name + "."}
+}
+
+// addLogAttr adds a, flattening groups into dotted keys.
+func addLogAttr(m map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		for _, g := range v.Group() {
+			addLogAttr(m, prefix+a.Key+".", g)
+		}
+		return
+	}
+	if err, ok := v.Any().(error); ok {
+		m[prefix+a.Key] = err.Error()
+		return
+	}
+	m[prefix+a.Key] = v.Any()
+}
+
+type loggerKey struct{}
+
+// withLogAttrs returns a context whose logger adds args to every record.
+func withLogAttrs(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger(ctx).With(args...))
+}
+
+// logger returns the request-scoped logger carried by ctx, or the default.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// textAttr describes text for logs: the text itself (see logText) and a
+// stable hash that survives redaction.
+func textAttr(text string) slog.Attr {
+	return slog.Group("text", slog.String("value", logText(text)), slog.String("hash", shortHash(text)))
+}
@@ -0,0 +1,282 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+)
+
+// With LOUDNESS_TARGET_LUFS set, clips are brought to that integrated
+// loudness before they are cached, so voices and providers that come back
+// at different volumes sound alike. WAV clips are measured and scaled in Go;
+// MP3 and Opus clips need ffmpeg (FFMPEG_PATH, or ffmpeg on the PATH) and
+// are cached as they come without it.
+var (
+	loudnessTarget  float64
+	loudnessEnabled bool
+	ffmpegPath      string
+)
+
+// maxLoudnessGain bounds the correction, so near-silent clips aren't
+// amplified into noise.
+const maxLoudnessGain = 20.0 // dB
+
+// normalizesLoudness reports whether clips in format are normalized.
+func normalizesLoudness(format audioFormat) bool {
+	return loudnessEnabled && (format.encoding == "LINEAR16" || ffmpegPath != "")
+}
+
+func applyLoudnessNormalization(ctx context.Context, audio []byte, format audioFormat) []byte {
+	if !normalizesLoudness(format) {
+		return audio
+	}
+	var normalized []byte
+	var err error
+	if format.encoding == "LINEAR16" {
+		normalized, err = normalizeWAV(audio, loudnessTarget)
+	} else {
+		normalized, err = normalizeWithFFmpeg(ctx, audio, format, loudnessTarget)
+	}
+	if err != nil {
+		logger(ctx).Warn("Skipping loudness normalization", "encoding", format.encoding, "error", err)
+		return audio
+	}
+	return normalized
+}
+
+// loudnessGain is the gain in dB that takes a clip measured at lufs to
+// target.
+func loudnessGain(lufs, target float64) float64 {
+	return max(-maxLoudnessGain, min(maxLoudnessGain, target-lufs))
+}
+
+// normalizeWAV scales the samples of a 16-bit PCM WAV to target LUFS. The
+// gain is lowered if it would clip the loudest sample.
+func normalizeWAV(data []byte, target float64) ([]byte, error) {
+	channels, rate, offset, length, err := wavPCM(data)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]float64, length/2)
+	peak := 0.0
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(data[offset+2*i:]))) / 32768
+		peak = max(peak, math.Abs(samples[i]))
+	}
+	lufs, ok := integratedLoudness(samples, channels, rate)
+	if !ok {
+		return data, nil
+	}
+	gain := math.Pow(10, loudnessGain(lufs, target)/20)
+	if peak > 0 {
+		gain = min(gain, 0.99/peak)
+	}
+
+	out := bytes.Clone(data)
+	for i, s := range samples {
+		v := math.Round(s * gain * 32768)
+		binary.LittleEndian.PutUint16(out[offset+2*i:], uint16(int16(max(-32768, min(32767, v)))))
+	}
+	return out, nil
+}
+
+// wavPCM returns the format of a 16-bit PCM WAV and where its samples are.
+func wavPCM(data []byte) (channels, rate, offset, length int, err error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, 0, 0, 0, errors.New("not a WAV file")
+	}
+	bits := 0
+	for pos := 12; pos+8 <= len(data); {
+		id, size := string(data[pos:pos+4]), int(binary.LittleEndian.Uint32(data[pos+4:pos+8]))
+		body := data[pos+8:]
+		switch {
+		case id == "fmt " && len(body) >= 16:
+			if binary.LittleEndian.Uint16(body[0:2]) != 1 {
+				return 0, 0, 0, 0, errors.New("WAV is not PCM")
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bits = int(binary.LittleEndian.Uint16(body[14:16]))
+		case id == "data":
+			if bits != 16 || channels == 0 || rate == 0 {
+				return 0, 0, 0, 0, fmt.Errorf("unsupported WAV format: %d-bit, %d channels", bits, channels)
+			}
+			// Streamed WAVs may leave the size unset; use what is there.
+			size = min(size, len(body))
+			return channels, rate, pos + 8, size - size%(2*channels), nil
+		}
+		pos += 8 + size + size%2
+	}
+	return 0, 0, 0, 0, errors.New("WAV has no data chunk")
+}
+
+// biquad is a second-order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x1, f.x2, f.y1, f.y2 = x, f.x1, y, f.y1
+	return y
+}
+
+// kWeighting returns the two stages of the ITU-R BS.1770 K-weighting
+// filter, a high shelf and a high pass, designed for rate.
+func kWeighting(rate int) (shelf, highPass biquad) {
+	// High shelf: +4 dB above about 1.5 kHz.
+	a := math.Pow(10, 4.0/40)
+	w0 := 2 * math.Pi * 1500 / float64(rate)
+	alpha := math.Sin(w0) / (2 / math.Sqrt2)
+	cos := math.Cos(w0)
+	a0 := (a + 1) - (a-1)*cos + 2*math.Sqrt(a)*alpha
+	shelf = biquad{
+		b0: a * ((a + 1) + (a-1)*cos + 2*math.Sqrt(a)*alpha) / a0,
+		b1: -2 * a * ((a - 1) + (a+1)*cos) / a0,
+		b2: a * ((a + 1) + (a-1)*cos - 2*math.Sqrt(a)*alpha) / a0,
+		a1: 2 * ((a - 1) - (a+1)*cos) / a0,
+		a2: ((a + 1) - (a-1)*cos - 2*math.Sqrt(a)*alpha) / a0,
+	}
+
+	// High pass at 38 Hz.
+	w0 = 2 * math.Pi * 38 / float64(rate)
+	alpha = math.Sin(w0) / (2 * 0.5)
+	cos = math.Cos(w0)
+	a0 = 1 + alpha
+	highPass = biquad{
+		b0: (1 + cos) / 2 / a0,
+		b1: -(1 + cos) / a0,
+		b2: (1 + cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+	return shelf, highPass
+}
+
+// integratedLoudness measures interleaved samples in LUFS as BS.1770 does:
+// K-weighted mean square over 400 ms blocks overlapping by 75%, gated at
+// -70 LUFS and then at 10 LU below the mean of the remaining blocks. Clips
+// shorter than one block are measured as a whole. It reports false for
+// silence.
+func integratedLoudness(samples []float64, channels, rate int) (float64, bool) {
+	frames := len(samples) / channels
+	power := make([]float64, frames) // K-weighted square, summed over channels
+	for c := range channels {
+		shelf, highPass := kWeighting(rate)
+		for i := range frames {
+			y := highPass.process(shelf.process(samples[i*channels+c]))
+			power[i] += y * y
+		}
+	}
+	loudness := func(meanSquare float64) float64 { return -0.691 + 10*math.Log10(meanSquare) }
+
+	block, step := rate*4/10, rate/10
+	var blocks []float64
+	for start := 0; start+block <= frames; start += step {
+		sum := 0.0
+		for _, p := range power[start : start+block] {
+			sum += p
+		}
+		blocks = append(blocks, sum/float64(block))
+	}
+	if len(blocks) == 0 {
+		sum := 0.0
+		for _, p := range power {
+			sum += p
+		}
+		if sum == 0 {
+			return 0, false
+		}
+		return loudness(sum / float64(max(frames, 1))), true
+	}
+
+	gated := func(threshold float64) (float64, int) {
+		sum, n := 0.0, 0
+		for _, z := range blocks {
+			if z > 0 && loudness(z) > threshold {
+				sum, n = sum+z, n+1
+			}
+		}
+		return sum, n
+	}
+	sum, n := gated(-70)
+	if n == 0 {
+		return 0, false
+	}
+	sum, n = gated(loudness(sum/float64(n)) - 10)
+	if n == 0 {
+		return 0, false
+	}
+	return loudness(sum / float64(n)), true
+}
+
+// ffmpegEncoders are the output options that re-encode each format.
+var ffmpegEncoders = map[string][]string{
+	"MP3":      {"-c:a", "libmp3lame", "-f", "mp3"},
+	"OGG_OPUS": {"-c:a", "libopus", "-f", "ogg"},
+	"MULAW":    {"-c:a", "pcm_mulaw", "-f", "wav"},
+	"ALAW":     {"-c:a", "pcm_alaw", "-f", "wav"},
+}
+
+// normalizeWithFFmpeg measures audio with ffmpeg's loudnorm filter, then
+// re-encodes it with the gain that reaches target. A plain volume change
+// keeps the sample rate, which loudnorm itself would raise to 192 kHz.
+func normalizeWithFFmpeg(ctx context.Context, audio []byte, format audioFormat, target float64) ([]byte, error) {
+	var stderr bytes.Buffer
+	measure := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-nostats", "-i", "pipe:0",
+		"-af", "loudnorm=print_format=json", "-f", "null", "-")
+	measure.Stdin, measure.Stderr = bytes.NewReader(audio), &stderr
+	if err := measure.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg measure: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+	// loudnorm prints its JSON summary last.
+	out := stderr.Bytes()
+	start := bytes.LastIndexByte(out, '{')
+	if start < 0 {
+		return nil, errors.New("ffmpeg printed no loudness summary")
+	}
+	var summary struct {
+		InputI string `json:"input_i"`
+	}
+	if err := json.Unmarshal(out[start:], &summary); err != nil {
+		return nil, fmt.Errorf("ffmpeg loudness summary: %w", err)
+	}
+	lufs, err := strconv.ParseFloat(summary.InputI, 64)
+	if err != nil || math.IsInf(lufs, 0) {
+		// Silence measures as -inf; there is nothing to normalize.
+		return audio, nil
+	}
+
+	return ffmpegFilter(ctx, audio, format, fmt.Sprintf("volume=%.2fdB", loudnessGain(lufs, target)))
+}
+
+// ffmpegFilter re-encodes audio in format through an ffmpeg audio filter
+// graph.
+func ffmpegFilter(ctx context.Context, audio []byte, format audioFormat, filter string) ([]byte, error) {
+	encoder, ok := ffmpegEncoders[format.encoding]
+	if !ok {
+		return nil, fmt.Errorf("no ffmpeg encoder for %s", format.encoding)
+	}
+	var encoded, stderr bytes.Buffer
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-af", filter}
+	cmd := exec.CommandContext(ctx, ffmpegPath, append(append(args, encoder...), "pipe:1")...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(audio), &encoded, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+	return encoded.Bytes(), nil
+}
+
+// lastLine returns the last non-empty line of out, where ffmpeg puts its
+// error.
+func lastLine(out []byte) string {
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	return string(lines[len(lines)-1])
+}
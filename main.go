@@ -1,173 +1,675 @@
-package main
+package wenbuntts
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"cmp"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"unicode/utf8"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Built-in defaults, overridden by DEFAULT_LANGUAGE, DEFAULT_VOICE and
+// SPEAKING_RATE.
 const (
-	languageCode  = "cmn-CN"
-	defaultName   = "cmn-CN-Wavenet-B"
-	audioEncoding = "MP3"
-	speakingRate  = 0.9
+	languageCode        = "cmn-CN"
+	builtinVoice        = "cmn-CN-Wavenet-B"
+	builtinSpeakingRate = 0.9
 )
 
 var allowedModels = [3]string{"cmn-CN-Chirp3-HD-Achernar", "cmn-CN-Wavenet-A", "cmn-CN-Wavenet-B"}
 
 var (
-	apiKey    string
 	outputDir string
+	history   *generationHistory
+
+	inferLangFromVoice bool
+	cacheControl       string
+	progressiveVoice   string
+
+	maxTextLength   int
+	voiceMaxLengths map[string]int
+
+	upstreamStatus *upstreamHealth
+
+	// fallbackProviders are tried in order when a request's provider fails.
+	fallbackProviders []provider
+
+	asyncJobRetention time.Duration
 )
 
-func main() {
+// Main runs the wenbun-tts-generator command with args (without the program
+// name): serve (the default), generate, purge, sweep, export, import or
+// migrate.
+func Main(args []string) {
+	processEnv = environNames()
 	_ = godotenv.Load()
 
-	apiKey = os.Getenv("GOOGLE_API_KEY")
-	if apiKey == "" {
-		log.Fatal("Missing GOOGLE_API_KEY in .env")
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
+	switch cmd {
+	case "serve":
+		runServe(args)
+	case "generate":
+		runGenerate(args)
+	case "purge":
+		runPurge(args)
+	case "sweep":
+		runSweep(args)
+	case "export":
+		runExport(args)
+	case "import":
+		runImport(args)
+	case "migrate":
+		runMigrate(args)
+	default:
+		log.Fatalf("Unknown command %q: must be serve, generate, purge, sweep, export, import or migrate", cmd)
+	}
+}
 
-	outputDir = os.Getenv("OUTPUT_DIR")
-	if outputDir == "" {
-		outputDir = "./audio"
+// fatal and fatalf stop setup on a bad setting. The commands exit, while New
+// returns the message as its error.
+var (
+	fatal  = log.Fatal
+	fatalf = log.Fatalf
+)
+
+// setup loads the configuration with fs's flags and prepares providers, the
+// cache and everything else the subcommands share. The returned function
+// flushes telemetry and closes the cache index.
+func setup(fs *flag.FlagSet, args []string) (cleanup func()) {
+	if err := loadConfig(fs, args); err != nil {
+		fatal(err)
+	}
+	if err := setupLogging(); err != nil {
+		fatal(err)
 	}
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Fatalf("Failed to create output dir: %v", err)
+	if err := setupUpstreamClient(); err != nil {
+		fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	err := loadSecrets(ctx)
+	cancel()
+	if err != nil {
+		fatal(err)
 	}
 
-	http.HandleFunc("/tts", handleTTS)
+	providerName := setting("TTS_PROVIDER")
+	if providerName == "" {
+		providerName = "google"
+		// Without cloud credentials, fall back to local synthesis.
+		if setting("GOOGLE_API_KEY") == "" && setting("GOOGLE_API_KEYS") == "" && setting("GOOGLE_AUTH") != "adc" {
+			providerName = "piper"
+		}
+	}
+	if err := setupProviders(providerName); err != nil {
+		fatalf("Failed to set up TTS provider: %v", err)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	for _, name := range splitList(setting("TTS_FALLBACK_PROVIDERS")) {
+		p, ok := providers[name]
+		if !ok {
+			fatalf("Invalid TTS_FALLBACK_PROVIDERS: %s is not a configured provider", name)
+		}
+		fallbackProviders = append(fallbackProviders, p)
 	}
+	breakerFailures = envInt("CIRCUIT_BREAKER_FAILURES", 5)
+	breakerCooldown = envDuration("CIRCUIT_BREAKER_COOLDOWN", 30*time.Second)
+	setupBreakers()
 
-	log.Printf("Server running at http://localhost:%s/tts?text=你好世界", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
+	switch backend := setting("CACHE_BACKEND"); backend {
+	case "", "disk":
+		outputDir = setting("OUTPUT_DIR")
+		if outputDir == "" {
+			outputDir = "./audio"
+		}
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			fatalf("Failed to create output dir: %v", err)
+		}
+		disk := diskStorage{outputDir}
+		disk.removeStaleTemps()
+		cacheStore = disk
+	case "s3":
+		s, err := newS3Storage()
+		if err != nil {
+			fatalf("Failed to set up S3 cache: %v", err)
+		}
+		cacheStore = s
+	case "gcs":
+		s, err := newGCSStorage()
+		if err != nil {
+			fatalf("Failed to set up GCS cache: %v", err)
+		}
+		cacheStore = s
+	default:
+		fatalf("Invalid CACHE_BACKEND: must be disk, s3 or gcs")
+	}
+	if v := setting("MEMORY_CACHE_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			fatal("Invalid MEMORY_CACHE_BYTES: must be a positive number of bytes")
+		}
+		hotCache = newMemoryCache(cacheStore, n)
+		cacheStore = hotCache
+	}
+	indexPath := setting("CACHE_INDEX_PATH")
+	if indexPath == "" {
+		indexPath = "./cache-index.db"
+		if outputDir != "" {
+			indexPath = filepath.Join(outputDir, "index.db")
+		}
+	}
+	if v := setting("REDIS_URL"); v != "" {
+		if redisClient, err = newRedisPool(v); err != nil {
+			fatalf("Invalid REDIS_URL: %v", err)
+		}
+		redisPrefix = cmp.Or(setting("REDIS_PREFIX"), redisPrefix)
+		redisLockTTL = envDuration("REDIS_LOCK_TTL", redisLockTTL)
+		if redisLockTTL < time.Second {
+			fatal("Invalid REDIS_LOCK_TTL: must be at least 1s")
+		}
+	}
+	if err := openCacheIndex(indexPath); err != nil {
+		fatalf("Failed to open cache index: %v", err)
+	}
+	if err := syncCacheIndex(context.Background()); err != nil {
+		fatalf("Failed to sync cache index: %v", err)
+	}
+
+	shutdownTelemetry, err := setupTelemetry(context.Background())
+	if err != nil {
+		fatalf("Failed to set up telemetry: %v", err)
+	}
+	cleanup = func() {
+		if err := cacheIndex.Close(); err != nil {
+			slog.Error("Failed to close cache index", "error", err)
+		}
+		shutdownTelemetry(context.Background())
+	}
 
-func isValidText(text string) bool {
-	if utf8.RuneCountInString(text) > 5 {
-		return false
+	history = newGenerationHistory(envDuration("HISTORY_RETENTION", 24*time.Hour))
+	asyncJobRetention = envDuration("ASYNC_JOB_RETENTION", 10*time.Minute)
+	compressionLevel = envInt("COMPRESSION_LEVEL", 5)
+	if compressionLevel < 0 || compressionLevel > 9 {
+		fatal("Invalid COMPRESSION_LEVEL: must be between 0 (off) and 9")
+	}
+	compressionBrotli = setting("COMPRESSION_BROTLI") == "true"
+	stateFile = setting("STATE_FILE")
+	stateSaveInterval = envDuration("STATE_SAVE_INTERVAL", time.Minute)
+	if stateSaveInterval <= 0 {
+		fatal("Invalid STATE_SAVE_INTERVAL: must be positive")
+	}
+
+	upstreamStatus = newUpstreamHealth(
+		envDuration("READY_ERROR_WINDOW", time.Minute),
+		envFloat("READY_ERROR_THRESHOLD", 0.5),
+		envInt("READY_MIN_SAMPLES", 10),
+	)
+	textAliases, err = parseTextAliases(setting("TEXT_ALIASES"))
+	if err != nil {
+		fatalf("Invalid TEXT_ALIASES: %v", err)
+	}
+	heteronymMode = cmp.Or(setting("HETERONYM_MODE"), "warn")
+	if heteronymMode != "warn" && heteronymMode != "apply" {
+		fatal("Invalid HETERONYM_MODE: must be warn or apply")
 	}
-	// \\p{Han} is a Unicode property that matches Han characters.
-	match, _ := regexp.MatchString(`^[\p{Han}]+$`, text)
-	return match
+	heteronymOverrides, err = parsePinyinHints(setting("HETERONYM_OVERRIDES"))
+	if err != nil {
+		fatalf("Invalid HETERONYM_OVERRIDES: %v", err)
+	}
+	voicePool = splitList(setting("VOICE_POOL"))
+	dialogueVoices, err = parseDialogueVoices(setting("DIALOGUE_VOICES"))
+	if err != nil {
+		fatalf("Invalid DIALOGUE_VOICES: %v", err)
+	}
+	leadInTrim = time.Duration(envInt("LEADIN_TRIM_MS", 0)) * time.Millisecond
+	leadInTrimVoices = splitList(setting("LEADIN_TRIM_VOICES"))
+	maxTextLength = envInt("MAX_TEXT_LENGTH", 5)
+	if maxTextLength == 0 {
+		fatal("Invalid MAX_TEXT_LENGTH: must be at least 1")
+	}
+	voiceMaxLengths, err = parseVoiceMaxLengths(setting("VOICE_MAX_LENGTHS"))
+	if err != nil {
+		fatalf("Invalid VOICE_MAX_LENGTHS: %v", err)
+	}
+	if path := setting("AUDIT_LOG"); path != "" {
+		if err := openAuditLog(path); err != nil {
+			fatalf("Failed to open audit log: %v", err)
+		}
+	}
+	inferLangFromVoice = setting("INFER_LANG_FROM_VOICE") != "false"
+	verbalizeNumbers = setting("VERBALIZE_NUMBERS") == "true"
+	if v := setting("YEAR_READING"); v != "" {
+		if yearReading, err = parseYearReading(v); err != nil {
+			fatalf("Invalid YEAR_READING: %v", err)
+		}
+	}
+	reloadable, err := readReloadable()
+	if err != nil {
+		fatal(err)
+	}
+	reloadable.apply()
+	ffmpegPath, _ = exec.LookPath(cmp.Or(setting("FFMPEG_PATH"), "ffmpeg"))
+	transcodeCached = setting("TRANSCODE_CACHED") != "false"
+	transcodeFailPolicy = cmp.Or(setting("TRANSCODE_FAIL_POLICY"), "error")
+	if transcodeFailPolicy != "error" && transcodeFailPolicy != "degrade" {
+		fatal("Invalid TRANSCODE_FAIL_POLICY: must be error or degrade")
+	}
+	if v := setting("LOUDNESS_TARGET_LUFS"); v != "" {
+		loudnessTarget, err = strconv.ParseFloat(v, 64)
+		if err != nil || loudnessTarget < -70 || loudnessTarget > -5 {
+			fatal("Invalid LOUDNESS_TARGET_LUFS: must be between -70 and -5")
+		}
+		loudnessEnabled = true
+	}
+	silenceThreshold = envFloat("SILENCE_THRESHOLD_DB", -50)
+	defaultSilence, err = parseSilenceEdit(url.Values{
+		"trimSilence": {setting("SILENCE_TRIM")},
+		"padStartMs":  {setting("SILENCE_PAD_START_MS")},
+		"padEndMs":    {setting("SILENCE_PAD_END_MS")},
+	})
+	if err != nil {
+		fatalf("Invalid silence settings: %v", err)
+	}
+	if ffmpegPath == "" && (loudnessEnabled || defaultSilence.active()) {
+		slog.Warn("ffmpeg not found; only WAV clips will be loudness-normalized or trimmed")
+	}
+	if v := setting("SAMPLE_RATE_HERTZ"); v != "" {
+		if defaultSampleRate, err = parseSampleRate(v); err != nil {
+			fatalf("Invalid SAMPLE_RATE_HERTZ: %v", err)
+		}
+	}
+	if v := setting("MP3_BITRATE"); v != "" {
+		if defaultBitrate, err = parseBitrate(v); err != nil {
+			fatalf("Invalid MP3_BITRATE: %v", err)
+		}
+	}
+	if v := setting("AUDIO_FORMAT"); v != "" {
+		f, ok := parseFormat(v)
+		if !ok {
+			fatalf("Invalid AUDIO_FORMAT: must be one of %s", strings.Join(slices.Sorted(maps.Keys(audioFormats)), ", "))
+		}
+		defaultFormat = f
+	}
+	speedPresets, err = parseSpeedPresets(setting("SPEED_PRESETS"))
+	if err != nil {
+		fatalf("Invalid SPEED_PRESETS: %v", err)
+	}
+	progressiveVoice = setting("PROGRESSIVE_VOICE")
+	if progressiveVoice == "" {
+		progressiveVoice = "cmn-CN-Standard-A"
+	}
+	redactLogText = setting("LOG_REDACT_TEXT") == "true"
+	serveOnly = setting("SERVE_ONLY") == "true"
+	readyProviderPing = setting("READY_PROVIDER_PING") == "true"
+	adminToken = setting("ADMIN_TOKEN")
+	apiKeys = splitList(setting("API_KEYS"))
+	keys, err := parseTenantKeys(setting("TENANT_KEYS"))
+	if err != nil {
+		fatal(err)
+	}
+	tenantKeys = keys
+	cacheNamespaceByKey = setting("CACHE_NAMESPACE_BY_KEY") == "true"
+	cacheNamespaceSalt = []byte(setting("CACHE_NAMESPACE_SALT"))
+	if cacheNamespaceByKey && len(cacheNamespaceSalt) == 0 {
+		fatal("Invalid CACHE_NAMESPACE_BY_KEY: needs CACHE_NAMESPACE_SALT, which must never change")
+	}
+	if cacheNamespaceByKey && len(apiKeys) == 0 {
+		fatal("Invalid CACHE_NAMESPACE_BY_KEY: needs API_KEYS, whose keys it namespaces")
+	}
+	apiKeys = append(apiKeys, slices.Sorted(maps.Keys(tenantKeys))...)
+	ankiConnectURL = setting("ANKICONNECT_URL")
+	ankiConnectKey = setting("ANKICONNECT_KEY")
+	// SERVE_ONLY never calls the provider, so its voices don't matter.
+	if setting("VALIDATE_DEFAULT_VOICE") == "true" && !serveOnly {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		checkDefaultVoice(ctx, setting("STRICT_STARTUP") == "true")
+		cancel()
+	}
+	cacheControl = "public, max-age=31536000, immutable"
+	if v, ok := lookupSetting("CACHE_CONTROL"); ok {
+		cacheControl = v
+	}
+	ttsCacheControl = cmp.Or(setting("TTS_CACHE_CONTROL"), cacheControl)
+	urlSigningSecret = []byte(setting("URL_SIGNING_SECRET"))
+	webhookSecret = []byte(setting("WEBHOOK_SECRET"))
+	webhookHosts = splitList(setting("WEBHOOK_HOSTS"))
+	signedURLTTL = envDuration("SIGNED_URL_TTL", time.Hour)
+	if signedURLTTL <= 0 || signedURLTTL > maxSignedURLTTL {
+		fatal("Invalid SIGNED_URL_TTL: must be a duration up to 168h")
+	}
+	if trustedProxies, err = parseIPPrefixes("TRUSTED_PROXIES", setting("TRUSTED_PROXIES")); err != nil {
+		fatal(err)
+	}
+	if ipAllow, err = parseIPPrefixes("IP_ALLOW", setting("IP_ALLOW")); err != nil {
+		fatal(err)
+	}
+	if ipDeny, err = parseIPPrefixes("IP_DENY", setting("IP_DENY")); err != nil {
+		fatal(err)
+	}
+	if missIPAllow, err = parseIPPrefixes("MISS_IP_ALLOW", setting("MISS_IP_ALLOW")); err != nil {
+		fatal(err)
+	}
+	sentenceMaxLength = envInt("SENTENCE_MAX_LENGTH", 60)
+	sentenceDailyChars = envInt("SENTENCE_DAILY_CHARS", 0)
+	failureTTL = envDuration("FAILURE_CACHE_TTL", time.Minute)
+	voiceListTTL = envDuration("VOICES_CACHE_TTL", time.Hour)
+	if n := envInt("MAX_UPSTREAM_CONCURRENCY", 0); n > 0 {
+		upstreamSlots = make(chan struct{}, n)
+	}
+	upstreamQueueTimeout = envDuration("UPSTREAM_QUEUE_TIMEOUT", 10*time.Second)
+	upstreamTimeout = envDuration("UPSTREAM_TIMEOUT", 30*time.Second)
+	retryAttempts = envInt("TTS_RETRY_ATTEMPTS", 3)
+	if retryAttempts == 0 {
+		fatal("Invalid TTS_RETRY_ATTEMPTS: must be at least 1")
+	}
+	retryBaseDelay = envDuration("TTS_RETRY_BASE_DELAY", 200*time.Millisecond)
+	cacheTTL = envDuration("CACHE_TTL", 0)
+	verifyOnServe = setting("VERIFY_ON_SERVE") == "true"
+	if v := setting("MAX_CACHE_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			fatal("Invalid MAX_CACHE_BYTES: must be a positive number of bytes")
+		}
+		maxCacheBytes = n
+		switch setting("CACHE_EVICT_POLICY") {
+		case "", "lru":
+		case "created":
+			evictOldest = true
+		default:
+			fatal("Invalid CACHE_EVICT_POLICY: must be lru or created")
+		}
+		go runEvictor(envDuration("CACHE_EVICT_INTERVAL", time.Minute))
+	}
+	if v := setting("CACHE_HASH"); v != "" {
+		h, ok := cacheHashers[v]
+		if !ok {
+			fatalf("Invalid CACHE_HASH: must be one of %s", strings.Join(slices.Sorted(maps.Keys(cacheHashers)), ", "))
+		}
+		keyHasher = h
+	}
+	if v := setting("FILENAME_TEMPLATE"); v != "" {
+		if filenameTemplate, err = parseFilenameTemplate(v); err != nil {
+			fatalf("Invalid FILENAME_TEMPLATE: %v", err)
+		}
+	}
+	sweepInterval = envDuration("CACHE_SWEEP_INTERVAL", 0)
+	retryQueueAttempts = envInt("RETRY_QUEUE_ATTEMPTS", 5)
+	retryQueueDelay = envDuration("RETRY_QUEUE_DELAY", 5*time.Minute)
+	sweepRegenerate = setting("CACHE_SWEEP_REGENERATE") == "true"
+	return cleanup
 }
 
-func handleTTS(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
+// runServe runs the HTTP server until SIGINT or SIGTERM.
+func runServe(args []string) {
+	defer setup(flag.NewFlagSet("serve", flag.ExitOnError), args)()
 
-	text := query.Get("text")
-	if text == "" {
-		http.Error(w, "Missing ?text= parameter", http.StatusBadRequest)
-		return
+	registerRoutes()
+	if stateFile != "" {
+		loadState(stateFile)
 	}
 
-	if !isValidText(text) {
-		http.Error(w, "Invalid text: must be all Chinese characters with a max length of 5", http.StatusBadRequest)
-		return
+	listeners, err := openListeners()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range listeners {
+		slog.Info("Server running", "addr", l.Addr().String(), "admin", isAdminListener(l))
+	}
+	srv := &http.Server{Handler: serverHandler(), ConnContext: markAdminConn}
+	if err := configureTLS(srv); err != nil {
+		log.Fatal(err)
+	}
+	startGRPC(srv)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdownCtx = ctx
+	go reloadOnSignal(ctx)
+	warmupConcurrency = max(envInt("WARMUP_CONCURRENCY", 4), 1)
+	popularWarmCount = envInt("POPULAR_WARM_COUNT", 0)
+	if path := setting("WARMUP_FILE"); path != "" {
+		go warmUpFile(ctx, path)
+	}
+	if popularWarmCount > 0 {
+		go func() {
+			if err := warmPopular(ctx, popularWarmCount); err != nil {
+				slog.Error("Failed to read the most requested items", "error", err)
+			}
+		}()
+	}
+	if sweepInterval > 0 {
+		go runSweeper(ctx, sweepInterval)
+	}
+	if retryQueueAttempts > 0 {
+		go runRetryQueue(ctx)
+	}
+	if redisClient != nil {
+		go watchIndexChanges(ctx)
+	}
+	if stateFile != "" {
+		go runStateSaver(ctx)
 	}
+	if v := setting("MAINTENANCE_SCHEDULE"); v != "" {
+		tasks, err := parseMaintenanceSchedule(v)
+		if err != nil {
+			fatalf("Invalid MAINTENANCE_SCHEDULE: %v", err)
+		}
+		go runScheduler(ctx, tasks)
+	}
+
+	if err := serveUntilSignal(srv, listeners, envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)); err != nil {
+		slog.Error("Shutdown incomplete", "error", err)
+	}
+	if stateFile != "" {
+		if err := saveState(stateFile); err != nil {
+			slog.Error("Failed to save state file", "path", stateFile, "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
 
-	modelName := query.Get("model")
-	if modelName == "" {
-		modelName = defaultName
+// registerRoutes registers the HTTP API on http.DefaultServeMux.
+func registerRoutes() {
+	http.HandleFunc("/tts", withJSONBody(countRequests(requireAPIKey(limitRate(limitInflightPerIP(handleTTS))))))
+	http.HandleFunc("/tts/status", requireAPIKey(handleTTSStatus))
+	http.HandleFunc("/tts/batch", requireAPIKey(limitRate(limitInflightPerIP(handleTTSBatch))))
+	http.HandleFunc("/tts/tones", requireAPIKey(limitRate(limitInflightPerIP(handleTTSTones))))
+	http.HandleFunc("/tts/compare", requireAPIKey(limitRate(limitInflightPerIP(handleTTSCompare))))
+	http.HandleFunc("/tts/any", requireAPIKey(limitRate(handleTTSAny)))
+	http.HandleFunc("GET /audio/{file...}", allowSignedURL(requireAPIKey(handleAudio)))
+	http.HandleFunc("GET /audio/sign", requireAPIKey(handleAudioSign))
+	http.HandleFunc("/tts/estimate", requireAPIKey(limitRate(handleTTSEstimate)))
+	http.HandleFunc("/tts/concat", requireAPIKey(limitRate(limitInflightPerIP(handleTTSConcat))))
+	http.HandleFunc("POST /tts/dialogue", requireAPIKey(limitRate(limitInflightPerIP(handleTTSDialogue))))
+	http.HandleFunc("GET /tts/pair", requireAPIKey(limitRate(limitInflightPerIP(handleTTSPair))))
+	http.HandleFunc("GET /tts/stream", withQueryAPIKey(requireAPIKey(limitRate(limitInflightPerIP(handleTTSStream)))))
+	http.HandleFunc("/jobs", requireAPIKey(limitRate(limitInflightPerIP(handleJobsCreate))))
+	http.HandleFunc("/jobs/{id}", requireAPIKey(handleJobStatus))
+	http.HandleFunc("/jobs/{id}/events", requireAPIKey(handleJobEvents))
+	http.HandleFunc("/voices", requireAPIKey(limitRate(handleVoices)))
+	http.HandleFunc("/cache/tar", requireAPIKey(limitRate(limitInflightPerIP(handleCacheTar))))
+	http.HandleFunc("/cache/zip", requireAPIKey(limitRate(limitInflightPerIP(handleCacheZip))))
+	http.HandleFunc("/cache/anki", requireAPIKey(limitRate(limitInflightPerIP(handleCacheAnki))))
+	http.HandleFunc("/import/wenbun", requireAPIKey(limitRate(limitInflightPerIP(handleImportWenBun))))
+	http.HandleFunc("/import/csv", requireAPIKey(limitRate(limitInflightPerIP(handleImportCSV))))
+	if ankiConnectURL != "" {
+		http.HandleFunc("/anki/push", requireAPIKey(limitRate(limitInflightPerIP(handleAnkiPush))))
 	}
-	
-	if allowedModels[0] != modelName && allowedModels[1] != modelName && allowedModels[2] != modelName {
-		http.Error(w, "Invalid model: must be one of "+strings.Join(allowedModels[:], ", "), http.StatusBadRequest)
-		return
+	http.HandleFunc("/cache", requireAdmin(handleCacheList))
+	http.HandleFunc("/cache/entry", requireAdmin(handleCacheEntry))
+	http.HandleFunc("/cache/purge", requireAdmin(handleCachePurge))
+	http.HandleFunc("/cache/warmup", requireAdmin(handleCacheWarmup))
+	http.HandleFunc("/cache/sweep", requireAdmin(handleCacheSweep))
+	http.HandleFunc("/cache/retries", requireAdmin(handleCacheRetries))
+	http.HandleFunc("GET /cache/export", requireAdmin(handleCacheExport))
+	http.HandleFunc("POST /cache/import", requireAdmin(handleCacheImport))
+	http.HandleFunc("/stats", requireStatsAccess(handleStats))
+	http.HandleFunc("/stats/history", requireStatsAccess(handleStatsHistory))
+	http.HandleFunc("/stats/cache", requireStatsAccess(handleStatsCache))
+	http.HandleFunc("/stats/usage", requireStatsAccess(handleStatsUsage))
+	http.HandleFunc("/stats/keys", requireAdmin(handleStatsKeys))
+	http.HandleFunc("/admin", requireAdmin(handleAdmin))
+	http.HandleFunc("POST /admin/reload", requireAdmin(handleAdminReload))
+	http.HandleFunc("GET /{$}", handlePlayground)
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+	if metricsHandler != nil {
+		http.Handle("/metrics", metricsHandler)
 	}
+	http.HandleFunc("/v1/", handleV1(http.DefaultServeMux))
+	http.HandleFunc("GET /v1/openapi.json", handleOpenAPI)
+}
 
-	// don't allow reset
-	// reset := query.Get("reset") == "true"
-	reset := false
+// serverHandler is http.DefaultServeMux behind the middleware every request
+// goes through.
+func serverHandler() http.Handler {
+	return accessLog(compressResponses(filterClientIPs(allowCORS(http.DefaultServeMux))))
+}
 
-	filename := sanitizeFilename(fmt.Sprintf("%s_%s", modelName, text)) + ".mp3"
-	filePath := filepath.Join(outputDir, filename)
+// envDuration reads a positive duration (see parseDuration) from the environment, falling back to def when unset.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := setting(name)
+	if v == "" {
+		return def
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		fatalf("Invalid %s: %q", name, v)
+	}
+	return d
+}
 
-	// Skip cache if reset=true
-	if !reset {
-		if _, err := os.Stat(filePath); err == nil {
-			log.Printf("Serving cached file: %s", filePath)
-			w.Header().Set("Content-Type", "audio/mpeg")
-			http.ServeFile(w, r, filePath)
-			return
+// parseDuration parses a positive duration. Besides Go durations it accepts
+// whole days, e.g. "30d".
+func parseDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
 		}
-	} else {
-		log.Printf("Cache reset requested for: %s", text)
+		return time.Duration(n) * 24 * time.Hour, nil
 	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
 
-	log.Printf("Generating new file for text: %s (model: %s)", text, modelName)
-
-	apiURL := fmt.Sprintf("https://texttospeech.googleapis.com/v1/text:synthesize?key=%s", apiKey)
-	payload := fmt.Sprintf(`{
-		"input": {"text": %q},
-		"voice": {"languageCode": "%s", "name": "%s"},
-		"audioConfig": {"audioEncoding": "%s", "speakingRate": %.2f}
-	}`, text, languageCode, modelName, audioEncoding, speakingRate)
-
-	resp, err := http.Post(apiURL, "application/json", io.NopCloser(strings.NewReader(payload)))
+// envInt reads a non-negative integer from the environment, falling back to def when unset.
+func envInt(name string, def int) int {
+	n, err := intSetting(name, def)
 	if err != nil {
-		http.Error(w, "TTS request failed: "+err.Error(), http.StatusInternalServerError)
-		return
+		fatal(err)
 	}
-	defer resp.Body.Close()
+	return n
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	// log.Printf("Response body: %s", string(body)) // debug print
+// intSetting is envInt returning an invalid value as an error.
+func intSetting(name string, def int) (int, error) {
+	v := setting(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid %s: %q", name, v)
+	}
+	return n, nil
+}
 
-	var result struct {
-		AudioContent string `json:"audioContent"`
-		Error        any    `json:"error,omitempty"`
+// envFloat reads a number between 0 and 1 from the environment, falling back to def when unset.
+func envFloat(name string, def float64) float64 {
+	v := setting(name)
+	if v == "" {
+		return def
 	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		http.Error(w, "Failed to parse response: "+err.Error(), http.StatusInternalServerError)
-		return
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		fatalf("Invalid %s: %q", name, v)
 	}
+	return f
+}
 
-	if result.AudioContent == "" {
-		http.Error(w, "No audio content in response", http.StatusInternalServerError)
-		return
+// splitList splits a comma-separated config value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
 	}
+	return items
+}
 
-	audio, err := base64.StdEncoding.DecodeString(result.AudioContent)
-	if err != nil {
-		http.Error(w, "Failed to decode audio: "+err.Error(), http.StatusInternalServerError)
-		return
+// maxTextLengthFor returns the max input length in runes for modelName
+// speaking language, from VOICE_MAX_LENGTHS if it has an entry, then the
+// language's rule, otherwise MAX_TEXT_LENGTH.
+func maxTextLengthFor(modelName, language string) int {
+	if n, ok := voiceMaxLengths[modelName]; ok {
+		return n
+	}
+	if n := ruleFor(language).maxLength; n > 0 {
+		return n
 	}
+	return maxTextLength
+}
 
-	// Save the new file
-	if err := os.WriteFile(filePath, audio, 0644); err != nil {
-		http.Error(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
-		return
+// parseVoiceMaxLengths parses a comma-separated list of voice:length pairs.
+func parseVoiceMaxLengths(s string) (map[string]int, error) {
+	lengths := map[string]int{}
+	for _, pair := range splitList(s) {
+		voice, length, _ := strings.Cut(pair, ":")
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid entry %q: want voice:length", pair)
+		}
+		lengths[strings.TrimSpace(voice)] = n
 	}
+	return lengths, nil
+}
 
-	log.Printf("Saved new file: %s", filePath)
+var voiceLanguagePattern = regexp.MustCompile(`^([a-z]{2,3}-[A-Z]{2})-`)
 
-	// Serve the newly created file
-	w.Header().Set("Content-Type", "audio/mpeg")
-	http.ServeFile(w, r, filePath)
+// languageFor returns the language code to send for modelName. Google voice
+// names start with their language (e.g. yue-HK-Standard-A), and a mismatched
+// languageCode is rejected upstream, so the prefix wins unless
+// INFER_LANG_FROM_VOICE=false. The cache key has the voice name, and any
+// other language besides, see ttsRequest.tuning.
+func languageFor(modelName string) string {
+	if inferLangFromVoice {
+		if m := voiceLanguagePattern.FindStringSubmatch(modelName); m != nil {
+			return m[1]
+		}
+	}
+	return current().language
 }
 
-// sanitizeFilename ensures filename is valid and short enough.
-func sanitizeFilename(s string) string {
-	s = strings.ReplaceAll(s, "/", "_")
-	s = strings.ReplaceAll(s, "\\", "_")
-	s = strings.TrimSpace(s)
-	if len([]rune(s)) > 50 {
-		s = string([]rune(s)[:50])
+// allowedModelNames returns the built-in allowed Google models followed by
+// any configured pool voices.
+func allowedModelNames() []string {
+	names := languageVoices()
+	for _, v := range voicePool {
+		if !slices.Contains(names, v) {
+			names = append(names, v)
+		}
 	}
-	return s
+	return names
 }
@@ -0,0 +1,110 @@
+package wenbuntts
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// memoryCache keeps the most recently read audio of a storage in memory, up
+// to maxBytes, so the hottest clips are served without touching the backend.
+// Other objects, such as deck manifests, always go to the backend. Returned
+// data is shared and must not be modified.
+type memoryCache struct {
+	storage
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *memoryEntry, most recent first
+	entries map[string]*list.Element
+	hits    int64
+	misses  int64
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+	info objectInfo
+}
+
+// hotCache is the memoryCache wrapping cacheStore, or nil with
+// MEMORY_CACHE_BYTES unset.
+var hotCache *memoryCache
+
+func newMemoryCache(backend storage, maxBytes int64) *memoryCache {
+	return &memoryCache{storage: backend, maxBytes: maxBytes, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, objectInfo, error) {
+	if _, ok := formatForFile(key); !ok {
+		return c.storage.Get(ctx, key)
+	}
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.hits++
+		e := el.Value.(*memoryEntry)
+		c.mu.Unlock()
+		return e.data, e.info, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	data, info, err := c.storage.Get(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+	c.add(key, data, info)
+	return data, info, nil
+}
+
+// add remembers data for key, evicting the least recently used entries to
+// make room. Clips larger than an eighth of the cache aren't kept, so one
+// long sentence can't flush the words that make the cache worthwhile.
+func (c *memoryCache) add(key string, data []byte, info objectInfo) {
+	size := int64(len(data))
+	if size > c.maxBytes/8 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key, data, info})
+	c.size += size
+	for c.size > c.maxBytes {
+		oldest := c.lru.Back()
+		c.removeLocked(oldest.Value.(*memoryEntry).key)
+	}
+}
+
+func (c *memoryCache) removeLocked(key string) {
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		c.size -= int64(len(el.Value.(*memoryEntry).data))
+	}
+}
+
+func (c *memoryCache) forget(key string) {
+	c.mu.Lock()
+	c.removeLocked(key)
+	c.mu.Unlock()
+}
+
+func (c *memoryCache) Put(ctx context.Context, key string, data []byte) error {
+	c.forget(key)
+	return c.storage.Put(ctx, key, data)
+}
+
+func (c *memoryCache) Delete(ctx context.Context, key string) error {
+	c.forget(key)
+	return c.storage.Delete(ctx, key)
+}
+
+// stats returns the bytes held and the hit and miss counts.
+func (c *memoryCache) stats() (size, hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size, c.hits, c.misses
+}
@@ -0,0 +1,106 @@
+package wenbuntts
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// migrateReport lists what migrateLegacyCache did, or with DryRun would do.
+type migrateReport struct {
+	Migrated []string `json:"migrated"`
+	// Unmapped entries are legacy names no configured provider, voice and
+	// text reproduce, e.g. those rendered with since-changed defaults. They
+	// are left as they are.
+	Unmapped []string `json:"unmapped"`
+	DryRun   bool     `json:"dryRun"`
+}
+
+// legacyVoice is the provider and voice a legacy name's voice part, as
+// cacheVoiceKey made it, stands for.
+type legacyVoice struct {
+	provider provider
+	voice    string
+}
+
+// migrateLegacyCache moves every entry still stored under its legacy
+// "{voice}_{text}" name (see legacyStorageKey) to its content-hash key, as
+// lookupCached does one request at a time, along with its index row and
+// manifest entry.
+func migrateLegacyCache(ctx context.Context, dryRun bool) (migrateReport, error) {
+	report := migrateReport{Migrated: []string{}, Unmapped: []string{}, DryRun: dryRun}
+	var legacy []string
+	err := cacheStore.List(ctx, func(obj objectInfo) error {
+		if _, _, ok := parseCacheFilename(path.Base(obj.Key)); ok && validCacheKey(obj.Key) {
+			legacy = append(legacy, obj.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	voices := map[string]legacyVoice{}
+	for _, p := range providers {
+		for _, v := range p.AllowedVoices() {
+			voices[strings.ReplaceAll(cacheVoiceKey(p, v), "_", "-")] = legacyVoice{p, v}
+		}
+	}
+
+	for _, key := range legacy {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		req, ok := legacyRequest(ctx, key, voices)
+		if !ok {
+			report.Unmapped = append(report.Unmapped, key)
+			continue
+		}
+		req.key = req.storageKey()
+		if !dryRun {
+			if err := moveCacheEntry(ctx, key, req.key); err != nil {
+				slog.Error("Failed to migrate cache entry", "from", logPath(key), "key", req.key, "error", err)
+				continue
+			}
+		}
+		report.Migrated = append(report.Migrated, key)
+	}
+	slog.Info("Cache migration finished", "migrated", len(report.Migrated), "unmapped", len(report.Unmapped), "dry_run", dryRun)
+	return report, nil
+}
+
+// legacyRequest recovers the request whose legacy name is key, with voices
+// mapping the voice part of legacy names to a provider's voice. The text
+// comes from the filename or, where that was truncated, the index; a
+// request only counts if its legacyStorageKey is key again.
+func legacyRequest(ctx context.Context, key string, voices map[string]legacyVoice) (ttsRequest, bool) {
+	voicePart, text, _ := parseCacheFilename(path.Base(key))
+	base, _, _ := strings.Cut(voicePart, ".")
+	v, ok := voices[base]
+	if !ok {
+		return ttsRequest{}, false
+	}
+	f, _ := formatForFile(key)
+	tenant, deck := keyTenant(key)
+	texts := []string{text}
+	if entries, err := queryIndex(ctx, indexFilter{key: key}); err == nil && len(entries) == 1 && entries[0].Text != "" {
+		texts = append(texts, entries[0].Text)
+	}
+	for _, text := range texts {
+		req := ttsRequest{
+			text:     text,
+			provider: v.provider,
+			model:    v.voice,
+			format:   formatKey(f.encoding),
+			sentence: strings.HasSuffix(voicePart, ".sentence"),
+			language: languageFor(v.voice),
+			deck:     deck,
+			tenant:   tenant,
+		}
+		if req.legacyStorageKey() == key {
+			return req, true
+		}
+	}
+	return ttsRequest{}, false
+}
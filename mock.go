@@ -0,0 +1,107 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// mockProvider returns silent audio, a quarter second per character, without
+// calling anything. It lets frontends be developed against the server with
+// -provider=mock and no credentials, and the same text always gives the same
+// bytes. It is only set up when it is the default provider, so a real
+// deployment never serves it for ?provider=mock.
+type mockProvider struct{}
+
+const (
+	mockVoice         = "mock"
+	mockCharDuration  = 250 * time.Millisecond
+	mockWAVSampleRate = 24000
+)
+
+// mockMP3Frame is a silent MPEG1 Layer III frame: 32 kbps, 48 kHz, mono, so
+// 96 bytes and 24ms long. The zero side info decodes to silence.
+var mockMP3Frame = func() []byte {
+	frame := make([]byte, 96)
+	copy(frame, []byte{0xFF, 0xFB, 0x14, 0xC0})
+	return frame
+}()
+
+func newMockProvider() (provider, error) {
+	if setting("TTS_PROVIDER") != "mock" {
+		return nil, fmt.Errorf("%w: only used as TTS_PROVIDER", errNotConfigured)
+	}
+	return mockProvider{}, nil
+}
+
+func (mockProvider) Name() string { return "mock" }
+
+func (mockProvider) DefaultVoice() string { return mockVoice }
+
+func (mockProvider) AllowedVoices() []string { return []string{mockVoice} }
+
+func (mockProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	return []voiceInfo{{Name: mockVoice, LanguageCodes: []string{"cmn-CN"}}}, nil
+}
+
+func (mockProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	text := req.Text
+	if req.SSML != "" {
+		text = req.SSML
+	}
+	d := time.Duration(max(utf8.RuneCountInString(text), 1)) * mockCharDuration
+	switch req.AudioEncoding {
+	case "MP3":
+		frames := int((d + 24*time.Millisecond - 1) / (24 * time.Millisecond))
+		return bytes.Repeat(mockMP3Frame, frames), nil
+	case "LINEAR16":
+		return silentWAV(d), nil
+	case "MULAW":
+		return silentG711(d, 7, 0xFF), nil
+	case "ALAW":
+		return silentG711(d, 6, 0xD5), nil
+	}
+	return nil, fmt.Errorf("mock does not support %s output", req.AudioEncoding)
+}
+
+// silentWAV returns d of 16-bit mono PCM silence.
+func silentWAV(d time.Duration) []byte {
+	samples := int(d * mockWAVSampleRate / time.Second)
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+2*samples))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Size              uint32
+		Format, Channels  uint16
+		Rate, ByteRate    uint32
+		Align, SampleBits uint16
+	}{16, 1, 1, mockWAVSampleRate, 2 * mockWAVSampleRate, 2, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(2*samples))
+	buf.Write(make([]byte, 2*samples))
+	return buf.Bytes()
+}
+
+// silentG711 returns d of 8 kHz G.711 silence: a WAV of format 6 (A-law) or
+// 7 (µ-law) filled with that law's silence byte.
+func silentG711(d time.Duration, format uint16, silence byte) []byte {
+	samples := int(d * telephonySampleRate / time.Second)
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+samples))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Size              uint32
+		Format, Channels  uint16
+		Rate, ByteRate    uint32
+		Align, SampleBits uint16
+	}{16, format, 1, telephonySampleRate, telephonySampleRate, 1, 8})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(samples))
+	buf.Write(bytes.Repeat([]byte{silence}, samples))
+	return buf.Bytes()
+}
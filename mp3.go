@@ -0,0 +1,132 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// mp3Frame locates one MPEG audio frame within a byte slice.
+type mp3Frame struct {
+	offset   int
+	length   int
+	duration time.Duration
+}
+
+var (
+	// Bitrates in kbps for Layer III, indexed by [mpeg1?][bitrate index].
+	mp3Bitrates = [2][16]int{
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	}
+	// Sample rates in Hz for MPEG1, indexed by sample rate index. MPEG2 halves
+	// them and MPEG2.5 quarters them.
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+var errNotMP3 = errors.New("not an MP3 stream")
+
+// id3v2Length returns the size of a leading ID3v2 tag, or 0 if there is none.
+func id3v2Length(data []byte) int {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return 0
+	}
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	n := 10 + size
+	if data[5]&0x10 != 0 { // footer present
+		n += 10
+	}
+	if n > len(data) {
+		return len(data)
+	}
+	return n
+}
+
+// parseMP3Frame decodes the Layer III frame header at the start of data.
+func parseMP3Frame(data []byte) (mp3Frame, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version := (data[1] >> 3) & 0x03 // 0: MPEG2.5, 2: MPEG2, 3: MPEG1
+	layer := (data[1] >> 1) & 0x03   // 1: Layer III
+	bitrateIndex := data[2] >> 4
+	rateIndex := (data[2] >> 2) & 0x03
+	padding := int(data[2]>>1) & 0x01
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	mpeg1 := version == 3
+	sampleRate := mp3SampleRates[rateIndex]
+	samples := 1152
+	bitrate := 0
+	if mpeg1 {
+		bitrate = mp3Bitrates[1][bitrateIndex] * 1000
+	} else {
+		bitrate = mp3Bitrates[0][bitrateIndex] * 1000
+		samples = 576
+		sampleRate /= 2
+		if version == 0 {
+			sampleRate /= 2
+		}
+	}
+
+	length := samples/8*bitrate/sampleRate + padding
+	return mp3Frame{
+		length:   length,
+		duration: time.Duration(samples) * time.Second / time.Duration(sampleRate),
+	}, true
+}
+
+// mp3Frames returns the audio frames of an MP3 stream, skipping a leading
+// ID3v2 tag and any Xing/Info metadata frame. It stops at the first byte that
+// is not a valid frame (e.g. a trailing ID3v1 tag).
+func mp3Frames(data []byte) ([]mp3Frame, error) {
+	var frames []mp3Frame
+	for pos := id3v2Length(data); pos < len(data); {
+		f, ok := parseMP3Frame(data[pos:])
+		if !ok || pos+f.length > len(data) {
+			break
+		}
+		f.offset = pos
+		pos += f.length
+
+		if len(frames) == 0 && isXingFrame(data[f.offset:pos]) {
+			continue
+		}
+		frames = append(frames, f)
+	}
+	if len(frames) == 0 {
+		return nil, errNotMP3
+	}
+	return frames, nil
+}
+
+func isXingFrame(frame []byte) bool {
+	head := frame[:min(len(frame), 64)]
+	return bytes.Contains(head, []byte("Xing")) || bytes.Contains(head, []byte("Info"))
+}
+
+// trimMP3LeadIn drops whole frames from the start of the stream until at
+// least d of audio has been removed. A leading ID3v2 tag is preserved.
+func trimMP3LeadIn(data []byte, d time.Duration) ([]byte, error) {
+	frames, err := mp3Frames(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cut time.Duration
+	i := 0
+	for i < len(frames) && cut < d {
+		cut += frames[i].duration
+		i++
+	}
+	if i == len(frames) {
+		return nil, errors.New("lead-in trim would remove the whole clip")
+	}
+
+	tag := data[:id3v2Length(data)]
+	out := make([]byte, 0, len(tag)+len(data)-frames[i].offset)
+	out = append(out, tag...)
+	return append(out, data[frames[i].offset:]...), nil
+}
@@ -0,0 +1,22 @@
+package wenbuntts
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// zeroWidth lists invisible characters that copy-pasted text often carries:
+// zero-width spaces and joiners, the word joiner, byte order marks and soft
+// hyphens.
+var zeroWidth = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "", "\u00ad", "")
+
+// normalizeText canonicalizes input text before it is validated or keyed:
+// NFC, without zero-width characters, trimmed and with each run of
+// whitespace made one space. Visually identical inputs then share one cache
+// entry instead of each being synthesized and paid for.
+func normalizeText(s string) string {
+	s = zeroWidth.Replace(norm.NFC.String(s))
+	return strings.Join(strings.FieldsFunc(s, unicode.IsSpace), " ")
+}
@@ -0,0 +1,128 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+const openAIAPIBase = "https://api.openai.com/v1"
+
+// openAIProvider synthesizes with OpenAI's speech endpoint. Its voices are
+// multilingual and there is no API to list them, so the allowed voices come
+// from OPENAI_VOICES.
+type openAIProvider struct {
+	apiKey       secretSetting
+	model        string
+	defaultVoice string
+	voices       []string
+}
+
+func newOpenAIProvider() (provider, error) {
+	key := setting("OPENAI_API_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing OPENAI_API_KEY", errNotConfigured)
+	}
+
+	p := &openAIProvider{
+		apiKey:       "OPENAI_API_KEY",
+		model:        setting("OPENAI_TTS_MODEL"),
+		defaultVoice: setting("OPENAI_DEFAULT_VOICE"),
+		voices:       splitList(setting("OPENAI_VOICES")),
+	}
+	if p.model == "" {
+		p.model = "tts-1"
+	}
+	if p.defaultVoice == "" {
+		p.defaultVoice = "alloy"
+	}
+	if !slices.Contains(p.voices, p.defaultVoice) {
+		p.voices = append(p.voices, p.defaultVoice)
+	}
+	return p, nil
+}
+
+func (p *openAIProvider) Name() string { return "openai" }
+
+func (p *openAIProvider) DefaultVoice() string { return p.defaultVoice }
+
+func (p *openAIProvider) AllowedVoices() []string { return p.voices }
+
+// openAIResponseFormats maps our audio encodings onto OpenAI response formats.
+var openAIResponseFormats = map[string]string{
+	"MP3":      "mp3",
+	"OGG_OPUS": "opus",
+	"LINEAR16": "wav",
+}
+
+// ParseOptions reads ?modelId=, e.g. tts-1-hd, overriding OPENAI_TTS_MODEL.
+func (p *openAIProvider) ParseOptions(q url.Values) (map[string]string, error) {
+	options := map[string]string{}
+	if v := q.Get("modelId"); v != "" && v != p.model {
+		options["modelId"] = v
+	}
+	return options, nil
+}
+
+func (p *openAIProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	format, ok := openAIResponseFormats[req.AudioEncoding]
+	if !ok {
+		return nil, fmt.Errorf("openai does not support %s output", req.AudioEncoding)
+	}
+	if req.Pitch != 0 || req.VolumeGainDb != 0 {
+		return nil, fmt.Errorf("openai does not support pitch or volume adjustment")
+	}
+
+	model := p.model
+	if v := req.Options["modelId"]; v != "" {
+		model = v
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"model":           model,
+		"input":           req.Text,
+		"voice":           req.Voice,
+		"response_format": format,
+		"speed":           req.SpeakingRate,
+	})
+	auditSynthesis(ctx, string(body))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIAPIBase+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey.value())
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := upstreamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, audio)
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("No audio content in response")
+	}
+	return audio, nil
+}
+
+// Voices returns the configured voices; OpenAI has no voice listing endpoint.
+func (p *openAIProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	voices := make([]voiceInfo, len(p.voices))
+	for i, v := range p.voices {
+		voices[i] = voiceInfo{Name: v}
+	}
+	return voices, nil
+}
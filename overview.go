@@ -0,0 +1,157 @@
+package wenbuntts
+
+import (
+	_ "embed"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// envExample lists the documented settings, which /admin reports.
+//
+//go:embed .env.example
+var envExample string
+
+// startTime is when the process started, for the uptime /admin reports.
+var startTime = time.Now()
+
+var settingName = regexp.MustCompile(`(?m)^([A-Z][A-Z0-9_]*)=`)
+
+// isSecretSetting reports whether name holds a credential, which /admin
+// only reports as set.
+func isSecretSetting(name string) bool {
+	for _, suffix := range []string{"_KEY", "_KEYS", "_SECRET", "_TOKEN", "_PASSWORD"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentConfig returns the documented settings that are set, as given
+// (secret references are not resolved) and with secrets redacted.
+func currentConfig() map[string]string {
+	config := map[string]string{}
+	for _, m := range settingName.FindAllStringSubmatch(envExample, -1) {
+		name := m[1]
+		v, ok := rawSetting(name)
+		if !ok || v == "" {
+			continue
+		}
+		if isSecretSetting(name) {
+			v = "[redacted]"
+		}
+		config[name] = v
+	}
+	return config
+}
+
+type generationStatus struct {
+	Key     string `json:"key"`
+	Waiters int    `json:"waiters"`
+}
+
+type memoryOverview struct {
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"maxBytes"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+type breakerOverview struct {
+	State string    `json:"state"`
+	Until time.Time `json:"until,omitzero"`
+}
+
+// handleAdmin summarizes the server's live state: what is being synthesized
+// and queued, provider health, the cache, recent errors and the settings.
+func handleAdmin(w http.ResponseWriter, r *http.Request) {
+	var overview struct {
+		Uptime     string             `json:"uptime"`
+		Generating []generationStatus `json:"generating"`
+		Upstream   struct {
+			InUse     int     `json:"inUse"`
+			Limit     int     `json:"limit,omitempty"` // 0 for unlimited
+			Queued    int64   `json:"queued"`
+			ErrorRate float64 `json:"errorRate"`
+			Samples   int     `json:"samples"`
+		} `json:"upstream"`
+		AsyncJobs int                        `json:"asyncJobs"`
+		BatchJobs int                        `json:"batchJobs"`
+		Providers []string                   `json:"providers"`
+		Default   string                     `json:"defaultProvider"`
+		Fallbacks []string                   `json:"fallbackProviders,omitempty"`
+		Breakers  map[string]breakerOverview `json:"circuitBreakers,omitempty"`
+		Cache     struct {
+			Entries int64           `json:"entries"`
+			Bytes   int64           `json:"bytes"`
+			Memory  *memoryOverview `json:"memory,omitempty"`
+			Error   string          `json:"error,omitempty"`
+		} `json:"cache"`
+		RecentErrors []recentError     `json:"recentErrors"`
+		Config       map[string]string `json:"config"`
+	}
+	now := time.Now()
+	overview.Uptime = now.Sub(startTime).Round(time.Second).String()
+
+	generatingMu.Lock()
+	for key, g := range generating {
+		overview.Generating = append(overview.Generating, generationStatus{logPath(key), g.waiters})
+	}
+	generatingMu.Unlock()
+	if overview.Generating == nil {
+		overview.Generating = []generationStatus{}
+	}
+	slices.SortFunc(overview.Generating, func(a, b generationStatus) int { return strings.Compare(a.Key, b.Key) })
+
+	overview.Upstream.InUse, overview.Upstream.Limit = len(upstreamSlots), cap(upstreamSlots)
+	overview.Upstream.Queued = upstreamWaiting.Load()
+	overview.Upstream.ErrorRate, overview.Upstream.Samples = upstreamStatus.errorRate(now)
+
+	asyncJobsMu.Lock()
+	overview.AsyncJobs = len(asyncJobs)
+	asyncJobsMu.Unlock()
+	batchJobsMu.Lock()
+	overview.BatchJobs = len(batchJobs)
+	batchJobsMu.Unlock()
+
+	overview.Providers = slices.Sorted(maps.Keys(providers))
+	overview.Default = defaultProvider.Name()
+	for _, p := range fallbackProviders {
+		overview.Fallbacks = append(overview.Fallbacks, p.Name())
+	}
+	if len(breakers) > 0 {
+		overview.Breakers = map[string]breakerOverview{}
+		for name, b := range breakers {
+			state, until := b.status()
+			overview.Breakers[name] = breakerOverview{State: state.String(), Until: until}
+		}
+	}
+
+	err := cacheIndex.QueryRowContext(r.Context(), `SELECT COUNT(*), COALESCE(SUM(size), 0) FROM entries`).
+		Scan(&overview.Cache.Entries, &overview.Cache.Bytes)
+	if err != nil {
+		overview.Cache.Error = err.Error()
+	}
+	if hotCache != nil {
+		size, hits, misses := hotCache.stats()
+		overview.Cache.Memory = &memoryOverview{size, hotCache.maxBytes, hits, misses}
+	}
+
+	recentErrors.Lock()
+	overview.RecentErrors = slices.Clone(recentErrors.lines)
+	recentErrors.Unlock()
+	slices.Reverse(overview.RecentErrors) // newest first
+	if overview.RecentErrors == nil {
+		overview.RecentErrors = []recentError{}
+	}
+	overview.Config = currentConfig()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(overview)
+}
@@ -0,0 +1,120 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// pairClip is one clip of a ?response=json /tts/pair response.
+type pairClip struct {
+	Text       string `json:"text"`
+	URL        string `json:"url"`
+	ContentURL string `json:"contentUrl"` // see audioURL
+	DurationMs int64  `json:"durationMs,omitempty"`
+}
+
+// pairMetadata is the ?response=json form of a /tts/pair response.
+type pairMetadata struct {
+	Word     pairClip `json:"word"`
+	Sentence pairClip `json:"sentence"`
+}
+
+// handleTTSPair makes the clips of a flashcard: ?word= and its example
+// ?sentence=, in the same ?model=. It returns one MP3 of the word, ?pauseMs=
+// of silence (1000 by default) and the sentence, or with ?response=json the
+// /tts URLs of the two now cached clips. Both are cached like any other clip,
+// the sentence in sentence mode.
+func handleTTSPair(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	word := normalizeText(query.Get("word"))
+	sentence := normalizeText(query.Get("sentence"))
+	if word == "" || sentence == "" {
+		http.Error(w, "Missing ?word= or ?sentence= parameter", http.StatusBadRequest)
+		return
+	}
+	if sentenceMaxLength == 0 {
+		http.Error(w, "Sentence mode is disabled", http.StatusBadRequest)
+		return
+	}
+	pause := time.Second
+	if v := query.Get("pauseMs"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxConcatGap {
+			http.Error(w, "Invalid pauseMs: must be between 0 and 5000", http.StatusBadRequest)
+			return
+		}
+		pause = time.Duration(ms) * time.Millisecond
+	}
+	prov, ok := providerFor(query.Get("provider"))
+	if !ok {
+		http.Error(w, "Invalid provider: "+query.Get("provider"), http.StatusBadRequest)
+		return
+	}
+	modelName := query.Get("model")
+	if modelName == "" {
+		modelName = prov.DefaultVoice()
+	}
+	if !slices.Contains(prov.AllowedVoices(), modelName) {
+		http.Error(w, "Invalid model: must be one of "+strings.Join(prov.AllowedVoices(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	wordReq := ttsRequest{text: word, provider: prov, model: modelName, format: "mp3", language: languageFor(modelName), tenant: tenantFrom(ctx)}
+	if err := validateText(word, wordReq.language, wordReq.model); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wordReq.key = wordReq.storageKey()
+	sentenceReq := wordReq
+	sentenceReq.text, sentenceReq.sentence = sentence, true
+	if err := validateSentence(sentence, sentenceReq.language); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sentenceReq.key = sentenceReq.storageKey()
+	if _, err := lookupCached(ctx, sentenceReq); err != nil {
+		if err := allowMiss(ctx); err != nil {
+			httpGenerateError(ctx, w, err.Error(), err)
+			return
+		}
+		if !takeSentenceBudget(utf8.RuneCountInString(sentence), time.Now()) {
+			http.Error(w, "Daily sentence budget exhausted", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	out, spans, err := stitchMP3(ctx, []ttsRequest{wordReq, sentenceReq}, pause)
+	if err != nil {
+		httpGenerateError(ctx, w, err.Error(), err)
+		return
+	}
+
+	if wantsJSON(r) {
+		clip := func(req ttsRequest, span clipSpan) pairClip {
+			v := url.Values{"text": {req.text}, "model": {req.model}}
+			if p := query.Get("provider"); p != "" {
+				v.Set("provider", p)
+			}
+			if req.sentence {
+				v.Set("mode", "sentence")
+			}
+			return pairClip{Text: req.text, URL: "/tts?" + v.Encode(), ContentURL: audioURL(req.key), DurationMs: span.duration.Milliseconds()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.Encode(pairMetadata{Word: clip(wordReq, spans[0]), Sentence: clip(sentenceReq, spans[1])})
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("ETag", audioETag(out))
+	http.ServeContent(w, r, "pair.mp3", time.Time{}, bytes.NewReader(out))
+}
@@ -0,0 +1,145 @@
+package wenbuntts
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// pinyinTones maps each tone-marked vowel to its plain vowel and tone.
+var pinyinTones = map[rune]struct {
+	vowel rune
+	tone  byte
+}{
+	'ā': {'a', '1'}, 'á': {'a', '2'}, 'ǎ': {'a', '3'}, 'à': {'a', '4'},
+	'ē': {'e', '1'}, 'é': {'e', '2'}, 'ě': {'e', '3'}, 'è': {'e', '4'},
+	'ī': {'i', '1'}, 'í': {'i', '2'}, 'ǐ': {'i', '3'}, 'ì': {'i', '4'},
+	'ō': {'o', '1'}, 'ó': {'o', '2'}, 'ǒ': {'o', '3'}, 'ò': {'o', '4'},
+	'ū': {'u', '1'}, 'ú': {'u', '2'}, 'ǔ': {'u', '3'}, 'ù': {'u', '4'},
+	'ǖ': {'v', '1'}, 'ǘ': {'v', '2'}, 'ǚ': {'v', '3'}, 'ǜ': {'v', '4'},
+	'ü': {'v', 0},
+}
+
+// numberedSyllable is one syllable in the alphabet="pinyin" notation: letters
+// with "v" for ü, then a tone from 1 to 5.
+var numberedSyllable = regexp.MustCompile(`^[a-z]+[1-5]$`)
+
+// numberedPinyin converts a reading such as "yín háng" or "yin2 hang2" to the
+// numbered syllables SSML's pinyin alphabet expects. A syllable without a
+// tone mark or number is neutral (5). A zhuyin reading is converted, see
+// zhuyinToPinyin.
+func numberedPinyin(reading string) (string, error) {
+	var syllables []string
+	if isZhuyin(reading) {
+		for _, s := range zhuyinSyllables(reading) {
+			syllable, err := zhuyinToPinyin(s)
+			if err != nil {
+				return "", err
+			}
+			syllables = append(syllables, syllable)
+		}
+		if len(syllables) == 0 {
+			return "", errors.New("empty reading")
+		}
+		return strings.Join(syllables, " "), nil
+	}
+	for _, s := range strings.Fields(strings.ToLower(reading)) {
+		var b strings.Builder
+		tone := byte('5')
+		for _, c := range s {
+			if t, ok := pinyinTones[c]; ok {
+				b.WriteRune(t.vowel)
+				if t.tone != 0 {
+					tone = t.tone
+				}
+			} else {
+				b.WriteRune(c)
+			}
+		}
+		syllable := b.String()
+		if last := syllable[len(syllable)-1]; last < '1' || last > '5' {
+			syllable += string(tone)
+		}
+		if !numberedSyllable.MatchString(syllable) {
+			return "", fmt.Errorf("%q is not a pinyin syllable", s)
+		}
+		syllables = append(syllables, syllable)
+	}
+	if len(syllables) == 0 {
+		return "", errors.New("empty reading")
+	}
+	return strings.Join(syllables, " "), nil
+}
+
+// parsePinyinHints parses ?pinyin=, a comma-separated list of text=reading
+// pairs such as "行=xíng" or "银行=yín háng". Each reading must have one
+// syllable per character of its text.
+func parsePinyinHints(v string) (map[string]string, error) {
+	hints := map[string]string{}
+	if v == "" {
+		return hints, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		text, reading, ok := strings.Cut(pair, "=")
+		text = strings.TrimSpace(text)
+		if !ok || text == "" {
+			return nil, fmt.Errorf("%q is not text=reading", pair)
+		}
+		ph, err := numberedPinyin(reading)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", text, err)
+		}
+		if n := strings.Count(ph, " ") + 1; n != utf8.RuneCountInString(text) {
+			return nil, fmt.Errorf("%s: reading has %d syllables for %d characters", text, n, utf8.RuneCountInString(text))
+		}
+		hints[text] = ph
+	}
+	return hints, nil
+}
+
+// hintSpan is a piece of text and the reading of the hint that matched it,
+// or a single character no hint matched and an empty reading.
+type hintSpan struct {
+	text, reading string
+}
+
+// splitHints cuts text into the occurrences of hinted texts and the
+// characters between them. Longer hints win where they overlap, so "银行"
+// can override "行".
+func splitHints(text string, hints map[string]string) []hintSpan {
+	var spans []hintSpan
+	for rest := text; rest != ""; {
+		match := ""
+		for h := range hints {
+			if len(h) > len(match) && strings.HasPrefix(rest, h) {
+				match = h
+			}
+		}
+		if match == "" {
+			_, n := utf8.DecodeRuneInString(rest)
+			match = rest[:n]
+		}
+		spans = append(spans, hintSpan{match, hints[match]})
+		rest = rest[len(match):]
+	}
+	return spans
+}
+
+// pinyinSSML returns text as SSML content (without <speak>) in which every
+// occurrence of a hinted text is wrapped in a <phoneme> with its reading.
+func pinyinSSML(text string, hints map[string]string) string {
+	var out strings.Builder
+	for _, s := range splitHints(text, hints) {
+		if s.reading == "" {
+			xml.EscapeText(&out, []byte(s.text))
+			continue
+		}
+		fmt.Fprintf(&out, `<phoneme alphabet="pinyin" ph="%s">`, s.reading)
+		xml.EscapeText(&out, []byte(s.text))
+		out.WriteString("</phoneme>")
+	}
+	return out.String()
+}
@@ -0,0 +1,135 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// piperProvider synthesizes locally with the Piper CLI, so the server can run
+// without any cloud credentials. Voices are the *.onnx models found in
+// PIPER_VOICES_DIR, named by file stem (e.g. zh_CN-huayan-medium). Piper only
+// writes WAV; other formats are transcoded with ffmpeg.
+type piperProvider struct {
+	binary       string
+	ffmpeg       string
+	voicesDir    string
+	defaultVoice string
+	voices       []string
+}
+
+func newPiperProvider() (provider, error) {
+	binary := setting("PIPER_BINARY")
+	if binary == "" {
+		binary = "piper"
+	}
+	binary, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: piper binary not found", errNotConfigured)
+	}
+
+	p := &piperProvider{
+		binary:       binary,
+		voicesDir:    setting("PIPER_VOICES_DIR"),
+		defaultVoice: setting("PIPER_DEFAULT_VOICE"),
+	}
+	if p.voicesDir == "" {
+		p.voicesDir = "./voices"
+	}
+	if p.defaultVoice == "" {
+		p.defaultVoice = "zh_CN-huayan-medium"
+	}
+	// ffmpeg is optional; without it only WAV can be produced.
+	p.ffmpeg, _ = exec.LookPath("ffmpeg")
+
+	models, err := filepath.Glob(filepath.Join(p.voicesDir, "*.onnx"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		p.voices = append(p.voices, strings.TrimSuffix(filepath.Base(m), ".onnx"))
+	}
+	if !slices.Contains(p.voices, p.defaultVoice) {
+		return nil, fmt.Errorf("%w: no %s.onnx in %s", errNotConfigured, p.defaultVoice, p.voicesDir)
+	}
+	return p, nil
+}
+
+func (p *piperProvider) Name() string { return "piper" }
+
+func (p *piperProvider) DefaultVoice() string { return p.defaultVoice }
+
+func (p *piperProvider) AllowedVoices() []string { return p.voices }
+
+// piperTranscodeArgs holds the ffmpeg output arguments for each non-WAV encoding.
+var piperTranscodeArgs = map[string][]string{
+	"MP3":      {"-codec:a", "libmp3lame", "-q:a", "4", "-f", "mp3"},
+	"OGG_OPUS": {"-codec:a", "libopus", "-f", "ogg"},
+}
+
+func (p *piperProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	transcode, needsTranscode := piperTranscodeArgs[req.AudioEncoding]
+	if req.AudioEncoding != "LINEAR16" && !needsTranscode {
+		return nil, fmt.Errorf("piper does not support %s output", req.AudioEncoding)
+	}
+	if needsTranscode && p.ffmpeg == "" {
+		return nil, fmt.Errorf("piper needs ffmpeg for %s output", req.AudioEncoding)
+	}
+	if req.Pitch != 0 || req.VolumeGainDb != 0 {
+		return nil, fmt.Errorf("piper does not support pitch or volume adjustment")
+	}
+
+	wav, err := os.CreateTemp("", "piper-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	wav.Close()
+	defer os.Remove(wav.Name())
+
+	// length_scale stretches phoneme durations, so it is the inverse of a rate.
+	cmd := exec.CommandContext(ctx, p.binary,
+		"--model", filepath.Join(p.voicesDir, req.Voice+".onnx"),
+		"--output_file", wav.Name(),
+		"--length_scale", strconv.FormatFloat(1/req.SpeakingRate, 'f', 2, 64),
+	)
+	cmd.Stdin = strings.NewReader(req.Text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("TTS request failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	if !needsTranscode {
+		return os.ReadFile(wav.Name())
+	}
+
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", wav.Name()}, transcode...)
+	cmd = exec.CommandContext(ctx, p.ffmpeg, append(args, "pipe:1")...)
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	audio, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to transcode audio: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("No audio content in response")
+	}
+	return audio, nil
+}
+
+// Voices lists the installed models. Piper names them "{lang}_{REGION}-...",
+// which gives their language.
+func (p *piperProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	voices := make([]voiceInfo, len(p.voices))
+	for i, v := range p.voices {
+		lang, _, _ := strings.Cut(v, "-")
+		voices[i] = voiceInfo{Name: v, LanguageCodes: []string{strings.ReplaceAll(lang, "_", "-")}}
+	}
+	return voices, nil
+}
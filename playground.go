@@ -0,0 +1,37 @@
+package wenbuntts
+
+import (
+	_ "embed"
+	"html/template"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// playgroundPage is the page at /, for trying voices in a browser.
+//
+//go:embed playground.html
+var playgroundPage string
+
+var playgroundTemplate = template.Must(template.New("playground").Parse(playgroundPage))
+
+func handlePlayground(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	err := playgroundTemplate.Execute(w, struct {
+		Providers     []string
+		Default       string
+		Formats       []string
+		DefaultFormat string
+		SpeakingRate  float64
+	}{
+		Providers:     slices.Sorted(maps.Keys(providers)),
+		Default:       defaultProvider.Name(),
+		Formats:       slices.Sorted(maps.Keys(audioFormats)),
+		DefaultFormat: defaultFormat,
+		SpeakingRate:  current().speakingRate,
+	})
+	if err != nil {
+		logger(r.Context()).Error("Failed to render playground", "error", err)
+	}
+}
@@ -0,0 +1,168 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pollyProvider synthesizes with AWS Polly's neural engine, signing requests
+// with the standard AWS_* credentials from the environment.
+type pollyProvider struct {
+	creds        awsCredentials
+	region       string
+	defaultVoice string
+	voices       []string
+}
+
+func newPollyProvider() (provider, error) {
+	creds := awsCredentials{
+		accessKeyID:     setting("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: setting("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    setting("AWS_SESSION_TOKEN"),
+	}
+	region := setting("AWS_REGION")
+	if region == "" {
+		region = setting("AWS_DEFAULT_REGION")
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" || region == "" {
+		return nil, fmt.Errorf("%w: missing AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY or AWS_REGION", errNotConfigured)
+	}
+
+	p := &pollyProvider{
+		creds:        creds,
+		region:       region,
+		defaultVoice: setting("POLLY_DEFAULT_VOICE"),
+		voices:       splitList(setting("POLLY_VOICES")),
+	}
+	if p.defaultVoice == "" {
+		p.defaultVoice = "Zhiyu"
+	}
+	if len(p.voices) == 0 {
+		p.voices = []string{"Zhiyu"}
+	}
+	if !slices.Contains(p.voices, p.defaultVoice) {
+		p.voices = append(p.voices, p.defaultVoice)
+	}
+	return p, nil
+}
+
+func (p *pollyProvider) Name() string { return "polly" }
+
+func (p *pollyProvider) DefaultVoice() string { return p.defaultVoice }
+
+func (p *pollyProvider) AllowedVoices() []string { return p.voices }
+
+func (p *pollyProvider) SpeaksSSML() bool { return true }
+
+// pollyOutputFormats maps our audio encodings onto Polly's output formats.
+var pollyOutputFormats = map[string]string{
+	"MP3": "mp3",
+}
+
+func (p *pollyProvider) endpoint(path string) string {
+	return fmt.Sprintf("https://polly.%s.amazonaws.com%s", p.region, path)
+}
+
+func (p *pollyProvider) do(req *http.Request, body []byte) (*http.Response, error) {
+	signAWSv4(req, body, p.creds, "polly", p.region, time.Now())
+	return upstreamClient.Do(req)
+}
+
+func (p *pollyProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	format, ok := pollyOutputFormats[req.AudioEncoding]
+	if !ok {
+		return nil, fmt.Errorf("polly does not support %s output", req.AudioEncoding)
+	}
+	// The neural engine ignores prosody pitch.
+	if req.Pitch != 0 {
+		return nil, fmt.Errorf("polly does not support pitch adjustment")
+	}
+
+	var text strings.Builder
+	if req.SSML != "" {
+		text.WriteString(req.SSML)
+	} else {
+		xml.EscapeText(&text, []byte(req.Text))
+	}
+	// Polly's prosody rate is a percentage of the voice's normal speed.
+	ssml := fmt.Sprintf(`<speak><prosody rate="%.0f%%" volume="%+.1fdB">%s</prosody></speak>`, req.SpeakingRate*100, req.VolumeGainDb, text.String())
+
+	body, _ := json.Marshal(map[string]string{
+		"Engine":       "neural",
+		"LanguageCode": req.Language,
+		"OutputFormat": format,
+		"Text":         ssml,
+		"TextType":     "ssml",
+		"VoiceId":      req.Voice,
+	})
+	auditSynthesis(ctx, string(body))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint("/v1/speech"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.do(httpReq, body)
+	if err != nil {
+		return nil, fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, audio)
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("No audio content in response")
+	}
+	return audio, nil
+}
+
+func (p *pollyProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	q := url.Values{"Engine": {"neural"}}
+	if language != "" {
+		q.Set("LanguageCode", language)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint("/v1/voices?"+q.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.do(req, nil)
+	if err != nil {
+		return nil, fmt.Errorf("voices request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("voices request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Voices []struct {
+			ID           string `json:"Id"`
+			LanguageCode string `json:"LanguageCode"`
+			Gender       string `json:"Gender"`
+		} `json:"Voices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse voices: %w", err)
+	}
+	voices := make([]voiceInfo, len(result.Voices))
+	for i, v := range result.Voices {
+		voices[i] = voiceInfo{Name: v.ID, LanguageCodes: []string{v.LanguageCode}, Gender: v.Gender}
+	}
+	return voices, nil
+}
@@ -0,0 +1,36 @@
+package wenbuntts
+
+import (
+	"context"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// voicePool lists interchangeable voices used by ?pool=true, from the
+// comma-separated VOICE_POOL. Pool voices are operator-chosen, so they are
+// also accepted as an explicit ?model=.
+var voicePool []string
+
+var poolNext atomic.Uint64
+
+// resolvePoolVoice returns a pool voice that already has req cached, or
+// otherwise the next voice in round-robin order, so misses spread upstream
+// quota across the pool.
+func resolvePoolVoice(ctx context.Context, req ttsRequest) string {
+	for _, v := range voicePool {
+		req.model = v
+		req.key = req.storageKey()
+		if _, err := lookupCached(ctx, req); err == nil {
+			return v
+		}
+	}
+	return voicePool[(poolNext.Add(1)-1)%uint64(len(voicePool))]
+}
+
+// seededPoolVoice deterministically maps seed to a pool voice, so e.g. a deck
+// name always gets the same voice across regenerations.
+func seededPoolVoice(seed string) string {
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	return voicePool[h.Sum32()%uint32(len(voicePool))]
+}
@@ -0,0 +1,79 @@
+package wenbuntts
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// usePool sets VOICE_POOL for the rest of the test.
+func usePool(t *testing.T, voices ...string) {
+	saved := voicePool
+	voicePool = voices
+	t.Cleanup(func() { voicePool = saved })
+}
+
+func TestVoicePoolRotates(t *testing.T) {
+	pool := []string{"mock-a", "mock-b", "mock-c"}
+	usePool(t, pool...)
+
+	texts := []string{"轮一", "轮二", "轮三", "轮四"}
+	var voices []string
+	for _, text := range texts {
+		meta := getMetadata(t, url.Values{"text": {text}, "pool": {"true"}})
+		if meta.CacheHit {
+			t.Errorf("%s: first request was a cache hit", text)
+		}
+		voices = append(voices, meta.Voice)
+	}
+	for i, v := range voices {
+		j := slices.Index(pool, v)
+		if j < 0 {
+			t.Fatalf("voices %q, not from the pool", voices)
+		}
+		if i > 0 && voices[i-1] != pool[(j+len(pool)-1)%len(pool)] {
+			t.Errorf("voices %q, want them in pool order", voices)
+		}
+	}
+
+	backgroundWork.Wait()
+	for i, text := range texts {
+		entries, err := queryIndex(context.Background(), indexFilter{text: text})
+		if err != nil || len(entries) != 1 || entries[0].Voice != voices[i] {
+			t.Errorf("%s: index %v %+v, want it cached as %s", text, err, entries, voices[i])
+		}
+		// A hit is served in whichever voice has it.
+		if meta := getMetadata(t, url.Values{"text": {text}, "pool": {"true"}}); !meta.CacheHit || meta.Voice != voices[i] {
+			t.Errorf("%s again: hit %v in %s, want a hit in %s", text, meta.CacheHit, meta.Voice, voices[i])
+		}
+	}
+}
+
+func TestVoicePoolSeed(t *testing.T) {
+	usePool(t, "mock-a", "mock-b", "mock-c")
+
+	voiceFor := func(text, seed string) string {
+		t.Helper()
+		return getMetadata(t, url.Values{"text": {text}, "seed": {seed}}).Voice
+	}
+	// Whatever the round-robin position, a seed always picks one voice.
+	first := voiceFor("种一", "deck-1")
+	for _, text := range []string{"种一", "种二", "种三"} {
+		if v := voiceFor(text, "deck-1"); v != first {
+			t.Errorf("%s with seed deck-1: %s, want %s", text, v, first)
+		}
+	}
+	seen := map[string]bool{}
+	for _, seed := range []string{"deck-1", "deck-2", "deck-3", "deck-4", "deck-5", "deck-6"} {
+		seen[voiceFor("种一", seed)] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("six seeds all picked %v", seen)
+	}
+	// Each voice is cached apart.
+	backgroundWork.Wait()
+	if entries, err := queryIndex(context.Background(), indexFilter{text: "种一"}); err != nil || len(entries) != len(seen) {
+		t.Errorf("index %v %+v, want an entry for each of %v", err, entries, seen)
+	}
+}
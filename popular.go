@@ -0,0 +1,74 @@
+package wenbuntts
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// Every /tts request is counted in the word_requests table of the cache
+// index by text and the voice, provider and format it asked for, kept even
+// when its clip is evicted, expires or was made for another voice. With
+// popularWarmCount set, the most requested items are warmed at startup, so
+// that they are regenerated after a change of the default voice or other
+// settings, and by the popular task of MAINTENANCE_SCHEDULE, e.g. to follow
+// CACHE_TTL.
+var popularWarmCount int
+
+// A voice, provider or format left out of the request is stored as "", so
+// that warming follows the current defaults.
+const wordRequestsSchema = `
+CREATE TABLE IF NOT EXISTS word_requests (
+	tenant       TEXT NOT NULL,
+	text         TEXT NOT NULL,
+	voice        TEXT NOT NULL,
+	provider     TEXT NOT NULL,
+	format       TEXT NOT NULL,
+	count        INTEGER NOT NULL,
+	last_request INTEGER NOT NULL,
+	PRIMARY KEY (tenant, text, voice, provider, format)
+);
+`
+
+// recordWordRequest counts a /tts request for req with the given query.
+func recordWordRequest(ctx context.Context, req ttsRequest, query url.Values) {
+	_, err := cacheIndex.ExecContext(ctx, `INSERT INTO word_requests (tenant, text, voice, provider, format, count, last_request) VALUES (?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT DO UPDATE SET count = count + 1, last_request = excluded.last_request`,
+		req.tenant, req.text, query.Get("model"), query.Get("provider"), query.Get("format"), time.Now().UnixNano())
+	if err != nil {
+		logger(ctx).Error("Failed to count the request", "error", err)
+	}
+}
+
+// popularItems returns the n most requested items by tenant.
+func popularItems(ctx context.Context, n int) (map[string][]batchItem, error) {
+	rows, err := cacheIndex.QueryContext(ctx, `SELECT tenant, text, voice, provider, format FROM word_requests ORDER BY count DESC, last_request DESC LIMIT ?`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := map[string][]batchItem{}
+	for rows.Next() {
+		var tenant string
+		var item batchItem
+		if err := rows.Scan(&tenant, &item.Text, &item.Model, &item.Provider, &item.Format); err != nil {
+			return nil, err
+		}
+		items[tenant] = append(items[tenant], item)
+	}
+	return items, rows.Err()
+}
+
+// warmPopular warms the cache with the n most requested items.
+func warmPopular(ctx context.Context, n int) error {
+	items, err := popularItems(ctx, n)
+	if err != nil {
+		return err
+	}
+	slog.Info("Warming the most requested items", "count", n)
+	for tenant, list := range items {
+		warmUpItems(withTenant(ctx, tenant), list)
+	}
+	return nil
+}
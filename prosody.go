@@ -0,0 +1,81 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// prosody is how a clip is spoken. The zero value is the server default: a
+// zero rate stands for SPEAKING_RATE.
+type prosody struct {
+	rate         float64
+	pitch        float64 // semitones
+	volumeGainDb float64
+}
+
+// prosodyParams lists the prosody query parameters with their bounds, which
+// are Google's limits.
+var prosodyParams = []struct {
+	name     string
+	min, max float64
+	field    func(*prosody) *float64
+}{
+	{"speakingRate", 0.25, 4, func(p *prosody) *float64 { return &p.rate }},
+	{"pitch", -20, 20, func(p *prosody) *float64 { return &p.pitch }},
+	{"volumeGainDb", -96, 16, func(p *prosody) *float64 { return &p.volumeGainDb }},
+}
+
+func parseProsody(q url.Values) (prosody, error) {
+	var p prosody
+	for _, param := range prosodyParams {
+		v := q.Get(param.name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < param.min || f > param.max {
+			return prosody{}, fmt.Errorf("Invalid %s: must be between %g and %g", param.name, param.min, param.max)
+		}
+		*param.field(&p) = f
+	}
+	if v := q.Get("speed"); v != "" {
+		if q.Get("speakingRate") != "" {
+			return prosody{}, fmt.Errorf("Invalid speed: give speed or speakingRate, not both")
+		}
+		rate, ok := speedRate(v)
+		if !ok && v != "all" {
+			return prosody{}, fmt.Errorf("Invalid speed: must be all or one of %s", speedNames())
+		}
+		p.rate = rate
+	}
+	if p.rate == current().speakingRate {
+		p.rate = 0
+	}
+	return p, nil
+}
+
+func (p prosody) speakingRate() float64 {
+	if p.rate == 0 {
+		return current().speakingRate
+	}
+	return p.rate
+}
+
+// cacheOptions returns the settings that differ from the defaults, in the
+// same form as provider options, for the cache key. The rate is compared
+// with the built-in default rather than SPEAKING_RATE, so that changing it
+// can't serve clips cached at another rate.
+func (p prosody) cacheOptions() map[string]string {
+	options := map[string]string{}
+	p.rate = p.speakingRate()
+	if p.rate == builtinSpeakingRate {
+		p.rate = 0
+	}
+	for _, param := range prosodyParams {
+		if v := *param.field(&p); v != 0 {
+			options[param.name] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return options
+}
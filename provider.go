@@ -0,0 +1,215 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// synthesisRequest is everything a provider needs to render one clip.
+type synthesisRequest struct {
+	Text          string
+	Language      string
+	Voice         string
+	AudioEncoding string
+	SpeakingRate  float64
+	// Pitch (in semitones) and VolumeGainDb are zero unless the client set
+	// them. Providers that cannot apply a non-zero value return an error.
+	Pitch        float64
+	VolumeGainDb float64
+	// Options holds provider-specific settings parsed by optionParser.
+	Options map[string]string
+	// SSML, if set, is the content of a validated <speak> document to speak
+	// instead of Text. It is only set for providers implementing ssmlSpeaker.
+	SSML string
+	// SampleRateHertz is zero for the voice's natural rate. It is only set
+	// for providers implementing sampleRater.
+	SampleRateHertz int
+	// BitrateKbps is zero for the provider's own MP3 bitrate. It is only set
+	// to a bitrate the provider's SetsBitrate accepts.
+	BitrateKbps int
+}
+
+// voiceInfo describes one voice offered by a provider.
+type voiceInfo struct {
+	Name              string   `json:"name"`
+	LanguageCodes     []string `json:"languageCodes"`
+	Gender            string   `json:"gender,omitempty"`
+	NaturalSampleRate int      `json:"naturalSampleRateHertz,omitempty"`
+}
+
+// provider is a TTS backend. Implementations only talk to their API;
+// caching, validation and instrumentation stay in the HTTP layer.
+type provider interface {
+	// Name identifies the provider in config and logs.
+	Name() string
+	// Synthesize renders req and returns the encoded audio.
+	Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error)
+	// Voices lists the voices available for language.
+	Voices(ctx context.Context, language string) ([]voiceInfo, error)
+	// DefaultVoice is used when a request names no voice.
+	DefaultVoice() string
+	// AllowedVoices lists the voices clients may request.
+	AllowedVoices() []string
+}
+
+// optionParser is implemented by providers that take extra query parameters.
+// ParseOptions returns only the settings that differ from the provider's
+// defaults, since they become part of the cache key.
+type optionParser interface {
+	ParseOptions(q url.Values) (map[string]string, error)
+}
+
+func parseProviderOptions(p provider, q url.Values) (map[string]string, error) {
+	if op, ok := p.(optionParser); ok {
+		return op.ParseOptions(q)
+	}
+	return nil, nil
+}
+
+// languageVoicer is implemented by providers with a default voice per
+// language.
+type languageVoicer interface {
+	DefaultVoiceFor(language string) (string, bool)
+}
+
+// defaultVoiceFor returns p's default voice for language, falling back to its
+// overall default.
+func defaultVoiceFor(p provider, language string) string {
+	if lv, ok := p.(languageVoicer); ok {
+		if v, ok := lv.DefaultVoiceFor(language); ok {
+			return v
+		}
+	}
+	return p.DefaultVoice()
+}
+
+// ssmlSpeaker is implemented by providers that accept SSML. Others are given
+// the plain text of an SSML request.
+type ssmlSpeaker interface {
+	SpeaksSSML() bool
+}
+
+func speaksSSML(p provider) bool {
+	s, ok := p.(ssmlSpeaker)
+	return ok && s.SpeaksSSML()
+}
+
+// sampleRater is implemented by providers that can render at a chosen
+// sample rate.
+type sampleRater interface {
+	SetsSampleRate() bool
+}
+
+func setsSampleRate(p provider) bool {
+	s, ok := p.(sampleRater)
+	return ok && s.SetsSampleRate()
+}
+
+// bitrateSetter is implemented by providers that can render MP3 at some
+// bitrates, in kbps.
+type bitrateSetter interface {
+	SetsBitrate(kbps int) bool
+}
+
+func setsBitrate(p provider, kbps int) bool {
+	s, ok := p.(bitrateSetter)
+	return ok && s.SetsBitrate(kbps)
+}
+
+// canonicalOptions encodes options as sorted "k=v" pairs joined by "&".
+func canonicalOptions(options map[string]string) string {
+	pairs := make([]string, 0, len(options))
+	for k, v := range options {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// optionsHash returns a short, stable digest of options for cache filenames.
+func optionsHash(options map[string]string) string {
+	return shortHash(canonicalOptions(options))
+}
+
+// shortHash returns 8 hex digits of the SHA-256 of s.
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// errNotConfigured is returned by a provider factory whose credentials are
+// absent from the environment.
+var errNotConfigured = errors.New("provider not configured")
+
+// providerFactories builds each known provider from the environment.
+var providerFactories = map[string]func() (provider, error){
+	"google":     newGoogleProvider,
+	"azure":      newAzureProvider,
+	"polly":      newPollyProvider,
+	"elevenlabs": newElevenLabsProvider,
+	"openai":     newOpenAIProvider,
+	"piper":      newPiperProvider,
+	"mock":       newMockProvider,
+}
+
+var (
+	// providers holds every provider whose credentials are configured,
+	// selectable per request with ?provider=.
+	providers = map[string]provider{}
+	// defaultProvider, chosen by TTS_PROVIDER, serves requests that name none.
+	defaultProvider provider
+)
+
+// setupProviders builds every configured provider. The default provider must
+// be configured; others are skipped when their credentials are missing.
+func setupProviders(defaultName string) error {
+	if _, ok := providerFactories[defaultName]; !ok {
+		return fmt.Errorf("unknown provider %q: must be one of %s", defaultName, strings.Join(providerNames(), ", "))
+	}
+	for name, factory := range providerFactories {
+		p, err := factory()
+		if errors.Is(err, errNotConfigured) && name != defaultName {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		providers[name] = p
+	}
+	defaultProvider = providers[defaultName]
+	return nil
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(providerFactories))
+	for n := range providerFactories {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerFor resolves a ?provider= value, with "" meaning the default.
+func providerFor(name string) (provider, bool) {
+	if name == "" {
+		return defaultProvider, true
+	}
+	p, ok := providers[name]
+	return p, ok
+}
+
+// cacheVoiceKey names the voice in cache filenames. Google entries keep the
+// bare voice name so existing caches stay valid; other providers are
+// prefixed so identically named voices never collide across providers.
+func cacheVoiceKey(p provider, voice string) string {
+	if p.Name() == "google" {
+		return voice
+	}
+	return p.Name() + "-" + voice
+}
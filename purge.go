@@ -0,0 +1,94 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type purgeRequest struct {
+	Voice     string `json:"voice"`
+	OlderThan string `json:"olderThan"`
+	Prefix    string `json:"prefix"`
+}
+
+// handleCachePurge deletes cache entries matching every given criterion:
+// voice, age (olderThan) and text prefix. With ?dryRun=true it only counts them.
+func handleCachePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body purgeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Voice == "" && body.OlderThan == "" && body.Prefix == "" {
+		http.Error(w, "Refusing to purge everything: give at least one of voice, olderThan, prefix", http.StatusBadRequest)
+		return
+	}
+
+	filter := indexFilter{voice: body.Voice, prefix: body.Prefix}
+	if body.OlderThan != "" {
+		d, err := parseDuration(body.OlderThan)
+		if err != nil {
+			http.Error(w, "Invalid olderThan: must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		filter.createdBefore = time.Now().Add(-d)
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	matched, removed, err := purgeCache(r.Context(), filter, dryRun)
+	if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Matched int  `json:"matched"`
+		Removed int  `json:"removed"`
+		DryRun  bool `json:"dryRun"`
+	}{matched, removed, dryRun})
+}
+
+// purgeCache deletes the cache entries matching filter, or with dryRun only
+// counts them.
+func purgeCache(ctx context.Context, filter indexFilter, dryRun bool) (matched, removed int, err error) {
+	entries, err := queryIndex(ctx, filter)
+	if err != nil {
+		return 0, 0, err
+	}
+	matched = len(entries)
+	if dryRun {
+		entries = nil
+	}
+
+	decks := map[string]bool{}
+	for _, e := range entries {
+		if err := cacheStore.Delete(ctx, e.Key); err != nil {
+			slog.Error("Failed to purge", "key", logPath(e.Key), "error", err)
+			continue
+		}
+		deleteSidecars(ctx, e.Key)
+		if err := indexDelete(ctx, e.Key); err != nil {
+			slog.Error("Failed to drop entry from the cache index", "key", logPath(e.Key), "error", err)
+		}
+		removed++
+		decks[keyDeck(e.Key)] = true
+	}
+	for deck := range decks {
+		if err := pruneDeckManifest(ctx, deck); err != nil {
+			slog.Error("Failed to prune manifest", "deck", deck, "error", err)
+		}
+	}
+	slog.Info("Purged cache entries", "removed", removed, "matched", matched, "dry_run", dryRun)
+	return matched, removed, nil
+}
@@ -0,0 +1,75 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCachePurge(t *testing.T) {
+	useEmptyCache(t)
+	adminToken = "root"
+	t.Cleanup(func() { adminToken = "" })
+
+	purge := func(query, body, token string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/cache/purge?"+query, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result map[string]any
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+	cached := func(text string) bool {
+		resp, _ := get(t, "/tts", url.Values{"text": {text}, "probe": {"true"}})
+		return resp.StatusCode == http.StatusOK
+	}
+
+	for _, text := range []string{"清一", "清二", "留一"} {
+		getMetadata(t, url.Values{"text": {text}})
+	}
+	backgroundWork.Wait()
+	// A file put in the cache by hand isn't in the index, so it is never
+	// purged, whatever its name.
+	manual := filepath.Join(outputDir, "清manual.mp3")
+	if err := os.WriteFile(manual, mockMP3Frame, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := purge("", `{"prefix": "清"}`, "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("purge with a wrong token: %d, want 401", status)
+	}
+	if status, _ := purge("", `{}`, "root"); status != http.StatusBadRequest {
+		t.Errorf("purge with no criteria: %d, want 400", status)
+	}
+
+	status, result := purge("dryRun=true", `{"prefix": "清"}`, "root")
+	if status != http.StatusOK || result["matched"] != 2.0 || result["removed"] != 0.0 || result["dryRun"] != true {
+		t.Errorf("dry run: %d %v, want 2 matched and none removed", status, result)
+	}
+	if !cached("清一") || !cached("清二") {
+		t.Error("the dry run deleted entries")
+	}
+
+	status, result = purge("", `{"prefix": "清"}`, "root")
+	if status != http.StatusOK || result["matched"] != 2.0 || result["removed"] != 2.0 {
+		t.Errorf("purge: %d %v, want 2 removed", status, result)
+	}
+	if cached("清一") || cached("清二") {
+		t.Error("purged entries are still cached")
+	}
+	if !cached("留一") {
+		t.Error("purge removed an entry without the prefix")
+	}
+	if _, err := os.Stat(manual); err != nil {
+		t.Errorf("purge touched a file added by hand: %v", err)
+	}
+}
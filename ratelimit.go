@@ -0,0 +1,89 @@
+package wenbuntts
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket holds a client IP's requests: each may make
+// RATE_LIMIT_PER_MINUTE requests a minute on average, with bursts of up to
+// RATE_LIMIT_BURST; 0 disables the limit.
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+var (
+	rateMu      sync.Mutex
+	rateBuckets = map[string]*tokenBucket{}
+	rateSweptAt time.Time
+)
+
+// takeToken spends one of ip's tokens under the limits of s. If none is
+// left it returns false and how long until the next one.
+func takeToken(s *reloadableSettings, ip string, now time.Time) (bool, time.Duration) {
+	perSecond := float64(s.rateLimitPerMinute) / 60
+	burst := float64(s.rateLimitBurst)
+
+	rateMu.Lock()
+	defer rateMu.Unlock()
+
+	// Buckets that have refilled are the same as absent ones, so drop them
+	// now and then to keep the map bounded by recently active clients.
+	if now.Sub(rateSweptAt) > time.Minute {
+		for k, b := range rateBuckets {
+			if b.tokens+now.Sub(b.at).Seconds()*perSecond >= burst {
+				delete(rateBuckets, k)
+			}
+		}
+		rateSweptAt = now
+	}
+
+	b, ok := rateBuckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: burst, at: now}
+		rateBuckets[ip] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.at).Seconds()*perSecond)
+	b.at = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// takeClientToken is takeToken, with the bucket shared by every replica
+// through Redis when it is set up and reachable.
+func takeClientToken(ctx context.Context, s *reloadableSettings, ip string, now time.Time) (bool, time.Duration) {
+	if redisClient != nil {
+		ok, wait, err := takeSharedToken(ctx, s, ip, now)
+		if err == nil {
+			return ok, wait
+		}
+		logger(ctx).Warn("Failed to take shared rate limit token; limiting locally", "error", err)
+	}
+	return takeToken(s, ip, now)
+}
+
+// limitRate rejects a request with 429 and Retry-After once its client IP
+// has used up its token bucket.
+func limitRate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := current()
+		if s.rateLimitPerMinute <= 0 {
+			next(w, r)
+			return
+		}
+		if ok, wait := takeClientToken(r.Context(), s, clientIP(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,46 @@
+package wenbuntts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// redactLogText replaces user-supplied text in log lines with a summary when
+// LOG_REDACT_TEXT=true.
+var redactLogText bool
+
+// logText returns s for logging, or "<N chars, hash xxxxxxxx>" when
+// redaction is on. The hash is stable, so lines can still be correlated.
+func logText(s string) string {
+	if !redactLogText {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return fmt.Sprintf("<%d chars, hash %s>", utf8.RuneCountInString(s), hex.EncodeToString(sum[:4]))
+}
+
+// logPath returns a cache file path for logging. With redaction on, the
+// file name (which embeds the text) is summarized like logText.
+func logPath(path string) string {
+	if !redactLogText {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), logText(filepath.Base(path)))
+}
+
+// logRedacted summarizes every occurrence of the given texts within s.
+func logRedacted(s string, texts ...string) string {
+	if !redactLogText {
+		return s
+	}
+	for _, t := range texts {
+		if t != "" {
+			s = strings.ReplaceAll(s, t, logText(t))
+		}
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLogRedactText(t *testing.T) {
+	var logs bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() {
+		slog.SetDefault(saved)
+		redactLogText = false
+	})
+
+	// A hit, a miss, a failed synthesis and a batch item each log the text.
+	render := func(texts ...string) {
+		t.Helper()
+		getMetadata(t, url.Values{"text": {texts[0]}})
+		getMetadata(t, url.Values{"text": {texts[0]}})
+		get(t, "/tts", url.Values{"text": {texts[1]}, "format": {"ogg"}})
+		resp, err := http.Post(server.URL+"/tts/batch", "application/json", strings.NewReader(`[{"text": "`+texts[2]+`"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		backgroundWork.Wait()
+	}
+
+	render("公开", "公布", "公告")
+	if !strings.Contains(logs.String(), "公开") {
+		t.Fatalf("without LOG_REDACT_TEXT, the text wasn't logged:\n%s", logs.String())
+	}
+
+	logs.Reset()
+	redactLogText = true
+	texts := []string{"保密", "秘密", "机密"}
+	render(texts...)
+	for _, text := range texts {
+		if strings.Contains(logs.String(), text) || strings.Contains(logs.String(), url.QueryEscape(text)) {
+			t.Errorf("%s was logged with LOG_REDACT_TEXT=true:\n%s", text, logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), logText("保密")) {
+		t.Errorf("no summary %s of 保密 in the logs:\n%s", logText("保密"), logs.String())
+	}
+}
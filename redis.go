@@ -0,0 +1,414 @@
+package wenbuntts
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// With REDIS_URL set (redis://[user:password@]host:6379[/db], or rediss://
+// for TLS), replicas behind a load balancer coordinate through Redis: only
+// one replica synthesizes a missing clip while the others wait for it to
+// reach the cache, rate limits count every replica's requests, and each
+// replica's cache index learns the entries the others add and remove. This
+// assumes the replicas share their cache store, e.g. CACHE_BACKEND=s3. Keys
+// and channels start with REDIS_PREFIX. When Redis can't be reached each
+// replica carries on alone.
+//
+// Redis is not itself a cache index backend: each replica keeps its own
+// SQLite index, and Redis only relays changes between them. The indexes are
+// eventually consistent at best. A change published while a replica is
+// disconnected is lost until it reconnects and resyncs from the cache
+// store, and hit counts, popularity and history stay per replica.
+var (
+	redisClient  *redisPool
+	redisPrefix  = "wenbuntts:"
+	redisLockTTL = 30 * time.Second
+)
+
+// replicaID tells this process's index changes from other replicas'.
+var replicaID = newRequestID()
+
+const (
+	redisTimeout  = 5 * time.Second
+	redisLockPoll = 250 * time.Millisecond
+)
+
+// redisPool is a minimal RESP client keeping a few idle connections.
+type redisPool struct {
+	addr, user, password, db string
+	tls                      bool
+	idle                     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisError is an error reply from Redis. The connection stays usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// newRedisPool parses REDIS_URL.
+func newRedisPool(rawURL string) (*redisPool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+		return nil, errors.New("must be a URL such as redis://localhost:6379/0")
+	}
+	p := &redisPool{addr: u.Host, tls: u.Scheme == "rediss", idle: make(chan *redisConn, 16)}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		p.user = u.User.Username()
+		p.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, errors.New("the database must be a number, as in redis://localhost:6379/0")
+		}
+		p.db = db
+	}
+	return p, nil
+}
+
+func (p *redisPool) dial(ctx context.Context) (*redisConn, error) {
+	d := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if p.tls {
+		host, _, _ := net.SplitHostPort(p.addr)
+		conn, err = (&tls.Dialer{NetDialer: d, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", p.addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", p.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	if p.password != "" {
+		args := []string{"AUTH", p.password}
+		if p.user != "" {
+			args = []string{"AUTH", p.user, p.password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if p.db != "" {
+		if _, err := c.do("SELECT", p.db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do runs one command on an idle connection, or a new one.
+func (p *redisPool) do(ctx context.Context, args ...string) (any, error) {
+	var c *redisConn
+	select {
+	case c = <-p.idle:
+	default:
+		var err error
+		if c, err = p.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+	reply, err := c.do(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+// eval runs a Lua script, sending it whole each time; the scripts here are
+// short enough.
+func (p *redisPool) eval(ctx context.Context, script string, keys []string, args ...string) (any, error) {
+	cmd := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return p.do(ctx, append(cmd, args...)...)
+}
+
+func (c *redisConn) do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads one reply: a string, an int64, nil, a []any or a
+// redisError.
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: bad reply %q", line)
+}
+
+const (
+	// renewLockScript and releaseLockScript only touch a lock still held
+	// with the caller's token, not one that expired and was taken since.
+	renewLockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end return 0`
+
+	releaseLockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end return 0`
+)
+
+// generateAcrossReplicas runs doGenerateFile for req once this replica
+// holds the Redis lock on req.key. While another replica holds it, it waits
+// for that replica's clip to reach the cache and publishes that instead, or
+// takes over if the lock goes away without one. Without Redis, or when
+// Redis fails, it generates right away.
+func generateAcrossReplicas(ctx context.Context, req ttsRequest, publish func([]byte)) error {
+	if redisClient == nil {
+		return doGenerateFile(ctx, req, publish)
+	}
+	lock, token := redisPrefix+"lock:"+req.key, newRequestID()
+	ttl := strconv.FormatInt(redisLockTTL.Milliseconds(), 10)
+	// Clips the other replica saved since we started waiting count, not an
+	// expired entry it was never asked for. Object stores keep whole seconds.
+	since := time.Now().Truncate(time.Second)
+	for waited := false; ; waited = true {
+		reply, err := redisClient.do(ctx, "SET", lock, token, "NX", "PX", ttl)
+		if err != nil {
+			logger(ctx).Warn("Failed to take generation lock; generating anyway", "error", err)
+			return doGenerateFile(ctx, req, publish)
+		}
+		if reply == "OK" {
+			break
+		}
+		if !waited {
+			logger(ctx).Info("Waiting for another replica's generation", "key", logPath(req.key))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(redisLockPoll):
+		}
+		if audio, info, err := cacheStore.Get(ctx, req.key); err == nil && !info.ModTime.Before(since) {
+			publish(audio)
+			return nil
+		}
+	}
+
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisTimeout)
+		defer cancel()
+		if _, err := redisClient.eval(releaseCtx, releaseLockScript, []string{lock}, token); err != nil {
+			logger(ctx).Warn("Failed to release generation lock", "error", err)
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(redisLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := redisClient.eval(context.WithoutCancel(ctx), renewLockScript, []string{lock}, token, ttl); err != nil {
+					logger(ctx).Warn("Failed to renew generation lock", "error", err)
+				}
+			}
+		}
+	}()
+	return doGenerateFile(ctx, req, publish)
+}
+
+// takeTokenScript is takeToken's bucket kept in a Redis hash, in ms.
+const takeTokenScript = `
+local rate, burst, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens, at = tonumber(b[1]) or burst, tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - at) * rate)
+if tokens < 1 then
+	return {0, tostring(math.ceil((1 - tokens) / rate))}
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens - 1), 'at', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate))
+return {1, '0'}`
+
+// takeSharedToken is takeToken with the bucket shared by every replica.
+func takeSharedToken(ctx context.Context, s *reloadableSettings, ip string, now time.Time) (bool, time.Duration, error) {
+	perMs := float64(s.rateLimitPerMinute) / 60000
+	burst := s.rateLimitBurst
+	reply, err := redisClient.eval(ctx, takeTokenScript, []string{redisPrefix + "rate:" + ip},
+		strconv.FormatFloat(perMs, 'g', -1, 64), strconv.Itoa(burst), strconv.FormatInt(now.UnixMilli(), 10))
+	if err != nil {
+		return false, 0, err
+	}
+	r, ok := reply.([]any)
+	if !ok || len(r) != 2 {
+		return false, 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	wait, _ := strconv.ParseInt(fmt.Sprint(r[1]), 10, 64)
+	return r[0] == int64(1), time.Duration(wait) * time.Millisecond, nil
+}
+
+// indexChange is a change to the cache index one replica shares with the
+// others: an entry it indexed, or one it deleted.
+type indexChange struct {
+	Replica string      `json:"replica"`
+	Put     *indexEntry `json:"put,omitempty"`
+	Delete  string      `json:"delete,omitempty"`
+}
+
+// shareIndexChange publishes c to the other replicas, if there are any.
+func shareIndexChange(ctx context.Context, c indexChange) {
+	if redisClient == nil {
+		return
+	}
+	c.Replica = replicaID
+	msg, _ := json.Marshal(c)
+	if _, err := redisClient.do(ctx, "PUBLISH", redisPrefix+"index", string(msg)); err != nil {
+		logger(ctx).Warn("Failed to share cache index change", "error", err)
+	}
+}
+
+// watchIndexChanges applies the other replicas' index changes until ctx is
+// done. It resyncs the index after losing the subscription, since changes
+// made meanwhile are gone.
+func watchIndexChanges(ctx context.Context) {
+	for lost := false; ctx.Err() == nil; lost = true {
+		if lost {
+			if err := syncCacheIndex(ctx); err != nil {
+				slog.Error("Failed to sync cache index", "error", err)
+			}
+		}
+		err := subscribeIndexChanges(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Lost cache index subscription; retrying", "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func subscribeIndexChanges(ctx context.Context) error {
+	c, err := redisClient.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+	c.SetDeadline(time.Time{})
+	if _, err := c.do("SUBSCRIBE", redisPrefix+"index"); err != nil {
+		return err
+	}
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			return err
+		}
+		msg, ok := reply.([]any)
+		if !ok || len(msg) != 3 || msg[0] != "message" {
+			continue
+		}
+		var change indexChange
+		if err := json.Unmarshal([]byte(fmt.Sprint(msg[2])), &change); err != nil || change.Replica == replicaID {
+			continue
+		}
+		if err := applyIndexChange(ctx, change); err != nil {
+			slog.Error("Failed to apply cache index change", "error", err)
+		}
+	}
+}
+
+// applyIndexChange records another replica's change in the index. Like
+// indexPut, it keeps the hits this replica counted on a regenerated entry.
+func applyIndexChange(ctx context.Context, c indexChange) error {
+	if c.Delete != "" {
+		_, err := cacheIndex.ExecContext(ctx, `DELETE FROM entries WHERE key = ?`, c.Delete)
+		return err
+	}
+	if c.Put == nil {
+		return nil
+	}
+	e := c.Put
+	_, err := cacheIndex.ExecContext(ctx, `
+		INSERT INTO entries (key, tenant, deck, text, voice, provider, encoding, size, created, last_access, duration_ms, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			text = excluded.text, voice = excluded.voice, provider = excluded.provider,
+			encoding = excluded.encoding, size = excluded.size, created = excluded.created,
+			last_access = excluded.last_access, duration_ms = excluded.duration_ms,
+			content_hash = excluded.content_hash`,
+		e.Key, e.Tenant, e.Deck, e.Text, e.Voice, e.Provider, e.Encoding, e.Size, e.Created.UnixNano(), e.LastAccess.UnixNano(), e.DurationMs, e.ContentHash)
+	return err
+}
@@ -0,0 +1,257 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+// SIGHUP or POST /admin/reload re-read the config file and .env and apply
+// the settings in reloadableSettings without a restart, so in-flight
+// requests and batch jobs carry on. Everything else still needs one. A
+// reload with an invalid setting changes nothing.
+//
+// reloadMu serializes reloads; see liveSettings for how requests see them.
+var reloadMu sync.Mutex
+
+// processEnv names the variables set in the environment before .env was
+// loaded, which .env doesn't override on reload either.
+var processEnv map[string]bool
+
+// environNames returns the names of the variables in the environment.
+func environNames() map[string]bool {
+	names := map[string]bool{}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		names[name] = true
+	}
+	return names
+}
+
+// reloadableSettings are the voice defaults, validation policy, rate
+// limits, CORS settings and character budgets.
+type reloadableSettings struct {
+	rules            map[string]languageRule
+	language, voice  string
+	speakingRate     float64
+	allowLatin       bool
+	allowDigits      bool
+	allowPunctuation bool
+	minScriptChars   int
+	minHanForTTS     int
+
+	rateLimitPerMinute, rateLimitBurst, maxInflightPerIP int
+
+	corsOrigins, corsMethods []string
+
+	charBudgetDaily, charBudgetMonthly, tenantBudgetDaily, tenantBudgetMonthly int
+	charBudgetStatus                                                           int
+}
+
+// readReloadable reads the reloadable settings, or returns why one is
+// invalid.
+func readReloadable() (reloadableSettings, error) {
+	s := reloadableSettings{rules: maps.Clone(builtinLanguageRules), language: languageCode, voice: builtinVoice}
+	if err := parseTextScripts(s.rules, setting("TEXT_SCRIPTS")); err != nil {
+		return s, fmt.Errorf("Invalid TEXT_SCRIPTS: %w", err)
+	}
+	s.allowLatin = setting("TEXT_ALLOW_LATIN") == "true"
+	s.allowDigits = setting("TEXT_ALLOW_DIGITS") == "true"
+	s.allowPunctuation = setting("TEXT_ALLOW_PUNCTUATION") == "true"
+	for _, n := range []struct {
+		v    *int
+		name string
+		def  int
+	}{
+		{&s.minScriptChars, "TEXT_MIN_SCRIPT_CHARS", 1},
+		{&s.minHanForTTS, "MIN_HAN_FOR_TTS", 1},
+		{&s.maxInflightPerIP, "MAX_INFLIGHT_PER_IP", 0},
+		{&s.rateLimitPerMinute, "RATE_LIMIT_PER_MINUTE", 0},
+		{&s.rateLimitBurst, "RATE_LIMIT_BURST", 10},
+		{&s.charBudgetDaily, "CHAR_BUDGET_DAILY", 0},
+		{&s.charBudgetMonthly, "CHAR_BUDGET_MONTHLY", 0},
+		{&s.tenantBudgetDaily, "TENANT_CHAR_BUDGET_DAILY", 0},
+		{&s.tenantBudgetMonthly, "TENANT_CHAR_BUDGET_MONTHLY", 0},
+		{&s.charBudgetStatus, "CHAR_BUDGET_STATUS", http.StatusPaymentRequired},
+	} {
+		var err error
+		if *n.v, err = intSetting(n.name, n.def); err != nil {
+			return s, err
+		}
+	}
+	if s.minHanForTTS < 1 {
+		return s, errors.New("Invalid MIN_HAN_FOR_TTS: must be at least 1")
+	}
+	s.rateLimitBurst = max(s.rateLimitBurst, 1)
+	if s.charBudgetStatus < 400 || s.charBudgetStatus > 499 {
+		return s, errors.New("Invalid CHAR_BUDGET_STATUS: must be a 4xx status, such as 402 or 429")
+	}
+	if v := setting("DEFAULT_LANGUAGE"); v != "" {
+		if _, ok := s.rules[v]; !ok {
+			return s, fmt.Errorf("Invalid DEFAULT_LANGUAGE: must be one of %s", strings.Join(slices.Sorted(maps.Keys(s.rules)), ", "))
+		}
+		s.language = v
+	}
+	if v := setting("DEFAULT_VOICE"); v != "" {
+		language, err := setDefaultVoice(s.rules, v, s.language, setting("DEFAULT_LANGUAGE") == "")
+		if err != nil {
+			return s, fmt.Errorf("Invalid DEFAULT_VOICE: %w", err)
+		}
+		s.language, s.voice = language, v
+	}
+	s.speakingRate = builtinSpeakingRate
+	if v := setting("SPEAKING_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0.25 || rate > 4 {
+			return s, errors.New("Invalid SPEAKING_RATE: must be between 0.25 and 4")
+		}
+		s.speakingRate = rate
+	}
+
+	s.corsOrigins = splitList(setting("CORS_ALLOWED_ORIGINS"))
+	s.corsMethods = defaultCORSMethods
+	if methods := splitList(strings.ToUpper(setting("CORS_ALLOWED_METHODS"))); len(methods) > 0 {
+		s.corsMethods = methods
+	}
+	return s, nil
+}
+
+// liveSettings holds the reloadable settings in effect. A reload stores new ones
+// instead of changing them, so a request that loads them once, at the top
+// of a handler or helper, sees one consistent set.
+var liveSettings atomic.Pointer[reloadableSettings]
+
+// builtinSettings are in effect until setup reads the settings.
+var builtinSettings = reloadableSettings{
+	rules:            builtinLanguageRules,
+	language:         languageCode,
+	voice:            builtinVoice,
+	speakingRate:     builtinSpeakingRate,
+	minScriptChars:   1,
+	minHanForTTS:     1,
+	rateLimitBurst:   10,
+	corsMethods:      defaultCORSMethods,
+	charBudgetStatus: http.StatusPaymentRequired,
+}
+
+// current returns the reloadable settings in effect.
+func current() *reloadableSettings {
+	if s := liveSettings.Load(); s != nil {
+		return s
+	}
+	return &builtinSettings
+}
+
+// apply makes s the settings in effect.
+func (s reloadableSettings) apply() {
+	liveSettings.Store(&s)
+}
+
+// reloadSettings re-reads the config file and .env and applies the
+// reloadable settings, or returns why it can't.
+func reloadSettings() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	file, err := readConfigFile(settings.path)
+	if err != nil {
+		return err
+	}
+	dotenv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Invalid .env: %w", err)
+	}
+	restoreEnv := setDotEnv(dotenv)
+	oldFile := settings.file
+	settings.file = file
+
+	reloaded, err := readReloadable()
+	if err != nil {
+		settings.file = oldFile
+		restoreEnv()
+		return err
+	}
+	reloaded.apply()
+	slog.Info("Reloaded settings")
+	return nil
+}
+
+// setDotEnv sets the variables of dotenv that the process environment
+// doesn't, and unsets those a previous .env set but dotenv lacks. The
+// returned function undoes it.
+func setDotEnv(dotenv map[string]string) (restore func()) {
+	if processEnv == nil {
+		// Not started by Main, so .env was never read.
+		return func() {}
+	}
+	old := map[string]*string{}
+	for name := range environNames() {
+		if _, ok := dotenv[name]; !ok && !processEnv[name] && !strings.HasPrefix(name, "OTEL_") {
+			v := os.Getenv(name)
+			old[name] = &v
+			os.Unsetenv(name)
+		}
+	}
+	for name, v := range dotenv {
+		if processEnv[name] {
+			continue
+		}
+		if prev, ok := os.LookupEnv(name); ok {
+			old[name] = &prev
+		} else {
+			old[name] = nil
+		}
+		os.Setenv(name, v)
+	}
+	return func() {
+		for name, v := range old {
+			if v == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *v)
+			}
+		}
+	}
+}
+
+// reloadOnSignal reloads the settings on every SIGHUP until ctx is done.
+func reloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			if err := reloadSettings(); err != nil {
+				slog.Error("Reload failed, keeping the current settings", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleAdminReload reloads the settings, answering 400 with the reason if
+// they are invalid.
+func handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if err := reloadSettings(); err != nil {
+		slog.Error("Reload failed, keeping the current settings", "error", err)
+		http.Error(w, "Reload failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// setSettings applies the reloadable settings in effect as changed by edit,
+// until t ends.
+func setSettings(t *testing.T, edit func(*reloadableSettings)) {
+	t.Helper()
+	old := current()
+	s := *old
+	edit(&s)
+	s.apply()
+	t.Cleanup(old.apply)
+}
+
+func TestReloadDuringRequests(t *testing.T) {
+	old := current()
+	t.Cleanup(old.apply)
+	t.Setenv("TEXT_ALLOW_DIGITS", "true")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				resp, err := http.Get(server.URL + "/tts?" + url.Values{"text": {"重载"}, "response": {"json"}}.Encode())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("/tts during reloads: %s", resp.Status)
+				}
+			}
+		})
+	}
+	for i := range 50 {
+		rate := "0.9"
+		if i%2 == 1 {
+			rate = "1.5"
+		}
+		t.Setenv("SPEAKING_RATE", rate)
+		if err := reloadSettings(); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if !current().allowDigits {
+		t.Error("TEXT_ALLOW_DIGITS=true was not reloaded")
+	}
+}
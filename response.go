@@ -0,0 +1,109 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// audioMetadata is the ?response=json form of a /tts response.
+type audioMetadata struct {
+	URL          string `json:"url"`
+	ContentURL   string `json:"contentUrl"`   // see audioURL
+	ImmutableURL string `json:"immutableUrl"` // see contentAudioURL
+	CacheHit     bool   `json:"cacheHit"`
+	Provider     string `json:"provider"`
+	Voice        string `json:"voice"`
+	DurationMs   int64  `json:"durationMs,omitempty"`
+	Bytes        int64  `json:"bytes"`
+	AudioBase64  string `json:"audioBase64,omitempty"`
+
+	// Heteronyms lists the 多音字 no ?pinyin= hint or dictionary word
+	// settled, see HETERONYM_MODE.
+	Heteronyms []heteronymNote `json:"heteronyms,omitempty"`
+
+	// Chunks are the clips an ?autoSplit=true clip joins.
+	Chunks []chunkMetadata `json:"chunks,omitempty"`
+}
+
+// wantsJSON reports whether a /tts request asked for metadata instead of
+// audio, with ?response=json or by accepting application/json but no audio.
+func wantsJSON(r *http.Request) bool {
+	if v := r.URL.Query().Get("response"); v != "" {
+		return v == "json"
+	}
+	accept := r.Header.Get("Accept")
+	acceptsJSON := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+		if strings.HasPrefix(mediaType, "audio/") {
+			return false
+		}
+		acceptsJSON = acceptsJSON || mediaType == "application/json"
+	}
+	return acceptsJSON
+}
+
+// writeAudioJSON describes the clip stored for req. URL is the request's
+// own /tts URL without the JSON options, which serves the audio itself;
+// ?includeAudio=true also embeds it.
+func writeAudioJSON(w http.ResponseWriter, r *http.Request, req ttsRequest, cacheHit bool) {
+	defer beginServing(req.key)()
+	meta, err := clipMetadata(r.Context(), req, r.URL.Query(), cacheHit)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "Cache entry disappeared, try again", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to read cache entry", http.StatusInternalServerError)
+		logger(r.Context()).Error("Failed to read cache entry", "key", logPath(req.key), "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(meta)
+}
+
+// clipMetadata describes the clip cached for req, which query, the
+// parameters of a /tts request, serves.
+func clipMetadata(ctx context.Context, req ttsRequest, query url.Values, cacheHit bool) (audioMetadata, error) {
+	data, _, err := cacheStore.Get(ctx, req.key)
+	if err != nil {
+		return audioMetadata{}, err
+	}
+	includeAudio := query.Get("includeAudio") == "true"
+	query.Del("response")
+	query.Del("includeAudio")
+	chunks, err := chunksMetadata(ctx, req, query)
+	if err != nil {
+		return audioMetadata{}, err
+	}
+	meta := audioMetadata{
+		URL:          "/tts?" + query.Encode(),
+		ContentURL:   audioURL(req.key),
+		ImmutableURL: contentAudioURL(clipContentHash(ctx, req.key, data), req.audioFormat()),
+		CacheHit:     cacheHit,
+		Provider:     req.provider.Name(),
+		Voice:        req.model,
+		Bytes:        int64(len(data)),
+
+		Heteronyms: req.heteronyms,
+		Chunks:     chunks,
+	}
+	if d, ok := clipDuration(ctx, req.key, data); ok {
+		meta.DurationMs = d.Milliseconds()
+	}
+	if includeAudio {
+		meta.AudioBase64 = base64.StdEncoding.EncodeToString(data)
+	}
+	return meta, nil
+}
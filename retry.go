@@ -0,0 +1,129 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Transient upstream failures are retried up to retryAttempts times in all,
+// waiting a random delay of up to retryBaseDelay, 2*retryBaseDelay, ... (at
+// most retryMaxDelay) between attempts.
+var (
+	retryAttempts  int
+	retryBaseDelay time.Duration
+
+	// upstreamTimeout bounds each provider call.
+	upstreamTimeout time.Duration
+)
+
+const retryMaxDelay = 10 * time.Second
+
+// statusError is a non-OK response from a provider's synthesis API.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+// newStatusError describes resp, whose body has already been read.
+func newStatusError(resp *http.Response, body []byte) error {
+	msg := "TTS request failed: " + resp.Status
+	if body = bytes.TrimSpace(body); len(body) > 0 {
+		msg += ": " + string(body)
+	}
+	return &statusError{resp.StatusCode, msg}
+}
+
+// isTransient reports whether err is worth retrying: rate limiting, a
+// server-side error, a network failure or an attempt that hit
+// upstreamTimeout. Cancellation by the caller is not.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// retryDelay returns the jittered backoff before retry number n (from 1).
+func retryDelay(n int) time.Duration {
+	d := retryBaseDelay << (n - 1)
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return rand.N(d) + 1
+}
+
+// synthesizeRetrying calls req.provider.Synthesize, see callUpstream.
+func synthesizeRetrying(ctx context.Context, req ttsRequest, sreq synthesisRequest) ([]byte, error) {
+	var audio []byte
+	err := callUpstream(ctx, req, func(ctx context.Context) (err error) {
+		audio, err = req.provider.Synthesize(ctx, sreq)
+		return err
+	})
+	return audio, err
+}
+
+// callUpstream calls req's provider through call, retrying transient
+// failures. Each attempt holds an upstream slot, but backoff waits don't; it
+// goes through the provider's circuit breaker and is abandoned after
+// upstreamTimeout. The text is charged to the character budgets, see
+// checkBudget.
+func callUpstream(ctx context.Context, req ttsRequest, call func(context.Context) error) (err error) {
+	if serveOnly {
+		return errServeOnly
+	}
+	if err := checkBudget(ctx, req); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			recordUsage(ctx, req)
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		release, err := acquireUpstream(ctx)
+		if err != nil {
+			return err
+		}
+		breaker := breakerFor(req.provider)
+		if !breaker.allow(time.Now()) {
+			release()
+			return errCircuitOpen
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+		err = call(attemptCtx)
+		cancel()
+		release()
+		if ctx.Err() != nil {
+			breaker.abandon(time.Now())
+		} else {
+			// Only failures a retry could fix say the provider is down.
+			breaker.record(time.Now(), !isTransient(ctx, err))
+		}
+		if err == nil || attempt >= retryAttempts || !isTransient(ctx, err) {
+			return err
+		}
+		delay := retryDelay(attempt)
+		logger(ctx).Warn("Upstream attempt failed, retrying", "provider", req.provider.Name(), "attempt", attempt, "of", retryAttempts,
+			"delay", delay.Round(time.Millisecond), "error", logRedacted(err.Error(), req.text, req.alias))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
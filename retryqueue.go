@@ -0,0 +1,213 @@
+package wenbuntts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Batch items whose synthesis fails (from /tts/batch, /jobs, imports and
+// warm-ups) are kept in the retries table of the cache index and tried again
+// in the background, waiting retryQueueDelay, then twice that and so on, up
+// to retryQueueMaxDelay. After retryQueueAttempts tries, or at once if the
+// provider rejected the request, an item stays in the table as a dead
+// letter until an admin requeues or drops it through /cache/retries. The
+// table survives restarts, so items a shutdown cut short are retried too.
+var (
+	retryQueueAttempts int
+	retryQueueDelay    time.Duration
+)
+
+const retryQueueMaxDelay = 6 * time.Hour
+
+const retryQueueSchema = `
+CREATE TABLE IF NOT EXISTS retries (
+	key        TEXT PRIMARY KEY,
+	item       TEXT NOT NULL,
+	tenant     TEXT NOT NULL DEFAULT '',
+	attempts   INTEGER NOT NULL,
+	last_error TEXT NOT NULL,
+	next_at    INTEGER NOT NULL,
+	dead       INTEGER NOT NULL DEFAULT 0
+);
+`
+
+// queuedRetry is a row of the retries table as /cache/retries lists it.
+type queuedRetry struct {
+	Key         string    `json:"file"`
+	Item        batchItem `json:"item"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError"`
+	NextAttempt time.Time `json:"nextAttempt,omitzero"`
+	Dead        bool      `json:"dead"`
+}
+
+// retryBackoff is the wait after the given number of failed attempts.
+func retryBackoff(attempts int) time.Duration {
+	d := retryQueueDelay << (attempts - 1)
+	if d <= 0 || d > retryQueueMaxDelay {
+		d = retryQueueMaxDelay
+	}
+	return d
+}
+
+// enqueueRetry records that generating req for item failed with err, as
+// one more attempt if it is queued already.
+func enqueueRetry(ctx context.Context, req ttsRequest, item batchItem, err error) {
+	if retryQueueAttempts == 0 || errors.Is(err, errServeOnly) || errors.Is(err, errMissForbidden) {
+		return
+	}
+	// A shutdown cancels ctx, but the item should still be recorded.
+	ctx = context.WithoutCancel(ctx)
+	var attempts int
+	row := cacheIndex.QueryRowContext(ctx, `SELECT attempts FROM retries WHERE key = ?`, req.key)
+	if err := row.Scan(&attempts); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger(ctx).Error("Failed to read the retry queue", "error", err)
+		return
+	}
+	attempts++
+	dead := attempts >= retryQueueAttempts || isRejection(err)
+	item.Text = req.text
+	data, _ := json.Marshal(item)
+	_, dbErr := cacheIndex.ExecContext(ctx, `INSERT INTO retries (key, item, tenant, attempts, last_error, next_at, dead) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET attempts = excluded.attempts, last_error = excluded.last_error, next_at = excluded.next_at, dead = excluded.dead`,
+		req.key, string(data), req.tenant, attempts, logRedacted(err.Error(), req.text), time.Now().Add(retryBackoff(attempts)).Unix(), dead)
+	if dbErr != nil {
+		logger(ctx).Error("Failed to queue a retry", "error", dbErr)
+		return
+	}
+	if dead {
+		logger(ctx).Warn("Generation failed for good, kept as a dead letter", "key", logPath(req.key), "attempts", attempts)
+	}
+}
+
+// dequeueRetry drops key from the queue once it has been generated.
+func dequeueRetry(ctx context.Context, key string) {
+	if retryQueueAttempts == 0 {
+		return
+	}
+	if _, err := cacheIndex.ExecContext(ctx, `DELETE FROM retries WHERE key = ?`, key); err != nil {
+		logger(ctx).Error("Failed to update the retry queue", "error", err)
+	}
+}
+
+// queryRetries lists the queue, dead letters only with dead.
+func queryRetries(ctx context.Context, dead bool) ([]queuedRetry, error) {
+	rows, err := cacheIndex.QueryContext(ctx, `SELECT key, item, tenant, attempts, last_error, next_at, dead FROM retries
+		WHERE dead = 1 OR NOT ? ORDER BY next_at`, dead)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	retries := []queuedRetry{}
+	for rows.Next() {
+		var q queuedRetry
+		var item string
+		var next int64
+		if err := rows.Scan(&q.Key, &item, &q.Tenant, &q.Attempts, &q.LastError, &next, &q.Dead); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(item), &q.Item)
+		if !q.Dead {
+			q.NextAttempt = time.Unix(next, 0).UTC()
+		}
+		retries = append(retries, q)
+	}
+	return retries, rows.Err()
+}
+
+// runRetryQueue retries the items that are due every minute until ctx is
+// done.
+func runRetryQueue(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		retries, err := queryRetries(ctx, false)
+		if err != nil {
+			slog.Error("Failed to read the retry queue", "error", err)
+			continue
+		}
+		for _, q := range retries {
+			if q.Dead || q.NextAttempt.After(time.Now()) || ctx.Err() != nil {
+				continue
+			}
+			retryQueued(withTenant(ctx, q.Tenant), q)
+		}
+	}
+}
+
+// retryQueued tries q again. An item that no longer validates, e.g.
+// because its voice was removed, becomes a dead letter.
+func retryQueued(ctx context.Context, q queuedRetry) {
+	req, result := batchRequest(ctx, q.Item)
+	if result.Error != "" {
+		_, err := cacheIndex.ExecContext(ctx, `UPDATE retries SET dead = 1, last_error = ? WHERE key = ?`, result.Error, q.Key)
+		if err != nil {
+			logger(ctx).Error("Failed to update the retry queue", "error", err)
+		}
+		return
+	}
+	if _, err := lookupCached(ctx, req); err != nil {
+		if err := generateFile(ctx, req); err != nil {
+			enqueueRetry(ctx, req, q.Item, err)
+			return
+		}
+	}
+	dequeueRetry(ctx, q.Key)
+	if req.key != q.Key {
+		dequeueRetry(ctx, req.key)
+	}
+	slog.Info("Queued retry succeeded", "key", logPath(req.key), "attempts", q.Attempts+1)
+}
+
+// handleCacheRetries lists the retry queue (GET, ?dead=true for dead
+// letters only), requeues the item for ?file= to be tried again with a
+// fresh count of attempts (POST) or drops it (DELETE).
+func handleCacheRetries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	if r.Method == http.MethodGet {
+		retries, err := queryRetries(ctx, query.Get("dead") == "true")
+		if err != nil {
+			http.Error(w, "Failed to read the retry queue: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.Encode(retries)
+		return
+	}
+
+	var stmt string
+	switch r.Method {
+	case http.MethodPost:
+		stmt = `UPDATE retries SET attempts = 0, dead = 0, next_at = 0 WHERE key = ?`
+	case http.MethodDelete:
+		stmt = `DELETE FROM retries WHERE key = ?`
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res, err := cacheIndex.ExecContext(ctx, stmt, query.Get("file"))
+	if err != nil {
+		http.Error(w, "Failed to update the retry queue: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "No such queued item", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
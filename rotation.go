@@ -0,0 +1,52 @@
+package wenbuntts
+
+import (
+	"math/rand/v2"
+	"net/http"
+)
+
+// randomVoice picks a voice for ?model=random: one of VOICE_POOL for the
+// default provider when a pool is configured, or else any of prov's voices
+// for language.
+func randomVoice(prov provider, language string) (string, bool) {
+	candidates := voicePool
+	if len(candidates) == 0 || prov != defaultProvider {
+		candidates = nil
+		for _, v := range prov.AllowedVoices() {
+			if languageFor(v) == language {
+				candidates = append(candidates, v)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return candidates[rand.IntN(len(candidates))], true
+}
+
+// handleTTSAny serves a random cached rendering of ?text=, in whichever
+// voice, optionally limited to a ?deck= or ?voice=. It never synthesizes.
+// Each request may pick a different clip, so none is cacheable by clients;
+// X-TTS-Voice names the voice that was picked.
+func handleTTSAny(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	text := normalizeText(query.Get("text"))
+	if text == "" {
+		http.Error(w, "Missing ?text= parameter", http.StatusBadRequest)
+		return
+	}
+	entries, err := queryIndex(r.Context(), indexFilter{tenant: tenantFrom(r.Context()), byTenant: true, text: text, deck: query.Get("deck"), voice: query.Get("voice")})
+	if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "No cached rendering of this text", http.StatusNotFound)
+		return
+	}
+	e := entries[rand.IntN(len(entries))]
+	indexHit(r.Context(), e.Key)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-TTS-Voice", e.Voice)
+	writeAudio(w, r, e.Key)
+}
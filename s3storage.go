@@ -0,0 +1,212 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Storage stores objects in an S3 bucket, or in any service speaking the
+// S3 API with SigV4, such as Google Cloud Storage with HMAC keys. Requests
+// use path-style URLs, so endpoint may be any S3-compatible server.
+type s3Storage struct {
+	endpoint string // scheme://host
+	bucket   string
+	prefix   string // prepended to every key, e.g. "tts/"
+	region   string
+	creds    awsCredentials
+}
+
+func newS3Storage() (*s3Storage, error) {
+	s := &s3Storage{
+		endpoint: setting("S3_ENDPOINT"),
+		bucket:   setting("S3_BUCKET"),
+		prefix:   setting("S3_PREFIX"),
+		region:   cmp.Or(setting("S3_REGION"), setting("AWS_REGION")),
+		creds: awsCredentials{
+			accessKeyID:     setting("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: setting("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    setting("AWS_SESSION_TOKEN"),
+		},
+	}
+	if s.bucket == "" || s.region == "" || s.creds.accessKeyID == "" || s.creds.secretAccessKey == "" {
+		return nil, fmt.Errorf("missing S3_BUCKET, S3_REGION/AWS_REGION or AWS credentials")
+	}
+	if s.endpoint == "" {
+		s.endpoint = "https://s3." + s.region + ".amazonaws.com"
+	}
+	return s, nil
+}
+
+// newGCSStorage uses Cloud Storage's S3-compatible XML API, authenticated
+// with an HMAC key.
+func newGCSStorage() (*s3Storage, error) {
+	s := &s3Storage{
+		endpoint: "https://storage.googleapis.com",
+		bucket:   setting("GCS_BUCKET"),
+		prefix:   setting("GCS_PREFIX"),
+		region:   "auto",
+		creds: awsCredentials{
+			accessKeyID:     setting("GCS_HMAC_ACCESS_KEY"),
+			secretAccessKey: setting("GCS_HMAC_SECRET"),
+		},
+	}
+	if s.bucket == "" || s.creds.accessKeyID == "" || s.creds.secretAccessKey == "" {
+		return nil, fmt.Errorf("missing GCS_BUCKET, GCS_HMAC_ACCESS_KEY or GCS_HMAC_SECRET")
+	}
+	return s, nil
+}
+
+func (s *s3Storage) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// S3 wants every byte outside the unreserved set escaped in the path,
+	// which is stricter than url.URL's own escaping.
+	segments := []string{"", s.bucket}
+	if key != "" {
+		segments = append(segments, strings.Split(s.prefix+key, "/")...)
+	}
+	u.Path = strings.Join(segments, "/")
+	escaped := make([]string, len(segments))
+	for i, seg := range segments {
+		escaped[i] = awsEscape(seg)
+	}
+	u.RawPath = strings.Join(escaped, "/")
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if f, ok := formatForFile(key); ok && method == http.MethodPut {
+		req.Header.Set("Content-Type", f.contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", sha256Hex(body))
+	signAWSv4(req, body, s.creds, "s3", s.region, time.Now())
+	return upstreamClient.Do(req)
+}
+
+// s3Error turns an unexpected response into an error. 404s match
+// fs.ErrNotExist.
+func s3Error(op, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+	}
+	return fmt.Errorf("storage %s %s: %s: %s", op, key, resp.Status, bytes.TrimSpace(body))
+}
+
+func objectInfoFromHeader(key string, h http.Header) objectInfo {
+	size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(h.Get("Last-Modified"))
+	return objectInfo{Key: key, Size: size, ModTime: modTime}
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (objectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return objectInfo{}, s3Error("stat", key, resp)
+	}
+	return objectInfoFromHeader(key, resp.Header), nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) ([]byte, objectInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, objectInfo{}, s3Error("get", key, resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	info := objectInfoFromHeader(key, resp.Header)
+	info.Size = int64(len(data))
+	return data, info, nil
+}
+
+// Put uploads data in a single request; S3 object writes are atomic.
+func (s *s3Storage) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("put", key, resp)
+	}
+	return nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+func (s *s3Storage) List(ctx context.Context, fn func(objectInfo) error) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("list", s.prefix, resp)
+			resp.Body.Close()
+			return err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("storage list: %w", err)
+		}
+
+		for _, c := range page.Contents {
+			key := strings.TrimPrefix(c.Key, s.prefix)
+			if err := fn(objectInfo{Key: key, Size: c.Size, ModTime: c.LastModified}); err == fs.SkipAll {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
@@ -0,0 +1,198 @@
+package wenbuntts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// scheduledTask is one MAINTENANCE_SCHEDULE entry.
+type scheduledTask struct {
+	name     string
+	schedule cronSchedule
+	run      func(context.Context) error
+	running  atomic.Bool
+}
+
+// MAINTENANCE_SCHEDULE runs maintenance tasks on cron schedules in the
+// server's local time, as a semicolon-separated list of task=schedule
+// entries, e.g. "evict=*/10 * * * *; sweep=0 3 * * *; warmup=30 3 * * 1".
+// The tasks are:
+//
+//   - evict: shrink the cache to MAX_CACHE_BYTES now, see evictCache
+//   - sweep: the integrity sweep, see sweepCache
+//   - rollup: fold the per-day character counts of past months into their
+//     monthly totals, see rollupUsage
+//   - warmup: warm the cache from WARMUP_FILE again, picking up edits to it
+//   - popular: warm the POPULAR_WARM_COUNT most requested items, see
+//     warmPopular
+//
+// A task still running when it comes due again is skipped that time.
+var maintenanceTasks = map[string]func(context.Context) error{
+	"evict": func(context.Context) error { return evictCache() },
+	"sweep": func(ctx context.Context) error {
+		_, err := sweepCache(ctx, sweepRegenerate, false)
+		return err
+	},
+	"rollup": rollupUsage,
+	"warmup": func(ctx context.Context) error {
+		warmUpFile(ctx, setting("WARMUP_FILE"))
+		return nil
+	},
+	"popular": func(ctx context.Context) error { return warmPopular(ctx, popularWarmCount) },
+}
+
+// parseMaintenanceSchedule parses MAINTENANCE_SCHEDULE.
+func parseMaintenanceSchedule(s string) ([]*scheduledTask, error) {
+	var tasks []*scheduledTask
+	for entry := range strings.SplitSeq(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, spec, _ := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		run, ok := maintenanceTasks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown task %q: must be evict, sweep, rollup, warmup or popular", name)
+		}
+		switch {
+		case name == "evict" && maxCacheBytes == 0:
+			return nil, fmt.Errorf("evict needs MAX_CACHE_BYTES")
+		case name == "warmup" && setting("WARMUP_FILE") == "":
+			return nil, fmt.Errorf("warmup needs WARMUP_FILE")
+		case name == "popular" && popularWarmCount == 0:
+			return nil, fmt.Errorf("popular needs POPULAR_WARM_COUNT")
+		}
+		schedule, err := parseCron(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		tasks = append(tasks, &scheduledTask{name: name, schedule: schedule, run: run})
+	}
+	return tasks, nil
+}
+
+// runScheduler starts each task at the minutes its schedule matches until
+// ctx is done.
+func runScheduler(ctx context.Context, tasks []*scheduledTask) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-time.After(next.Sub(now)):
+		case <-ctx.Done():
+			return
+		}
+		for _, task := range tasks {
+			if !task.schedule.matches(next) {
+				continue
+			}
+			if !task.running.CompareAndSwap(false, true) {
+				slog.Warn("Scheduled task still running, skipped", "task", task.name)
+				continue
+			}
+			go func() {
+				defer task.running.Store(false)
+				start := time.Now()
+				if err := task.run(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("Scheduled task failed", "task", task.name, "error", err)
+					return
+				}
+				slog.Info("Scheduled task finished", "task", task.name, "duration", time.Since(start).Round(time.Millisecond))
+			}()
+		}
+	}
+}
+
+// rollupUsage deletes the per-day character counts of months before the
+// current one. recordUsage counts each character in its month as well, so
+// the monthly totals are unchanged; only days are no longer told apart.
+func rollupUsage(ctx context.Context) error {
+	month := time.Now().UTC().Format("2006-01")
+	res, err := cacheIndex.ExecContext(ctx, `DELETE FROM usage
+		WHERE substr(period, -10) GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]' AND substr(period, -10, 7) < ?`, month)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	slog.Info("Rolled up character usage", "days", n)
+	return nil
+}
+
+// cronSchedule is a parsed five-field cron expression: the allowed minutes,
+// hours, days of the month, months and weekdays (0 is Sunday).
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// As in cron, with both days restricted either may match.
+	domAny, dowAny bool
+}
+
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+// parseCron parses "minute hour day-of-month month day-of-week", each field
+// a comma-separated list of *, n or n-m, optionally followed by /step.
+func parseCron(spec string) (cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("invalid schedule %q: want 5 fields", spec)
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		f := cronFields[i]
+		for part := range strings.SplitSeq(field, ",") {
+			rng, stepStr, hasStep := strings.Cut(part, "/")
+			lo, hi, step := f.min, f.max, 1
+			var err error
+			if hasStep {
+				if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+					return cronSchedule{}, fmt.Errorf("invalid %s step %q", f.name, stepStr)
+				}
+			}
+			if rng != "*" {
+				a, b, isRange := strings.Cut(rng, "-")
+				lo, err = strconv.Atoi(a)
+				if err == nil {
+					hi = lo
+					if isRange {
+						hi, err = strconv.Atoi(b)
+					} else if hasStep {
+						hi = f.max
+					}
+				}
+				if err != nil || lo < f.min || hi > f.max || lo > hi {
+					return cronSchedule{}, fmt.Errorf("invalid %s %q: must be within %d-%d", f.name, part, f.min, f.max)
+				}
+			}
+			for v := lo; v <= hi; v += step {
+				sets[i] |= 1 << v
+			}
+		}
+	}
+	// Both 0 and 7 are Sunday.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+// matches reports whether the schedule runs at t's minute.
+func (c cronSchedule) matches(t time.Time) bool {
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom, dow := c.dom&(1<<t.Day()) != 0, c.dow&(1<<int(t.Weekday())) != 0
+	if !c.domAny && !c.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
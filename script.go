@@ -0,0 +1,114 @@
+package wenbuntts
+
+import (
+	"context"
+	"strings"
+)
+
+// traditionalPairs lists common 繁體 characters, each followed by its
+// simplified form, in the style of OpenCC's TSCharacters table. Conversion is
+// per character, so characters whose simplified form depends on the word
+// (such as 乾 and 干) are left out.
+const traditionalPairs = `
+來来 個个 們们 億亿 兒儿 劃划 劇剧 動动 務务 勞劳 勢势 勵励 區区
+協协 參参 員员 問问 單单 嚴严 國国 園园 圓圆 圖图 團团 報报 場场
+塊块 壓压 壞坏 夢梦 夥伙 奪夺 奮奋 婦妇 媽妈 嬰婴 孫孙 學学 實实
+寧宁 審审 寫写 寶宝 將将 專专 尋寻 對对 導导 層层 屬属 島岛 嶺岭
+師师 帶带 幣币 幫帮 幾几 庫库 廠厂 廣广 廳厅 張张 強强 彈弹 彎弯
+後后 從从 復复 徵征 愛爱 憶忆 應应 懷怀 戰战 戲戏 戶户 掃扫 換换
+擁拥 擇择 擊击 擔担 據据 擠挤 擴扩 攝摄 敗败 敵敌 數数 斷断 於于
+時时 晝昼 暫暂 曆历 曉晓 書书 會会 東东 條条 楊杨 業业 極极 樂乐
+樓楼 標标 樣样 樹树 橋桥 機机 檢检 權权 歐欧 歡欢 歲岁 歷历 歸归
+殺杀 氣气 沒没 湯汤 溫温 滿满 漁渔 漢汉 潔洁 澤泽 濕湿 濟济 灣湾
+災灾 為为 烏乌 無无 煙烟 煩烦 熱热 燈灯 營营 爐炉 爭争 爺爷 爾尔
+牆墙 獎奖 獨独 獲获 現现 環环 畢毕 畫画 當当 療疗 發发 盡尽 監监
+盤盘 眾众 睏困 確确 礎础 禍祸 禮礼 種种 稱称 穩稳 窮穷 竊窃 競竞
+筆笔 節节 範范 築筑 簡简 簽签 籃篮 糧粮 紀纪 約约 紅红 純纯 紙纸
+級级 細细 終终 組组 結结 給给 統统 絲丝 經经 綠绿 維维 網网 緊紧
+線线 練练 縣县 總总 績绩 織织 繩绳 續续 罰罚 罷罢 義义 習习 聖圣
+聯联 聲声 職职 聽听 肅肃 腦脑 腳脚 膽胆 臉脸 興兴 舉举 舊旧 艱艰
+莊庄 華华 萬万 葉叶 蓋盖 藝艺 藥药 蘇苏 蘭兰 號号 蟲虫 術术 衛卫
+衝冲 補补 裝装 裡里 製制 複复 襪袜 見见 規规 視视 親亲 覺觉 觀观
+訂订 計计 討讨 訓训 記记 訪访 設设 許许 評评 試试 詩诗 話话 該该
+詳详 誌志 認认 語语 誤误 說说 誰谁 課课 調调 談谈 請请 論论 諾诺
+講讲 謝谢 證证 識识 譯译 議议 護护 讀读 變变 讓让 豐丰 貓猫 負负
+財财 貧贫 貨货 責责 貴贵 買买 費费 貼贴 資资 賓宾 賣卖 質质 賽赛
+趕赶 趨趋 跡迹 踐践 車车 較较 輕轻 輛辆 輪轮 輸输 轉转 辦办 農农
+這这 連连 進进 運运 過过 達达 遠远 適适 遲迟 遷迁 選选 遺遗 還还
+邊边 郵邮 鄉乡 醜丑 醫医 釋释 針针 銀银 銅铜 銷销 鋼钢 錄录 錢钱
+錯错 鍋锅 鍵键 鎖锁 鏡镜 鐘钟 鐵铁 長长 門门 閃闪 閉闭 開开 間间
+閱阅 闆板 關关 陣阵 陰阴 陳陈 陸陆 陽阳 隊队 際际 隨随 險险 隻只
+雖虽 雙双 雜杂 雞鸡 離离 難难 雲云 電电 靈灵 靜静 響响 頁页 須须
+預预 頓顿 領领 頭头 頻频 顆颗 題题 額额 顏颜 願愿 類类 顧顾 顯显
+風风 飄飘 飛飞 飯饭 飲饮 飽饱 養养 餓饿 館馆 馬马 駕驾 騎骑 驅驱
+驗验 驚惊 髒脏 體体 髮发 鬆松 鬥斗 魚鱼 鮮鲜 鳥鸟 鴨鸭 鹽盐 麗丽
+麥麦 麵面 黃黄 點点 黨党 齊齐 齒齿 齡龄 龍龙`
+
+var simplifiedFor = func() map[rune]rune {
+	m := map[rune]rune{}
+	for _, pair := range strings.Fields(traditionalPairs) {
+		r := []rune(pair)
+		m[r[0]] = r[1]
+	}
+	return m
+}()
+
+// traditionalFor maps back the simplified forms in traditionalPairs that
+// only one traditional character has, so not 复, which is 復 or 複.
+var traditionalFor = func() map[rune]rune {
+	m := map[rune]rune{}
+	seen := map[rune]bool{}
+	for trad, simple := range simplifiedFor {
+		if seen[simple] {
+			delete(m, simple)
+			continue
+		}
+		seen[simple] = true
+		m[simple] = trad
+	}
+	return m
+}()
+
+// toSimplified replaces the traditional characters in s that
+// traditionalPairs knows with their simplified forms.
+func toSimplified(s string) string {
+	return strings.Map(func(c rune) rune {
+		if simple, ok := simplifiedFor[c]; ok {
+			return simple
+		}
+		return c
+	}, s)
+}
+
+// toTraditional replaces the simplified characters in s that have a single
+// traditional form in traditionalPairs with it.
+func toTraditional(s string) string {
+	return strings.Map(func(c rune) rune {
+		if trad, ok := traditionalFor[c]; ok {
+			return trad
+		}
+		return c
+	}, s)
+}
+
+// cachedVariant returns req for its text written in the other script, if
+// that is cached, for ?variantFallback=true: the reading rarely differs, so
+// a cached 学习 can stand in for 學習 and the other way round. Aliases, and
+// requests with readings or chunks of their own, have none.
+func cachedVariant(ctx context.Context, req ttsRequest) (ttsRequest, bool) {
+	if req.alias != "" || req.ssml != "" || len(req.chunks) > 0 {
+		return req, false
+	}
+	variant := req
+	if variant.text = toSimplified(req.text); variant.text == req.text {
+		variant.text = toTraditional(req.text)
+	}
+	if variant.text == req.text {
+		return req, false
+	}
+	variant.key = variant.storageKey()
+	if _, err := lookupCached(ctx, variant); err != nil {
+		return req, false
+	}
+	return variant, true
+}
@@ -0,0 +1,32 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestToTraditional(t *testing.T) {
+	for in, want := range map[string]string{
+		"学习":   "學習",
+		"学習":   "學習",
+		"复习":   "复習", // 復 or 複
+		"hi你好": "hi你好",
+	} {
+		if got := toTraditional(in); got != want {
+			t.Errorf("toTraditional(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTTSVariantFallback(t *testing.T) {
+	getMetadata(t, url.Values{"text": {"学习"}})
+
+	resp, body := get(t, "/tts", url.Values{"text": {"學習"}, "variantFallback": {"true"}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Variant-Fallback") != "true" {
+		t.Fatalf("%s %s, X-Variant-Fallback %q, want the cached 学习", resp.Status, body, resp.Header.Get("X-Variant-Fallback"))
+	}
+	if meta := getMetadata(t, url.Values{"text": {"學習"}}); meta.CacheHit {
+		t.Error("without variantFallback, 學習 was a cache hit")
+	}
+}
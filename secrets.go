@@ -0,0 +1,266 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Any setting may name a secret instead of holding it, e.g.
+//
+//	GOOGLE_API_KEY=gcpsecret://projects/my-project/secrets/tts-key
+//	OPENAI_API_KEY=awssecret://prod/tts#openai
+//	AZURE_SPEECH_KEY=vault://secret/data/tts#azure
+//
+// The secrets are fetched at startup and every SECRETS_REFRESH_INTERVAL.
+// "#field" picks a field of a secret holding a JSON object.
+var secretSchemes = []string{"gcpsecret://", "awssecret://", "vault://"}
+
+// secrets holds the fetched value of every secret reference.
+var secrets struct {
+	sync.RWMutex
+	values map[string]string
+}
+
+// secretSetting names a setting that is read again on every use, so a
+// secret rotated in the manager takes effect without a restart.
+type secretSetting string
+
+func (s secretSetting) value() string { return setting(string(s)) }
+
+func isSecretRef(v string) bool {
+	for _, scheme := range secretSchemes {
+		if strings.HasPrefix(v, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvedSecret returns the fetched value of ref, or "" before it is.
+func resolvedSecret(ref string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	return secrets.values[ref]
+}
+
+// secretRefs returns every secret reference among the settings.
+func secretRefs() []string {
+	var refs []string
+	add := func(v string) {
+		if isSecretRef(v) {
+			refs = append(refs, v)
+		}
+	}
+	for _, v := range settings.flags {
+		add(v)
+	}
+	for _, kv := range os.Environ() {
+		_, v, _ := strings.Cut(kv, "=")
+		add(v)
+	}
+	for _, v := range settings.file {
+		add(v)
+	}
+	return refs
+}
+
+// loadSecrets fetches every secret the settings refer to, then again every
+// SECRETS_REFRESH_INTERVAL in the background. A failed refresh keeps the
+// previous values.
+func loadSecrets(ctx context.Context) error {
+	refs := secretRefs()
+	if len(refs) == 0 {
+		return nil
+	}
+	if err := fetchSecrets(ctx, refs); err != nil {
+		return err
+	}
+	interval := envDuration("SECRETS_REFRESH_INTERVAL", time.Hour)
+	go func() {
+		for range time.Tick(interval) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := fetchSecrets(ctx, refs); err != nil {
+				slog.Error("Failed to refresh secrets", "error", err)
+			}
+			cancel()
+		}
+	}()
+	return nil
+}
+
+func fetchSecrets(ctx context.Context, refs []string) error {
+	values := map[string]string{}
+	for _, ref := range refs {
+		if _, ok := values[ref]; ok {
+			continue
+		}
+		v, err := fetchSecret(ctx, ref)
+		if err != nil {
+			// Only the reference: the value may be partly the secret.
+			return fmt.Errorf("failed to fetch secret %s: %w", ref, err)
+		}
+		values[ref] = v
+	}
+	secrets.Lock()
+	secrets.values = values
+	secrets.Unlock()
+	return nil
+}
+
+func fetchSecret(ctx context.Context, ref string) (string, error) {
+	ref, field, _ := strings.Cut(ref, "#")
+	scheme, name, _ := strings.Cut(ref, "://")
+	var value string
+	var err error
+	switch scheme {
+	case "gcpsecret":
+		value, err = fetchGCPSecret(ctx, name)
+	case "awssecret":
+		value, err = fetchAWSSecret(ctx, name)
+	case "vault":
+		value, err = fetchVaultSecret(ctx, name)
+	}
+	if err != nil || field == "" {
+		return value, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("#%s needs a JSON object: %w", field, err)
+	}
+	v, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("no string field %q", field)
+	}
+	return v, nil
+}
+
+// getSecret sends req and returns its body, failing on any status but 200.
+func getSecret(req *http.Request) ([]byte, error) {
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+var (
+	gcpSecretCredsOnce sync.Once
+	gcpSecretCreds     *googleCredentials
+	gcpSecretCredsErr  error
+)
+
+// fetchGCPSecret reads projects/P/secrets/S[/versions/V] from Secret
+// Manager with Application Default Credentials, see googleCredentials.
+func fetchGCPSecret(ctx context.Context, name string) (string, error) {
+	gcpSecretCredsOnce.Do(func() { gcpSecretCreds, gcpSecretCredsErr = newGoogleCredentials() })
+	if gcpSecretCredsErr != nil {
+		return "", gcpSecretCredsErr
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://secretmanager.googleapis.com/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	if err := gcpSecretCreds.authorize(req); err != nil {
+		return "", err
+	}
+	body, err := getSecret(req)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	return string(data), err
+}
+
+// fetchAWSSecret reads a secret, by name or ARN, from AWS Secrets Manager
+// with the AWS_* credentials. ARNs carry their own region.
+func fetchAWSSecret(ctx context.Context, name string) (string, error) {
+	creds := awsCredentials{
+		accessKeyID:     setting("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: setting("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    setting("AWS_SESSION_TOKEN"),
+	}
+	region := cmp.Or(setting("AWS_REGION"), setting("AWS_DEFAULT_REGION"))
+	if parts := strings.Split(name, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" || region == "" {
+		return "", fmt.Errorf("missing AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY or AWS_REGION")
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://secretsmanager."+region+".amazonaws.com/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSv4(req, body, creds, "secretsmanager", region, time.Now())
+	data, err := getSecret(req)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", err
+	}
+	return result.SecretString, nil
+}
+
+// fetchVaultSecret reads a path of HashiCorp Vault's HTTP API from
+// VAULT_ADDR with VAULT_TOKEN. Its data is returned as a JSON object, so
+// pick a field with "#field"; KV version 2 nests data once more, which is
+// unwrapped.
+func fetchVaultSecret(ctx context.Context, name string) (string, error) {
+	addr, token := setting("VAULT_ADDR"), setting("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("missing VAULT_ADDR or VAULT_TOKEN")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+name, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	body, err := getSecret(req)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(result.Data)
+	if inner, ok := result.Data["data"]; ok && len(result.Data["metadata"]) > 0 {
+		data = inner
+	}
+	return string(data), nil
+}
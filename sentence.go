@@ -0,0 +1,56 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Sentence mode (?mode=sentence) accepts example sentences: longer input
+// with punctuation, cached apart from single words. Sentences cost far more
+// to synthesize, so new ones can be capped at sentenceDailyChars characters
+// per UTC day.
+var (
+	sentenceMaxLength  int
+	sentenceDailyChars int
+
+	sentenceUsageMu  sync.Mutex
+	sentenceUsageDay string
+	sentenceUsage    int
+)
+
+var sentencePunctuation = regexp.MustCompile(`[\p{P}\s]+`)
+
+// validateSentence checks that text, once punctuation and spaces are
+// removed, is written in the script of language.
+func validateSentence(text, language string) error {
+	rule := ruleFor(language)
+	bare := sentencePunctuation.ReplaceAllString(text, "")
+	if utf8.RuneCountInString(text) > sentenceMaxLength || bare == "" || !rule.script.MatchString(bare) {
+		return fmt.Errorf("Invalid text: must be %s and punctuation with a max length of %d", rule.name, sentenceMaxLength)
+	}
+	return nil
+}
+
+// takeSentenceBudget charges n characters to today's sentence budget,
+// reporting false without charging if that would exceed it.
+func takeSentenceBudget(n int, now time.Time) bool {
+	if sentenceDailyChars == 0 {
+		return true
+	}
+	day := now.UTC().Format(time.DateOnly)
+
+	sentenceUsageMu.Lock()
+	defer sentenceUsageMu.Unlock()
+
+	if sentenceUsageDay != day {
+		sentenceUsageDay, sentenceUsage = day, 0
+	}
+	if sentenceUsage+n > sentenceDailyChars {
+		return false
+	}
+	sentenceUsage += n
+	return true
+}
@@ -0,0 +1,13 @@
+package wenbuntts
+
+import "errors"
+
+// serveOnly, from SERVE_ONLY=true, turns the server into a mirror of its
+// cache: cached audio is served as usual, but a miss fails with
+// errServeOnly (404) instead of calling a provider, so nothing is ever
+// billed. doGenerateFile stops misses early, callUpstream catches the rest.
+// The default provider is still set up, as its voices decide which requests
+// are valid and where they are cached, but its credentials go unused.
+var serveOnly bool
+
+var errServeOnly = errors.New("Not cached, and this server only serves cached audio")
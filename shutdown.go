@@ -0,0 +1,69 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// backgroundWork tracks syntheses that must finish writing to the cache
+// before the process exits, including async jobs whose clients are gone.
+var backgroundWork sync.WaitGroup
+
+// shutdownCtx is canceled once SIGINT or SIGTERM arrives, stopping
+// long-running work such as warm-ups and batch jobs.
+var shutdownCtx = context.Background()
+
+// serveUntilSignal runs srv on listeners, over HTTPS when it has a
+// TLSConfig, until SIGINT or SIGTERM, then stops accepting
+// connections and waits up to timeout for in-flight requests and background
+// syntheses to finish.
+func serveUntilSignal(srv *http.Server, listeners []net.Listener, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Serve sets a TLSConfig of its own for HTTP/2, so decide beforehand.
+	useTLS := srv.TLSConfig != nil
+	errc := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			if useTLS {
+				errc <- srv.ServeTLS(l, "", "")
+			} else {
+				errc <- srv.Serve(l)
+			}
+		}()
+	}
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", timeout)
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(deadline); err != nil {
+		return err
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		backgroundWork.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-deadline.Done():
+		return errors.New("background syntheses still running at shutdown timeout")
+	}
+}
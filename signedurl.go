@@ -0,0 +1,112 @@
+package wenbuntts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed URLs let an app hand /audio links to browsers that hold no API key.
+// GET /audio/sign, behind the API key, returns an /audio URL carrying
+// ?expires= (Unix seconds) and ?sig=, an HMAC-SHA256 over the key and expiry
+// with URL_SIGNING_SECRET; allowSignedURL serves such URLs until they expire.
+// Without a secret, signing is disabled.
+var (
+	urlSigningSecret []byte
+	signedURLTTL     time.Duration
+)
+
+const maxSignedURLTTL = 7 * 24 * time.Hour
+
+// audioSignature returns the signature for serving key until expires.
+func audioSignature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, urlSigningSecret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedAudioURL returns audioURL(key) signed to stay valid until expires.
+func signedAudioURL(key string, expires time.Time) string {
+	query := url.Values{"expires": {strconv.FormatInt(expires.Unix(), 10)}, "sig": {audioSignature(key, expires.Unix())}}
+	return audioURL(key) + "?" + query.Encode()
+}
+
+// allowSignedURL serves /audio requests carrying a valid, unexpired
+// signature without next's API key check. Requests without ?sig= go to next.
+func allowSignedURL(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !query.Has("sig") {
+			next(w, r)
+			return
+		}
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if len(urlSigningSecret) == 0 || err != nil ||
+			!hmac.Equal([]byte(query.Get("sig")), []byte(audioSignature(r.PathValue("file"), expires))) {
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+		if time.Now().Unix() > expires {
+			http.Error(w, "Signed URL expired", http.StatusForbidden)
+			return
+		}
+		// The signature is for this key alone, whoever's it is.
+		if key := r.PathValue("file"); validCacheKey(key) {
+			serveAudioKey(w, r, key)
+		} else {
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// handleAudioSign signs the /audio URL of the cached clip named by ?file=,
+// a storage key or /audio URL, for ?ttl= (default SIGNED_URL_TTL, at most a
+// week). Callers can only sign clips they may read, see mayReadKey.
+func handleAudioSign(w http.ResponseWriter, r *http.Request) {
+	if len(urlSigningSecret) == 0 {
+		http.Error(w, "URL signing is disabled", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	key := query.Get("file")
+	if rest, ok := strings.CutPrefix(key, "/audio/"); ok {
+		key, _ = url.PathUnescape(rest)
+	}
+	if key == "" {
+		http.Error(w, "Missing ?file= parameter", http.StatusBadRequest)
+		return
+	}
+	ttl := signedURLTTL
+	if v := query.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxSignedURLTTL {
+			http.Error(w, "Invalid ttl: must be a duration up to 168h", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if !validCacheKey(key) || !mayReadKey(r.Context(), key) {
+		http.Error(w, "No such cache entry", http.StatusNotFound)
+		return
+	}
+	if _, err := cacheStore.Stat(r.Context(), key); err != nil {
+		http.Error(w, "No such cache entry", http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(struct {
+		URL     string    `json:"url"`
+		Expires time.Time `json:"expires"`
+	}{signedAudioURL(key, expires), expires.UTC()})
+}
@@ -0,0 +1,178 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// silenceEdit trims silence from and pads silence onto a clip before it is
+// cached, so clips start and end crisply for rapid review. WAV clips are
+// edited in Go; MP3 and Opus clips need ffmpeg, like loudness normalization.
+type silenceEdit struct {
+	trimStart, trimEnd bool
+	padStart, padEnd   time.Duration
+}
+
+var (
+	// defaultSilence is from SILENCE_TRIM, SILENCE_PAD_START_MS and
+	// SILENCE_PAD_END_MS; requests may override it.
+	defaultSilence silenceEdit
+	// silenceThreshold is the level in dBFS below which audio counts as
+	// silence, from SILENCE_THRESHOLD_DB.
+	silenceThreshold = -50.0
+)
+
+// maxSilencePad bounds ?padStartMs= and ?padEndMs=.
+const maxSilencePad = 2 * time.Second
+
+// silenceMargin is kept before the first and after the last sound, so that
+// soft onsets and decays aren't clipped.
+const silenceMargin = 20 * time.Millisecond
+
+func (e silenceEdit) active() bool {
+	return e.trimStart || e.trimEnd || e.padStart > 0 || e.padEnd > 0
+}
+
+// leading returns the part of e that changes where the clip starts.
+func (e silenceEdit) leading() silenceEdit {
+	return silenceEdit{trimStart: e.trimStart, padStart: e.padStart}
+}
+
+// cacheOption encodes e for the cache key.
+func (e silenceEdit) cacheOption() string {
+	return fmt.Sprintf("%t,%t,%d,%d,%g", e.trimStart, e.trimEnd, e.padStart.Milliseconds(), e.padEnd.Milliseconds(), silenceThreshold)
+}
+
+// parseSilenceEdit applies ?trimSilence=, ?padStartMs= and ?padEndMs= to
+// defaultSilence.
+func parseSilenceEdit(q url.Values) (silenceEdit, error) {
+	e := defaultSilence
+	switch q.Get("trimSilence") {
+	case "":
+	case "true":
+		e.trimStart, e.trimEnd = true, true
+	case "false":
+		e.trimStart, e.trimEnd = false, false
+	default:
+		return e, errors.New("Invalid trimSilence: must be true or false")
+	}
+	for _, p := range []struct {
+		name string
+		pad  *time.Duration
+	}{{"padStartMs", &e.padStart}, {"padEndMs", &e.padEnd}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxSilencePad {
+			return e, fmt.Errorf("Invalid %s: must be between 0 and %d", p.name, maxSilencePad.Milliseconds())
+		}
+		*p.pad = time.Duration(ms) * time.Millisecond
+	}
+	return e, nil
+}
+
+// editsSilence reports whether e is applied to clips in format.
+func editsSilence(e silenceEdit, format audioFormat) bool {
+	return e.active() && (format.encoding == "LINEAR16" || ffmpegPath != "")
+}
+
+func applySilenceEdit(ctx context.Context, audio []byte, format audioFormat, e silenceEdit) []byte {
+	if !editsSilence(e, format) {
+		return audio
+	}
+	var edited []byte
+	var err error
+	if format.encoding == "LINEAR16" {
+		edited, err = editWAVSilence(audio, e)
+	} else {
+		edited, err = ffmpegFilter(ctx, audio, format, silenceFilter(e))
+	}
+	if err != nil {
+		logger(ctx).Warn("Skipping silence trimming", "encoding", format.encoding, "error", err)
+		return audio
+	}
+	return edited
+}
+
+// silenceFilter is the ffmpeg filter graph for e. silenceremove only trims
+// the start of a stream on its own, so the end is trimmed in reverse.
+func silenceFilter(e silenceEdit) string {
+	trim := fmt.Sprintf("silenceremove=start_periods=1:start_threshold=%gdB:start_silence=%g", silenceThreshold, silenceMargin.Seconds())
+	filter := "anull"
+	if e.trimStart {
+		filter += "," + trim
+	}
+	if e.trimEnd {
+		filter += ",areverse," + trim + ",areverse"
+	}
+	if e.padStart > 0 {
+		filter += fmt.Sprintf(",adelay=%d:all=1", e.padStart.Milliseconds())
+	}
+	if e.padEnd > 0 {
+		filter += fmt.Sprintf(",apad=pad_dur=%g", e.padEnd.Seconds())
+	}
+	return filter
+}
+
+// editWAVSilence applies e to a 16-bit PCM WAV.
+func editWAVSilence(data []byte, e silenceEdit) ([]byte, error) {
+	channels, rate, offset, length, err := wavPCM(data)
+	if err != nil {
+		return nil, err
+	}
+	frameSize := 2 * channels
+	frames := length / frameSize
+	threshold := math.Pow(10, silenceThreshold/20) * 32768
+	loud := func(i int) bool {
+		for c := range channels {
+			if math.Abs(float64(int16(binary.LittleEndian.Uint16(data[offset+i*frameSize+2*c:])))) > threshold {
+				return true
+			}
+		}
+		return false
+	}
+
+	first, last := 0, frames
+	margin := int(silenceMargin.Seconds() * float64(rate))
+	if e.trimStart {
+		for first < frames && !loud(first) {
+			first++
+		}
+		first = max(first-margin, 0)
+	}
+	if e.trimEnd {
+		for last > first && !loud(last-1) {
+			last--
+		}
+		last = min(last+margin, frames)
+	}
+	if first >= last {
+		// All silence: keep the clip rather than cache an empty one.
+		first, last = 0, frames
+	}
+
+	padStart := int(e.padStart.Seconds()*float64(rate)) * frameSize
+	padEnd := int(e.padEnd.Seconds()*float64(rate)) * frameSize
+	samples := data[offset+first*frameSize : offset+last*frameSize]
+	size := padStart + len(samples) + padEnd
+
+	var out bytes.Buffer
+	out.Write(data[:offset-8]) // RIFF header and every chunk before data
+	out.WriteString("data")
+	binary.Write(&out, binary.LittleEndian, uint32(size))
+	out.Write(make([]byte, padStart))
+	out.Write(samples)
+	out.Write(make([]byte, padEnd))
+	wav := out.Bytes()
+	binary.LittleEndian.PutUint32(wav[4:8], uint32(len(wav)-8))
+	return wav, nil
+}
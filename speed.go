@@ -0,0 +1,145 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Named speeds stand for speaking rates, as learners keep switching between
+// slow and natural speed during review: ?speed=slow is ?speakingRate=0.7,
+// ?speed=normal the SPEAKING_RATE default and ?speed=fast 1.2. SPEED_PRESETS
+// (name:rate,...) changes their rates or adds presets. ?speed=all makes sure
+// the clip is cached at every preset and returns the ?response=json metadata
+// of each.
+type speedPreset struct {
+	name string
+	rate float64 // 0 for speakingRate
+}
+
+var builtinSpeedPresets = []speedPreset{{"slow", 0.7}, {"normal", 0}, {"fast", 1.2}}
+
+var speedPresets = builtinSpeedPresets
+
+// speedVariant is one clip of a ?speed=all response.
+type speedVariant struct {
+	Speed        string  `json:"speed"`
+	SpeakingRate float64 `json:"speakingRate"`
+	audioMetadata
+}
+
+// parseSpeedPresets parses SPEED_PRESETS.
+func parseSpeedPresets(s string) ([]speedPreset, error) {
+	presets := slices.Clone(builtinSpeedPresets)
+	for _, entry := range splitList(s) {
+		name, v, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || name == "" || name == "all" || err != nil || rate < 0.25 || rate > 4 {
+			return nil, fmt.Errorf("%q is not name:rate with a rate between 0.25 and 4", entry)
+		}
+		if i := slices.IndexFunc(presets, func(p speedPreset) bool { return p.name == name }); i >= 0 {
+			presets[i].rate = rate
+		} else {
+			presets = append(presets, speedPreset{name, rate})
+		}
+	}
+	return presets, nil
+}
+
+// speedRate returns the rate of the preset name.
+func speedRate(name string) (float64, bool) {
+	i := slices.IndexFunc(speedPresets, func(p speedPreset) bool { return p.name == name })
+	if i < 0 {
+		return 0, false
+	}
+	return speedPresets[i].rate, true
+}
+
+func speedNames() string {
+	names := make([]string, len(speedPresets))
+	for i, p := range speedPresets {
+		names[i] = p.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// serveSpeedVariants answers /tts?speed=all: it generates req at every
+// speed preset it isn't cached at yet, concurrently, and describes each
+// clip.
+func serveSpeedVariants(w http.ResponseWriter, r *http.Request, req ttsRequest) {
+	ctx := r.Context()
+	recordWordRequest(ctx, req, r.URL.Query())
+	variants := make([]ttsRequest, len(speedPresets))
+	cached := make([]bool, len(speedPresets))
+	defaultRate := current().speakingRate
+	for i, preset := range speedPresets {
+		v := req
+		v.prosody.rate = preset.rate
+		if v.prosody.rate == defaultRate {
+			v.prosody.rate = 0
+		}
+		v.key = v.storageKey()
+		variants[i] = v
+		if _, err := lookupCached(ctx, v); err == nil {
+			cached[i] = true
+			indexHit(ctx, v.key)
+			continue
+		}
+		if err := allowMiss(ctx); err != nil {
+			httpGenerateError(ctx, w, err.Error(), err)
+			return
+		}
+		if v.sentence && !takeSentenceBudget(utf8.RuneCountInString(v.text), time.Now()) {
+			http.Error(w, "Daily sentence budget exhausted", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(variants))
+	for i, v := range variants {
+		if !cached[i] {
+			wg.Go(func() { errs[i] = generateFile(ctx, v) })
+		}
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			httpGenerateError(ctx, w, fmt.Sprintf("Failed to generate speed %s: %v", speedPresets[i].name, err), err)
+			return
+		}
+	}
+
+	out := make([]speedVariant, len(variants))
+	for i, v := range variants {
+		query := maps.Clone(r.URL.Query())
+		query.Set("speed", speedPresets[i].name)
+		meta, err := clipMetadata(ctx, v, query, cached[i])
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Cache entry disappeared, try again", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to read cache entry", http.StatusInternalServerError)
+			logger(ctx).Error("Failed to read cache entry", "key", logPath(v.key), "error", err)
+			return
+		}
+		out[i] = speedVariant{Speed: speedPresets[i].name, SpeakingRate: v.prosody.speakingRate(), audioMetadata: meta}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(struct {
+		Speeds []speedVariant `json:"speeds"`
+	}{out})
+}
@@ -0,0 +1,104 @@
+package wenbuntts
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxSSMLLength bounds the size of an ?ssml=true document, in bytes.
+	maxSSMLLength = 2048
+	ssmlNamespace = "http://www.w3.org/2001/10/synthesis"
+)
+
+// ssmlAttributes lists the SSML elements clients may use inside <speak> and
+// the attributes kept on each. Anything else is rejected, so a document can
+// only shape how its text is spoken.
+var ssmlAttributes = map[string][]string{
+	"break":    {"time", "strength"},
+	"phoneme":  {"alphabet", "ph"},
+	"say-as":   {"interpret-as", "format", "detail"},
+	"sub":      {"alias"},
+	"prosody":  {"rate", "pitch", "volume"},
+	"emphasis": {"level"},
+	"p":        nil,
+	"s":        nil,
+}
+
+// parseSSML validates a <speak> document and returns its content re-encoded
+// from the parsed tokens, without the <speak> wrapper, along with the plain
+// text it contains. Providers wrap the content in their own <speak>.
+func parseSSML(doc string) (content, text string, err error) {
+	if len(doc) > maxSSMLLength {
+		return "", "", fmt.Errorf("document longer than %d bytes", maxSSMLLength)
+	}
+
+	var out, plain strings.Builder
+	depth := 0
+	closed := false
+	d := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if closed {
+				return "", "", errors.New("content after </speak>")
+			}
+			if depth == 0 {
+				if t.Name.Local != "speak" {
+					return "", "", errors.New("root element must be <speak>")
+				}
+				depth++
+				continue
+			}
+			allowed, ok := ssmlAttributes[t.Name.Local]
+			if !ok || (t.Name.Space != "" && t.Name.Space != ssmlNamespace) {
+				return "", "", fmt.Errorf("element <%s> is not allowed", t.Name.Local)
+			}
+			out.WriteString("<" + t.Name.Local)
+			for _, a := range t.Attr {
+				if !slices.Contains(allowed, a.Name.Local) || a.Name.Space != "" {
+					return "", "", fmt.Errorf("attribute %s is not allowed on <%s>", a.Name.Local, t.Name.Local)
+				}
+				out.WriteString(" " + a.Name.Local + `="`)
+				xml.EscapeText(&out, []byte(a.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				closed = true
+				continue
+			}
+			out.WriteString("</" + t.Name.Local + ">")
+		case xml.CharData:
+			if depth == 0 {
+				if strings.TrimSpace(string(t)) != "" {
+					return "", "", errors.New("text outside <speak>")
+				}
+				continue
+			}
+			xml.EscapeText(&out, t)
+			plain.WriteString(strings.Join(strings.Fields(string(t)), ""))
+		case xml.Directive:
+			return "", "", errors.New("directives are not allowed")
+		}
+	}
+	if !closed {
+		return "", "", errors.New("missing <speak> element")
+	}
+	return out.String(), plain.String(), nil
+}
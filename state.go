@@ -0,0 +1,126 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// With STATE_FILE set, the server saves the counters it keeps in memory,
+// the hits and misses behind /stats and /stats/history and the sentence
+// budget spent today, to that JSON file every STATE_SAVE_INTERVAL and on
+// shutdown, and loads them at startup. Character budgets and per-voice
+// usage are counted in the cache index, which keeps them already. Only
+// serve saves state, so CLI commands sharing the file don't overwrite it.
+var (
+	stateFile         string
+	stateSaveInterval time.Duration
+)
+
+// counterState is the content of the state file.
+type counterState struct {
+	SavedAt       time.Time     `json:"savedAt"`
+	History       []savedMinute `json:"history"`
+	SentenceDay   string        `json:"sentenceDay,omitempty"`
+	SentenceChars int           `json:"sentenceChars,omitempty"`
+}
+
+// savedMinute is a minute of the generation history.
+type savedMinute struct {
+	Minute int64 `json:"minute"` // minutes since the Unix epoch
+	Hits   int   `json:"hits"`
+	Misses int   `json:"misses"`
+}
+
+// snapshotCounters returns the counters as they are now.
+func snapshotCounters(now time.Time) counterState {
+	state := counterState{SavedAt: now.UTC()}
+	history.mu.Lock()
+	for _, slot := range history.slots {
+		if slot.hits > 0 || slot.misses > 0 {
+			state.History = append(state.History, savedMinute{slot.minute, slot.hits, slot.misses})
+		}
+	}
+	history.mu.Unlock()
+	sentenceUsageMu.Lock()
+	state.SentenceDay, state.SentenceChars = sentenceUsageDay, sentenceUsage
+	sentenceUsageMu.Unlock()
+	return state
+}
+
+// restoreCounters adds the counters of state, dropping minutes that have
+// left the history's retention window by now.
+func restoreCounters(state counterState, now time.Time) {
+	oldest := now.Add(-history.retention).Unix() / 60
+	history.mu.Lock()
+	for _, s := range state.History {
+		if s.Minute <= oldest || s.Minute > now.Unix()/60 {
+			continue
+		}
+		slot := &history.slots[s.Minute%int64(len(history.slots))]
+		if slot.minute != s.Minute {
+			*slot = historySlot{minute: s.Minute}
+		}
+		slot.hits += s.Hits
+		slot.misses += s.Misses
+	}
+	history.mu.Unlock()
+	if state.SentenceDay == now.UTC().Format(time.DateOnly) {
+		sentenceUsageMu.Lock()
+		if sentenceUsageDay != state.SentenceDay {
+			sentenceUsageDay, sentenceUsage = state.SentenceDay, 0
+		}
+		sentenceUsage += state.SentenceChars
+		sentenceUsageMu.Unlock()
+	}
+}
+
+// saveState writes the counters to path, replacing it atomically.
+func saveState(path string) error {
+	data, err := json.Marshal(snapshotCounters(time.Now()))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// loadState restores the counters saved to path. The counters start at zero
+// if there is no such file, or, with a warning, if it can't be read.
+func loadState(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("No state file yet; counters start at zero", "path", path)
+		return
+	}
+	var state counterState
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		slog.Warn("Failed to read state file; counters start at zero", "path", path, "error", err)
+		return
+	}
+	restoreCounters(state, time.Now())
+	slog.Info("Loaded counters", "path", path, "saved_at", state.SavedAt)
+}
+
+// runStateSaver saves the counters to stateFile every stateSaveInterval
+// until ctx is done.
+func runStateSaver(ctx context.Context) {
+	ticker := time.NewTicker(stateSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := saveState(stateFile); err != nil {
+			slog.Error("Failed to save state file", "path", stateFile, "error", err)
+		}
+	}
+}
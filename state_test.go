@@ -0,0 +1,56 @@
+package wenbuntts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatePersistsAcrossRestart(t *testing.T) {
+	saved, savedDay, savedUsage, savedLimit := history, sentenceUsageDay, sentenceUsage, sentenceDailyChars
+	t.Cleanup(func() {
+		history = saved
+		sentenceUsageDay, sentenceUsage, sentenceDailyChars = savedDay, savedUsage, savedLimit
+	})
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Now()
+
+	history = newGenerationHistory(time.Hour)
+	history.record(now.Add(-2*time.Minute), true)
+	history.record(now.Add(-2*time.Minute), true)
+	history.record(now, false)
+	sentenceDailyChars, sentenceUsageDay, sentenceUsage = 100, "", 0
+	takeSentenceBudget(30, now)
+	if err := saveState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart starts from zero, then loads the file.
+	history = newGenerationHistory(time.Hour)
+	sentenceUsageDay, sentenceUsage = "", 0
+	loadState(path)
+	if hits, misses := historyTotals(); hits != 2 || misses != 1 {
+		t.Errorf("after restart: %d hits, %d misses, want 2 and 1", hits, misses)
+	}
+	if takeSentenceBudget(71, now) {
+		t.Error("sentence budget spent before the restart was forgotten")
+	}
+
+	// A corrupt file leaves the counters at zero.
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	history = newGenerationHistory(time.Hour)
+	loadState(path)
+	if hits, misses := historyTotals(); hits != 0 || misses != 0 {
+		t.Errorf("after a corrupt state file: %d hits, %d misses, want none", hits, misses)
+	}
+}
+
+func historyTotals() (hits, misses int) {
+	for _, b := range history.buckets(time.Now(), time.Hour, time.Hour) {
+		hits, misses = hits+b.Hits, misses+b.Misses
+	}
+	return hits, misses
+}
@@ -0,0 +1,136 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type allTenantsKey struct{}
+
+// requireStatsAccess guards the /stats endpoints, which must not show one
+// tenant another's figures. ADMIN_TOKEN sees every tenant's, or with
+// ?tenant= one tenant's. Anything else goes through requireAPIKey and only
+// sees its own tenant's; while TENANT_KEYS or CACHE_NAMESPACE_BY_KEY is in
+// use, that has to be the tenant its API key belongs to.
+func requireStatsAccess(next http.HandlerFunc) http.HandlerFunc {
+	keyed := requireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+		if len(tenantKeys) > 0 || cacheNamespaceByKey {
+			if _, ok := boundTenant(requestAPIKey(r)); !ok {
+				http.Error(w, "Stats need an API key bound to a tenant, or the admin token", http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasAdminToken(r) {
+			keyed(w, r)
+			return
+		}
+		tenant := r.URL.Query().Get("tenant")
+		if tenant != "" && !isValidDeck(tenant) {
+			http.Error(w, errInvalidTenant.Error()+": must be 1-64 letters, digits, '-' or '_'", http.StatusBadRequest)
+			return
+		}
+		ctx := withTenant(r.Context(), tenant)
+		if tenant == "" {
+			ctx = context.WithValue(ctx, allTenantsKey{}, true)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// statsTenant returns whose figures a request through requireStatsAccess
+// may see: tenant's, "" being the shared cache, or with all every tenant's.
+func statsTenant(ctx context.Context) (tenant string, all bool) {
+	all, _ = ctx.Value(allTenantsKey{}).(bool)
+	return tenantFrom(ctx), all
+}
+
+type statsWord struct {
+	Text string `json:"text"`
+	Hits int64  `json:"hits"`
+}
+
+// handleStats sums up the other /stats endpoints: cache totals and
+// syntheses per voice from the index, the hit ratio over the history window,
+// this month's characters and the ?top= (default 10) most served texts,
+// for the tenants statsTenant allows. The hit ratio isn't kept per tenant,
+// so it is left out of a tenant's stats.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	tenant, all := statsTenant(r.Context())
+	top := 10
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "Invalid top: must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	var stats struct {
+		Entries      int64             `json:"entries"`
+		Bytes        int64             `json:"bytes"`
+		Hits         int64             `json:"hits,omitempty"`
+		Misses       int64             `json:"misses,omitempty"`
+		HitRatio     float64           `json:"hitRatio,omitempty"`
+		Window       string            `json:"window,omitempty"` // of hits, misses and hitRatio
+		ByVoice      []cacheStatsGroup `json:"byVoice"`
+		MonthlyChars int64             `json:"monthlyChars"`
+		TopWords     []statsWord       `json:"topWords"`
+	}
+	ctx := r.Context()
+	where, args := tenantWhere(tenant, all)
+	err := cacheIndex.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(size), 0) FROM entries`+where, args...).Scan(&stats.Entries, &stats.Bytes)
+	if err == nil {
+		stats.ByVoice, err = indexGroups(ctx, "voice", tenant, all)
+	}
+	if err == nil {
+		_, month := usagePeriods(time.Now(), tenant)
+		stats.MonthlyChars, err = usageChars(ctx, month)
+	}
+	if err == nil {
+		stats.TopWords, err = topWords(ctx, tenant, all, top)
+	}
+	if err != nil {
+		http.Error(w, "Failed to read cache index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if tenant == "" {
+		for _, b := range history.buckets(time.Now(), history.retention, history.retention) {
+			stats.Hits += int64(b.Hits)
+			stats.Misses += int64(b.Misses)
+		}
+		if total := stats.Hits + stats.Misses; total > 0 {
+			stats.HitRatio = float64(stats.Hits) / float64(total)
+		}
+		stats.Window = history.retention.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// topWords returns the n texts served from the cache most often, summed
+// over voices, of every tenant with all or else only tenant's.
+func topWords(ctx context.Context, tenant string, all bool, n int) ([]statsWord, error) {
+	rows, err := cacheIndex.QueryContext(ctx, `SELECT text, SUM(hits) FROM entries WHERE text != '' AND (? OR tenant = ?) GROUP BY text ORDER BY 2 DESC, 1 LIMIT ?`, all, tenant, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	words := []statsWord{}
+	for rows.Next() {
+		var word statsWord
+		if err := rows.Scan(&word.Text, &word.Hits); err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
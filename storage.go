@@ -0,0 +1,153 @@
+package wenbuntts
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// objectInfo describes one stored object.
+type objectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// storage holds the audio cache and the deck manifests. Keys are
+// slash-separated paths such as "deck/voice_text.mp3". A missing object is
+// reported with an error matching fs.ErrNotExist.
+type storage interface {
+	Stat(ctx context.Context, key string) (objectInfo, error)
+	Get(ctx context.Context, key string) ([]byte, objectInfo, error)
+	// Put replaces the object atomically: readers see the old or the new
+	// content, never a mix.
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object, in no particular order. fn may
+	// return fs.SkipAll to stop early.
+	List(ctx context.Context, fn func(objectInfo) error) error
+}
+
+// cacheStore is the configured storage, chosen by CACHE_BACKEND. Local disk
+// under OUTPUT_DIR is the default.
+var cacheStore storage
+
+// diskStorage stores objects as files under dir.
+type diskStorage struct {
+	dir string
+}
+
+func (s diskStorage) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s diskStorage) Stat(ctx context.Context, key string) (objectInfo, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return objectInfo{}, err
+	}
+	return objectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s diskStorage) Get(ctx context.Context, key string) ([]byte, objectInfo, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	info, err := s.Stat(ctx, key)
+	return data, info, err
+}
+
+func (s diskStorage) Put(ctx context.Context, key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (s diskStorage) Delete(ctx context.Context, key string) error {
+	return os.Remove(s.path(key))
+}
+
+// List walks dir. Only regular files are listed, so symlinks can never lead
+// a purge outside it.
+func (s diskStorage) List(ctx context.Context, fn func(objectInfo) error) error {
+	return filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(objectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+// Several processes may share a disk cache, such as serve and a generate
+// run against the same OUTPUT_DIR, and both write through diskStorage.Put.
+// Their contract needs no lock files: an object is only ever written to a
+// temporary file named ".tts-*.tmp" in its own directory, synced, and then
+// renamed over its key, so a reader opens either the complete old file or
+// the complete new one. Two processes generating the same key each rename a
+// complete file into place and the last one wins. Temporary files are not
+// audio, so listings of the cache skip them, and removeStaleTemps leaves
+// those younger than an hour to the process still writing them. The cache
+// index they share is SQLite, which serializes their writes itself.
+const tempPrefix = ".tts-"
+
+// removeStaleTemps deletes temporary files left behind by writes that were
+// interrupted by a crash. Files younger than an hour are kept, in case
+// another instance shares dir and is still writing them.
+func (s diskStorage) removeStaleTemps() {
+	filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !strings.HasPrefix(d.Name(), tempPrefix) || !strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+			if err := os.Remove(path); err == nil {
+				slog.Info("Removed interrupted write", "path", path)
+			}
+		}
+		return nil
+	})
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers see either the old or the new content. The data is
+// synced before the rename, so a crash can't leave a renamed but empty file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
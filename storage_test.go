@@ -0,0 +1,77 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestGenerateWhileServing runs the generate command in a separate process
+// against the server's OUTPUT_DIR while the server renders and serves the
+// same words, so both write the same keys. Every read must be a complete
+// clip, and so must what is left on disk.
+func TestGenerateWhileServing(t *testing.T) {
+	var words []string
+	for _, a := range "春夏秋冬" {
+		for _, b := range "东南西北中" {
+			words = append(words, "共"+string(a)+string(b))
+		}
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "WENBUNTTS_TEST_MAIN=generate")
+	cmd.Stdin = strings.NewReader(strings.Join(words, "\n"))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	served := make([][]byte, len(words))
+	var wg sync.WaitGroup
+	for i, word := range words {
+		wg.Go(func() {
+			resp, body := get(t, "/tts", url.Values{"text": {word}})
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%s: %s %s", word, resp.Status, body)
+			}
+			served[i] = body
+		})
+	}
+	wg.Wait()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("generate: %v\n%s%s", err, stdout.String(), stderr.String())
+	}
+	backgroundWork.Wait()
+
+	for i, word := range words {
+		if !strings.Contains(stdout.String(), fmt.Sprintf("%q", word)) {
+			t.Errorf("generate did not report %s:\n%s", word, stdout.String())
+		}
+		entries, err := queryIndex(context.Background(), indexFilter{text: word})
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("index for %s: %v %+v", word, err, entries)
+		}
+		key := entries[0].Key
+		stored, _, err := diskStorage{outputDir}.Get(context.Background(), key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if problem := clipProblem(key, stored); problem != "" {
+			t.Errorf("%s on disk: %s", key, problem)
+		}
+		if problem := clipProblem(key, served[i]); problem != "" {
+			t.Errorf("%s as served: %s", key, problem)
+		}
+		if !bytes.Equal(served[i], stored) {
+			t.Errorf("%s: served %d bytes, %d on disk", key, len(served[i]), len(stored))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package wenbuntts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamConcurrency bounds the syntheses one /tts/stream connection runs
+	// at a time; later words wait their turn.
+	streamConcurrency = 4
+	// streamIdleTimeout closes a connection that sent nothing for this long.
+	streamIdleTimeout = 2 * time.Minute
+	maxStreamMessage  = 64 << 10
+)
+
+// streamItem is a /tts/stream request: a batchItem, from a JSON text message
+// or a plain word, with an ID the client picks to match up the reply.
+type streamItem struct {
+	ID string `json:"id,omitempty"`
+	batchItem
+}
+
+// streamResult precedes the binary message carrying an item's audio, which
+// is left out when Error is set.
+type streamResult struct {
+	ID          string `json:"id,omitempty"`
+	Index       int    `json:"index"` // of the message on the connection, from 0
+	Text        string `json:"text"`
+	Model       string `json:"model"`
+	Cached      bool   `json:"cached"`
+	ContentType string `json:"contentType,omitempty"`
+	Bytes       int    `json:"bytes,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// handleTTSStream upgrades to a WebSocket on which the client sends words,
+// one per text message, and gets each one's audio back as soon as it is
+// ready: a JSON streamResult text message, then the audio as a binary
+// message. Results can arrive out of order; index and id tell them apart.
+// Browsers can't set headers on WebSockets, so the API key may also be given as
+// ?apiKey=.
+func handleTTSStream(w http.ResponseWriter, r *http.Request) {
+	srv := websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if !streamOriginAllowed(r) {
+				return fmt.Errorf("origin %q not allowed", r.Header.Get("Origin"))
+			}
+			return nil
+		},
+		Handler: serveTTSStream,
+	}
+	srv.ServeHTTP(hijackWriter{w}, r)
+}
+
+// withQueryAPIKey passes ?apiKey= on to requireAPIKey as X-API-Key.
+func withQueryAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key := r.URL.Query().Get("apiKey"); key != "" && r.Header.Get("X-API-Key") == "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		next(w, r)
+	}
+}
+
+// streamOriginAllowed applies the CORS origins to the handshake, since
+// browsers don't check them for WebSockets. Clients other than browsers send
+// no Origin.
+func streamOriginAllowed(r *http.Request) bool {
+	origin, origins := r.Header.Get("Origin"), current().corsOrigins
+	if origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func serveTTSStream(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxStreamMessage
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+	// Hijacked connections outlive http.Server.Shutdown, so close them on
+	// the way down.
+	go func() {
+		select {
+		case <-shutdownCtx.Done():
+			ws.Close()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		sendMu sync.Mutex
+		work   sync.WaitGroup
+		slots  = make(chan struct{}, streamConcurrency)
+	)
+	send := func(result streamResult, audio []byte) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if err := websocket.JSON.Send(ws, result); err != nil {
+			return err
+		}
+		if result.Error != "" {
+			return nil
+		}
+		return websocket.Message.Send(ws, audio)
+	}
+	defer work.Wait()
+
+	for index := 0; index < maxBatchItems; index++ {
+		ws.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return
+		}
+		item, err := parseStreamItem(msg)
+		if err != nil {
+			send(streamResult{Index: index, Error: err.Error()}, nil)
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		work.Go(func() {
+			defer func() { <-slots }()
+			result, audio := streamGenerate(ctx, item)
+			result.Index = index
+			if err := send(result, audio); err != nil {
+				cancel()
+			}
+		})
+	}
+	websocket.JSON.Send(ws, streamResult{Index: maxBatchItems, Error: "Too many words on one connection, reconnect to continue"})
+}
+
+// parseStreamItem reads a JSON streamItem, or takes msg as the text itself.
+func parseStreamItem(msg string) (streamItem, error) {
+	var item streamItem
+	if !strings.HasPrefix(strings.TrimSpace(msg), "{") {
+		item.Text = strings.TrimSpace(msg)
+		return item, nil
+	}
+	if err := json.Unmarshal([]byte(msg), &item); err != nil {
+		return item, fmt.Errorf("Invalid JSON message: %v", err)
+	}
+	return item, nil
+}
+
+func streamGenerate(ctx context.Context, item streamItem) (streamResult, []byte) {
+	req, result := batchRequest(ctx, item.batchItem)
+	sr := streamResult{ID: item.ID, Text: result.Text, Model: result.Model, Error: result.Error}
+	if sr.Error != "" {
+		return sr, nil
+	}
+	sr.Cached = isCached(ctx, req)
+	if err := ensureCached(ctx, req); err != nil {
+		sr.Error = err.Error()
+		return sr, nil
+	}
+	audio, _, err := cacheStore.Get(ctx, req.key)
+	if err != nil {
+		sr.Error = "Failed to read cache entry"
+		logger(ctx).Error("Failed to read cache entry", "key", logPath(req.key), "error", err)
+		return sr, nil
+	}
+	sr.ContentType, sr.Bytes = req.audioFormat().contentType, len(audio)
+	return sr, audio
+}
+
+// hijackWriter lets websocket.Server hijack connections through wrapping
+// writers such as accessLog's, which it finds with a type assertion.
+type hijackWriter struct{ http.ResponseWriter }
+
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
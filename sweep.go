@@ -0,0 +1,289 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The integrity sweep reads every cached clip and deletes those that are
+// empty, truncated, don't decode or don't match their checksum (see
+// verifyClip), as a crash or a failing disk can leave behind: lookups only
+// stat entries unless verifyOnServe is set, so such clips would otherwise be
+// served forever. It also deletes timing sidecars whose clip is gone and drops index
+// rows and manifest entries for missing files. A deleted clip is generated
+// again by its next request, or right away with regenerate.
+var (
+	sweepInterval   time.Duration
+	sweepRegenerate bool
+)
+
+// sweepReport is the outcome of a sweep, or with DryRun what it would do.
+type sweepReport struct {
+	Checked     int           `json:"checked"`
+	Corrupt     []corruptClip `json:"corrupt"`
+	Regenerated int           `json:"regenerated"`
+	Orphans     int           `json:"orphans"` // sidecars and index rows
+	DryRun      bool          `json:"dryRun"`
+}
+
+type corruptClip struct {
+	Key     string `json:"file"`
+	Problem string `json:"problem"`
+}
+
+// clipProblem says what is wrong with the format of data, a clip stored
+// under key: empty, truncated or undecodable, or "" if it looks whole. Trailing bytes that are
+// not the start of a cut-off frame or page, e.g. an ID3v1 tag, are allowed.
+func clipProblem(key string, data []byte) string {
+	if len(data) == 0 {
+		return "empty"
+	}
+	switch path.Ext(key) {
+	case ".mp3":
+		frames, err := mp3Frames(data)
+		if err != nil {
+			return "undecodable"
+		}
+		last := frames[len(frames)-1]
+		if rest := data[last.offset+last.length:]; len(rest) > 0 {
+			if f, ok := parseMP3Frame(rest); ok && f.length > len(rest) {
+				return "truncated"
+			}
+		}
+	case ".wav":
+		return wavProblem(data)
+	case ".ogg":
+		return oggProblem(data)
+	}
+	return ""
+}
+
+// wavProblem checks that a WAV has a data chunk as long as it says. Streamed
+// WAVs may leave the size unset, which is fine.
+func wavProblem(data []byte) string {
+	if _, ok := wavDuration(data); !ok {
+		return "undecodable"
+	}
+	for pos := 12; pos+8 <= len(data); {
+		id, size := string(data[pos:pos+4]), binary.LittleEndian.Uint32(data[pos+4:pos+8])
+		if id == "data" {
+			if size != 0 && size != 0xFFFFFFFF && int(size) > len(data)-pos-8 {
+				return "truncated"
+			}
+			break
+		}
+		pos += 8 + int(size) + int(size%2)
+	}
+	return ""
+}
+
+// oggProblem walks the Ogg pages, which must fit the data and end with the
+// end-of-stream page.
+func oggProblem(data []byte) string {
+	eos := false
+	for pos := 0; pos < len(data); {
+		if !bytes.HasPrefix(data[pos:], []byte("OggS")) {
+			if pos == 0 {
+				return "undecodable"
+			}
+			break
+		}
+		if pos+27 > len(data) || pos+27+int(data[pos+26]) > len(data) {
+			return "truncated"
+		}
+		segments := data[pos+27 : pos+27+int(data[pos+26])]
+		length := 27 + len(segments)
+		for _, s := range segments {
+			length += int(s)
+		}
+		if pos+length > len(data) {
+			return "truncated"
+		}
+		eos = data[pos+5]&0x04 != 0
+		pos += length
+	}
+	if !eos {
+		return "truncated"
+	}
+	return ""
+}
+
+// runSweeper sweeps the cache every interval until ctx is done.
+func runSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if _, err := sweepCache(ctx, sweepRegenerate, false); err != nil && ctx.Err() == nil {
+			slog.Error("Cache sweep failed", "error", err)
+		}
+	}
+}
+
+// sweepCache checks every cached clip and cleans up what is corrupt or
+// orphaned, or with dryRun only reports it.
+func sweepCache(ctx context.Context, regenerate, dryRun bool) (sweepReport, error) {
+	report := sweepReport{Corrupt: []corruptClip{}, DryRun: dryRun}
+	clips := map[string]bool{}
+	var sidecars []string
+	err := cacheStore.List(ctx, func(obj objectInfo) error {
+		if strings.HasSuffix(obj.Key, ".timing.json") {
+			sidecars = append(sidecars, obj.Key)
+		} else if _, ok := formatForFile(obj.Key); ok && validCacheKey(obj.Key) {
+			clips[obj.Key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	decks, removed := map[string]bool{}, map[string]bool{}
+	for _, key := range slices.Sorted(maps.Keys(clips)) {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		cacheServingMu.Lock()
+		serving := cacheServing[key] > 0
+		cacheServingMu.Unlock()
+		if serving {
+			continue
+		}
+		data, _, err := cacheStore.Get(ctx, key)
+		if err != nil {
+			// Deleted meanwhile, or unreadable for now.
+			continue
+		}
+		report.Checked++
+		problem := clipProblem(key, data)
+		if stored := storedContentHash(ctx, key); problem == "" && stored != "" && stored != contentHash(data) {
+			problem = "checksum mismatch"
+		} else if problem == "" && stored == "" && !dryRun {
+			// Clips from before checksums were kept get one now.
+			recordContentHash(ctx, key, contentHash(data))
+		}
+		if problem == "" {
+			continue
+		}
+		report.Corrupt = append(report.Corrupt, corruptClip{key, problem})
+		slog.Warn("Corrupt cache entry", "key", logPath(key), "problem", problem, "dry_run", dryRun)
+		if dryRun {
+			continue
+		}
+		entries, _ := queryIndex(ctx, indexFilter{key: key})
+		if err := cacheStore.Delete(ctx, key); err != nil {
+			slog.Error("Failed to delete corrupt entry", "key", logPath(key), "error", err)
+			continue
+		}
+		delete(clips, key)
+		removed[clipStem(key)] = true
+		deleteSidecars(ctx, key)
+		if err := indexDelete(ctx, key); err != nil {
+			slog.Error("Failed to drop entry from the cache index", "key", logPath(key), "error", err)
+		}
+		decks[keyDeck(key)] = true
+		if regenerate && len(entries) == 1 && regenerateEntry(ctx, entries[0]) {
+			report.Regenerated++
+			clips[key] = true
+		}
+	}
+
+	stems := map[string]bool{}
+	for key := range clips {
+		stems[clipStem(key)] = true
+	}
+	for _, key := range sidecars {
+		// Those of deleted clips went with them.
+		if stem := strings.TrimSuffix(key, ".timing.json"); stems[stem] || removed[stem] {
+			continue
+		}
+		report.Orphans++
+		if !dryRun {
+			if err := cacheStore.Delete(ctx, key); err != nil {
+				slog.Error("Failed to delete orphaned sidecar", "key", logPath(key), "error", err)
+			}
+		}
+	}
+	indexed, err := queryIndex(ctx, indexFilter{})
+	if err != nil {
+		return report, err
+	}
+	for _, e := range indexed {
+		if clips[e.Key] {
+			continue
+		}
+		// Only stale if the file is still missing, not just newly written.
+		if _, err := cacheStore.Stat(ctx, e.Key); err == nil {
+			continue
+		}
+		report.Orphans++
+		if !dryRun {
+			if err := indexDelete(ctx, e.Key); err != nil {
+				slog.Error("Failed to drop entry from the cache index", "key", logPath(e.Key), "error", err)
+			}
+			decks[keyDeck(e.Key)] = true
+		}
+	}
+
+	for deck := range decks {
+		if err := pruneDeckManifest(ctx, deck); err != nil {
+			slog.Error("Failed to prune manifest", "deck", deck, "error", err)
+		}
+	}
+	slog.Info("Cache sweep finished", "checked", report.Checked, "corrupt", len(report.Corrupt),
+		"regenerated", report.Regenerated, "orphans", report.Orphans, "dry_run", dryRun)
+	return report, nil
+}
+
+// clipStem is key without its extension, which sidecars share.
+func clipStem(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+// regenerateEntry synthesizes the clip e describes again, if its index row
+// tells the whole request: the one it names must map to the same key, which
+// rules out decks and non-default settings.
+func regenerateEntry(ctx context.Context, e indexEntry) bool {
+	ctx = withTenant(ctx, e.Tenant)
+	req, result := batchRequest(ctx, batchItem{Text: e.Text, Model: e.Voice, Provider: e.Provider, Format: formatKey(e.Encoding)})
+	if result.Error != "" || req.key != e.Key {
+		return false
+	}
+	if err := generateFile(ctx, req); err != nil {
+		slog.Warn("Failed to regenerate corrupt entry", "key", logPath(e.Key), "error", logRedacted(err.Error(), e.Text))
+		return false
+	}
+	return true
+}
+
+// handleCacheSweep runs a sweep now and reports it. ?regenerate=true
+// regenerates what it can, ?dryRun=true only reports.
+func handleCacheSweep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	report, err := sweepCache(r.Context(), query.Get("regenerate") == "true", query.Get("dryRun") == "true")
+	if err != nil {
+		http.Error(w, "Cache sweep failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
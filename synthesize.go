@@ -0,0 +1,356 @@
+package wenbuntts
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// synthesize renders req with its provider and, if that fails, with each of
+// fallbackProviders in turn using their default voice. It returns the request
+// that produced the audio, whose provider and model may differ from req's.
+func synthesize(ctx context.Context, req ttsRequest) ([]byte, ttsRequest, error) {
+	audio, err := synthesizeWith(ctx, req)
+	if err == nil {
+		return audio, req, nil
+	}
+	errs := []error{fmt.Errorf("%s: %w", req.provider.Name(), err)}
+	for _, p := range fallbackProviders {
+		if p == req.provider {
+			continue
+		}
+		logger(ctx).Warn("Synthesis failed, falling back", "error", logRedacted(errs[len(errs)-1].Error(), req.text, req.alias), "fallback", p.Name())
+		fallback := req
+		fallback.provider = p
+		fallback.model = p.DefaultVoice()
+		fallback.options = nil
+		fallback.sampleRate = 0
+		audio, err := synthesizeWith(ctx, fallback)
+		if err == nil {
+			return audio, fallback, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+	if len(errs) == 1 {
+		return nil, req, err
+	}
+	return nil, req, errors.Join(errs...)
+}
+
+// synthesizeWith makes a single instrumented call to req's provider.
+func synthesizeWith(ctx context.Context, req ttsRequest) (audio []byte, err error) {
+	ctx, span := tracer.Start(ctx, "upstream.synthesize")
+	span.SetAttributes(attribute.String("tts.provider", req.provider.Name()))
+	start := time.Now()
+	defer func() {
+		upstreamLatency.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("tts.provider", req.provider.Name()),
+			attribute.String("tts.model", req.model),
+			attribute.Bool("tts.success", err == nil),
+		))
+		upstreamStatus.record(time.Now(), err == nil)
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		logger(ctx).Info("Upstream synthesis", "provider", req.provider.Name(), "model", req.model, "latency_ms", time.Since(start).Milliseconds(), "status", status)
+		if err == nil {
+			synthesizedChars.Add(ctx, int64(utf8.RuneCountInString(req.text)), metric.WithAttributes(attribute.String("tts.provider", req.provider.Name())))
+		} else {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	sreq := synthesisRequest{
+		Text:          req.text,
+		Language:      req.language,
+		Voice:         req.model,
+		AudioEncoding: req.audioFormat().encoding,
+		SpeakingRate:  req.prosody.speakingRate(),
+		Pitch:         req.prosody.pitch,
+		VolumeGainDb:  req.prosody.volumeGainDb,
+		Options:       req.options,
+	}
+	if speaksSSML(req.provider) {
+		sreq.SSML = req.ssml
+	}
+	if setsSampleRate(req.provider) {
+		sreq.SampleRateHertz = req.sampleRateHertz()
+	}
+	if kbps := req.bitrateKbps(); setsBitrate(req.provider, kbps) {
+		sreq.BitrateKbps = kbps
+	}
+	return synthesizeRetrying(ctx, req, sreq)
+}
+
+// ttsRequest is a validated /tts request resolved to its cache location.
+type ttsRequest struct {
+	text     string
+	alias    string // ?text= keyword that text was expanded from, if any
+	ssml     string // SSML content from parseSSML; text is then its plain text
+	provider provider
+	model    string
+	options  map[string]string // provider-specific settings, see optionParser
+	prosody  prosody
+	format   string // key of audioFormats; "" means defaultFormat
+	sentence bool   // ?mode=sentence
+	language string
+	deck     string
+	tenant   string // see withTenant; "" for the shared cache
+	key      string // storage key of the cached audio, from storageKey
+
+	sampleRate int             // ?sampleRateHertz=; 0 means defaultSampleRate, see sampleRateHertz
+	bitrate    int             // ?bitrate= in kbps; 0 means defaultBitrate, see bitrateKbps
+	silence    *silenceEdit    // from parseSilenceEdit; nil means defaultSilence
+	heteronyms []heteronymNote // 多音字 left to the voice or its default reading
+	chunks     []ttsRequest    // with ?autoSplit=true, the clips joined into this one
+}
+
+// dir is the cache directory req's audio goes in: its deck within its
+// tenant's directory.
+func (req ttsRequest) dir() string {
+	return path.Join(tenantDir(req.tenant), req.deck)
+}
+
+// textKey is the ?text= value req is cached under.
+func (req ttsRequest) textKey() string {
+	if req.alias != "" {
+		return req.alias
+	}
+	return req.text
+}
+
+// silenceEdit is how silence is trimmed from and padded onto req's audio.
+func (req ttsRequest) silenceEdit() silenceEdit {
+	if req.silence != nil {
+		return *req.silence
+	}
+	return defaultSilence
+}
+
+// sampleRateHertz is the sample rate req's audio is rendered at, or zero for
+// the voice's natural rate.
+func (req ttsRequest) sampleRateHertz() int {
+	if req.sampleRate != 0 {
+		return req.sampleRate
+	}
+	if req.audioFormat().telephony {
+		if setsSampleRate(req.provider) {
+			return telephonySampleRate
+		}
+		return 0
+	}
+	if setsSampleRate(req.provider) {
+		return defaultSampleRate
+	}
+	return 0
+}
+
+// bitrateKbps is the bitrate of req's MP3 audio, or zero for the provider's
+// own and for other formats.
+func (req ttsRequest) bitrateKbps() int {
+	if req.audioFormat().encoding != "MP3" {
+		return 0
+	}
+	return cmp.Or(req.bitrate, defaultBitrate)
+}
+
+func (req ttsRequest) audioFormat() audioFormat {
+	if f, ok := audioFormats[req.format]; ok {
+		return f
+	}
+	return audioFormats[defaultFormat]
+}
+
+// storageKey returns where the audio for req is cached: a hash of everything
+// that shapes the audio (provider, voice, text or SSML, encoding, prosody,
+// options, language and mode), so no two requests can share a file however
+// long or unusual their text, in a name from filenameTemplate if set. The
+// cache index maps names back to texts.
+func (req ttsRequest) storageKey() string {
+	return path.Join(req.dir(), req.cacheFilename(req.storageHash()))
+}
+
+// hashStorageKey is storageKey without a filenameTemplate.
+func (req ttsRequest) hashStorageKey() string {
+	return path.Join(req.dir(), req.storageHash()+req.audioFormat().ext)
+}
+
+func (req ttsRequest) storageHash() string {
+	fields := []string{
+		req.provider.Name(),
+		req.model,
+		req.textKey(),
+		req.ssml,
+		req.audioFormat().encoding,
+		canonicalOptions(req.tuning()),
+		strconv.FormatBool(req.sentence),
+	}
+	return keyHasher.hash([]byte(strings.Join(fields, "\x00")))
+}
+
+// tuning returns the settings besides voice and text that change the audio:
+// non-default prosody, provider options and a language the voice name
+// doesn't imply. That holds with INFER_LANG_FROM_VOICE=false too, so
+// toggling it doesn't serve clips cached in the other language.
+func (req ttsRequest) tuning() map[string]string {
+	tuning := req.prosody.cacheOptions()
+	maps.Copy(tuning, req.options)
+	implied := current().language
+	if m := voiceLanguagePattern.FindStringSubmatch(req.model); m != nil {
+		implied = m[1]
+	}
+	if req.language != "" && req.language != implied {
+		tuning["language"] = req.language
+	}
+	if e := req.silenceEdit(); editsSilence(e, req.audioFormat()) {
+		tuning["silence"] = e.cacheOption()
+	}
+	if normalizesLoudness(req.audioFormat()) {
+		tuning["loudness"] = strconv.FormatFloat(loudnessTarget, 'f', -1, 64)
+	}
+	if rate := req.sampleRateHertz(); rate != 0 {
+		tuning["sampleRateHertz"] = strconv.Itoa(rate)
+	}
+	if kbps := req.bitrateKbps(); kbps != 0 {
+		tuning["bitrate"] = strconv.Itoa(kbps)
+	}
+	if len(req.chunks) > 0 {
+		tuning["autoSplit"] = "true"
+	}
+	return tuning
+}
+
+// fallbackError is the generation error when only a fallback provider could
+// synthesize req. Its clip is cached under the fallback voice's own key,
+// generated.key, never under req's, so req's voice is tried again next time
+// instead of its URL serving another voice until the entry expires.
+type fallbackError struct {
+	generated ttsRequest
+}
+
+func (e *fallbackError) Error() string {
+	return fmt.Sprintf("Synthesized by fallback %s voice %s", e.generated.provider.Name(), e.generated.model)
+}
+
+// doGenerateFile synthesizes req and saves it to req.key, handing the audio
+// to publish just before it is written. Callers go through generateFile or
+// generateAudio, which coalesce concurrent calls for the same key. Audio
+// from a fallback provider is saved under its own key instead and reported
+// as a fallbackError.
+func doGenerateFile(ctx context.Context, req ttsRequest, publish func([]byte)) (err error) {
+	ctx, span := tracer.Start(ctx, "generate", trace.WithAttributes(attribute.String("tts.cache_key", req.key)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	if err := rememberedFailure(req.key); err != nil {
+		return err
+	}
+	cacheMissCounter.Add(ctx, 1)
+	audio, transcoded, err := transcodeFromCache(ctx, req)
+	if err != nil {
+		return err
+	}
+	generated := req
+	if len(req.chunks) > 0 && !transcoded {
+		// Each chunk was trimmed and normalized when it was generated.
+		audio, _, err = stitchMP3(ctx, req.chunks, 0)
+		if err != nil {
+			errorCounter.Add(ctx, 1)
+			return err
+		}
+	} else if !transcoded {
+		if serveOnly {
+			return errServeOnly
+		}
+		logger(ctx).Info("Generating new file", "cache_hit", false)
+
+		audio, generated, err = synthesize(ctx, req)
+		if err != nil {
+			errorCounter.Add(ctx, 1)
+			rememberFailure(req.key, err)
+			return err
+		}
+		if generated.provider != req.provider {
+			generated.key = generated.storageKey()
+		}
+		if req.audioFormat().encoding == "MP3" {
+			audio = applyLeadInTrim(generated.model, audio)
+		}
+		audio = applySilenceEdit(ctx, audio, req.audioFormat(), req.silenceEdit())
+		audio = applyLoudnessNormalization(ctx, audio, req.audioFormat())
+		// ffmpeg's silence and loudness edits re-encode at its own bitrate.
+		format := req.audioFormat()
+		if kbps := req.bitrateKbps(); !setsBitrate(generated.provider, kbps) || editsSilence(req.silenceEdit(), format) || normalizesLoudness(format) {
+			audio = applyBitrate(ctx, audio, kbps)
+		}
+	}
+	if generated.key == req.key {
+		publish(audio)
+	}
+
+	// Save the new file. Puts are atomic, since an expired entry being
+	// replaced may still be served meanwhile.
+	writeCtx, writeSpan := tracer.Start(ctx, "cache.write", trace.WithAttributes(attribute.Int("tts.bytes", len(audio))))
+	err = cacheStore.Put(writeCtx, generated.key, audio)
+	if err == nil {
+		duration, _ := audioDuration(audio, req.audioFormat().ext)
+		if ierr := indexPut(writeCtx, generated, audio, duration); ierr != nil {
+			logger(ctx).Error("Failed to index cache entry", "key", logPath(generated.key), "error", ierr)
+		}
+	}
+	writeSpan.End()
+	if err != nil {
+		errorCounter.Add(ctx, 1)
+		return fmt.Errorf("Failed to save file: %w", err)
+	}
+
+	if generated.key != req.key {
+		logger(ctx).Info("Saved new file", "key", logPath(generated.key), "fallback", generated.provider.Name(), "fallback_voice", generated.model)
+	} else {
+		logger(ctx).Info("Saved new file", "key", logPath(req.key))
+	}
+	history.record(time.Now(), false)
+	requestEviction()
+
+	if req.deck != "" {
+		if err := updateDeckManifest(ctx, generated); err != nil {
+			logger(ctx).Error("Failed to update manifest", "deck", req.deck, "error", err)
+		}
+	}
+	if generated.key != req.key {
+		return &fallbackError{generated}
+	}
+	return nil
+}
+
+const maxFilenameRunes = 50
+
+// sanitizeFilename ensures filename is valid and short enough.
+func sanitizeFilename(s string) string {
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.ReplaceAll(s, "\\", "_")
+	s = strings.TrimSpace(s)
+	if len([]rune(s)) > maxFilenameRunes {
+		s = string([]rune(s)[:maxFilenameRunes])
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package wenbuntts
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type tarRequest struct {
+	Words    []string `json:"words"`
+	Model    string   `json:"model"`
+	Provider string   `json:"provider"`
+	Format   string   `json:"format"`
+}
+
+type tarMissing struct {
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+// maxTarWords bounds the work a single /cache/tar request can trigger.
+const maxTarWords = 1000
+
+// handleCacheTar streams a tar archive with the audio for each requested
+// word, generating any that are not cached yet. Members are named after the
+// source text, with a hash of the cache key added when two names collide. Since the status line is sent before the first word is
+// resolved, words that could not be produced are listed in a trailing
+// manifest.json member instead of failing the response.
+func handleCacheTar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body tarRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	words, err := body.resolve(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", `attachment; filename="audio.tar"`)
+	tw := tar.NewWriter(w)
+
+	missing := []tarMissing{}
+	used := map[string]bool{}
+	for _, req := range words {
+		if err := ensureCached(r.Context(), req); err != nil {
+			missing = append(missing, tarMissing{req.text, err.Error()})
+			continue
+		}
+		name := sanitizeFilename(req.text) + req.audioFormat().ext
+		if used[name] {
+			// Another text that sanitizes to the same name, e.g. a/b and a\b.
+			name = sanitizeFilename(req.text) + "." + shortHash(req.key) + req.audioFormat().ext
+		}
+		if err := writeTarFile(r.Context(), tw, name, req.key); err != nil {
+			// The archive is corrupt past this point; abort the stream.
+			slog.Error("Failed to write tar entry", "key", logPath(req.key), "error", logRedacted(err.Error(), req.text))
+			return
+		}
+		used[name] = true
+	}
+
+	manifest, _ := json.MarshalIndent(struct {
+		Missing []tarMissing `json:"missing"`
+	}{missing}, "", "  ")
+	tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: time.Now()})
+	tw.Write(manifest)
+	tw.Close()
+}
+
+// resolve validates body and returns a request for each distinct word.
+// Invalid words get a request with an empty key.
+func (body tarRequest) resolve(ctx context.Context) ([]ttsRequest, error) {
+	if len(body.Words) == 0 || len(body.Words) > maxTarWords {
+		return nil, errors.New("Invalid words: must list between 1 and 1000 words")
+	}
+	prov, ok := providerFor(body.Provider)
+	if !ok {
+		return nil, errors.New("Invalid provider: " + body.Provider)
+	}
+	if body.Model == "" {
+		body.Model = prov.DefaultVoice()
+	}
+	if !slices.Contains(prov.AllowedVoices(), body.Model) {
+		return nil, errors.New("Invalid model: must be one of " + strings.Join(prov.AllowedVoices(), ", "))
+	}
+	format, ok := parseFormat(body.Format)
+	if !ok {
+		return nil, errors.New("Invalid format: must be one of " + strings.Join(slices.Sorted(maps.Keys(audioFormats)), ", "))
+	}
+
+	var words []ttsRequest
+	seen := map[string]bool{}
+	for _, text := range body.Words {
+		text = normalizeText(text)
+		if seen[text] {
+			continue
+		}
+		seen[text] = true
+		req := ttsRequest{text: text, provider: prov, model: body.Model, format: format, language: languageFor(body.Model), tenant: tenantFrom(ctx)}
+		if validateText(text, req.language, req.model) == nil {
+			req.key = req.storageKey()
+		}
+		words = append(words, req)
+	}
+	return words, nil
+}
+
+// ensureCached generates req's entry unless it is cached already. A request
+// without a key failed validation in resolve.
+func ensureCached(ctx context.Context, req ttsRequest) error {
+	if req.key == "" {
+		return errors.New("invalid text")
+	}
+	if _, err := lookupCached(ctx, req); err != nil {
+		return generateFile(ctx, req)
+	}
+	history.record(time.Now(), true)
+	cacheHitCounter.Add(ctx, 1)
+	indexHit(ctx, req.key)
+	return nil
+}
+
+func writeTarFile(ctx context.Context, tw *tar.Writer, name, key string) error {
+	defer beginServing(key)()
+	data, info, err := cacheStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size, ModTime: info.ModTime}); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
@@ -0,0 +1,48 @@
+package wenbuntts
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCacheTarNamesAreUnique(t *testing.T) {
+	// Both words sanitize to 一_二.
+	setSettings(t, func(s *reloadableSettings) { s.allowPunctuation = true })
+	body, _ := json.Marshal(tarRequest{Words: []string{"一/二", `一\二`, "三"}})
+	resp, err := http.Post(server.URL+"/cache/tar", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s", resp.Status)
+	}
+
+	names := map[string]bool{}
+	tr := tar.NewReader(resp.Body)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if names[h.Name] {
+			t.Errorf("two members named %s", h.Name)
+		}
+		names[h.Name] = true
+		if h.Name == manifestName {
+			manifest, _ := io.ReadAll(tr)
+			if !strings.Contains(string(manifest), `"missing": []`) {
+				t.Errorf("manifest: %s", manifest)
+			}
+		}
+	}
+	if len(names) != 4 {
+		t.Errorf("members %v, want 3 clips and the manifest", names)
+	}
+}
@@ -0,0 +1,203 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "wenbun-tts-generator"
+
+var (
+	tracer trace.Tracer
+
+	requestCounter   metric.Int64Counter
+	cacheHitCounter  metric.Int64Counter
+	cacheMissCounter metric.Int64Counter
+	errorCounter     metric.Int64Counter
+	upstreamLatency  metric.Float64Histogram
+	synthesizedChars metric.Int64Counter
+
+	// metricsHandler serves /metrics in the Prometheus format, or is nil
+	// with METRICS_ENABLED=false.
+	metricsHandler http.Handler
+)
+
+// setupTelemetry installs OTLP trace and metric exporters when
+// OTEL_EXPORTER_OTLP_ENDPOINT is set, and a Prometheus reader for /metrics
+// unless METRICS_ENABLED=false. The OTLP exporters read the rest of their
+// configuration from the standard OTEL_* environment variables.
+func setupTelemetry(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+
+	var readers []sdkmetric.Option
+	if setting("METRICS_ENABLED") != "false" {
+		registry := prometheus.NewRegistry()
+		exporter, err := otelprom.New(otelprom.WithRegisterer(registry))
+		if err != nil {
+			return shutdown, err
+		}
+		readers = append(readers, sdkmetric.WithReader(exporter))
+		metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	}
+
+	var tp *sdktrace.TracerProvider
+	if setting("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		traceExporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return shutdown, err
+		}
+		metricExporter, err := otlpmetrichttp.New(ctx)
+		if err != nil {
+			return shutdown, err
+		}
+		readers = append(readers, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)))
+
+		tp = sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter))
+		otel.SetTracerProvider(tp)
+	}
+
+	if len(readers) > 0 {
+		mp := sdkmetric.NewMeterProvider(readers...)
+		otel.SetMeterProvider(mp)
+		shutdown = func(ctx context.Context) error {
+			err := mp.Shutdown(ctx)
+			if tp != nil {
+				err = errors.Join(err, tp.Shutdown(ctx))
+			}
+			return err
+		}
+	}
+
+	// Incoming W3C trace context lets a client's trace continue here.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer = otel.Tracer(instrumentationName)
+	meter := otel.Meter(instrumentationName)
+
+	requestCounter, err = meter.Int64Counter("tts.requests", metric.WithDescription("Requests to /tts"))
+	if err != nil {
+		return shutdown, err
+	}
+	cacheHitCounter, err = meter.Int64Counter("tts.cache.hits", metric.WithDescription("Requests served from the audio cache"))
+	if err != nil {
+		return shutdown, err
+	}
+	cacheMissCounter, err = meter.Int64Counter("tts.cache.misses", metric.WithDescription("Requests that required a new synthesis"))
+	if err != nil {
+		return shutdown, err
+	}
+	errorCounter, err = meter.Int64Counter("tts.errors", metric.WithDescription("Failed syntheses"))
+	if err != nil {
+		return shutdown, err
+	}
+	upstreamLatency, err = meter.Float64Histogram("tts.upstream.latency", metric.WithUnit("s"), metric.WithDescription("Latency of calls to the TTS API"),
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30))
+	if err != nil {
+		return shutdown, err
+	}
+	synthesizedChars, err = meter.Int64Counter("tts.synthesized.characters", metric.WithDescription("Characters sent to the TTS API in successful syntheses"))
+	if err != nil {
+		return shutdown, err
+	}
+	_, err = meter.Int64ObservableGauge("tts.cache.size", metric.WithUnit("By"), metric.WithDescription("Total size of cached audio"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			if cacheIndex == nil {
+				return nil
+			}
+			var size int64
+			if err := cacheIndex.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM entries`).Scan(&size); err != nil {
+				return err
+			}
+			o.Observe(size)
+			return nil
+		}))
+	if err != nil {
+		return shutdown, err
+	}
+	if len(breakers) > 0 {
+		_, err = meter.Int64ObservableGauge("tts.circuit_breaker.state", metric.WithDescription("Circuit breaker state per provider: 0 closed, 1 half-open, 2 open"),
+			metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+				for name, b := range breakers {
+					state, _ := b.status()
+					o.Observe(int64(state), metric.WithAttributes(attribute.String("tts.provider", name)))
+				}
+				return nil
+			}))
+		if err != nil {
+			return shutdown, err
+		}
+	}
+	if hotCache != nil {
+		_, err = meter.Int64ObservableGauge("tts.memcache.size", metric.WithUnit("By"), metric.WithDescription("Audio held by the in-memory hot cache"),
+			metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+				size, _, _ := hotCache.stats()
+				o.Observe(size)
+				return nil
+			}))
+		if err != nil {
+			return shutdown, err
+		}
+		_, err = meter.Int64ObservableCounter("tts.memcache.lookups", metric.WithDescription("Reads of cached audio by whether the hot cache had it"),
+			metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+				_, hits, misses := hotCache.stats()
+				o.Observe(hits, metric.WithAttributes(attribute.Bool("hit", true)))
+				o.Observe(misses, metric.WithAttributes(attribute.Bool("hit", false)))
+				return nil
+			}))
+		if err != nil {
+			return shutdown, err
+		}
+	}
+	return shutdown, nil
+}
+
+// statusRecorder remembers the status code and body size written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// countRequests counts requests to next in requestCounter by response status.
+func countRequests(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		requestCounter.Add(r.Context(), 1, metric.WithAttributes(attribute.Int("http.response.status_code", rec.status)))
+	}
+}
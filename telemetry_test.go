@@ -0,0 +1,82 @@
+package wenbuntts
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTelemetryRecorded serves a miss and a hit with in-memory exporters in
+// place of OTLP and checks what they were given.
+func TestTelemetryRecorded(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	spans := tracetest.NewSpanRecorder()
+	mp, tp := otel.GetMeterProvider(), otel.GetTracerProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	// With neither exporter configured, setupTelemetry takes its
+	// instruments from the providers above.
+	t.Setenv("METRICS_ENABLED", "false")
+	t.Cleanup(func() {
+		otel.SetMeterProvider(mp)
+		otel.SetTracerProvider(tp)
+		setupTelemetry(context.Background())
+	})
+	if _, err := setupTelemetry(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if resp, body := get(t, "/tts", url.Values{"text": {"遥测"}}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("/tts: %s %s", resp.Status, body)
+		}
+	}
+	backgroundWork.Wait()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	recorded := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			recorded[m.Name] = m.Data
+		}
+	}
+	for name, want := range map[string]int64{
+		"tts.requests":               2,
+		"tts.cache.hits":             1,
+		"tts.cache.misses":           1,
+		"tts.synthesized.characters": 2,
+	} {
+		sum, ok := recorded[name].(metricdata.Sum[int64])
+		var got int64
+		for _, p := range sum.DataPoints {
+			got += p.Value
+		}
+		if !ok || got != want {
+			t.Errorf("%s = %d, want %d", name, got, want)
+		}
+	}
+	if latency, ok := recorded["tts.upstream.latency"].(metricdata.Histogram[float64]); !ok || len(latency.DataPoints) != 1 || latency.DataPoints[0].Count != 1 {
+		t.Errorf("tts.upstream.latency = %+v, want one upstream call", recorded["tts.upstream.latency"])
+	}
+
+	var names []string
+	for _, s := range spans.Ended() {
+		names = append(names, s.Name())
+	}
+	for _, want := range []string{"tts", "validate", "cache.lookup", "generate", "upstream.synthesize", "cache.write"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("spans %q, missing %q", names, want)
+		}
+	}
+}
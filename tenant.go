@@ -0,0 +1,165 @@
+package wenbuntts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Tenants let several apps or classes share one server without sharing
+// files or budgets. A tenant's audio is cached under tenants/<tenant>/, its
+// characters are counted against TENANT_CHAR_BUDGET_DAILY and
+// TENANT_CHAR_BUDGET_MONTHLY as well as the server's budgets, and /stats
+// only shows it its own figures (see requireStatsAccess). The tenant comes
+// from the API key, for keys listed in TENANT_KEYS as "tenant:key", or else
+// from ?tenant= (x-tenant metadata over gRPC). Requests with neither use the
+// shared, untenanted cache.
+//
+// With CACHE_NAMESPACE_BY_KEY=true, every key in API_KEYS is a tenant of
+// its own too, named after an HMAC of the key with CACHE_NAMESPACE_SALT, so
+// keys never share cached audio and the raw key is never stored. ?tenant=
+// can't name those tenants.
+var (
+	tenantKeys map[string]string // API key to tenant
+
+	cacheNamespaceByKey bool
+	cacheNamespaceSalt  []byte
+)
+
+const tenantsDir = "tenants"
+
+var (
+	errInvalidTenant = errors.New("Invalid tenant")
+	errWrongTenant   = errors.New("API key belongs to another tenant")
+)
+
+// parseTenantKeys reads TENANT_KEYS. Tenant names follow deck names, as
+// each is a single path element in the cache.
+func parseTenantKeys(s string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, entry := range splitList(s) {
+		tenant, key, ok := strings.Cut(entry, ":")
+		if !ok || !isValidDeck(tenant) || key == "" {
+			return nil, errors.New("Invalid TENANT_KEYS: want a comma-separated list of tenant:key")
+		}
+		keys[key] = tenant
+	}
+	return keys, nil
+}
+
+// resolveTenant returns the tenant for a request made with key asking for
+// requested, which a key bound to a tenant may only repeat.
+func resolveTenant(key, requested string) (string, error) {
+	if bound, ok := boundTenant(key); ok {
+		if requested != "" && requested != bound {
+			return "", errWrongTenant
+		}
+		return bound, nil
+	}
+	if requested != "" && !isValidDeck(requested) {
+		return "", fmt.Errorf("%w: must be 1-64 letters, digits, '-' or '_'", errInvalidTenant)
+	}
+	if strings.HasPrefix(requested, keyNamespacePrefix) {
+		return "", fmt.Errorf("%w: %s is reserved for CACHE_NAMESPACE_BY_KEY", errInvalidTenant, keyNamespacePrefix)
+	}
+	return requested, nil
+}
+
+// boundTenant returns the tenant key belongs to, from TENANT_KEYS or
+// CACHE_NAMESPACE_BY_KEY, if any. Only configured keys are namespaced, so
+// made-up keys can't create tenants.
+func boundTenant(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	if tenant, ok := tenantKeys[key]; ok {
+		return tenant, true
+	}
+	if cacheNamespaceByKey && validAPIKey(key) {
+		return keyNamespace(key), true
+	}
+	return "", false
+}
+
+// keyNamespacePrefix starts the tenant names of CACHE_NAMESPACE_BY_KEY,
+// which ?tenant= may not use.
+const keyNamespacePrefix = "key-"
+
+// keyNamespace is the tenant of key under CACHE_NAMESPACE_BY_KEY.
+func keyNamespace(key string) string {
+	mac := hmac.New(sha256.New, cacheNamespaceSalt)
+	mac.Write([]byte(key))
+	return keyNamespacePrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// requestTenant returns the tenant r acts for, see resolveTenant, or
+// answers r itself if it names one it can't.
+func requestTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenant, err := resolveTenant(requestAPIKey(r), r.URL.Query().Get("tenant"))
+	if errors.Is(err, errWrongTenant) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return "", false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return tenant, true
+}
+
+type tenantKey struct{}
+
+// withTenant returns a context for requests made on behalf of tenant.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return withLogAttrs(context.WithValue(ctx, tenantKey{}, tenant), "tenant", tenant)
+}
+
+// tenantFrom returns the tenant ctx acts for, or "" for none.
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// tenantDir is the directory under which tenant's audio is cached, "" for
+// the shared cache.
+func tenantDir(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return path.Join(tenantsDir, tenant)
+}
+
+// keyTenant splits a storage key's directory into its tenant and deck.
+func keyTenant(key string) (tenant, deck string) {
+	deck = keyDeck(key)
+	if rest, ok := strings.CutPrefix(deck, tenantsDir+"/"); ok {
+		tenant, deck, _ = strings.Cut(rest, "/")
+	}
+	return tenant, deck
+}
+
+// validCacheKey reports whether file names an audio file as
+// "[tenants/{tenant}/][{deck}/]{name}", so it can never leave the cache.
+func validCacheKey(file string) bool {
+	parts := strings.Split(file, "/")
+	if len(parts) >= 3 && parts[0] == tenantsDir {
+		if !isValidDeck(parts[1]) {
+			return false
+		}
+		parts = parts[2:]
+	}
+	if len(parts) > 2 || (len(parts) == 2 && !isValidDeck(parts[0])) {
+		return false
+	}
+	name := parts[len(parts)-1]
+	_, ok := formatForFile(name)
+	return ok && !strings.Contains(name, `\`)
+}
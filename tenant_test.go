@@ -0,0 +1,131 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCacheNamespaceByKey(t *testing.T) {
+	t.Cleanup(func() { cacheNamespaceByKey, cacheNamespaceSalt, apiKeys = false, nil, nil })
+	cacheNamespaceByKey, cacheNamespaceSalt, apiKeys = true, []byte("pepper"), []string{"alice-secret", "bob-secret"}
+
+	request := func(key string, query url.Values) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+"/tts?"+query.Encode(), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+	metadata := func(key string) audioMetadata {
+		t.Helper()
+		resp, body := request(key, url.Values{"text": {"隔离"}, "response": {"json"}})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("key %s: %s %s", key, resp.Status, body)
+		}
+		var meta audioMetadata
+		if err := json.Unmarshal(body, &meta); err != nil {
+			t.Fatal(err)
+		}
+		return meta
+	}
+	a, b := metadata("alice-secret"), metadata("bob-secret")
+	if a.CacheHit || b.CacheHit {
+		t.Error("a key was served the other key's cache entry")
+	}
+	if a.ContentURL == b.ContentURL {
+		t.Errorf("both keys cached %s", a.ContentURL)
+	}
+	for _, u := range []string{a.ContentURL, b.ContentURL} {
+		if strings.Contains(u, "secret") || !strings.Contains(u, tenantsDir+"/key-") {
+			t.Errorf("cached as %s, want a hashed key namespace", u)
+		}
+	}
+	if again := metadata("alice-secret"); !again.CacheHit || again.ContentURL != a.ContentURL {
+		t.Errorf("same key again: hit %v at %s", again.CacheHit, again.ContentURL)
+	}
+
+	// Keys that aren't configured get no namespace, and nobody can ask
+	// for one by name.
+	if resp, _ := request("mallory", url.Values{"text": {"隔离"}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unknown key: %s, want 401", resp.Status)
+	}
+	if tenant, ok := boundTenant("mallory"); ok {
+		t.Errorf("unknown key bound to %s", tenant)
+	}
+	apiKeys = nil
+	namespace := strings.Split(strings.TrimPrefix(a.ContentURL, "/audio/"+tenantsDir+"/"), "/")[0]
+	resp, body := request("", url.Values{"text": {"隔离"}, "tenant": {namespace}})
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "reserved") {
+		t.Errorf("?tenant=%s: %s %s, want 400", namespace, resp.Status, body)
+	}
+}
+
+func TestStatsScopedToTenant(t *testing.T) {
+	t.Cleanup(func() { tenantKeys, adminToken = nil, "" })
+	tenantKeys, adminToken = map[string]string{"alpha-key": "stats-a", "beta-key": "stats-b"}, "root"
+
+	get := func(path, auth string, query url.Values) (int, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+path+"?"+query.Encode(), nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+	for key, text := range map[string]string{"alpha-key": "甲方", "beta-key": "乙方"} {
+		if status, body := get("/tts", key, url.Values{"text": {text}}); status != http.StatusOK {
+			t.Fatalf("%s: %d %s", key, status, body)
+		}
+	}
+	// /tts answers before the clips are cached and indexed.
+	backgroundWork.Wait()
+
+	for _, tt := range []struct {
+		path, auth string
+		query      url.Values
+		status     int
+		want, not  string
+	}{
+		{"/stats", "alpha-key", nil, http.StatusOK, "甲方", "乙方"},
+		{"/stats/cache", "beta-key", nil, http.StatusOK, "", ""},
+		{"/stats/usage", "beta-key", nil, http.StatusOK, `"tenant":"stats-b"`, ""},
+		{"/stats", "alpha-key", url.Values{"tenant": {"stats-b"}}, http.StatusForbidden, "", ""},
+		{"/stats/cache", "", nil, http.StatusForbidden, "", ""},
+		{"/stats/usage", "shared-key", nil, http.StatusForbidden, "", ""},
+		{"/stats/history", "alpha-key", nil, http.StatusForbidden, "", ""},
+		{"/stats", "root", url.Values{"top": {"100"}}, http.StatusOK, "乙方", ""},
+		{"/stats", "root", url.Values{"tenant": {"stats-b"}, "top": {"100"}}, http.StatusOK, "乙方", "甲方"},
+		{"/stats/history", "root", nil, http.StatusOK, "", ""},
+	} {
+		status, body := get(tt.path, tt.auth, tt.query)
+		if status != tt.status {
+			t.Errorf("%s?%s as %q: %d %s, want %d", tt.path, tt.query.Encode(), tt.auth, status, body, tt.status)
+			continue
+		}
+		if !strings.Contains(string(body), tt.want) || (tt.not != "" && strings.Contains(string(body), tt.not)) {
+			t.Errorf("%s?%s as %q: %s, want %q without %q", tt.path, tt.query.Encode(), tt.auth, body, tt.want, tt.not)
+		}
+	}
+
+	// A tenant's cache totals are only its own entries.
+	_, body := get("/stats/cache", "alpha-key", nil)
+	var stats struct{ Entries int64 }
+	if err := json.Unmarshal(body, &stats); err != nil || stats.Entries != 1 {
+		t.Errorf("alpha's cache stats: %s, want its one entry", body)
+	}
+}
@@ -0,0 +1,131 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// timepointer is implemented by providers that can report when each
+// character of the text is spoken.
+type timepointer interface {
+	// SynthesizeTimed renders req.Text and returns the offset at which each
+	// of its characters (runes) starts.
+	SynthesizeTimed(ctx context.Context, req synthesisRequest) ([]byte, []time.Duration, error)
+}
+
+// charTiming is one character of a timing sidecar.
+type charTiming struct {
+	Index    int    `json:"index"`
+	Char     string `json:"char"`
+	OffsetMs int64  `json:"offsetMs"`
+}
+
+type timingSidecar struct {
+	Text       string       `json:"text"`
+	Characters []charTiming `json:"characters"`
+}
+
+// timingKey is where the timing sidecar of the clip under key is cached.
+func timingKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".timing.json"
+}
+
+// deleteSidecars removes the files cached next to the clip under key.
+func deleteSidecars(ctx context.Context, key string) {
+	if err := cacheStore.Delete(ctx, timingKey(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger(ctx).Error("Failed to delete timing sidecar", "key", logPath(key), "error", err)
+	}
+}
+
+// serveTiming answers /tts?timing=true with per-character offsets for req's
+// clip, from its cached sidecar or a timed synthesis. Those offsets describe
+// the cached audio, so a lead-in trim applied to it is subtracted.
+func serveTiming(ctx context.Context, w http.ResponseWriter, req ttsRequest) {
+	tp, ok := req.provider.(timepointer)
+	if !ok || req.ssml != "" || req.sentence {
+		http.Error(w, "Timing is not available for this request: it needs plain text and the google provider", http.StatusBadRequest)
+		return
+	}
+
+	data, _, err := cacheStore.Get(ctx, timingKey(req.key))
+	if errors.Is(err, fs.ErrNotExist) {
+		// The clip itself is cached like any other, so it matches the
+		// timings once they exist.
+		if _, err := lookupCached(ctx, req); err != nil {
+			if err := generateFile(ctx, req); err != nil {
+				httpGenerateError(ctx, w, err.Error(), err)
+				return
+			}
+		}
+		data, err = generateTiming(ctx, req, tp)
+	}
+	if err != nil {
+		httpGenerateError(ctx, w, "Failed to get timing: "+err.Error(), err)
+		return
+	}
+
+	if ttsCacheControl != "" {
+		w.Header().Set("Cache-Control", ttsCacheControl)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func generateTiming(ctx context.Context, req ttsRequest, tp timepointer) ([]byte, error) {
+	sreq := synthesisRequest{
+		Text:          req.text,
+		Language:      req.language,
+		Voice:         req.model,
+		AudioEncoding: req.audioFormat().encoding,
+		SpeakingRate:  req.prosody.speakingRate(),
+		Pitch:         req.prosody.pitch,
+		VolumeGainDb:  req.prosody.volumeGainDb,
+		Options:       req.options,
+	}
+	if setsSampleRate(req.provider) {
+		sreq.SampleRateHertz = req.sampleRateHertz()
+	}
+	var audio []byte
+	var offsets []time.Duration
+	err := callUpstream(ctx, req, func(ctx context.Context) (err error) {
+		audio, offsets, err = tp.SynthesizeTimed(ctx, sreq)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only edits to the start of the clip shift the offsets.
+	f := req.audioFormat()
+	edited := audio
+	if f.encoding == "MP3" {
+		edited = applyLeadInTrim(req.model, edited)
+	}
+	edited = applySilenceEdit(ctx, edited, f, req.silenceEdit().leading())
+	var trimmed time.Duration
+	full, ok := audioDuration(audio, f.ext)
+	short, ok2 := audioDuration(edited, f.ext)
+	if ok && ok2 {
+		trimmed = full - short
+	}
+
+	sidecar := timingSidecar{Text: req.text, Characters: []charTiming{}}
+	for i, c := range []rune(req.text) {
+		offset := 0 * time.Millisecond
+		if i < len(offsets) {
+			offset = max(offsets[i]-trimmed, 0)
+		}
+		sidecar.Characters = append(sidecar.Characters, charTiming{Index: i, Char: string(c), OffsetMs: offset.Milliseconds()})
+	}
+	data, _ := json.Marshal(sidecar)
+	if err := cacheStore.Put(ctx, timingKey(req.key), data); err != nil {
+		logger(ctx).Error("Failed to cache timing sidecar", "key", logPath(req.key), "error", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,49 @@
+package wenbuntts
+
+import (
+	"cmp"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureTLS makes srv serve HTTPS when TLS_CERT_FILE and TLS_KEY_FILE
+// are set, or with certificates from Let's Encrypt for AUTOCERT_DOMAINS.
+// Autocert answers HTTP-01 challenges on AUTOCERT_HTTP_ADDR (":80" by
+// default), which otherwise redirects to HTTPS.
+func configureTLS(srv *http.Server) error {
+	certFile, keyFile := setting("TLS_CERT_FILE"), setting("TLS_KEY_FILE")
+	domains := splitList(setting("AUTOCERT_DOMAINS"))
+	switch {
+	case certFile != "" && len(domains) > 0:
+		return errors.New("Set either TLS_CERT_FILE/TLS_KEY_FILE or AUTOCERT_DOMAINS, not both")
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	case len(domains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cmp.Or(setting("AUTOCERT_CACHE_DIR"), "./autocert")),
+			Email:      setting("AUTOCERT_EMAIL"),
+		}
+		srv.TLSConfig = m.TLSConfig()
+
+		addr := cmp.Or(setting("AUTOCERT_HTTP_ADDR"), ":80")
+		go func() {
+			if err := http.ListenAndServe(addr, m.HTTPHandler(nil)); err != nil {
+				slog.Error("ACME challenge listener failed", "addr", addr, "error", err)
+			}
+		}()
+	}
+	return nil
+}
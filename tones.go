@@ -0,0 +1,82 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// toneSyllable is a toneless pinyin syllable, with "v" for ü.
+var toneSyllable = regexp.MustCompile(`^[a-z]{1,6}$`)
+
+// handleTTSTones generates a syllable in each of the four tones and the
+// neutral tone with SSML phonemes, for pronunciation drills. ?tone=1 to 5
+// returns one clip; otherwise all five come as a ZIP named e.g. ma1.mp3.
+func handleTTSTones(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	syllable := strings.ReplaceAll(strings.ToLower(query.Get("syllable")), "ü", "v")
+	if !toneSyllable.MatchString(syllable) {
+		http.Error(w, "Invalid syllable: must be 1-6 pinyin letters without a tone", http.StatusBadRequest)
+		return
+	}
+
+	prov, ok := providerFor(query.Get("provider"))
+	if !ok || !speaksSSML(prov) {
+		http.Error(w, "Invalid provider: tone drills need a provider that accepts SSML", http.StatusBadRequest)
+		return
+	}
+	modelName := query.Get("model")
+	if modelName == "" {
+		modelName = defaultVoiceFor(prov, "cmn-CN")
+	}
+	if !slices.Contains(prov.AllowedVoices(), modelName) || languageFor(modelName) != "cmn-CN" {
+		http.Error(w, "Invalid model: must be a Mandarin voice of "+prov.Name(), http.StatusBadRequest)
+		return
+	}
+	format, ok := parseFormat(query.Get("format"))
+	if !ok {
+		http.Error(w, "Invalid format: must be one of "+strings.Join(slices.Sorted(maps.Keys(audioFormats)), ", "), http.StatusBadRequest)
+		return
+	}
+
+	tones := []int{1, 2, 3, 4, 5}
+	if v := query.Get("tone"); v != "" {
+		tone, err := strconv.Atoi(v)
+		if err != nil || tone < 1 || tone > 5 {
+			http.Error(w, "Invalid tone: must be 1-5, 5 being the neutral tone", http.StatusBadRequest)
+			return
+		}
+		tones = []int{tone}
+	}
+
+	var reqs []ttsRequest
+	for _, tone := range tones {
+		ph := fmt.Sprintf("%s%d", syllable, tone)
+		req := ttsRequest{
+			text:     ph,
+			ssml:     fmt.Sprintf(`<phoneme alphabet="pinyin" ph="%s">%s</phoneme>`, ph, syllable),
+			provider: prov,
+			model:    modelName,
+			format:   format,
+			language: "cmn-CN",
+			tenant:   tenantFrom(r.Context()),
+		}
+		req.key = req.storageKey()
+		reqs = append(reqs, req)
+	}
+
+	if len(reqs) == 1 {
+		if err := ensureCached(r.Context(), reqs[0]); err != nil {
+			httpGenerateError(r.Context(), w, err.Error(), err)
+			return
+		}
+		serveAudio(w, r, reqs[0].key)
+		return
+	}
+
+	serveClipZip(w, r, syllable+"-tones.zip", reqs, func(req ttsRequest) string { return req.text })
+}
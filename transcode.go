@@ -0,0 +1,111 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// When a clip isn't cached in the requested format but the same clip is in
+// another, it is transcoded from that one with ffmpeg instead of being
+// synthesized again, and cached under its own key like a generated clip.
+// This works with SERVE_ONLY too, since no provider is called.
+// TRANSCODE_CACHED=false turns it off; it needs ffmpeg either way.
+var transcodeCached = true
+
+// transcodeFailPolicy, TRANSCODE_FAIL_POLICY, is what happens when ffmpeg
+// fails to transcode a cached clip: with "error" the request fails with
+// ffmpeg's error rather than synthesizing the clip again; with "degrade" the
+// cached clip is served as it is instead, in its own encoding, with
+// X-Transcode-Failed: true.
+var transcodeFailPolicy = "error"
+
+// transcodeFailedError is the generation error under the degrade policy:
+// src is the cached clip that failed to transcode.
+type transcodeFailedError struct {
+	src ttsRequest
+	err error
+}
+
+func (e *transcodeFailedError) Error() string {
+	return fmt.Sprintf("Failed to transcode %s: %v", logPath(e.src.key), e.err)
+}
+
+func (e *transcodeFailedError) Unwrap() error { return e.err }
+
+// transcodeSources are the formats a clip is transcoded from, in order of
+// preference: lossless WAV first.
+var transcodeSources = []string{"wav", "mp3", "opus"}
+
+// ffmpegTranscoders are the output options that encode each format from any
+// input ffmpeg can decode.
+var ffmpegTranscoders = map[string][]string{
+	"MP3":      ffmpegEncoders["MP3"],
+	"OGG_OPUS": ffmpegEncoders["OGG_OPUS"],
+	"LINEAR16": {"-c:a", "pcm_s16le", "-f", "wav"},
+	"MULAW":    {"-c:a", "pcm_mulaw", "-ar", "8000", "-ac", "1", "-f", "wav"},
+	"ALAW":     {"-c:a", "pcm_alaw", "-ar", "8000", "-ac", "1", "-f", "wav"},
+}
+
+// transcodeFromCache returns req's audio transcoded from a cached encoding of
+// the same clip, or false if there is none to transcode. The source was
+// trimmed and normalized when it was generated, so the result needs neither.
+// A failed transcode is an error, and under the degrade policy a
+// transcodeFailedError.
+func transcodeFromCache(ctx context.Context, req ttsRequest) ([]byte, bool, error) {
+	if !transcodeCached || ffmpegPath == "" {
+		return nil, false, nil
+	}
+	want := req.audioFormat()
+	for _, name := range transcodeSources {
+		if audioFormats[name].encoding == want.encoding {
+			continue
+		}
+		src := req
+		src.format = name
+		src.key = src.storageKey()
+		if _, err := statCached(ctx, src.key); err != nil {
+			continue
+		}
+		data, _, err := cacheStore.Get(ctx, src.key)
+		if err != nil {
+			continue
+		}
+		audio, err := ffmpegTranscode(ctx, data, want, req.bitrateKbps())
+		if err != nil && transcodeFailPolicy == "degrade" {
+			logger(ctx).Warn("Failed to transcode cached file; serving it untranscoded", "from", logPath(src.key), "error", err)
+			return nil, false, &transcodeFailedError{src, err}
+		} else if err != nil {
+			return nil, false, fmt.Errorf("Failed to transcode %s: %w", logPath(src.key), err)
+		}
+		logger(ctx).Info("Transcoded cached file", "from", logPath(src.key), "encoding", want.encoding)
+		return audio, true, nil
+	}
+	return nil, false, nil
+}
+
+// ffmpegTranscode re-encodes audio, in any format ffmpeg recognizes, to
+// format, at kbps if it is MP3.
+func ffmpegTranscode(ctx context.Context, audio []byte, format audioFormat, kbps int) ([]byte, error) {
+	encoder, ok := ffmpegTranscoders[format.encoding]
+	if format.encoding == "MP3" {
+		encoder = mp3Encoder(kbps)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no ffmpeg encoder for %s", format.encoding)
+	}
+	return runFFmpeg(ctx, audio, encoder...)
+}
+
+// runFFmpeg decodes audio and encodes it with the encoder output options.
+func runFFmpeg(ctx context.Context, audio []byte, encoder ...string) ([]byte, error) {
+	var encoded, stderr bytes.Buffer
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	cmd := exec.CommandContext(ctx, ffmpegPath, append(append(args, encoder...), "pipe:1")...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(audio), &encoded, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+	return encoded.Bytes(), nil
+}
@@ -0,0 +1,45 @@
+package wenbuntts
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscodeFailPolicy(t *testing.T) {
+	// An ffmpeg that always fails.
+	fake := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\necho 'unsupported filter' >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ffmpegPath, transcodeCached, transcodeFailPolicy = "", true, "error" })
+
+	for _, tt := range []struct {
+		policy, text, format string
+		status               int
+	}{
+		// The mock could synthesize mu-law, but the error policy must
+		// not fall back to it.
+		{"error", "转码", "mulaw", http.StatusInternalServerError},
+		// The mock can't synthesize Ogg Opus, so degrade serves the WAV.
+		{"degrade", "降级", "ogg", http.StatusOK},
+	} {
+		getMetadata(t, url.Values{"text": {tt.text}, "format": {"wav"}})
+		ffmpegPath, transcodeCached, transcodeFailPolicy = fake, true, tt.policy
+
+		resp, body := get(t, "/tts", url.Values{"text": {tt.text}, "format": {tt.format}})
+		ffmpegPath = ""
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %s %.80q, want %d", tt.policy, resp.Status, body, tt.status)
+		}
+		failed := resp.Header.Get("X-Transcode-Failed") == "true"
+		if failed != (tt.policy == "degrade") {
+			t.Errorf("%s: X-Transcode-Failed %q", tt.policy, resp.Header.Get("X-Transcode-Failed"))
+		}
+		if ct := resp.Header.Get("Content-Type"); failed && ct != "audio/wav" {
+			t.Errorf("%s: Content-Type %q, want the cached audio/wav", tt.policy, ct)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func handleTTS(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "tts")
+	defer span.End()
+	start := time.Now()
+
+	query := r.URL.Query()
+
+	_, validateSpan := tracer.Start(ctx, "validate")
+	defer validateSpan.End()
+
+	text := normalizeText(query.Get("text"))
+	if text == "" {
+		http.Error(w, "Missing ?text= parameter", http.StatusBadRequest)
+		return
+	}
+
+	// ?script=simplified lets 學 and 学 share one cache entry and reading;
+	// by default the text is synthesized as written.
+	switch query.Get("script") {
+	case "", "keep":
+	case "simplified":
+		text = toSimplified(text)
+	default:
+		http.Error(w, "Invalid script: must be keep or simplified", http.StatusBadRequest)
+		return
+	}
+
+	prov, ok := providerFor(query.Get("provider"))
+	if !ok {
+		http.Error(w, "Invalid provider: must be one of "+strings.Join(slices.Sorted(maps.Keys(providers)), ", "), http.StatusBadRequest)
+		return
+	}
+
+	live := current()
+	language := query.Get("language")
+	if _, ok := live.rules[language]; language != "" && !ok {
+		http.Error(w, "Invalid language: must be one of "+strings.Join(slices.Sorted(maps.Keys(live.rules)), ", "), http.StatusBadRequest)
+		return
+	}
+
+	modelName := query.Get("model")
+	if modelName == "" {
+		modelName = defaultVoiceFor(prov, cmp.Or(language, live.language))
+	}
+
+	// ?model=random redirects to a concrete voice, so that each voice's
+	// URL stays cacheable while repeated requests hear different speakers.
+	if modelName == "random" {
+		v, ok := randomVoice(prov, cmp.Or(language, live.language))
+		if !ok {
+			http.Error(w, "Invalid model: provider "+prov.Name()+" has no voice to pick from", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodPost {
+			query.Set("model", v)
+			http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), http.StatusFound)
+			return
+		}
+		// A redirect would move the body's text into the URL.
+		modelName = v
+	}
+
+	if !slices.Contains(prov.AllowedVoices(), modelName) {
+		http.Error(w, "Invalid model: must be one of "+strings.Join(prov.AllowedVoices(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	// Numbers are written out in characters, see verbalizeText.
+	readNumbers := verbalizeNumbers
+	if v := query.Get("numbers"); v != "" {
+		read, ok := numberReadings[v]
+		if !ok {
+			http.Error(w, "Invalid numbers: must be read or keep", http.StatusBadRequest)
+			return
+		}
+		readNumbers = read
+	}
+	years := yearReading
+	if v := query.Get("years"); v != "" {
+		var err error
+		if years, err = parseYearReading(v); err != nil {
+			http.Error(w, "Invalid years: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if _, isAlias := textAliases[text]; readNumbers && !isAlias && query.Get("ssml") != "true" && strings.HasPrefix(cmp.Or(language, languageFor(modelName)), "cmn") {
+		text = verbalizeText(text, years)
+	}
+
+	// An SSML document is validated and re-encoded; text becomes its plain
+	// text for validation, logs and the cache filename.
+	ssml := ""
+	if query.Get("ssml") == "true" {
+		if !speaksSSML(prov) {
+			http.Error(w, "Invalid ssml: provider "+prov.Name()+" does not accept SSML", http.StatusBadRequest)
+			return
+		}
+		content, plain, err := parseSSML(text)
+		if err != nil {
+			http.Error(w, "Invalid SSML: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ssml, text = content, plain
+	}
+
+	// Readings for 多音字, from ?pinyin= or ?zhuyin= hints or the heteronym
+	// dictionary, become <phoneme> elements around the characters they name.
+	_, isAlias := textAliases[text]
+	mandarin := ssml == "" && !isAlias && cmp.Or(language, languageFor(modelName)) == "cmn-CN"
+	var hints map[string]string
+	var err error
+	if v := strings.Trim(query.Get("pinyin")+","+query.Get("zhuyin"), ","); v != "" {
+		if !mandarin || !speaksSSML(prov) {
+			http.Error(w, "Invalid pinyin: hints need plain Mandarin text and a provider that accepts SSML", http.StatusBadRequest)
+			return
+		}
+		if hints, err = parsePinyinHints(v); err != nil {
+			http.Error(w, "Invalid pinyin: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var heteronyms []heteronymNote
+	if mandarin {
+		var readings map[string]string
+		readings, heteronyms, err = resolveHeteronyms(text, hints, heteronymMode == "apply" && speaksSSML(prov))
+		if err != nil {
+			http.Error(w, "Invalid pinyin: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(readings) > 0 {
+			ssml = pinyinSSML(text, readings)
+		}
+	}
+
+	options, err := parseProviderOptions(prov, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tone, err := parseProsody(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, ok := parseFormat(query.Get("format"))
+	if !ok {
+		http.Error(w, "Invalid format: must be one of "+strings.Join(slices.Sorted(maps.Keys(audioFormats)), ", "), http.StatusBadRequest)
+		return
+	}
+
+	sampleRate := 0
+	if v := query.Get("sampleRateHertz"); v != "" {
+		if !setsSampleRate(prov) {
+			http.Error(w, "Invalid sampleRateHertz: provider "+prov.Name()+" cannot set a sample rate", http.StatusBadRequest)
+			return
+		}
+		if sampleRate, err = parseSampleRate(v); err != nil {
+			http.Error(w, "Invalid sampleRateHertz: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if audioFormats[format].telephony && sampleRate != telephonySampleRate {
+			http.Error(w, fmt.Sprintf("Invalid sampleRateHertz: %s audio is %d Hz", format, telephonySampleRate), http.StatusBadRequest)
+			return
+		}
+	}
+
+	bitrate := 0
+	if v := query.Get("bitrate"); v != "" {
+		if audioFormats[format].encoding != "MP3" {
+			http.Error(w, "Invalid bitrate: only mp3 output has a bitrate", http.StatusBadRequest)
+			return
+		}
+		if bitrate, err = parseBitrate(v); err != nil {
+			http.Error(w, "Invalid bitrate: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !setsBitrate(prov, bitrate) && ffmpegPath == "" {
+			http.Error(w, fmt.Sprintf("Invalid bitrate: provider %s cannot make %d kbps MP3 without ffmpeg", prov.Name(), bitrate), http.StatusBadRequest)
+			return
+		}
+	}
+
+	silence, err := parseSilenceEdit(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deck := query.Get("deck")
+	if deck != "" && !isValidDeck(deck) {
+		http.Error(w, "Invalid deck: must be 1-64 letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+
+	// Aliases expand to a configured phrase and are exempt from validation.
+	spoken, isAlias := textAliases[text]
+	if !isAlias || ssml != "" {
+		spoken, isAlias = text, false
+	}
+
+	req := ttsRequest{text: spoken, ssml: ssml, provider: prov, model: modelName, options: options, prosody: tone, format: format, sampleRate: sampleRate, bitrate: bitrate, silence: &silence, deck: deck, tenant: tenantFrom(ctx), heteronyms: heteronyms}
+	if isAlias {
+		req.alias = text
+	}
+
+	// The voice pool and progressive voice name voices of the default provider.
+	seed := query.Get("seed")
+	if query.Get("pool") == "true" || seed != "" {
+		if len(voicePool) == 0 || prov != defaultProvider {
+			http.Error(w, "Voice pool is not configured", http.StatusBadRequest)
+			return
+		}
+		if seed != "" {
+			req.model = seededPoolVoice(seed)
+		} else {
+			req.model = resolvePoolVoice(ctx, req)
+		}
+	}
+
+	req.language, err = resolveLanguage(req.model, language)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch mode := query.Get("mode"); mode {
+	case "", "word":
+	case "sentence":
+		if sentenceMaxLength == 0 {
+			http.Error(w, "Sentence mode is disabled", http.StatusBadRequest)
+			return
+		}
+		req.sentence = true
+	default:
+		http.Error(w, "Invalid mode: must be word or sentence", http.StatusBadRequest)
+		return
+	}
+	if req.sentence {
+		if err := validateSentence(text, req.language); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if !isAlias {
+		if query.Get("autoSplit") == "true" && utf8.RuneCountInString(text) > maxTextLengthFor(req.model, req.language) {
+			if query.Get("ssml") == "true" || query.Get("timing") == "true" || query.Get("progressive") == "true" || query.Get("speed") == "all" {
+				http.Error(w, "Invalid autoSplit: cannot be combined with ssml, timing, progressive or speed=all", http.StatusBadRequest)
+				return
+			}
+			if req.audioFormat().encoding != "MP3" {
+				http.Error(w, "Invalid autoSplit: only mp3 clips can be joined", http.StatusBadRequest)
+				return
+			}
+			if req.chunks, err = splitRequest(req, hints, heteronymMode == "apply" && speaksSSML(prov)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else if err := validateText(text, req.language, req.model); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err := checkHanForTTS(text); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	validateSpan.End()
+	span.SetAttributes(attribute.String("tts.model", req.model))
+
+	// don't allow reset
+	// reset := query.Get("reset") == "true"
+	reset := false
+
+	req.key = req.storageKey()
+	ctx = withLogAttrs(ctx, "voice", req.model, textAttr(req.textKey()))
+
+	if query.Get("echo") == "true" {
+		writeEcho(w, req)
+		return
+	}
+
+	if query.Get("timing") == "true" {
+		serveTiming(ctx, w, req)
+		return
+	}
+
+	// A probe reports whether the entry is cached without ever synthesizing
+	// or sending the audio. A GET then has no body for the clip's
+	// Content-Length to describe, so its size is X-TTS-Content-Length.
+	if query.Get("probe") == "true" {
+		info, err := lookupCached(ctx, req)
+		if err != nil {
+			w.Header().Set("X-TTS-Cached", "false")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		size := strconv.FormatInt(info.Size, 10)
+		w.Header().Set("X-TTS-Cached", "true")
+		w.Header().Set("X-TTS-Content-Length", size)
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", size)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if query.Get("speed") == "all" {
+		serveSpeedVariants(w, r, req)
+		return
+	}
+
+	disposition, err := downloadDisposition(query, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recordWordRequest(ctx, req, query)
+
+	// Skip cache if reset=true
+	if !reset {
+		_, lookupSpan := tracer.Start(ctx, "cache.lookup")
+		_, err := lookupCached(ctx, req)
+		lookupSpan.SetAttributes(attribute.Bool("tts.cache_hit", err == nil))
+		lookupSpan.End()
+		if err != nil && query.Get("variantFallback") == "true" {
+			if variant, ok := cachedVariant(ctx, req); ok {
+				w.Header().Set("X-Variant-Fallback", "true")
+				req, err = variant, nil
+			}
+		}
+		if err == nil {
+			logger(ctx).Info("Serving cached file", "key", logPath(req.key), "cache_hit", true, "latency_ms", time.Since(start).Milliseconds())
+			history.record(time.Now(), true)
+			cacheHitCounter.Add(ctx, 1)
+			indexHit(ctx, req.key)
+			if wantsJSON(r) {
+				writeAudioJSON(w, r, req, true)
+				return
+			}
+			setDisposition(w, disposition)
+			serveAudio(w, r, req.key)
+			return
+		}
+	} else {
+		logger(ctx).Info("Cache reset requested")
+	}
+
+	if err := allowMiss(ctx); err != nil {
+		httpGenerateError(ctx, w, err.Error(), err)
+		return
+	}
+	if req.sentence && !takeSentenceBudget(utf8.RuneCountInString(req.text), time.Now()) {
+		http.Error(w, "Daily sentence budget exhausted", http.StatusTooManyRequests)
+		return
+	}
+
+	if query.Get("async") == "true" {
+		job := startAsyncJob(ctx, req)
+		w.Header().Set("Location", "/tts/status?id="+job.id)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "Generating, poll /tts/status?id=%s\n", job.id)
+		return
+	}
+
+	// Progressive mode serves a quick render with progressiveVoice now and
+	// generates the requested voice in the background for next time. A miss
+	// therefore costs two syntheses.
+	if query.Get("progressive") == "true" && progressiveVoice != "" && progressiveVoice != req.model && prov == defaultProvider {
+		startAsyncJob(ctx, req)
+
+		fast := req
+		fast.model = progressiveVoice
+		fast.language = languageFor(progressiveVoice)
+		fast.options = nil
+		fast.key = fast.storageKey()
+		if _, err := lookupCached(ctx, fast); err != nil {
+			if err := generateFile(ctx, fast); err != nil {
+				httpGenerateError(ctx, w, err.Error(), err)
+				return
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-TTS-Progressive", "placeholder")
+		writeAudio(w, r, fast.key)
+		return
+	}
+
+	// JSON describes the cached entry, so it waits for the write; audio is
+	// sent from memory while the cache write is still in progress.
+	if wantsJSON(r) {
+		if err := generateFile(ctx, req); serveUntranscoded(w, r, err) || serveFallback(w, r, err) {
+			return
+		} else if err != nil {
+			httpGenerateError(ctx, w, err.Error(), err)
+			return
+		}
+		logger(ctx).Info("Serving generated file", "key", logPath(req.key), "cache_hit", false, "latency_ms", time.Since(start).Milliseconds())
+		writeAudioJSON(w, r, req, false)
+		return
+	}
+	audio, err := generateAudio(ctx, req)
+	if serveUntranscoded(w, r, err) || serveFallback(w, r, err) {
+		return
+	} else if err != nil {
+		httpGenerateError(ctx, w, err.Error(), err)
+		return
+	}
+	logger(ctx).Info("Serving generated file", "key", logPath(req.key), "cache_hit", false, "latency_ms", time.Since(start).Milliseconds())
+	setAudioCacheHeaders(w)
+	setDisposition(w, disposition)
+	sendAudio(w, r, req.key, audio, time.Now())
+}
+
+// serveUntranscoded serves the cached clip behind a transcodeFailedError,
+// reporting false if err isn't one. It is served with no-store, so the
+// requested encoding is tried again next time.
+func serveUntranscoded(w http.ResponseWriter, r *http.Request, err error) bool {
+	var failed *transcodeFailedError
+	if !errors.As(err, &failed) {
+		return false
+	}
+	w.Header().Set("X-Transcode-Failed", "true")
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		writeAudioJSON(w, r, failed.src, true)
+	} else {
+		writeAudio(w, r, failed.src.key)
+	}
+	return true
+}
+
+// serveFallback serves the clip behind a fallbackError, reporting false if
+// err isn't one. Like an untranscoded clip, it is served with no-store.
+func serveFallback(w http.ResponseWriter, r *http.Request, err error) bool {
+	var fallback *fallbackError
+	if !errors.As(err, &fallback) {
+		return false
+	}
+	w.Header().Set("X-TTS-Fallback", fallback.generated.provider.Name())
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		writeAudioJSON(w, r, fallback.generated, false)
+	} else {
+		writeAudio(w, r, fallback.generated.key)
+	}
+	return true
+}
+
+// setDisposition sets the Content-Disposition from downloadDisposition, if
+// any.
+func setDisposition(w http.ResponseWriter, disposition string) {
+	if disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+}
+
+// generateErrorStatus picks the response status for a generateFile error.
+func generateErrorStatus(err error) int {
+	if errors.Is(err, errUpstreamBusy) || errors.Is(err, errCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, errBudgetExhausted) {
+		return current().charBudgetStatus
+	}
+	if errors.Is(err, errServeOnly) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, errMissForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// httpGenerateError replies to a request whose synthesis failed with err,
+// with msg and the generateErrorStatus, or with writeBudgetError if a budget
+// is exhausted.
+func httpGenerateError(ctx context.Context, w http.ResponseWriter, msg string, err error) {
+	if errors.Is(err, errBudgetExhausted) {
+		writeBudgetError(ctx, w, msg)
+		return
+	}
+	http.Error(w, msg, generateErrorStatus(err))
+}
+
+// serveAudio serves a cached clip for a /tts request, with the
+// ttsCacheControl policy.
+func serveAudio(w http.ResponseWriter, r *http.Request, key string) {
+	setAudioCacheHeaders(w)
+	writeAudio(w, r, key)
+}
+
+func setAudioCacheHeaders(w http.ResponseWriter) {
+	if ttsCacheControl != "" {
+		w.Header().Set("Cache-Control", ttsCacheControl)
+	}
+	// The same URL returns JSON to clients that ask for it, see wantsJSON.
+	w.Header().Set("Vary", "Accept")
+}
+
+// writeAudio sends the clip stored under key, honoring range and
+// conditional requests.
+func writeAudio(w http.ResponseWriter, r *http.Request, key string) {
+	defer beginServing(key)()
+	data, info, err := cacheStore.Get(r.Context(), key)
+	if errors.Is(err, fs.ErrNotExist) {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Cache entry disappeared, try again", http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Failed to read cache entry", http.StatusInternalServerError)
+		logger(r.Context()).Error("Failed to read cache entry", "key", logPath(key), "error", err)
+		return
+	}
+	if verifyOnServe {
+		if err := verifyClip(r.Context(), key, data); err != nil {
+			w.Header().Del("Cache-Control")
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Cache entry is corrupt", http.StatusNotFound)
+			logger(r.Context()).Warn("Cache entry failed verification", "key", logPath(key))
+			return
+		}
+	}
+	sendAudio(w, r, key, data, info.ModTime)
+}
+
+// sendAudio sends data, the clip stored under key.
+func sendAudio(w http.ResponseWriter, r *http.Request, key string, data []byte, modTime time.Time) {
+	if f, ok := formatForFile(key); ok {
+		w.Header().Set("Content-Type", f.contentType)
+		w.Header().Set("X-Content-URL", contentAudioURL(clipContentHash(r.Context(), key, data), f))
+	}
+	w.Header().Set("ETag", audioETag(data))
+	w.Header().Set("Content-Location", audioURL(key))
+	if d, ok := clipDuration(r.Context(), key, data); ok {
+		w.Header().Set("X-Audio-Duration", strconv.FormatFloat(d.Seconds(), 'f', 3, 64))
+	}
+	http.ServeContent(w, r, path.Base(key), modTime, bytes.NewReader(data))
+}
+
+// audioETag returns a strong entity tag for data. It is a hash of the bytes
+// rather than of the cache key, so a regenerated clip gets a new tag, and
+// http.ServeContent answers If-None-Match and If-Range with it.
+func audioETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
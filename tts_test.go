@@ -0,0 +1,405 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// server serves the HTTP API with the mock provider and a temporary cache,
+// set up once for the package's tests.
+var server *httptest.Server
+
+func TestMain(m *testing.M) {
+	// A test may run the test binary again as the command itself, like
+	// TestGenerateWhileServing does, with the arguments in this variable.
+	if args := os.Getenv("WENBUNTTS_TEST_MAIN"); args != "" {
+		Main(strings.Fields(args))
+		os.Exit(0)
+	}
+	dir, err := os.MkdirTemp("", "wenbuntts-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("TTS_PROVIDER", "mock")
+	os.Setenv("OUTPUT_DIR", dir)
+	os.Setenv("LOG_LEVEL", "error")
+	cleanup := setup(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	registerRoutes()
+	server = httptest.NewServer(serverHandler())
+
+	code := m.Run()
+	server.Close()
+	cleanup()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// get requests path with query from the test server, returning the
+// response and its body.
+func get(t *testing.T, path string, query url.Values) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func getMetadata(t *testing.T, query url.Values) audioMetadata {
+	t.Helper()
+	query = maps.Clone(query)
+	query.Set("response", "json")
+	resp, body := get(t, "/tts", query)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/tts?%s: %s %s", query.Encode(), resp.Status, body)
+	}
+	var meta audioMetadata
+	if err := json.Unmarshal(body, &meta); err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestTTSCacheMissThenHit(t *testing.T) {
+	query := url.Values{"text": {"你好"}}
+	if meta := getMetadata(t, query); meta.CacheHit {
+		t.Error("first request was a cache hit")
+	} else if meta.Provider != "mock" || meta.Voice != mockVoice {
+		t.Errorf("provider %q voice %q, want mock", meta.Provider, meta.Voice)
+	}
+	meta := getMetadata(t, query)
+	if !meta.CacheHit {
+		t.Error("second request was a cache miss")
+	}
+
+	resp, body := get(t, "/tts", url.Values{"text": {"你好"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s", resp.Status, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("Content-Type %q, want audio/mpeg", ct)
+	}
+	if int64(len(body)) != meta.Bytes || !bytes.HasPrefix(body, mockMP3Frame[:4]) {
+		t.Errorf("got %d bytes, want %d of mock MP3", len(body), meta.Bytes)
+	}
+
+	// The clip's content URL serves the same bytes.
+	resp, audio := get(t, meta.ContentURL, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(audio, body) {
+		t.Errorf("%s: %s, %d bytes", meta.ContentURL, resp.Status, len(audio))
+	}
+}
+
+func TestTTSOptionsAreCachedApart(t *testing.T) {
+	getMetadata(t, url.Values{"text": {"谢谢"}})
+	if meta := getMetadata(t, url.Values{"text": {"谢谢"}, "format": {"wav"}}); meta.CacheHit {
+		t.Error("wav was served from the mp3's cache entry")
+	}
+	if meta := getMetadata(t, url.Values{"text": {"谢谢"}, "speakingRate": {"1.5"}}); meta.CacheHit {
+		t.Error("speakingRate=1.5 was served from the default rate's cache entry")
+	}
+	if meta := getMetadata(t, url.Values{"text": {"谢谢"}, "format": {"wav"}}); !meta.CacheHit {
+		t.Error("second wav request was a cache miss")
+	}
+}
+
+func TestTTSTelephonyFormat(t *testing.T) {
+	resp, body := get(t, "/tts", url.Values{"text": {"喂"}, "format": {"mulaw"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s", resp.Status, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "audio/wav" {
+		t.Errorf("Content-Type %q, want audio/wav", ct)
+	}
+	// A µ-law (format 7) WAV at 8 kHz.
+	if len(body) < 44 || string(body[8:12]) != "WAVE" || body[20] != 7 || binary.LittleEndian.Uint32(body[24:28]) != 8000 {
+		t.Errorf("not an 8 kHz µ-law WAV: % x", body[:min(len(body), 44)])
+	}
+	if meta := getMetadata(t, url.Values{"text": {"喂"}, "format": {"wav"}}); meta.CacheHit {
+		t.Error("wav was served from the mulaw cache entry")
+	}
+
+	// The immutable URL shares .wav with LINEAR16 but still finds the clip
+	// once it is indexed.
+	backgroundWork.Wait()
+	meta := getMetadata(t, url.Values{"text": {"喂"}, "format": {"mulaw"}})
+	u, err := url.Parse(meta.ImmutableURL)
+	if err != nil || !strings.HasSuffix(u.Path, ".wav") {
+		t.Fatalf("immutableUrl %q", meta.ImmutableURL)
+	}
+	resp, content := get(t, u.Path, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(content, body) {
+		t.Errorf("%s: %s, want the mulaw clip", u.Path, resp.Status)
+	}
+}
+
+// TestTTSEcho checks that ?echo=true reports the request as it is then
+// rendered and cached, without rendering it.
+func TestTTSEcho(t *testing.T) {
+	query := url.Values{"text": {" 回\u200b声 "}, "speakingRate": {"1.5"}, "pitch": {"-2"}, "format": {"wav"}}
+	echoQuery := maps.Clone(query)
+	echoQuery.Set("echo", "true")
+	resp, body := get(t, "/tts", echoQuery)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s", resp.Status, body)
+	}
+	var echo requestEcho
+	if err := json.Unmarshal(body, &echo); err != nil {
+		t.Fatal(err)
+	}
+	want := requestEcho{
+		Text: "回声", Provider: "mock", Voice: mockVoice, Language: languageFor(mockVoice),
+		SpeakingRate: 1.5, Pitch: -2, AudioEncoding: "LINEAR16", CacheFile: echo.CacheFile,
+	}
+	if !reflect.DeepEqual(echo, want) {
+		t.Errorf("echo %+v, want %+v", echo, want)
+	}
+	if entries, _ := queryIndex(context.Background(), indexFilter{text: "回声"}); len(entries) != 0 {
+		t.Fatalf("echo rendered the clip: %+v", entries)
+	}
+
+	getMetadata(t, query)
+	backgroundWork.Wait()
+	entries, err := queryIndex(context.Background(), indexFilter{text: "回声"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("index: %v %+v", err, entries)
+	}
+	if e := entries[0]; e.Key != echo.CacheFile || e.Voice != echo.Voice || e.Encoding != echo.AudioEncoding {
+		t.Errorf("cached as %s, %s, %s; echoed %s, %s, %s", e.Key, e.Voice, e.Encoding, echo.CacheFile, echo.Voice, echo.AudioEncoding)
+	}
+}
+
+func TestTTSValidation(t *testing.T) {
+	for _, tt := range []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{}, "Missing ?text= parameter"},
+		{url.Values{"text": {""}}, "Missing ?text= parameter"},
+		{url.Values{"text": {"你好"}, "provider": {"nope"}}, "Invalid provider"},
+		{url.Values{"text": {"你好"}, "model": {"nope"}}, "Invalid model"},
+		{url.Values{"text": {"你好"}, "format": {"flac"}}, "Invalid format"},
+		{url.Values{"text": {"你好"}, "speakingRate": {"9"}}, "Invalid speakingRate"},
+		{url.Values{"text": {"你好"}, "speed": {"warp"}}, "Invalid speed"},
+		{url.Values{"text": {"你好"}, "deck": {"a/b"}}, "Invalid deck"},
+		{url.Values{"text": {"你好"}, "mode": {"paragraph"}}, "Invalid mode"},
+		{url.Values{"text": {strings.Repeat("好", 10000)}}, "Invalid text"},
+	} {
+		resp, body := get(t, "/tts", tt.query)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), tt.want) {
+			t.Errorf("/tts?%.60s: %s %q, want 400 %q", tt.query.Encode(), resp.Status, body, tt.want)
+		}
+	}
+}
+
+func TestTTSProviderError(t *testing.T) {
+	// The mock provider can't render Ogg Opus, so synthesis fails.
+	query := url.Values{"text": {"再见"}, "format": {"ogg"}}
+	for range 2 {
+		resp, body := get(t, "/tts", query)
+		if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(string(body), "mock does not support OGG_OPUS output") {
+			t.Errorf("%s %q, want 500 from the provider", resp.Status, body)
+		}
+	}
+	// Nothing was cached for it.
+	filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if strings.HasSuffix(path, ".ogg") {
+			t.Errorf("failed synthesis was cached as %s", path)
+		}
+		return err
+	})
+}
+
+func TestAudioNotFound(t *testing.T) {
+	resp, _ := get(t, "/audio/00000000000000000000000000000000.mp3", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("%s, want 404", resp.Status)
+	}
+}
+
+func TestTTSProbe(t *testing.T) {
+	// Every upstream call is counted here, successful or not.
+	saved := upstreamStatus
+	upstreamStatus = newUpstreamHealth(time.Minute, 0.5, 1)
+	t.Cleanup(func() { upstreamStatus = saved })
+	calls := func() int {
+		_, samples := upstreamStatus.errorRate(time.Now())
+		return samples
+	}
+
+	probe := url.Values{"text": {"探测"}, "probe": {"true"}}
+	resp, body := get(t, "/tts", probe)
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("X-TTS-Cached") != "false" || len(body) != 0 {
+		t.Errorf("probe of a miss: %s, X-TTS-Cached %q, %d bytes", resp.Status, resp.Header.Get("X-TTS-Cached"), len(body))
+	}
+	if n := calls(); n != 0 {
+		t.Fatalf("probe of a miss called upstream %d times", n)
+	}
+
+	meta := getMetadata(t, url.Values{"text": {"探测"}})
+	if meta.CacheHit {
+		t.Error("the probe cached the clip")
+	}
+	resp, body = get(t, "/tts", probe)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-TTS-Cached") != "true" || len(body) != 0 {
+		t.Errorf("probe of a hit: %s, X-TTS-Cached %q, %d bytes", resp.Status, resp.Header.Get("X-TTS-Cached"), len(body))
+	}
+	if resp.Header.Get("X-TTS-Content-Length") != strconv.FormatInt(meta.Bytes, 10) {
+		t.Errorf("probe of a hit: X-TTS-Content-Length %s, want %d", resp.Header.Get("X-TTS-Content-Length"), meta.Bytes)
+	}
+	head, err := http.Head(server.URL + "/tts?" + probe.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.Body.Close()
+	if head.StatusCode != http.StatusOK || head.ContentLength != meta.Bytes {
+		t.Errorf("HEAD probe of a hit: %s, Content-Length %d, want %d", head.Status, head.ContentLength, meta.Bytes)
+	}
+	if n := calls(); n != 1 {
+		t.Errorf("%d upstream calls, want only the one rendering the clip", n)
+	}
+}
+
+// downProvider is a mock whose synthesis always fails.
+type downProvider struct{ mockProvider }
+
+func (downProvider) Name() string { return "down" }
+
+func (downProvider) Synthesize(ctx context.Context, req synthesisRequest) ([]byte, error) {
+	return nil, errors.New("down for maintenance")
+}
+
+func TestTTSFallbackIsNotCachedAsRequested(t *testing.T) {
+	providers["down"] = downProvider{}
+	fallbackProviders = []provider{providers["mock"]}
+	t.Cleanup(func() {
+		delete(providers, "down")
+		fallbackProviders = nil
+	})
+
+	query := url.Values{"text": {"备用"}, "provider": {"down"}}
+	for range 2 {
+		resp, body := get(t, "/tts", query)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %q, want the fallback clip", resp.Status, body)
+		}
+		if got := resp.Header.Get("X-TTS-Fallback"); got != "mock" {
+			t.Errorf("X-TTS-Fallback %q, want mock", got)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control %q, want no-store", cc)
+		}
+	}
+	// The clip is the mock voice's own entry, so asking for it directly
+	// is a hit.
+	if meta := getMetadata(t, url.Values{"text": {"备用"}}); !meta.CacheHit {
+		t.Error("fallback clip was not cached under the mock voice's key")
+	}
+}
+
+func TestTTSManifestOnlyForDecks(t *testing.T) {
+	getMetadata(t, url.Values{"text": {"无卡组"}})
+	backgroundWork.Wait()
+	if _, err := os.Stat(filepath.Join(outputDir, manifestName)); !os.IsNotExist(err) {
+		t.Errorf("a miss outside any deck wrote %s: %v", manifestName, err)
+	}
+
+	getMetadata(t, url.Values{"text": {"卡组"}, "deck": {"lesson1"}})
+	backgroundWork.Wait()
+	data, err := os.ReadFile(filepath.Join(outputDir, "lesson1", manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest deckManifest
+	if err := json.Unmarshal(data, &manifest); err != nil || len(manifest.Entries) != 1 || manifest.Entries[0].Text != "卡组" {
+		t.Errorf("lesson1 manifest: %s", data)
+	}
+}
+
+func TestInflightCapCoversSynthesizingRoutes(t *testing.T) {
+	setSettings(t, func(s *reloadableSettings) { s.maxInflightPerIP = 1 })
+	release, _ := enterInflight(current(), "127.0.0.1")
+	defer release()
+
+	for _, tt := range []struct {
+		method, path string
+		capped       bool
+	}{
+		{"GET", "/tts?text=你好", true},
+		{"POST", "/tts/batch", true},
+		{"GET", "/tts/tones?syllable=ma", true},
+		{"GET", "/tts/compare?text=你好", true},
+		{"POST", "/tts/concat", true},
+		{"POST", "/tts/dialogue", true},
+		{"GET", "/tts/pair?word=你好&sentence=你好吗", true},
+		{"GET", "/tts/stream", true},
+		{"POST", "/jobs", true},
+		{"POST", "/cache/tar", true},
+		{"POST", "/cache/zip", true},
+		{"POST", "/cache/anki", true},
+		{"POST", "/import/wenbun", true},
+		{"POST", "/import/csv", true},
+		{"GET", "/voices", false},
+		{"POST", "/tts/estimate", false},
+	} {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader("[]"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if capped := resp.StatusCode == http.StatusTooManyRequests; capped != tt.capped {
+			t.Errorf("%s %s at the in-flight cap: %s", tt.method, tt.path, resp.Status)
+		}
+	}
+}
+
+func TestTTSCacheControl(t *testing.T) {
+	savedTTS, saved := ttsCacheControl, cacheControl
+	ttsCacheControl, cacheControl = "public, max-age=60", "public, max-age=120, immutable"
+	t.Cleanup(func() { ttsCacheControl, cacheControl = savedTTS, saved })
+
+	query := url.Values{"text": {"缓存"}}
+	for _, state := range []string{"generated", "cached"} {
+		resp, body := get(t, "/tts", query)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != ttsCacheControl {
+			t.Errorf("%s audio: %s %.60q, Cache-Control %q, want %q", state, resp.Status, body, resp.Header.Get("Cache-Control"), ttsCacheControl)
+		}
+	}
+	meta := getMetadata(t, query)
+	if resp, _ := get(t, meta.ContentURL, nil); resp.Header.Get("Cache-Control") != cacheControl {
+		t.Errorf("%s: Cache-Control %q, want %q", meta.ContentURL, resp.Header.Get("Cache-Control"), cacheControl)
+	}
+
+	for _, query := range []url.Values{
+		{"text": {"缓存"}, "model": {"nope"}},
+		{"text": {"缓存"}, "format": {"ogg"}},
+	} {
+		resp, _ := get(t, "/tts", query)
+		if resp.StatusCode == http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "max-age") {
+			t.Errorf("/tts?%s: %s, Cache-Control %q on an error", query.Encode(), resp.Status, resp.Header.Get("Cache-Control"))
+		}
+	}
+}
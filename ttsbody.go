@@ -0,0 +1,74 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// maxTTSBody bounds a JSON /tts request body.
+const maxTTSBody = 64 << 10
+
+// ttsBodyAliases maps JSON body fields to the query parameters they stand for.
+var ttsBodyAliases = map[string]string{
+	"voice": "model",
+	"rate":  "speakingRate",
+}
+
+// withJSONBody lets POST /tts take its parameters as a JSON object instead of
+// the query string, e.g. {"text": "你好", "voice": "cmn-CN-Wavenet-A",
+// "rate": 0.8}, so long sentences and SSML needn't fit in a URL or end up in
+// proxy logs. Body fields override query parameters of the same name; "voice"
+// and "rate" stand for model and speakingRate.
+func withJSONBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+			http.Error(w, "Unsupported Content-Type: must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTTSBody)).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		for name, v := range body {
+			s, err := bodyParam(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s: %v", name, err), http.StatusBadRequest)
+				return
+			}
+			if alias, ok := ttsBodyAliases[name]; ok {
+				name = alias
+			}
+			query.Set(name, s)
+		}
+
+		r = r.Clone(r.Context())
+		r.URL.RawQuery = query.Encode()
+		if ew, ok := w.(*errorEnvelopeWriter); ok {
+			ew.query = query
+		}
+		next(w, r)
+	}
+}
+
+// bodyParam renders a JSON body value as the query parameter value it
+// replaces.
+func bodyParam(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("must be a string, number or boolean")
+}
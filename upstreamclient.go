@@ -0,0 +1,87 @@
+package wenbuntts
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// upstreamClient sends every outgoing request but webhooks (see
+// webhookClient): provider calls, Google token exchanges, the S3 and GCS
+// caches, Vault and AnkiConnect. It keeps up to
+// UPSTREAM_MAX_IDLE_CONNS_PER_HOST connections to each host open for
+// UPSTREAM_IDLE_CONN_TIMEOUT, so that a batch reuses them instead of
+// dialing and handshaking for every item, and speaks HTTP/2 where the server
+// does unless UPSTREAM_HTTP2 is false. UPSTREAM_DIAL_TIMEOUT,
+// UPSTREAM_TLS_TIMEOUT and UPSTREAM_RESPONSE_TIMEOUT bound connecting, the
+// TLS handshake and the wait for response headers; UPSTREAM_TIMEOUT still
+// bounds a whole provider call. Requests go through UPSTREAM_PROXY if set,
+// or else the proxy of HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+var upstreamClient = newUpstreamClient(upstreamClientSettings{
+	dialTimeout:         10 * time.Second,
+	tlsTimeout:          10 * time.Second,
+	idleConnTimeout:     90 * time.Second,
+	maxIdleConnsPerHost: 16,
+	http2:               true,
+})
+
+type upstreamClientSettings struct {
+	dialTimeout, tlsTimeout, responseTimeout, idleConnTimeout time.Duration
+
+	maxIdleConnsPerHost, maxConnsPerHost int
+
+	http2 bool
+	proxy *url.URL
+}
+
+func newUpstreamClient(s upstreamClientSettings) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if s.proxy != nil {
+		proxy = http.ProxyURL(s.proxy)
+	}
+	t := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   s.dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     s.http2,
+		MaxIdleConnsPerHost:   s.maxIdleConnsPerHost,
+		MaxConnsPerHost:       s.maxConnsPerHost,
+		IdleConnTimeout:       s.idleConnTimeout,
+		TLSHandshakeTimeout:   s.tlsTimeout,
+		ResponseHeaderTimeout: s.responseTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if !s.http2 {
+		// A non-nil, empty map turns off the transport's HTTP/2 upgrade.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: t}
+}
+
+// setupUpstreamClient replaces upstreamClient according to the UPSTREAM_*
+// settings.
+func setupUpstreamClient() error {
+	s := upstreamClientSettings{
+		dialTimeout:         envDuration("UPSTREAM_DIAL_TIMEOUT", 10*time.Second),
+		tlsTimeout:          envDuration("UPSTREAM_TLS_TIMEOUT", 10*time.Second),
+		responseTimeout:     envDuration("UPSTREAM_RESPONSE_TIMEOUT", 0),
+		idleConnTimeout:     envDuration("UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second),
+		maxIdleConnsPerHost: envInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 16),
+		maxConnsPerHost:     envInt("UPSTREAM_MAX_CONNS_PER_HOST", 0),
+		http2:               setting("UPSTREAM_HTTP2") != "false",
+	}
+	if v := setting("UPSTREAM_PROXY"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("Invalid UPSTREAM_PROXY: must be a URL such as http://proxy:3128")
+		}
+		s.proxy = u
+	}
+	upstreamClient = newUpstreamClient(s)
+	return nil
+}
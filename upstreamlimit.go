@@ -0,0 +1,41 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// upstreamSlots bounds concurrent provider calls to MAX_UPSTREAM_CONCURRENCY;
+// nil means unlimited. A call that can't get a slot within
+// upstreamQueueTimeout fails with errUpstreamBusy.
+var (
+	upstreamSlots        chan struct{}
+	upstreamQueueTimeout time.Duration
+)
+
+// upstreamWaiting counts calls queued for a slot, for /admin.
+var upstreamWaiting atomic.Int64
+
+var errUpstreamBusy = errors.New("Too many concurrent synthesis requests, try again later")
+
+// acquireUpstream waits for a free upstream slot. The returned function
+// releases it.
+func acquireUpstream(ctx context.Context) (release func(), err error) {
+	if upstreamSlots == nil {
+		return func() {}, nil
+	}
+	upstreamWaiting.Add(1)
+	defer upstreamWaiting.Add(-1)
+	timer := time.NewTimer(upstreamQueueTimeout)
+	defer timer.Stop()
+	select {
+	case upstreamSlots <- struct{}{}:
+		return func() { <-upstreamSlots }, nil
+	case <-timer.C:
+		return nil, errUpstreamBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
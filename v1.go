@@ -0,0 +1,118 @@
+package wenbuntts
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// openAPISpec describes the /v1 routes, served at /v1/openapi.json.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// apiError is the envelope /v1 routes answer errors with, in place of the
+// plain text the unversioned routes write.
+type apiError struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"` // the status, e.g. "bad_request"
+	Message   string `json:"message"`
+	Param     string `json:"param,omitempty"`
+	Rule      string `json:"rule,omitempty"` // the text validation rule broken, see validateText
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// errorParam finds the parameter named by the handlers' "Invalid model: ..."
+// and "Missing ?text= parameter" messages.
+var errorParam = regexp.MustCompile(`^(?:Invalid ([a-z][A-Za-z]*)\b|Missing \?([A-Za-z]+)=)`)
+
+// errorRule finds the rule validateText names.
+var errorRule = regexp.MustCompile(`\(rule ([a-z_]+)\)$`)
+
+// newAPIError describes an error response to a request with query q.
+func newAPIError(status int, msg, requestID string, q url.Values) apiError {
+	e := apiError{
+		Status:    status,
+		Code:      strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+		Message:   msg,
+		RequestID: requestID,
+	}
+	if e.Code == "" {
+		e.Code = "status_" + strconv.Itoa(status)
+	}
+	// "Invalid" also names things other than parameters, e.g. the body.
+	if m := errorParam.FindStringSubmatch(msg); m != nil && (m[2] != "" || q.Has(m[1])) {
+		e.Param = m[1] + m[2]
+	}
+	if m := errorRule.FindStringSubmatch(msg); m != nil {
+		e.Rule = m[1]
+	}
+	return e
+}
+
+// handleV1 serves the API under /v1/ with the same handlers as the
+// unversioned routes of mux, turning their plain-text errors into apiError
+// envelopes.
+func handleV1(mux http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorEnvelopeWriter{ResponseWriter: w, requestID: requestID(r.Context()), query: r.URL.Query()}
+		defer ew.finish()
+		path := strings.TrimPrefix(r.URL.Path, "/v1")
+		if strings.HasPrefix(path, "/v1/") {
+			http.NotFound(ew, r)
+			return
+		}
+		http.StripPrefix("/v1", mux).ServeHTTP(ew, r)
+	}
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// errorEnvelopeWriter holds back an error response written with http.Error
+// (a text/plain body with a 4xx or 5xx status) and sends it as an apiError
+// once the handler returns. Everything else passes straight through.
+type errorEnvelopeWriter struct {
+	http.ResponseWriter
+	requestID string
+	query     url.Values
+	status    int // set while holding back an error
+	msg       bytes.Buffer
+}
+
+func (w *errorEnvelopeWriter) WriteHeader(status int) {
+	if status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorEnvelopeWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.msg.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *errorEnvelopeWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func (w *errorEnvelopeWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	json.NewEncoder(w.ResponseWriter).Encode(struct {
+		Error apiError `json:"error"`
+	}{newAPIError(w.status, strings.TrimSpace(w.msg.String()), w.requestID, w.query)})
+}
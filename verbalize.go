@@ -0,0 +1,182 @@
+package wenbuntts
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// With VERBALIZE_NUMBERS=true, or ?numbers=read, the Arabic numerals of
+// Mandarin text are written out in characters before the text is validated
+// and keyed, since voices read raw digits inconsistently: dates (2024-03-15
+// → 二零二四年三月十五日), times (10:05 → 十点零五分), percentages, decimals,
+// metric units (5km → 五公里) and counts (2个 → 两个). A 4-digit year is read
+// digit by digit, or as a number with YEAR_READING=value or ?years=value
+// (2024年 → 两千零二十四年). Numbers with a leading zero or of more than 9
+// digits, such as phone numbers, are read digit by digit.
+var (
+	verbalizeNumbers bool
+	yearReading      = "digits"
+)
+
+// numberReadings are the ?numbers= values.
+var numberReadings = map[string]bool{"read": true, "keep": false}
+
+// parseYearReading validates a ?years= or YEAR_READING value.
+func parseYearReading(v string) (string, error) {
+	if v != "digits" && v != "value" {
+		return "", errors.New("must be digits or value")
+	}
+	return v, nil
+}
+
+var (
+	fullwidthDigits  = strings.NewReplacer("０", "0", "１", "1", "２", "2", "３", "3", "４", "4", "５", "5", "６", "6", "７", "7", "８", "8", "９", "9", "％", "%", "：", ":")
+	thousandsPattern = regexp.MustCompile(`\d{1,3}(?:,\d{3})+`)
+	datePattern      = regexp.MustCompile(`(\d{4})(?:[-/.]|年)(\d{1,2})(?:[-/.]|月)(\d{1,2})([日号]?)`)
+	yearPattern      = regexp.MustCompile(`(\d{4})年`)
+	timePattern      = regexp.MustCompile(`(\d{1,2}):(\d{2})`)
+	percentPattern   = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
+	unitPattern      = regexp.MustCompile(`(\d+(?:\.\d+)?) ?(?:(km|kg|cm|mm|mg|ml|m|g|l|L)\b|(℃|°C))`)
+	countPattern     = regexp.MustCompile(`(\d+)(` + measureWords + `)`)
+	numberPattern    = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// measureWords are the classifiers and units after which 2 reads 两.
+const measureWords = `个|位|只|本|张|条|件|次|天|年|岁|块|元|斤|杯|瓶|双|对|把|台|辆|家|口|种|点|分钟|小时|周|星期|月|层|节|片|份|碗|首|部|句|篇|页|遍|趟`
+
+var metricUnits = map[string]string{
+	"km": "公里", "m": "米", "cm": "厘米", "mm": "毫米",
+	"kg": "公斤", "g": "克", "mg": "毫克",
+	"l": "升", "L": "升", "ml": "毫升",
+	"℃": "摄氏度", "°C": "摄氏度",
+}
+
+const chineseDigits = "零一二三四五六七八九"
+
+// verbalizeText writes out the numbers of text, reading 4-digit years as
+// years says.
+func verbalizeText(text, years string) string {
+	text = fullwidthDigits.Replace(text)
+	text = thousandsPattern.ReplaceAllStringFunc(text, func(s string) string { return strings.ReplaceAll(s, ",", "") })
+	readYear := readDigits
+	if years == "value" {
+		readYear = readInteger
+	}
+	text = replaceSubmatches(datePattern, text, func(m []string) string {
+		day := m[4]
+		if day == "" {
+			day = "日"
+		}
+		return readYear(m[1]) + "年" + readInteger(trimZeros(m[2])) + "月" + readInteger(trimZeros(m[3])) + day
+	})
+	text = replaceSubmatches(yearPattern, text, func(m []string) string { return readYear(m[1]) + "年" })
+	text = replaceSubmatches(timePattern, text, func(m []string) string {
+		hour := readCount(trimZeros(m[1])) + "点"
+		switch {
+		case m[2] == "00":
+			return hour
+		case m[2][0] == '0':
+			return hour + "零" + readInteger(m[2][1:]) + "分"
+		}
+		return hour + readInteger(m[2]) + "分"
+	})
+	text = replaceSubmatches(percentPattern, text, func(m []string) string { return "百分之" + readNumber(m[1]) })
+	text = replaceSubmatches(unitPattern, text, func(m []string) string { return readNumber(m[1]) + metricUnits[m[2]+m[3]] })
+	text = replaceSubmatches(countPattern, text, func(m []string) string { return readCount(m[1]) + m[2] })
+	return numberPattern.ReplaceAllStringFunc(text, readNumber)
+}
+
+func replaceSubmatches(re *regexp.Regexp, s string, repl func([]string) string) string {
+	return re.ReplaceAllStringFunc(s, func(match string) string { return repl(re.FindStringSubmatch(match)) })
+}
+
+// trimZeros drops the leading zeros of a month, day or hour.
+func trimZeros(s string) string {
+	if t := strings.TrimLeft(s, "0"); t != "" {
+		return t
+	}
+	return "0"
+}
+
+// readNumber reads an integer or decimal.
+func readNumber(s string) string {
+	whole, frac, ok := strings.Cut(s, ".")
+	if !ok {
+		return readInteger(whole)
+	}
+	return readInteger(whole) + "点" + readDigits(frac)
+}
+
+// readCount reads an integer before a measure word, where 2 is 两.
+func readCount(s string) string {
+	if strings.TrimLeft(s, "0") == "2" {
+		return "两"
+	}
+	return readInteger(s)
+}
+
+// readDigits reads each digit of s.
+func readDigits(s string) string {
+	digits := []rune(chineseDigits)
+	var b strings.Builder
+	for _, c := range s {
+		b.WriteRune(digits[c-'0'])
+	}
+	return b.String()
+}
+
+// readInteger reads s as a number: 2024 is 两千零二十四, 100001 十万零一.
+func readInteger(s string) string {
+	if (len(s) > 1 && s[0] == '0') || len(s) > 9 {
+		return readDigits(s)
+	}
+	if s == "0" {
+		return "零"
+	}
+	digits := []rune(chineseDigits)
+	places := []string{"", "十", "百", "千"}
+	var b strings.Builder
+	zero := false // a zero since the last digit read
+	for len(s) > 0 {
+		n := (len(s)-1)%4 + 1
+		group := s[:n]
+		s = s[n:]
+		written := false
+		for i, c := range group {
+			place := n - 1 - i
+			if c == '0' {
+				zero = zero || b.Len() > 0
+				continue
+			}
+			if zero {
+				b.WriteString("零")
+				zero = false
+			}
+			switch {
+			case c == '2' && place == 3:
+				b.WriteString("两")
+			case c == '2' && group == "2" && len(s) > 0:
+				b.WriteString("两") // 两万, 两亿
+			default:
+				b.WriteRune(digits[c-'0'])
+			}
+			b.WriteString(places[place])
+			written = true
+		}
+		if written {
+			switch len(s) {
+			case 4:
+				b.WriteString("万")
+			case 8:
+				b.WriteString("亿")
+			}
+		}
+	}
+	// 10 to 19 are 十 to 十九, not 一十.
+	out := b.String()
+	if strings.HasPrefix(out, "一十") {
+		out = strings.TrimPrefix(out, "一")
+	}
+	return out
+}
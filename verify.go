@@ -0,0 +1,31 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+)
+
+// Each clip's SHA-256 is recorded in the index when it is generated (see
+// contentHash). With verifyOnServe, from VERIFY_ON_SERVE, a cached clip is
+// checked against it before it is served, so one the disk has corrupted is
+// regenerated rather than sent. The sweep checks it either way.
+var verifyOnServe bool
+
+var errChecksumMismatch = errors.New("cache entry does not match its checksum")
+
+// storedContentHash returns the checksum recorded for the clip under key, or
+// "" if there is none yet.
+func storedContentHash(ctx context.Context, key string) string {
+	var hash string
+	cacheIndex.QueryRowContext(ctx, `SELECT content_hash FROM entries WHERE key = ?`, key).Scan(&hash)
+	return hash
+}
+
+// verifyClip checks data, the clip stored under key, against its recorded
+// checksum. Clips without one pass.
+func verifyClip(ctx context.Context, key string, data []byte) error {
+	if stored := storedContentHash(ctx, key); stored != "" && stored != contentHash(data) {
+		return errChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkDefaultVoice verifies at startup that the default provider still
+// offers its default voice, so a deprecated voice is caught before the first
+// request. Problems are logged, or are fatal when strict is set.
+func checkDefaultVoice(ctx context.Context, strict bool) {
+	fail := func(msg string, args ...any) { slog.Warn(msg, args...) }
+	if strict {
+		fail = func(msg string, args ...any) {
+			slog.Error(msg, args...)
+			fatal(msg)
+		}
+	}
+
+	defaultName := defaultProvider.DefaultVoice()
+	language := languageFor(defaultName)
+	voices, err := defaultProvider.Voices(ctx, language)
+	if err != nil {
+		fail("Could not validate default voice", "voice", defaultName, "error", err)
+		return
+	}
+	if !slices.ContainsFunc(voices, func(v voiceInfo) bool { return v.Name == defaultName }) {
+		fail("Default voice is not offered; requests without ?model= will fail", "voice", defaultName, "language", language)
+		return
+	}
+	slog.Info("Default voice is available", "voice", defaultName)
+}
+
+// voiceListCache holds provider voice lists for voiceListTTL, so /voices
+// doesn't call the provider API on every page load.
+var (
+	voiceListTTL = time.Hour
+
+	voiceListMu    sync.Mutex
+	voiceListCache = map[string]cachedVoiceList{}
+)
+
+type cachedVoiceList struct {
+	voices  []voiceInfo
+	fetched time.Time
+}
+
+// listVoices returns p's voices for language, from the cache when fresh.
+func listVoices(ctx context.Context, p provider, language string) ([]voiceInfo, error) {
+	key := p.Name() + "/" + language
+
+	voiceListMu.Lock()
+	cached, ok := voiceListCache[key]
+	voiceListMu.Unlock()
+	if ok && time.Since(cached.fetched) < voiceListTTL {
+		return cached.voices, nil
+	}
+
+	voices, err := p.Voices(ctx, language)
+	if err != nil {
+		return nil, err
+	}
+	voiceListMu.Lock()
+	voiceListCache[key] = cachedVoiceList{voices, time.Now()}
+	voiceListMu.Unlock()
+	return voices, nil
+}
+
+// voiceEntry is a /voices result. Allowed reports whether the voice can be
+// requested with ?model=.
+type voiceEntry struct {
+	voiceInfo
+	Allowed bool `json:"allowed"`
+}
+
+// handleVoices lists the voices of ?provider= for ?language=, optionally
+// keeping only names containing ?q= (e.g. Chirp3-HD).
+func handleVoices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prov, ok := providerFor(query.Get("provider"))
+	if !ok {
+		http.Error(w, "Invalid provider: must be one of "+strings.Join(slices.Sorted(maps.Keys(providers)), ", "), http.StatusBadRequest)
+		return
+	}
+
+	voices, err := listVoices(r.Context(), prov, query.Get("language"))
+	if err != nil {
+		// The error may carry the API key in a URL, so it is only logged.
+		slog.Error("Failed to list voices", "provider", prov.Name(), "error", err)
+		http.Error(w, "Failed to list voices", http.StatusBadGateway)
+		return
+	}
+
+	allowed := prov.AllowedVoices()
+	entries := []voiceEntry{}
+	for _, v := range voices {
+		if q := query.Get("q"); q != "" && !strings.Contains(v.Name, q) {
+			continue
+		}
+		entries = append(entries, voiceEntry{v, slices.Contains(allowed, v.Name)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,48 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// retiredVoiceProvider is a mock whose voice list no longer has its default.
+type retiredVoiceProvider struct{ mockProvider }
+
+func (retiredVoiceProvider) Voices(ctx context.Context, language string) ([]voiceInfo, error) {
+	return []voiceInfo{{Name: "mock-successor", LanguageCodes: []string{"cmn-CN"}}}, nil
+}
+
+func TestCheckDefaultVoice(t *testing.T) {
+	var logs bytes.Buffer
+	var fatalMsg string
+	savedProvider, savedLogger, savedFatal := defaultProvider, slog.Default(), fatal
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	fatal = func(v ...any) { fatalMsg = fmt.Sprint(v...) }
+	t.Cleanup(func() {
+		defaultProvider, fatal = savedProvider, savedFatal
+		slog.SetDefault(savedLogger)
+	})
+
+	checkDefaultVoice(context.Background(), false)
+	if !strings.Contains(logs.String(), "Default voice is available") || fatalMsg != "" {
+		t.Errorf("offered default voice: %q, fatal %q", logs.String(), fatalMsg)
+	}
+
+	defaultProvider = retiredVoiceProvider{}
+	for _, strict := range []bool{false, true} {
+		logs.Reset()
+		fatalMsg = ""
+		checkDefaultVoice(context.Background(), strict)
+		level := map[bool]string{false: "level=WARN", true: "level=ERROR"}[strict]
+		if !strings.Contains(logs.String(), level) || !strings.Contains(logs.String(), "Default voice is not offered") || !strings.Contains(logs.String(), "voice="+mockVoice) {
+			t.Errorf("STRICT_STARTUP=%v logged %q, want %s naming %s", strict, logs.String(), level, mockVoice)
+		}
+		if stopped := fatalMsg != ""; stopped != strict {
+			t.Errorf("STRICT_STARTUP=%v: fatal %q", strict, fatalMsg)
+		}
+	}
+}
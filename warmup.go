@@ -0,0 +1,146 @@
+package wenbuntts
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmupConcurrency bounds how many warm-up texts are generated at once.
+var warmupConcurrency int
+
+// readWordList reads one text per line; in CSV input the first column is
+// the text. Blank lines and lines starting with # are skipped.
+func readWordList(r io.Reader) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.Comment = '#'
+	var texts []string
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return texts, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if text := strings.TrimSpace(record[0]); text != "" {
+			texts = append(texts, text)
+		}
+	}
+}
+
+// warmUp generates audio for every text not yet cached, with the default
+// provider and voice.
+func warmUp(ctx context.Context, texts []string) {
+	items := make([]batchItem, len(texts))
+	for i, text := range texts {
+		items[i] = batchItem{Text: text}
+	}
+	warmUpItems(ctx, items)
+}
+
+// warmUpItems generates audio for every item not yet cached, logging
+// progress every 10%.
+func warmUpItems(ctx context.Context, items []batchItem) {
+	start := time.Now()
+	var done, cached, failed atomic.Int64
+	step := max(int64(len(items))/10, 1)
+
+	work := make(chan batchItem)
+	var wg sync.WaitGroup
+	for range max(warmupConcurrency, 1) {
+		wg.Go(func() {
+			for item := range work {
+				result := batchGenerate(ctx, item)
+				switch {
+				case result.Error != "":
+					failed.Add(1)
+					slog.Warn("Warm-up failed", textAttr(item.Text), "error", logRedacted(result.Error, item.Text))
+				case result.Cached:
+					cached.Add(1)
+				}
+				if n := done.Add(1); n%step == 0 {
+					slog.Info("Warm-up progress", "done", n, "total", len(items))
+				}
+			}
+		})
+	}
+	slog.Info("Warm-up started", "total", len(items), "concurrency", warmupConcurrency)
+feed:
+	for _, item := range items {
+		select {
+		case work <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	slog.Info("Warm-up finished", "total", len(items), "done", done.Load(), "cached", cached.Load(),
+		"generated", done.Load()-cached.Load()-failed.Load(), "failed", failed.Load(), "duration", time.Since(start).Round(time.Second))
+}
+
+// warmUpFile warms the cache from the word list in path.
+func warmUpFile(ctx context.Context, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("Failed to open warm-up file", "error", err)
+		return
+	}
+	texts, err := readWordList(f)
+	f.Close()
+	if err != nil {
+		slog.Error("Failed to read warm-up file", "path", path, "error", err)
+		return
+	}
+	warmUp(ctx, texts)
+}
+
+// handleCacheWarmup warms the cache in the background from the word list in
+// the request body, see readWordList, or with ?top=n from the n most
+// requested items, see warmPopular.
+func handleCacheWarmup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid top: must be a positive number", http.StatusBadRequest)
+			return
+		}
+		go func() {
+			if err := warmPopular(shutdownCtx, n); err != nil {
+				slog.Error("Failed to read the most requested items", "error", err)
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Warm-up started, see the server log for progress\n"))
+		return
+	}
+	texts, err := readWordList(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		http.Error(w, "Invalid word list: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(texts) == 0 {
+		http.Error(w, "Empty word list", http.StatusBadRequest)
+		return
+	}
+	go warmUp(shutdownCtx, texts)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Warm-up started, see the server log for progress\n"))
+}
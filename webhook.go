@@ -0,0 +1,146 @@
+package wenbuntts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// A batch job started with ?callback= POSTs its outcome there when it
+// finishes, so that a client needn't poll /jobs/{id}. The body is signed
+// with webhookSecret: X-Webhook-Signature is "sha256=" and the hex
+// HMAC-SHA256 of X-Webhook-Timestamp, a dot and the body. Callbacks are
+// refused without a secret, and limited to webhookHosts when it is set.
+var (
+	webhookSecret []byte
+	webhookHosts  []string
+)
+
+// webhookClient delivers webhooks. It doesn't follow redirects, and won't
+// connect to loopback, private or link-local addresses unless webhookHosts
+// names the host, so a callback can't be used to reach the server's own
+// network.
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:           dialWebhook,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+var errInternalAddress = errors.New("callback resolves to an internal address")
+
+// dialWebhook dials addr for webhookClient. The address is checked after
+// resolving, so a public name pointing at an internal address is caught too.
+func dialWebhook(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	if host, _, err := net.SplitHostPort(addr); err != nil || !slices.Contains(webhookHosts, host) {
+		d.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := ap.Addr().Unmap(); ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return errInternalAddress
+			}
+			return nil
+		}
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+const (
+	webhookAttempts = 3
+	webhookTimeout  = 10 * time.Second
+)
+
+// jobOutcome is what a webhook receives: the job's status ("done", or
+// "failed" if it was cut short) and the manifest of its results in item
+// order.
+type jobOutcome struct {
+	ID      string         `json:"id"`
+	Status  string         `json:"status"`
+	Total   int            `json:"total"`
+	Failed  int            `json:"failed"`
+	Results []*batchResult `json:"results"`
+}
+
+// validCallback checks a ?callback= URL.
+func validCallback(callback string) error {
+	if len(webhookSecret) == 0 {
+		return fmt.Errorf("webhooks are not enabled")
+	}
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	if len(webhookHosts) > 0 && !slices.Contains(webhookHosts, u.Hostname()) {
+		return fmt.Errorf("host %s is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// webhookSignature signs body as sent at timestamp.
+func webhookSignature(timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, webhookSecret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook POSTs outcome to callback, retrying failed deliveries. It
+// runs past shutdown, which is what may have ended the job.
+func deliverWebhook(ctx context.Context, callback string, outcome jobOutcome) {
+	ctx = context.WithoutCancel(ctx)
+	body, _ := json.Marshal(outcome)
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(ctx, callback, body)
+		if err == nil {
+			logger(ctx).Info("Delivered job webhook", "job", outcome.ID, "status", outcome.Status)
+			return
+		}
+		if attempt >= webhookAttempts {
+			logger(ctx).Error("Failed to deliver job webhook", "job", outcome.ID, "attempts", attempt, "error", err)
+			return
+		}
+		time.Sleep(retryDelay(attempt))
+	}
+}
+
+func postWebhook(ctx context.Context, callback string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature(timestamp, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPostWebhookStaysOffInternalAddresses(t *testing.T) {
+	t.Cleanup(func() { webhookSecret, webhookHosts = nil, nil })
+	webhookSecret = []byte("secret")
+
+	received := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	// 127.0.0.1 is refused unless WEBHOOK_HOSTS names it.
+	if err := postWebhook(context.Background(), target.URL, []byte("{}")); !errors.Is(err, errInternalAddress) {
+		t.Errorf("loopback callback: %v, want errInternalAddress", err)
+	}
+	u, _ := url.Parse(target.URL)
+	webhookHosts = []string{u.Hostname()}
+	if err := postWebhook(context.Background(), target.URL, []byte("{}")); err != nil || received != 1 {
+		t.Errorf("allowed callback: %v, delivered %d times", err, received)
+	}
+
+	// Redirects aren't followed, even to an allowed host.
+	if err := postWebhook(context.Background(), redirect.URL, []byte("{}")); err == nil || received != 1 {
+		t.Errorf("redirecting callback: %v, delivered %d times", err, received)
+	}
+}
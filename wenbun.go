@@ -0,0 +1,118 @@
+package wenbuntts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// wenbunDeck is the part of a WenBun deck export the importer reads. Older
+// exports list entries as plain strings, newer ones as objects; the word is
+// taken from the first of the known field names that is set.
+type wenbunDeck struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Entries []json.RawMessage `json:"entries"`
+	Words   []json.RawMessage `json:"words"`
+	Cards   []json.RawMessage `json:"cards"`
+}
+
+var wenbunWordFields = []string{"hanzi", "simplified", "word", "text", "front"}
+
+// words returns the vocabulary of the deck, in order.
+func (d wenbunDeck) words() []string {
+	var words []string
+	for _, list := range [][]json.RawMessage{d.Entries, d.Words, d.Cards} {
+		for _, raw := range list {
+			var word string
+			if json.Unmarshal(raw, &word) != nil {
+				var entry map[string]any
+				json.Unmarshal(raw, &entry)
+				for _, field := range wenbunWordFields {
+					if s, ok := entry[field].(string); ok && strings.TrimSpace(s) != "" {
+						word = s
+						break
+					}
+				}
+			}
+			if word = strings.TrimSpace(word); word != "" {
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+// handleImportWenBun pre-generates audio for every word of a WenBun deck
+// export and returns a JSON object mapping each word to its /tts URL, plus
+// the words that could not be produced. Audio goes into the deck given by
+// ?deck=, or the export's id when it is a valid deck name; ?model=,
+// ?provider= and ?format= apply to every word.
+func handleImportWenBun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var deck wenbunDeck
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4<<20)).Decode(&deck); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	deckName := query.Get("deck")
+	if deckName == "" && isValidDeck(deck.ID) {
+		deckName = deck.ID
+	}
+	if deckName != "" && !isValidDeck(deckName) {
+		http.Error(w, "Invalid deck: must be 1-64 letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+	words := deck.words()
+	if len(words) == 0 {
+		http.Error(w, "Deck has no entries", http.StatusBadRequest)
+		return
+	}
+
+	body := tarRequest{Words: words, Model: query.Get("model"), Provider: query.Get("provider"), Format: query.Get("format")}
+	resolved, err := body.resolve(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := struct {
+		Deck    string            `json:"deck,omitempty"`
+		Audio   map[string]string `json:"audio"`
+		Missing []tarMissing      `json:"missing"`
+	}{Deck: deckName, Audio: map[string]string{}, Missing: []tarMissing{}}
+	for _, req := range resolved {
+		if req.key != "" {
+			req.deck = deckName
+			req.key = req.storageKey()
+		}
+		if err := ensureCached(r.Context(), req); err != nil {
+			result.Missing = append(result.Missing, tarMissing{req.text, err.Error()})
+			continue
+		}
+		params := url.Values{"text": {req.text}, "model": {req.model}}
+		if body.Provider != "" {
+			params.Set("provider", body.Provider)
+		}
+		if req.format != defaultFormat {
+			params.Set("format", req.format)
+		}
+		if deckName != "" {
+			params.Set("deck", deckName)
+		}
+		result.Audio[req.text] = "/tts?" + params.Encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(result)
+}
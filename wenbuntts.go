@@ -0,0 +1,137 @@
+// Package wenbuntts generates and caches text-to-speech audio for WenBun
+// decks. The server and command line tool are in Main; other Go programs can
+// import github.com/ray-pH/wenbun-tts-generator and embed the generator with
+// New:
+//
+//	g, err := wenbuntts.New(wenbuntts.Config{Settings: map[string]string{"OUTPUT_DIR": "./audio"}})
+//	if err != nil {
+//		return err
+//	}
+//	defer g.Close()
+//	mp3, err := g.Synthesize(ctx, "你好", wenbuntts.Options{})
+//
+// The generator is configured with the same settings as the server (see
+// .env.example) and shares its state with the package, so New may only be
+// called once per process, successfully or not.
+//
+// Providers, the cache and the HTTP handlers read the same package-level
+// settings, so they are one package split by file rather than separate
+// packages: main.go has setup and the commands, tts.go the /tts handler,
+// synthesize.go the provider calls and cache keys, and each provider and
+// cache backend its own file.
+//
+// The embedding API is deliberately limited to that: one Generator per
+// process, sharing its settings, cache and counters with anything else in
+// the package. Per-Generator state and separate provider, cache and server
+// packages would mean threading the settings through every file, and are
+// not part of it.
+package wenbuntts
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sync"
+)
+
+// Config configures New.
+type Config struct {
+	// Settings override the environment and the config file, by setting
+	// name, e.g. {"TTS_PROVIDER": "google", "GOOGLE_API_KEY": "AI..."}.
+	Settings map[string]string
+	// ConfigFile is a YAML or TOML config file, as for -config.
+	ConfigFile string
+}
+
+// Options are per-synthesis choices. Zero fields are the defaults.
+type Options struct {
+	Provider string // e.g. "google"
+	Voice    string // one of the provider's allowed voices
+	Format   string // mp3, opus, wav, mulaw or alaw
+	Tenant   string // cache namespace and budget, as from TENANT_KEYS; "" for the shared cache
+}
+
+// Generator synthesizes through the configured providers and cache.
+type Generator struct {
+	cleanup func()
+}
+
+var (
+	generatorMu  sync.Mutex
+	generatorNew bool
+)
+
+// setupError carries a fatal setup message out of setup to New.
+type setupError struct{ msg string }
+
+// New sets up providers, the cache and its index from cfg. Unlike the
+// commands, it doesn't read .env.
+func New(cfg Config) (g *Generator, err error) {
+	generatorMu.Lock()
+	defer generatorMu.Unlock()
+	// Setup fills package-level state that can't be undone, so even a failed
+	// New is the process's only one.
+	if generatorNew {
+		return nil, errors.New("wenbuntts: New was already called in this process")
+	}
+	generatorNew = true
+	// Settings from the host's environment stay fixed across reloads, as
+	// in Main.
+	processEnv = environNames()
+
+	var args []string
+	if cfg.ConfigFile != "" {
+		args = append(args, "-config", cfg.ConfigFile)
+	}
+	for name, value := range cfg.Settings {
+		args = append(args, "-set", name+"="+value)
+	}
+	fs := flag.NewFlagSet("wenbuntts", flag.ContinueOnError)
+
+	// Only setup's failures become errors; a fatal setting read later, e.g.
+	// by a reload, still exits like it does in the server.
+	exit, exitf := fatal, fatalf
+	fatal = func(v ...any) { panic(setupError{fmt.Sprint(v...)}) }
+	fatalf = func(format string, v ...any) { panic(setupError{fmt.Sprintf(format, v...)}) }
+	defer func() {
+		fatal, fatalf = exit, exitf
+		if r := recover(); r != nil {
+			se, ok := r.(setupError)
+			if !ok {
+				panic(r)
+			}
+			err = errors.New(se.msg)
+			if cacheIndex != nil {
+				cacheIndex.Close()
+			}
+		}
+	}()
+	cleanup := setup(fs, args)
+	return &Generator{cleanup: cleanup}, nil
+}
+
+// Synthesize returns the audio for text, from the cache or synthesized and
+// cached first.
+func (g *Generator) Synthesize(ctx context.Context, text string, opts Options) ([]byte, error) {
+	if opts.Tenant != "" && !isValidDeck(opts.Tenant) {
+		return nil, errInvalidTenant
+	}
+	ctx = withTenant(ctx, opts.Tenant)
+	req, result := batchRequest(ctx, batchItem{Text: text, Model: opts.Voice, Provider: opts.Provider, Format: opts.Format})
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+	if err := ensureCached(ctx, req); err != nil {
+		return nil, err
+	}
+	audio, _, err := cacheStore.Get(ctx, req.key)
+	return audio, err
+}
+
+// Close waits for background cache writes and closes the cache index.
+func (g *Generator) Close() error {
+	backgroundWork.Wait()
+	g.cleanup()
+	return nil
+}
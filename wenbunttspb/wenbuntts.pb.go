@@ -0,0 +1,853 @@
+// The gRPC API, served on GRPC_PORT. It offers the same operations as the
+// HTTP API, with the same API keys: send "authorization: Bearer <key>" or
+// "x-api-key: <key>" metadata. ListCache needs "authorization: Bearer
+// <ADMIN_TOKEN>".
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: wenbuntts.proto
+
+package wenbunttspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SynthesizeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Text  string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	// The default provider, its default voice and mp3 when empty.
+	Provider      string `protobuf:"bytes,2,opt,name=provider,proto3" json:"provider,omitempty"`
+	Model         string `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"`
+	Format        string `protobuf:"bytes,4,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SynthesizeRequest) Reset() {
+	*x = SynthesizeRequest{}
+	mi := &file_wenbuntts_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SynthesizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SynthesizeRequest) ProtoMessage() {}
+
+func (x *SynthesizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SynthesizeRequest.ProtoReflect.Descriptor instead.
+func (*SynthesizeRequest) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SynthesizeRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *SynthesizeRequest) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *SynthesizeRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *SynthesizeRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type SynthesizeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Empty in BatchSynthesize results unless include_audio is set.
+	Audio       []byte `protobuf:"bytes,1,opt,name=audio,proto3" json:"audio,omitempty"`
+	ContentType string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	CacheHit    bool   `protobuf:"varint,3,opt,name=cache_hit,json=cacheHit,proto3" json:"cache_hit,omitempty"`
+	Provider    string `protobuf:"bytes,4,opt,name=provider,proto3" json:"provider,omitempty"`
+	Model       string `protobuf:"bytes,5,opt,name=model,proto3" json:"model,omitempty"`
+	// The cache key, as in /audio/{key}.
+	Key           string `protobuf:"bytes,6,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SynthesizeResponse) Reset() {
+	*x = SynthesizeResponse{}
+	mi := &file_wenbuntts_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SynthesizeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SynthesizeResponse) ProtoMessage() {}
+
+func (x *SynthesizeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SynthesizeResponse.ProtoReflect.Descriptor instead.
+func (*SynthesizeResponse) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SynthesizeResponse) GetAudio() []byte {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+func (x *SynthesizeResponse) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *SynthesizeResponse) GetCacheHit() bool {
+	if x != nil {
+		return x.CacheHit
+	}
+	return false
+}
+
+func (x *SynthesizeResponse) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *SynthesizeResponse) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *SynthesizeResponse) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type BatchSynthesizeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*SynthesizeRequest   `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	IncludeAudio  bool                   `protobuf:"varint,2,opt,name=include_audio,json=includeAudio,proto3" json:"include_audio,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSynthesizeRequest) Reset() {
+	*x = BatchSynthesizeRequest{}
+	mi := &file_wenbuntts_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSynthesizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSynthesizeRequest) ProtoMessage() {}
+
+func (x *BatchSynthesizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSynthesizeRequest.ProtoReflect.Descriptor instead.
+func (*BatchSynthesizeRequest) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchSynthesizeRequest) GetItems() []*SynthesizeRequest {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *BatchSynthesizeRequest) GetIncludeAudio() bool {
+	if x != nil {
+		return x.IncludeAudio
+	}
+	return false
+}
+
+type BatchSynthesizeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Result        *SynthesizeResponse    `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSynthesizeResponse) Reset() {
+	*x = BatchSynthesizeResponse{}
+	mi := &file_wenbuntts_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSynthesizeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSynthesizeResponse) ProtoMessage() {}
+
+func (x *BatchSynthesizeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSynthesizeResponse.ProtoReflect.Descriptor instead.
+func (*BatchSynthesizeResponse) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchSynthesizeResponse) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *BatchSynthesizeResponse) GetResult() *SynthesizeResponse {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *BatchSynthesizeResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ListVoicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Provider      string                 `protobuf:"bytes,1,opt,name=provider,proto3" json:"provider,omitempty"`
+	Language      string                 `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVoicesRequest) Reset() {
+	*x = ListVoicesRequest{}
+	mi := &file_wenbuntts_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVoicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVoicesRequest) ProtoMessage() {}
+
+func (x *ListVoicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVoicesRequest.ProtoReflect.Descriptor instead.
+func (*ListVoicesRequest) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListVoicesRequest) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *ListVoicesRequest) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+type Voice struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	Name                   string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	LanguageCodes          []string               `protobuf:"bytes,2,rep,name=language_codes,json=languageCodes,proto3" json:"language_codes,omitempty"`
+	Gender                 string                 `protobuf:"bytes,3,opt,name=gender,proto3" json:"gender,omitempty"`
+	NaturalSampleRateHertz int32                  `protobuf:"varint,4,opt,name=natural_sample_rate_hertz,json=naturalSampleRateHertz,proto3" json:"natural_sample_rate_hertz,omitempty"`
+	// Whether the voice can be requested as model.
+	Allowed       bool `protobuf:"varint,5,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Voice) Reset() {
+	*x = Voice{}
+	mi := &file_wenbuntts_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Voice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Voice) ProtoMessage() {}
+
+func (x *Voice) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Voice.ProtoReflect.Descriptor instead.
+func (*Voice) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Voice) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Voice) GetLanguageCodes() []string {
+	if x != nil {
+		return x.LanguageCodes
+	}
+	return nil
+}
+
+func (x *Voice) GetGender() string {
+	if x != nil {
+		return x.Gender
+	}
+	return ""
+}
+
+func (x *Voice) GetNaturalSampleRateHertz() int32 {
+	if x != nil {
+		return x.NaturalSampleRateHertz
+	}
+	return 0
+}
+
+func (x *Voice) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+type ListVoicesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Voices        []*Voice               `protobuf:"bytes,1,rep,name=voices,proto3" json:"voices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVoicesResponse) Reset() {
+	*x = ListVoicesResponse{}
+	mi := &file_wenbuntts_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVoicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVoicesResponse) ProtoMessage() {}
+
+func (x *ListVoicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVoicesResponse.ProtoReflect.Descriptor instead.
+func (*ListVoicesResponse) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListVoicesResponse) GetVoices() []*Voice {
+	if x != nil {
+		return x.Voices
+	}
+	return nil
+}
+
+type ListCacheRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Deck  string                 `protobuf:"bytes,1,opt,name=deck,proto3" json:"deck,omitempty"`
+	Voice string                 `protobuf:"bytes,2,opt,name=voice,proto3" json:"voice,omitempty"`
+	// Of the text.
+	Prefix string `protobuf:"bytes,3,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// 1000 when 0, at most 10000.
+	Limit         int32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCacheRequest) Reset() {
+	*x = ListCacheRequest{}
+	mi := &file_wenbuntts_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCacheRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCacheRequest) ProtoMessage() {}
+
+func (x *ListCacheRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCacheRequest.ProtoReflect.Descriptor instead.
+func (*ListCacheRequest) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListCacheRequest) GetDeck() string {
+	if x != nil {
+		return x.Deck
+	}
+	return ""
+}
+
+func (x *ListCacheRequest) GetVoice() string {
+	if x != nil {
+		return x.Voice
+	}
+	return ""
+}
+
+func (x *ListCacheRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ListCacheRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type CacheEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Deck          string                 `protobuf:"bytes,2,opt,name=deck,proto3" json:"deck,omitempty"`
+	Text          string                 `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	Voice         string                 `protobuf:"bytes,4,opt,name=voice,proto3" json:"voice,omitempty"`
+	Provider      string                 `protobuf:"bytes,5,opt,name=provider,proto3" json:"provider,omitempty"`
+	Encoding      string                 `protobuf:"bytes,6,opt,name=encoding,proto3" json:"encoding,omitempty"`
+	Size          int64                  `protobuf:"varint,7,opt,name=size,proto3" json:"size,omitempty"`
+	Created       *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created,proto3" json:"created,omitempty"`
+	Hits          int64                  `protobuf:"varint,9,opt,name=hits,proto3" json:"hits,omitempty"`
+	LastAccess    *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=last_access,json=lastAccess,proto3" json:"last_access,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,11,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheEntry) Reset() {
+	*x = CacheEntry{}
+	mi := &file_wenbuntts_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheEntry) ProtoMessage() {}
+
+func (x *CacheEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheEntry.ProtoReflect.Descriptor instead.
+func (*CacheEntry) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CacheEntry) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *CacheEntry) GetDeck() string {
+	if x != nil {
+		return x.Deck
+	}
+	return ""
+}
+
+func (x *CacheEntry) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *CacheEntry) GetVoice() string {
+	if x != nil {
+		return x.Voice
+	}
+	return ""
+}
+
+func (x *CacheEntry) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *CacheEntry) GetEncoding() string {
+	if x != nil {
+		return x.Encoding
+	}
+	return ""
+}
+
+func (x *CacheEntry) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *CacheEntry) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *CacheEntry) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *CacheEntry) GetLastAccess() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastAccess
+	}
+	return nil
+}
+
+func (x *CacheEntry) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+type ListCacheResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*CacheEntry          `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	Truncated     bool                   `protobuf:"varint,2,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCacheResponse) Reset() {
+	*x = ListCacheResponse{}
+	mi := &file_wenbuntts_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCacheResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCacheResponse) ProtoMessage() {}
+
+func (x *ListCacheResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wenbuntts_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCacheResponse.ProtoReflect.Descriptor instead.
+func (*ListCacheResponse) Descriptor() ([]byte, []int) {
+	return file_wenbuntts_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListCacheResponse) GetEntries() []*CacheEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *ListCacheResponse) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+var File_wenbuntts_proto protoreflect.FileDescriptor
+
+const file_wenbuntts_proto_rawDesc = "" +
+	"\n" +
+	"\x0fwenbuntts.proto\x12\fwenbuntts.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"q\n" +
+	"\x11SynthesizeRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1a\n" +
+	"\bprovider\x18\x02 \x01(\tR\bprovider\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\x12\x16\n" +
+	"\x06format\x18\x04 \x01(\tR\x06format\"\xae\x01\n" +
+	"\x12SynthesizeResponse\x12\x14\n" +
+	"\x05audio\x18\x01 \x01(\fR\x05audio\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\x1b\n" +
+	"\tcache_hit\x18\x03 \x01(\bR\bcacheHit\x12\x1a\n" +
+	"\bprovider\x18\x04 \x01(\tR\bprovider\x12\x14\n" +
+	"\x05model\x18\x05 \x01(\tR\x05model\x12\x10\n" +
+	"\x03key\x18\x06 \x01(\tR\x03key\"t\n" +
+	"\x16BatchSynthesizeRequest\x125\n" +
+	"\x05items\x18\x01 \x03(\v2\x1f.wenbuntts.v1.SynthesizeRequestR\x05items\x12#\n" +
+	"\rinclude_audio\x18\x02 \x01(\bR\fincludeAudio\"\x7f\n" +
+	"\x17BatchSynthesizeResponse\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x128\n" +
+	"\x06result\x18\x02 \x01(\v2 .wenbuntts.v1.SynthesizeResponseR\x06result\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"K\n" +
+	"\x11ListVoicesRequest\x12\x1a\n" +
+	"\bprovider\x18\x01 \x01(\tR\bprovider\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\"\xaf\x01\n" +
+	"\x05Voice\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12%\n" +
+	"\x0elanguage_codes\x18\x02 \x03(\tR\rlanguageCodes\x12\x16\n" +
+	"\x06gender\x18\x03 \x01(\tR\x06gender\x129\n" +
+	"\x19natural_sample_rate_hertz\x18\x04 \x01(\x05R\x16naturalSampleRateHertz\x12\x18\n" +
+	"\aallowed\x18\x05 \x01(\bR\aallowed\"A\n" +
+	"\x12ListVoicesResponse\x12+\n" +
+	"\x06voices\x18\x01 \x03(\v2\x13.wenbuntts.v1.VoiceR\x06voices\"j\n" +
+	"\x10ListCacheRequest\x12\x12\n" +
+	"\x04deck\x18\x01 \x01(\tR\x04deck\x12\x14\n" +
+	"\x05voice\x18\x02 \x01(\tR\x05voice\x12\x16\n" +
+	"\x06prefix\x18\x03 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05limit\x18\x04 \x01(\x05R\x05limit\"\xd0\x02\n" +
+	"\n" +
+	"CacheEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
+	"\x04deck\x18\x02 \x01(\tR\x04deck\x12\x12\n" +
+	"\x04text\x18\x03 \x01(\tR\x04text\x12\x14\n" +
+	"\x05voice\x18\x04 \x01(\tR\x05voice\x12\x1a\n" +
+	"\bprovider\x18\x05 \x01(\tR\bprovider\x12\x1a\n" +
+	"\bencoding\x18\x06 \x01(\tR\bencoding\x12\x12\n" +
+	"\x04size\x18\a \x01(\x03R\x04size\x124\n" +
+	"\acreated\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x12\x12\n" +
+	"\x04hits\x18\t \x01(\x03R\x04hits\x12;\n" +
+	"\vlast_access\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"lastAccess\x12\x1f\n" +
+	"\vduration_ms\x18\v \x01(\x03R\n" +
+	"durationMs\"e\n" +
+	"\x11ListCacheResponse\x122\n" +
+	"\aentries\x18\x01 \x03(\v2\x18.wenbuntts.v1.CacheEntryR\aentries\x12\x1c\n" +
+	"\ttruncated\x18\x02 \x01(\bR\ttruncated2\xd7\x02\n" +
+	"\x03TTS\x12O\n" +
+	"\n" +
+	"Synthesize\x12\x1f.wenbuntts.v1.SynthesizeRequest\x1a .wenbuntts.v1.SynthesizeResponse\x12`\n" +
+	"\x0fBatchSynthesize\x12$.wenbuntts.v1.BatchSynthesizeRequest\x1a%.wenbuntts.v1.BatchSynthesizeResponse0\x01\x12O\n" +
+	"\n" +
+	"ListVoices\x12\x1f.wenbuntts.v1.ListVoicesRequest\x1a .wenbuntts.v1.ListVoicesResponse\x12L\n" +
+	"\tListCache\x12\x1e.wenbuntts.v1.ListCacheRequest\x1a\x1f.wenbuntts.v1.ListCacheResponseB4Z2github.com/ray-pH/wenbun-tts-generator/wenbunttspbb\x06proto3"
+
+var (
+	file_wenbuntts_proto_rawDescOnce sync.Once
+	file_wenbuntts_proto_rawDescData []byte
+)
+
+func file_wenbuntts_proto_rawDescGZIP() []byte {
+	file_wenbuntts_proto_rawDescOnce.Do(func() {
+		file_wenbuntts_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_wenbuntts_proto_rawDesc), len(file_wenbuntts_proto_rawDesc)))
+	})
+	return file_wenbuntts_proto_rawDescData
+}
+
+var file_wenbuntts_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_wenbuntts_proto_goTypes = []any{
+	(*SynthesizeRequest)(nil),       // 0: wenbuntts.v1.SynthesizeRequest
+	(*SynthesizeResponse)(nil),      // 1: wenbuntts.v1.SynthesizeResponse
+	(*BatchSynthesizeRequest)(nil),  // 2: wenbuntts.v1.BatchSynthesizeRequest
+	(*BatchSynthesizeResponse)(nil), // 3: wenbuntts.v1.BatchSynthesizeResponse
+	(*ListVoicesRequest)(nil),       // 4: wenbuntts.v1.ListVoicesRequest
+	(*Voice)(nil),                   // 5: wenbuntts.v1.Voice
+	(*ListVoicesResponse)(nil),      // 6: wenbuntts.v1.ListVoicesResponse
+	(*ListCacheRequest)(nil),        // 7: wenbuntts.v1.ListCacheRequest
+	(*CacheEntry)(nil),              // 8: wenbuntts.v1.CacheEntry
+	(*ListCacheResponse)(nil),       // 9: wenbuntts.v1.ListCacheResponse
+	(*timestamppb.Timestamp)(nil),   // 10: google.protobuf.Timestamp
+}
+var file_wenbuntts_proto_depIdxs = []int32{
+	0,  // 0: wenbuntts.v1.BatchSynthesizeRequest.items:type_name -> wenbuntts.v1.SynthesizeRequest
+	1,  // 1: wenbuntts.v1.BatchSynthesizeResponse.result:type_name -> wenbuntts.v1.SynthesizeResponse
+	5,  // 2: wenbuntts.v1.ListVoicesResponse.voices:type_name -> wenbuntts.v1.Voice
+	10, // 3: wenbuntts.v1.CacheEntry.created:type_name -> google.protobuf.Timestamp
+	10, // 4: wenbuntts.v1.CacheEntry.last_access:type_name -> google.protobuf.Timestamp
+	8,  // 5: wenbuntts.v1.ListCacheResponse.entries:type_name -> wenbuntts.v1.CacheEntry
+	0,  // 6: wenbuntts.v1.TTS.Synthesize:input_type -> wenbuntts.v1.SynthesizeRequest
+	2,  // 7: wenbuntts.v1.TTS.BatchSynthesize:input_type -> wenbuntts.v1.BatchSynthesizeRequest
+	4,  // 8: wenbuntts.v1.TTS.ListVoices:input_type -> wenbuntts.v1.ListVoicesRequest
+	7,  // 9: wenbuntts.v1.TTS.ListCache:input_type -> wenbuntts.v1.ListCacheRequest
+	1,  // 10: wenbuntts.v1.TTS.Synthesize:output_type -> wenbuntts.v1.SynthesizeResponse
+	3,  // 11: wenbuntts.v1.TTS.BatchSynthesize:output_type -> wenbuntts.v1.BatchSynthesizeResponse
+	6,  // 12: wenbuntts.v1.TTS.ListVoices:output_type -> wenbuntts.v1.ListVoicesResponse
+	9,  // 13: wenbuntts.v1.TTS.ListCache:output_type -> wenbuntts.v1.ListCacheResponse
+	10, // [10:14] is the sub-list for method output_type
+	6,  // [6:10] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_wenbuntts_proto_init() }
+func file_wenbuntts_proto_init() {
+	if File_wenbuntts_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_wenbuntts_proto_rawDesc), len(file_wenbuntts_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_wenbuntts_proto_goTypes,
+		DependencyIndexes: file_wenbuntts_proto_depIdxs,
+		MessageInfos:      file_wenbuntts_proto_msgTypes,
+	}.Build()
+	File_wenbuntts_proto = out.File
+	file_wenbuntts_proto_goTypes = nil
+	file_wenbuntts_proto_depIdxs = nil
+}
@@ -0,0 +1,258 @@
+// The gRPC API, served on GRPC_PORT. It offers the same operations as the
+// HTTP API, with the same API keys: send "authorization: Bearer <key>" or
+// "x-api-key: <key>" metadata. ListCache needs "authorization: Bearer
+// <ADMIN_TOKEN>".
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: wenbuntts.proto
+
+package wenbunttspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TTS_Synthesize_FullMethodName      = "/wenbuntts.v1.TTS/Synthesize"
+	TTS_BatchSynthesize_FullMethodName = "/wenbuntts.v1.TTS/BatchSynthesize"
+	TTS_ListVoices_FullMethodName      = "/wenbuntts.v1.TTS/ListVoices"
+	TTS_ListCache_FullMethodName       = "/wenbuntts.v1.TTS/ListCache"
+)
+
+// TTSClient is the client API for TTS service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TTSClient interface {
+	// Synthesize returns the audio for one text, from the cache or
+	// synthesized and cached first.
+	Synthesize(ctx context.Context, in *SynthesizeRequest, opts ...grpc.CallOption) (*SynthesizeResponse, error)
+	// BatchSynthesize generates (or reuses) up to 1000 clips and streams a
+	// result as each one is ready, in order. Items that fail carry an error
+	// instead of ending the stream.
+	BatchSynthesize(ctx context.Context, in *BatchSynthesizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchSynthesizeResponse], error)
+	// ListVoices lists a provider's voices, as GET /voices.
+	ListVoices(ctx context.Context, in *ListVoicesRequest, opts ...grpc.CallOption) (*ListVoicesResponse, error)
+	// ListCache lists cache entries, least recently used first, as GET /cache.
+	ListCache(ctx context.Context, in *ListCacheRequest, opts ...grpc.CallOption) (*ListCacheResponse, error)
+}
+
+type tTSClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTTSClient(cc grpc.ClientConnInterface) TTSClient {
+	return &tTSClient{cc}
+}
+
+func (c *tTSClient) Synthesize(ctx context.Context, in *SynthesizeRequest, opts ...grpc.CallOption) (*SynthesizeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SynthesizeResponse)
+	err := c.cc.Invoke(ctx, TTS_Synthesize_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tTSClient) BatchSynthesize(ctx context.Context, in *BatchSynthesizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchSynthesizeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TTS_ServiceDesc.Streams[0], TTS_BatchSynthesize_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchSynthesizeRequest, BatchSynthesizeResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TTS_BatchSynthesizeClient = grpc.ServerStreamingClient[BatchSynthesizeResponse]
+
+func (c *tTSClient) ListVoices(ctx context.Context, in *ListVoicesRequest, opts ...grpc.CallOption) (*ListVoicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVoicesResponse)
+	err := c.cc.Invoke(ctx, TTS_ListVoices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tTSClient) ListCache(ctx context.Context, in *ListCacheRequest, opts ...grpc.CallOption) (*ListCacheResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListCacheResponse)
+	err := c.cc.Invoke(ctx, TTS_ListCache_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TTSServer is the server API for TTS service.
+// All implementations must embed UnimplementedTTSServer
+// for forward compatibility.
+type TTSServer interface {
+	// Synthesize returns the audio for one text, from the cache or
+	// synthesized and cached first.
+	Synthesize(context.Context, *SynthesizeRequest) (*SynthesizeResponse, error)
+	// BatchSynthesize generates (or reuses) up to 1000 clips and streams a
+	// result as each one is ready, in order. Items that fail carry an error
+	// instead of ending the stream.
+	BatchSynthesize(*BatchSynthesizeRequest, grpc.ServerStreamingServer[BatchSynthesizeResponse]) error
+	// ListVoices lists a provider's voices, as GET /voices.
+	ListVoices(context.Context, *ListVoicesRequest) (*ListVoicesResponse, error)
+	// ListCache lists cache entries, least recently used first, as GET /cache.
+	ListCache(context.Context, *ListCacheRequest) (*ListCacheResponse, error)
+	mustEmbedUnimplementedTTSServer()
+}
+
+// UnimplementedTTSServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTTSServer struct{}
+
+func (UnimplementedTTSServer) Synthesize(context.Context, *SynthesizeRequest) (*SynthesizeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Synthesize not implemented")
+}
+func (UnimplementedTTSServer) BatchSynthesize(*BatchSynthesizeRequest, grpc.ServerStreamingServer[BatchSynthesizeResponse]) error {
+	return status.Error(codes.Unimplemented, "method BatchSynthesize not implemented")
+}
+func (UnimplementedTTSServer) ListVoices(context.Context, *ListVoicesRequest) (*ListVoicesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListVoices not implemented")
+}
+func (UnimplementedTTSServer) ListCache(context.Context, *ListCacheRequest) (*ListCacheResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListCache not implemented")
+}
+func (UnimplementedTTSServer) mustEmbedUnimplementedTTSServer() {}
+func (UnimplementedTTSServer) testEmbeddedByValue()             {}
+
+// UnsafeTTSServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TTSServer will
+// result in compilation errors.
+type UnsafeTTSServer interface {
+	mustEmbedUnimplementedTTSServer()
+}
+
+func RegisterTTSServer(s grpc.ServiceRegistrar, srv TTSServer) {
+	// If the following call panics, it indicates UnimplementedTTSServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TTS_ServiceDesc, srv)
+}
+
+func _TTS_Synthesize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SynthesizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TTSServer).Synthesize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TTS_Synthesize_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TTSServer).Synthesize(ctx, req.(*SynthesizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TTS_BatchSynthesize_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BatchSynthesizeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TTSServer).BatchSynthesize(m, &grpc.GenericServerStream[BatchSynthesizeRequest, BatchSynthesizeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TTS_BatchSynthesizeServer = grpc.ServerStreamingServer[BatchSynthesizeResponse]
+
+func _TTS_ListVoices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVoicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TTSServer).ListVoices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TTS_ListVoices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TTSServer).ListVoices(ctx, req.(*ListVoicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TTS_ListCache_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCacheRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TTSServer).ListCache(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TTS_ListCache_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TTSServer).ListCache(ctx, req.(*ListCacheRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TTS_ServiceDesc is the grpc.ServiceDesc for TTS service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TTS_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wenbuntts.v1.TTS",
+	HandlerType: (*TTSServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Synthesize",
+			Handler:    _TTS_Synthesize_Handler,
+		},
+		{
+			MethodName: "ListVoices",
+			Handler:    _TTS_ListVoices_Handler,
+		},
+		{
+			MethodName: "ListCache",
+			Handler:    _TTS_ListCache_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BatchSynthesize",
+			Handler:       _TTS_BatchSynthesize_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "wenbuntts.proto",
+}
@@ -0,0 +1,108 @@
+package wenbuntts
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Readings in ?pinyin=, ?zhuyin= and HETERONYM_OVERRIDES may be written in
+// zhuyin (bopomofo), as Taiwanese learners are taught, e.g. "行=ㄒㄧㄥˊ" or
+// "銀行=ㄧㄣˊ ㄏㄤˊ". They become the same numbered pinyin syllables as a
+// pinyin reading. Syllables are separated by spaces or follow a tone mark;
+// one without a mark is in the first tone, and ˙ marks the neutral tone.
+
+var zhuyinInitials = map[rune]string{
+	'ㄅ': "b", 'ㄆ': "p", 'ㄇ': "m", 'ㄈ': "f",
+	'ㄉ': "d", 'ㄊ': "t", 'ㄋ': "n", 'ㄌ': "l",
+	'ㄍ': "g", 'ㄎ': "k", 'ㄏ': "h",
+	'ㄐ': "j", 'ㄑ': "q", 'ㄒ': "x",
+	'ㄓ': "zh", 'ㄔ': "ch", 'ㄕ': "sh", 'ㄖ': "r",
+	'ㄗ': "z", 'ㄘ': "c", 'ㄙ': "s",
+}
+
+// zhuyinFinals are the pinyin of each final on its own and after an
+// initial, with v for ü.
+var zhuyinFinals = map[string][2]string{
+	"ㄚ": {"a", "a"}, "ㄛ": {"o", "o"}, "ㄜ": {"e", "e"}, "ㄝ": {"e", "e"},
+	"ㄞ": {"ai", "ai"}, "ㄟ": {"ei", "ei"}, "ㄠ": {"ao", "ao"}, "ㄡ": {"ou", "ou"},
+	"ㄢ": {"an", "an"}, "ㄣ": {"en", "en"}, "ㄤ": {"ang", "ang"}, "ㄥ": {"eng", "eng"},
+	"ㄦ": {"er", "er"},
+
+	"ㄧ": {"yi", "i"}, "ㄧㄚ": {"ya", "ia"}, "ㄧㄛ": {"yo", "io"}, "ㄧㄝ": {"ye", "ie"},
+	"ㄧㄞ": {"yai", "iai"}, "ㄧㄠ": {"yao", "iao"}, "ㄧㄡ": {"you", "iu"}, "ㄧㄢ": {"yan", "ian"},
+	"ㄧㄣ": {"yin", "in"}, "ㄧㄤ": {"yang", "iang"}, "ㄧㄥ": {"ying", "ing"},
+
+	"ㄨ": {"wu", "u"}, "ㄨㄚ": {"wa", "ua"}, "ㄨㄛ": {"wo", "uo"}, "ㄨㄞ": {"wai", "uai"},
+	"ㄨㄟ": {"wei", "ui"}, "ㄨㄢ": {"wan", "uan"}, "ㄨㄣ": {"wen", "un"}, "ㄨㄤ": {"wang", "uang"},
+	"ㄨㄥ": {"weng", "ong"},
+
+	"ㄩ": {"yu", "v"}, "ㄩㄝ": {"yue", "ve"}, "ㄩㄢ": {"yuan", "van"}, "ㄩㄣ": {"yun", "vn"},
+	"ㄩㄥ": {"yong", "iong"},
+}
+
+var zhuyinTones = map[rune]byte{'ˉ': '1', 'ˊ': '2', 'ˇ': '3', 'ˋ': '4', '˙': '5'}
+
+// isZhuyin reports whether a reading is written in zhuyin.
+func isZhuyin(reading string) bool {
+	return strings.ContainsFunc(reading, func(c rune) bool { return unicode.Is(unicode.Bopomofo, c) })
+}
+
+// zhuyinSyllables splits a zhuyin reading into syllables, at spaces and
+// after tone marks other than a leading ˙.
+func zhuyinSyllables(reading string) []string {
+	var syllables []string
+	for _, field := range strings.Fields(reading) {
+		start := 0
+		for i, c := range field {
+			if _, ok := zhuyinTones[c]; ok && c != '˙' {
+				syllables = append(syllables, field[start:i+len(string(c))])
+				start = i + len(string(c))
+			}
+		}
+		if start < len(field) {
+			syllables = append(syllables, field[start:])
+		}
+	}
+	return syllables
+}
+
+// zhuyinToPinyin converts one zhuyin syllable, such as ㄒㄧㄥˊ, to numbered
+// pinyin: xing2.
+func zhuyinToPinyin(syllable string) (string, error) {
+	tone := byte('1')
+	var body []rune
+	for _, c := range syllable {
+		if t, ok := zhuyinTones[c]; ok {
+			tone = t
+			continue
+		}
+		body = append(body, c)
+	}
+	if len(body) == 0 {
+		return "", fmt.Errorf("%q is not a zhuyin syllable", syllable)
+	}
+	initial, hasInitial := zhuyinInitials[body[0]]
+	if hasInitial {
+		body = body[1:]
+	}
+	if len(body) == 0 {
+		switch initial {
+		case "zh", "ch", "sh", "r", "z", "c", "s":
+			return initial + "i" + string(tone), nil
+		}
+		return "", fmt.Errorf("%q is not a zhuyin syllable", syllable)
+	}
+	final, ok := zhuyinFinals[string(body)]
+	if !ok {
+		return "", fmt.Errorf("%q is not a zhuyin syllable", syllable)
+	}
+	if !hasInitial {
+		return final[0] + string(tone), nil
+	}
+	rest := final[1]
+	if initial == "j" || initial == "q" || initial == "x" {
+		rest = strings.Replace(rest, "v", "u", 1)
+	}
+	return initial + rest + string(tone), nil
+}
@@ -0,0 +1,161 @@
+package wenbuntts
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+)
+
+// zipRequest is a tarRequest, or the ID of a batch job whose results to
+// bundle instead.
+type zipRequest struct {
+	tarRequest
+	Job string `json:"job"`
+}
+
+// zipManifest is the manifest.json member of a ZIP bundle: the member name
+// of each text's clip (its first, for a job with the text in several
+// voices), and the texts that could not be produced.
+type zipManifest struct {
+	Files   map[string]string `json:"files"`
+	Missing []tarMissing      `json:"missing"`
+}
+
+// handleCacheZip returns a ZIP of the audio for the requested words, or for
+// a finished batch job's items, generating words that are not cached yet.
+// Like /cache/tar the archive is streamed, and manifest.json comes last.
+func handleCacheZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body zipRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var words []ttsRequest
+	manifest := zipManifest{Files: map[string]string{}, Missing: []tarMissing{}}
+	if body.Job != "" {
+		batchJobsMu.Lock()
+		job, ok := batchJobs[body.Job]
+		batchJobsMu.Unlock()
+		if !ok {
+			http.Error(w, "Unknown or expired job", http.StatusNotFound)
+			return
+		}
+		job.mu.Lock()
+		finished, results := !job.finished.IsZero(), job.results
+		job.mu.Unlock()
+		if !finished {
+			http.Error(w, "Job is still running", http.StatusConflict)
+			return
+		}
+		for _, result := range results {
+			if result.Error != "" {
+				manifest.Missing = append(manifest.Missing, tarMissing{result.Text, result.Error})
+				continue
+			}
+			words = append(words, ttsRequest{text: result.Text, key: result.File})
+		}
+	} else {
+		var err error
+		if words, err = body.resolve(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="audio.zip"`)
+	zw := zip.NewWriter(w)
+
+	used := map[string]bool{}
+	for _, req := range words {
+		// Only resolved words carry a provider; a job's entries were
+		// generated already, but may have been evicted since.
+		var err error
+		if req.provider != nil {
+			err = ensureCached(r.Context(), req)
+		} else {
+			_, err = statCached(r.Context(), req.key)
+		}
+		if err != nil {
+			manifest.Missing = append(manifest.Missing, tarMissing{req.text, err.Error()})
+			continue
+		}
+		name := sanitizeFilename(req.text) + path.Ext(req.key)
+		if used[name] {
+			// The same text in another voice or format.
+			name = sanitizeFilename(req.text) + "." + shortHash(req.key) + path.Ext(req.key)
+		}
+		if err := writeZipFile(r.Context(), zw, name, req.key); err != nil {
+			// The archive is corrupt past this point; abort the stream.
+			slog.Error("Failed to write zip entry", "key", logPath(req.key), "error", logRedacted(err.Error(), req.text))
+			return
+		}
+		used[name] = true
+		if _, ok := manifest.Files[req.text]; !ok {
+			manifest.Files[req.text] = name
+		}
+	}
+
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if f, err := zw.CreateHeader(&zip.FileHeader{Name: manifestName, Method: zip.Deflate, Modified: time.Now()}); err == nil {
+		f.Write(data)
+	}
+	zw.Close()
+}
+
+// serveClipZip streams a ZIP of the clips for reqs, generating those that
+// are not cached yet. Each clip is labelled by name, which its member is
+// named after; the manifest is keyed by those labels instead of texts.
+func serveClipZip(w http.ResponseWriter, r *http.Request, filename string, reqs []ttsRequest, name func(ttsRequest) string) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	zw := zip.NewWriter(w)
+	manifest := zipManifest{Files: map[string]string{}, Missing: []tarMissing{}}
+	for _, req := range reqs {
+		label := name(req)
+		member := sanitizeFilename(label) + req.audioFormat().ext
+		if err := ensureCached(r.Context(), req); err != nil {
+			manifest.Missing = append(manifest.Missing, tarMissing{label, err.Error()})
+			continue
+		}
+		if err := writeZipFile(r.Context(), zw, member, req.key); err != nil {
+			// The archive is corrupt past this point; abort the stream.
+			logger(r.Context()).Error("Failed to write zip entry", "key", logPath(req.key), "error", logRedacted(err.Error(), req.text))
+			return
+		}
+		manifest.Files[label] = member
+	}
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if f, err := zw.CreateHeader(&zip.FileHeader{Name: manifestName, Method: zip.Deflate, Modified: time.Now()}); err == nil {
+		f.Write(data)
+	}
+	zw.Close()
+}
+
+// writeZipFile stores the clip under key as name. Audio is already
+// compressed, so it isn't deflated again.
+func writeZipFile(ctx context.Context, zw *zip.Writer, name, key string) error {
+	defer beginServing(key)()
+	data, info, err := cacheStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}